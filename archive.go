@@ -0,0 +1,185 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sources of archived files, see ArchivedFile
+const (
+	archiveSourceDir   = "dir"   // a file of `dir` applied with WithArchive
+	archiveSourceStdin = "stdin" // sql applied by ExecVersion
+)
+
+// An ArchivedFile is the sql of an applied version kept in `dbmigrate_archive`, see WithArchive and ExecVersion
+type ArchivedFile struct {
+	Version    string    `json:"version"`
+	Filename   string    `json:"filename"`
+	Source     string    `json:"source"`  // `dir`, or `stdin` for ExecVersion
+	Content    []byte    `json:"content"` // as the file was on disk, so its checksum matches history
+	ArchivedAt time.Time `json:"archived_at"`
+	ArchivedBy string    `json:"archived_by"`
+}
+
+// ExecVersion applies `upSQL` as the migration of `version`, e.g. a one-off fix generated by other
+// tooling, without a file in `dir`. The version is recorded like files applied by Up, and `upSQL`
+// is archived in `dbmigrate_archive` in the same transaction, so the database keeps what was applied.
+//
+// `version` may be followed by `_name` like a migration file; the name defaults to `adhoc`. Fails if
+// `version` is already applied, or is the version of a file in `dir`
+func (c *Config) ExecVersion(ctx context.Context, opts MigrateOptions, version string, upSQL []byte) error {
+	if c.adapter.CreateArchiveTable == nil {
+		return errors.Errorf("database does not support archiving migrations")
+	}
+	if !strings.Contains(version, "_") {
+		version += "_adhoc"
+	}
+	currName, currVer := version+".up.sql", c.versionOf(version)
+	if err := checkVersion(currVer, c.versionPattern); err != nil {
+		return err
+	}
+	for _, name := range c.migrationFiles {
+		if c.versionOf(name) == currVer {
+			return errors.Errorf("version %s is the version of %s in dir", currVer, name)
+		}
+	}
+
+	migratedVersions, lock, err := c.prepareRun(ctx, opts, directionUp)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	if _, found := migratedVersions.Find(currVer); found {
+		return errors.Errorf("version %s is already applied", currVer)
+	}
+
+	if c.virtualFiles == nil {
+		c.virtualFiles = map[string][]byte{}
+	}
+	c.virtualFiles[currName] = upSQL
+	defer delete(c.virtualFiles, currName)
+	r := newRun(directionUp, opts, lock)
+	r.archive = archiveSourceStdin
+	return c.runFiles(ctx, r, []string{currName})
+}
+
+// createArchiveTable creates `dbmigrate_archive` if needed, before transactions that archive files
+func (c *Config) createArchiveTable(ctx context.Context, schema *string) error {
+	if c.adapter.CreateArchiveTable == nil {
+		return errors.Errorf("database does not support archiving migrations")
+	}
+	_, err := c.db.ExecContext(ctx, c.adapter.CreateArchiveTable(schema))
+	return errors.Wrapf(err, "unable to create archive table")
+}
+
+// archiveFile inserts the compressed content of `currName` into `dbmigrate_archive` when migrating up,
+// or deletes it when migrating down, inside `tx`
+func (c *Config) archiveFile(ctx context.Context, tx ExecCommitRollbacker, r run, currName string) error {
+	currVer := c.versionOf(currName)
+	if r.direction == directionDown {
+		if _, err := tx.ExecContext(ctx, c.adapter.DeleteArchive(r.schema), currVer); err != nil {
+			return errors.Wrapf(err, "unable to remove archive of version %q", currVer)
+		}
+		return nil
+	}
+	filecontent, err := c.readFile(currName)
+	if err != nil {
+		return err
+	}
+	content, err := compressArchive(filecontent)
+	if err != nil {
+		return errors.Wrapf(err, "unable to compress %s", currName)
+	}
+	archivedBy := c.appliedBy
+	if archivedBy == "" {
+		archivedBy = processName()
+	}
+	if _, err := tx.ExecContext(ctx, c.adapter.InsertArchive(r.schema), currVer, currName, r.archive, content, time.Now().UTC(), archivedBy); err != nil {
+		return errors.Wrapf(err, "unable to archive version %q", currVer)
+	}
+	return nil
+}
+
+// compressArchive returns `content` gzipped and base64 encoded, to fit a text column of any database
+func compressArchive(content []byte) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(content); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decompressArchive returns the content given to compressArchive
+func decompressArchive(s string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Archived returns the files kept in `dbmigrate_archive`, ordered by version, e.g. to compare
+// what was applied to an environment with `dir`, or with another environment
+func (c *Config) Archived(ctx context.Context, schema *string) ([]ArchivedFile, error) {
+	if err := c.createArchiveTable(ctx, schema); err != nil {
+		return nil, err
+	}
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectArchive(schema))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query archive")
+	}
+	defer rows.Close()
+	var result []ArchivedFile
+	for rows.Next() {
+		var f ArchivedFile
+		var content string
+		if err := rows.Scan(&f.Version, &f.Filename, &f.Source, &content, &f.ArchivedAt, &f.ArchivedBy); err != nil {
+			return nil, err
+		}
+		if f.Content, err = decompressArchive(content); err != nil {
+			return nil, errors.Wrapf(err, "unable to decompress archive of version %q", f.Version)
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
+// archivedVersions returns versions applied by ExecVersion; none if the adapter does not support it
+func (c *Config) archivedVersions(ctx context.Context, schema *string) (map[string]bool, error) {
+	result := map[string]bool{}
+	if c.adapter.CreateArchiveTable == nil {
+		return result, nil
+	}
+	if err := c.createArchiveTable(ctx, schema); err != nil {
+		return nil, err
+	}
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectArchivedVersions(schema), archiveSourceStdin)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query archived versions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		result[version] = true
+	}
+	return result, rows.Err()
+}
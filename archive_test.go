@@ -0,0 +1,133 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecVersion(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	archiving := Adapter{
+		CreateArchiveTable:     func(_ *string) string { return `CREATE TABLE IF NOT EXISTS dbmigrate_archive` },
+		InsertArchive:          func(_ *string) string { return `INSERT INTO dbmigrate_archive` },
+		SelectArchivedVersions: func(_ *string) string { return `SELECT version FROM dbmigrate_archive` },
+	}
+	testCases := []struct {
+		name            string
+		adapter         Adapter
+		applied         []string
+		version         string
+		expectedQueries []string
+		expectedVersion string
+		expectedError   string
+	}{
+		{
+			name:            fileline(),
+			adapter:         archiving,
+			version:         "20240501000000",
+			expectedQueries: []string{"UPDATE totals SET amount = 0;", `INSERT INTO dbmigrate_archive`},
+			expectedVersion: "20240501000000",
+		},
+		{
+			name:            fileline(),
+			adapter:         archiving,
+			version:         "20240501000000_fix-totals",
+			expectedQueries: []string{"UPDATE totals SET amount = 0;", `INSERT INTO dbmigrate_archive`},
+			expectedVersion: "20240501000000",
+		},
+		{
+			name:          fileline(),
+			adapter:       archiving,
+			applied:       []string{"20240501000000"},
+			version:       "20240501000000",
+			expectedError: "version 20240501000000 is already applied",
+		},
+		{
+			name:          fileline(),
+			adapter:       archiving,
+			version:       "20181222073750",
+			expectedError: "version 20181222073750 is the version of 20181222073750_a.up.sql in dir",
+		},
+		{
+			name:          fileline(),
+			adapter:       archiving,
+			version:       "20240501",
+			expectedError: `version "20240501" is not a 14-digit timestamp`,
+		},
+		{
+			name:          fileline(),
+			version:       "20240501000000",
+			expectedError: "database does not support archiving migrations",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tx := &recordingTx{noTx: noTx{db: db}}
+			tc.adapter.BeginTx = func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil }
+			store := &fakeStore{versions: tc.applied}
+			c := &Config{dir: fstest.MapFS{}, db: db, adapter: tc.adapter, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{"20181222073750_a.up.sql"}
+
+			err := c.ExecVersion(context.Background(), MigrateOptions{Mode: DbTxnModePerFile}, tc.version, []byte("UPDATE totals SET amount = 0;"))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Empty(t, store.entries)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedQueries, tx.queries)
+			if assert.Len(t, store.entries, 1) {
+				assert.Equal(t, tc.expectedVersion, store.entries[0].Version)
+			}
+			assert.Empty(t, c.virtualFiles, "stdin is not a file of later calls")
+		})
+	}
+}
+
+func TestWithArchive(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE a (id int);")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE a;")},
+	}
+	tx := &recordingTx{noTx: noTx{db: db}}
+	adapter := Adapter{
+		CreateArchiveTable: func(_ *string) string { return `CREATE TABLE IF NOT EXISTS dbmigrate_archive` },
+		InsertArchive:      func(_ *string) string { return `INSERT INTO dbmigrate_archive` },
+		DeleteArchive:      func(_ *string) string { return `DELETE FROM dbmigrate_archive` },
+		BeginTx:            func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil },
+	}
+	store := &fakeStore{}
+	c := &Config{dir: dir, db: db, adapter: adapter, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.down.sql", "20181222073750_a.up.sql"}
+	WithArchive()(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModePerFile}))
+	store.versions = []string{"20181222073750"}
+	assert.NoError(t, c.Down(context.Background(), MigrateOptions{Mode: DbTxnModePerFile, Steps: 1}))
+	assert.Equal(t, []string{
+		"CREATE TABLE a (id int);", `INSERT INTO dbmigrate_archive`,
+		"DROP TABLE a;", `DELETE FROM dbmigrate_archive`,
+	}, tx.queries)
+}
+
+func TestCompressArchive(t *testing.T) {
+	for _, content := range []string{"", "CREATE TABLE a (id int);\n", strings.Repeat("INSERT INTO a VALUES (1);\n", 1000)} {
+		compressed, err := compressArchive([]byte(content))
+		assert.NoError(t, err)
+		actual, err := decompressArchive(compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(actual))
+	}
+	_, err := decompressArchive("not base64!")
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package dbmigrate
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"time"
+)
+
+// DefaultAutoMigrateTimeout limits AutoMigrate when `ctx` has no deadline
+const DefaultAutoMigrateTimeout = 5 * time.Minute
+
+// AutoMigrate applies pending migrations of `dir` when an application starts, logging with log.Println
+// unless `options` has WithLogger. It waits for the database server to be ready, then returns early
+// if there is nothing pending. Otherwise, the process holding the migration lock applies pending
+// files, while other replicas wait for the lock and proceed once the database is current
+func AutoMigrate(ctx context.Context, dir fs.FS, driverName string, databaseURL string, options ...Option) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultAutoMigrateTimeout)
+		defer cancel()
+	}
+	driverName, databaseURL, err := SanitizeDriverNameURL(driverName, databaseURL)
+	if err != nil {
+		return err
+	}
+	adapter, err := AdapterFor(driverName)
+	if err != nil {
+		return err
+	}
+	if adapter.PingQuery != "" {
+		if err := ReadyWaitWithOptions(ctx, driverName, []string{databaseURL}, ReadyOptions{MaxInterval: 10 * time.Second, Jitter: 0.2}); err != nil {
+			return err
+		}
+	}
+
+	c, err := New(dir, driverName, databaseURL, append([]Option{WithLogger(log.Println)}, options...)...)
+	if err != nil {
+		return err
+	}
+	defer c.CloseDB()
+
+	pending, err := c.PendingVersions(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		c.logger("[auto-migrate] database is current")
+		return nil
+	}
+	c.logger("[auto-migrate]", len(pending), "pending version(s); applying, or waiting for another process applying them")
+	return c.Up(ctx, MigrateOptions{AfterFile: func(filename string) { c.logger("[up]", filename) }})
+}
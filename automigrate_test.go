@@ -0,0 +1,51 @@
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMigrate(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073900_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	testCases := []struct {
+		name         string
+		applied      []string
+		expectedLogs []string
+	}{
+		{
+			name:    fileline(),
+			applied: []string{"20181222073750"},
+			expectedLogs: []string{
+				"[auto-migrate] 1 pending version(s); applying, or waiting for another process applying them",
+				"[up] 20181222073900_b.up.sql",
+			},
+		},
+		{
+			name:         fileline(),
+			applied:      []string{"20181222073750", "20181222073900"},
+			expectedLogs: []string{"[auto-migrate] database is current"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs []string
+			logger := func(args ...interface{}) {
+				if line := strings.TrimSpace(fmt.Sprintln(args...)); strings.HasPrefix(line, "[auto-migrate]") || strings.HasPrefix(line, "[up]") {
+					logs = append(logs, line)
+				}
+			}
+			err := AutoMigrate(context.Background(), dir, "dbmigrate-fake", "1",
+				WithLogger(logger), WithVersionStore(&fakeStore{versions: tc.applied}))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLogs, logs)
+		})
+	}
+}
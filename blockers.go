@@ -0,0 +1,132 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Blocker is another session with a transaction open for long, e.g. idle in transaction,
+// holding a lock on a table that a pending statement alters. DDL queued behind it blocks
+// every later query of the table too
+type Blocker struct {
+	ID    string        `json:"id"`    // e.g. pid on postgres, thread id on mysql
+	State string        `json:"state"` // e.g. `idle in transaction`
+	Age   time.Duration `json:"age"`   // since the transaction began
+	Query string        `json:"query"` // last statement of the session
+}
+
+// BlockerPolicy decides what Up and Down do when WithBlockerCheck finds blockers
+type BlockerPolicy int
+
+const (
+	// BlockersWait polls every second until no blocker is left, or until the context is done
+	BlockersWait BlockerPolicy = iota
+	// BlockersFail returns an error before applying any file
+	BlockersFail
+	// BlockersTerminate terminates the blocking sessions, rolling back their transactions
+	BlockersTerminate
+)
+
+// heavyDDL matches normalized statements that queue behind open transactions on the table,
+// for databases without Adapter.LockLevel, e.g. mysql metadata locks
+var heavyDDL = regexp.MustCompile(`^(ALTER TABLE|DROP TABLE|TRUNCATE|RENAME TABLE|CREATE (UNIQUE )?INDEX|DROP INDEX|LOCK)`)
+
+// heavyTables returns the tables, sorted, that statements of `filenames` take a blocking lock on
+func (c *Config) heavyTables(filenames []string) ([]string, error) {
+	seen := map[string]bool{}
+	var result []string
+	for _, currName := range filenames {
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range splitStatements(string(filecontent)) {
+			if isBlankStatement(stmt) {
+				continue
+			}
+			normalized := normalizeStatement(stmt)
+			heavy := heavyDDL.MatchString(normalized)
+			if c.adapter.LockLevel != nil {
+				heavy = lockBlocks(c.adapter.LockLevel(normalized)) != ""
+			}
+			table := strings.ToLower(statementTable(normalized))
+			if heavy && table != "" && !seen[table] {
+				seen[table] = true
+				result = append(result, table)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Blockers returns other sessions with a transaction open for over `olderThan` that hold a
+// lock on any of `tables`
+func (c *Config) Blockers(ctx context.Context, tables []string, olderThan time.Duration) ([]Blocker, error) {
+	if c.adapter.SelectBlockers == nil {
+		return nil, errors.Errorf("database does not support checking blocking sessions")
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectBlockers(tables), olderThan.Seconds())
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query blocking sessions")
+	}
+	defer rows.Close()
+	var result []Blocker
+	for rows.Next() {
+		var b Blocker
+		var seconds float64
+		if err := rows.Scan(&b.ID, &b.State, &seconds, &b.Query); err != nil {
+			return nil, err
+		}
+		b.Age = time.Duration(seconds * float64(time.Second))
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// checkBlockers applies the BlockerPolicy of WithBlockerCheck to blockers of the tables that
+// `filenames` lock, before any of them is applied, so DDL does not queue behind them
+func (c *Config) checkBlockers(ctx context.Context, filenames []string) error {
+	if c.blockerAge <= 0 || len(filenames) == 0 {
+		return nil
+	}
+	tables, err := c.heavyTables(filenames)
+	if err != nil || len(tables) == 0 {
+		return err
+	}
+	for {
+		blockers, err := c.Blockers(ctx, tables, c.blockerAge)
+		if err != nil || len(blockers) == 0 {
+			return err
+		}
+		for _, b := range blockers {
+			c.logger("[blocker]", b.ID, "("+b.State+")", "in transaction for", b.Age.Round(time.Second).String()+":", b.Query)
+		}
+		switch c.blockerPolicy {
+		case BlockersFail:
+			return errors.Errorf("%d session(s) in transaction for over %s hold locks on %s, e.g. %s; end them, or retry later", len(blockers), c.blockerAge, strings.Join(tables, ", "), blockers[0].ID)
+		case BlockersTerminate:
+			for _, b := range blockers {
+				if _, err := c.db.ExecContext(ctx, c.adapter.TerminateSessionQuery, b.ID); err != nil {
+					return errors.Wrapf(err, "unable to terminate session %s", b.ID)
+				}
+				c.logger("[blocker] terminated", b.ID)
+			}
+		default:
+			select {
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "%d session(s) in transaction for over %s hold locks on %s", len(blockers), c.blockerAge, strings.Join(tables, ", "))
+			case <-time.After(time.Second):
+				c.logger("waiting for", len(blockers), "blocking session(s) to end...")
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeavyTables(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("ALTER TABLE users ADD COLUMN age int;\nUPDATE orders SET total = 0;")},
+		"20181222073751_b.up.sql": &fstest.MapFile{Data: []byte("CREATE INDEX CONCURRENTLY idx ON items (name);\nDROP TABLE public.carts;\nALTER TABLE users DROP COLUMN age;")},
+	}
+	filenames := []string{"20181222073750_a.up.sql", "20181222073751_b.up.sql"}
+	testCases := []struct {
+		name      string
+		lockLevel func(string) string
+		expected  []string
+	}{
+		{
+			name:     fileline(),
+			expected: []string{"carts", "items", "users"},
+		},
+		{
+			name:      fileline(),
+			lockLevel: pgLockLevel,
+			expected:  []string{"carts", "users"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{dir: dir}
+			c.adapter.LockLevel = tc.lockLevel
+			tables, err := c.heavyTables(filenames)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, tables)
+		})
+	}
+}
+
+func TestWithBlockerCheck(t *testing.T) {
+	idle := Blocker{ID: "4242", State: "idle in transaction", Age: 17 * time.Minute, Query: "SELECT * FROM users"}
+	filenames := []string{"20181222073750_a.up.sql"}
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("ALTER TABLE users ADD COLUMN age int;")},
+	}
+	testCases := []struct {
+		name               string
+		policy             BlockerPolicy
+		rounds             [][]Blocker
+		expectedErr        string
+		expectedTerminated []string // statements
+	}{
+		{
+			name:   fileline(),
+			policy: BlockersFail,
+		},
+		{
+			name:        fileline(),
+			policy:      BlockersFail,
+			rounds:      [][]Blocker{{idle}},
+			expectedErr: "1 session(s) in transaction for over 1m0s hold locks on users, e.g. 4242; end them, or retry later",
+		},
+		{
+			name:               fileline(),
+			policy:             BlockersTerminate,
+			rounds:             [][]Blocker{{idle}, nil},
+			expectedTerminated: []string{"KILL ? [4242]"},
+		},
+		{
+			name:   fileline(),
+			policy: BlockersWait,
+			rounds: [][]Blocker{{idle}, nil},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rounds := tc.rounds
+			db, fake := openFakeDB(t, func(_ int, query string, _ []driver.Value) (*fakeRows, error) {
+				if query != "SELECT blockers" || len(rounds) == 0 {
+					return nil, nil
+				}
+				rows := &fakeRows{columns: []string{"id", "state", "age", "query"}}
+				for _, b := range rounds[0] {
+					rows.values = append(rows.values, []driver.Value{b.ID, b.State, b.Age.Seconds(), b.Query})
+				}
+				rounds = rounds[1:]
+				return rows, nil
+			})
+			c := &Config{dir: dir, db: db, logger: func(...interface{}) {}}
+			c.adapter.SelectBlockers = func(tables []string) string { return "SELECT blockers" }
+			c.adapter.TerminateSessionQuery = "KILL ?"
+			WithBlockerCheck(time.Minute, tc.policy)(c)
+
+			err := c.checkBlockers(context.Background(), filenames)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			var terminated []string
+			for _, statement := range fake.executed() {
+				if strings.HasPrefix(statement, "KILL ") {
+					terminated = append(terminated, statement)
+				}
+			}
+			assert.Equal(t, tc.expectedTerminated, terminated)
+			assert.Empty(t, rounds)
+		})
+	}
+
+	c := &Config{dir: dir, logger: func(...interface{}) {}}
+	WithBlockerCheck(time.Minute, BlockersFail)(c)
+	assert.EqualError(t, c.checkBlockers(context.Background(), filenames), "database does not support checking blocking sessions")
+}
@@ -0,0 +1,174 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Provisioner creates and deletes branches of a database: copies of its schema and data, e.g. of
+// serverless postgres, to try pending migrations on before they are merged; see PreviewBranch
+type Provisioner interface {
+	CreateBranch(ctx context.Context, name string) (databaseURL string, err error)
+	DeleteBranch(ctx context.Context, name string) error // nil if there is no such branch
+}
+
+// A BranchPreview reports migrating a branch with PreviewBranch
+type BranchPreview struct {
+	Branch   string        `json:"branch"`
+	Pending  []string      `json:"pending"` // versions pending on the branch before migrating
+	Applied  []FileResult  `json:"applied"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"` // the migration that failed; the branch is kept
+}
+
+// PreviewBranch replaces branch `name` of `p` with a new copy of its parent, then applies pending migrations
+// of `dir` to it, e.g. for a preview deployment of a pull request. The branch is kept until DeleteBranch.
+// A failing migration is reported in BranchPreview.Error, not returned, so the report can be published
+func PreviewBranch(ctx context.Context, p Provisioner, name string, dir fs.FS, driverName string, opts MigrateOptions, options ...Option) (BranchPreview, error) {
+	preview := BranchPreview{Branch: name, Pending: []string{}, Applied: []FileResult{}}
+	if err := p.DeleteBranch(ctx, name); err != nil {
+		return preview, errors.Wrapf(err, "unable to delete branch %q", name)
+	}
+	databaseURL, err := p.CreateBranch(ctx, name)
+	if err != nil {
+		return preview, errors.Wrapf(err, "unable to create branch %q", name)
+	}
+	m, err := New(dir, driverName, databaseURL, options...)
+	if err != nil {
+		return preview, err
+	}
+	defer m.CloseDB()
+	handler := m.resultHandler
+	m.resultHandler = func(r FileResult) {
+		preview.Applied = append(preview.Applied, r)
+		handler(r)
+	}
+
+	started := time.Now()
+	if preview.Pending, err = m.PendingVersions(ctx, opts.Schema); err != nil {
+		return preview, errors.Wrapf(err, "branch %q", name)
+	}
+	if err := m.Up(ctx, opts); err != nil {
+		preview.Error = err.Error()
+	}
+	preview.Duration = time.Since(started)
+	return preview, nil
+}
+
+// NeonProvisioner creates branches of a Neon project with its API, each with a read-write compute endpoint
+type NeonProvisioner struct {
+	APIKey    string       // sent as bearer token
+	ProjectID string       // e.g. dry-sun-123456
+	Parent    string       // id of the branch to copy; default the project's default branch
+	Database  string       // database of the connection url; default the only one of the branch
+	Role      string       // role of the connection url; default the only one of the branch
+	BaseURL   string       // default https://console.neon.tech/api/v2
+	Client    *http.Client // default http.DefaultClient
+}
+
+// CreateBranch implements Provisioner
+func (p NeonProvisioner) CreateBranch(ctx context.Context, name string) (string, error) {
+	branch := map[string]interface{}{"name": name}
+	if p.Parent != "" {
+		branch["parent_id"] = p.Parent
+	}
+	request := map[string]interface{}{
+		"branch":    branch,
+		"endpoints": []map[string]interface{}{{"type": "read_write"}},
+	}
+	var created struct {
+		Branch struct {
+			ID string `json:"id"`
+		} `json:"branch"`
+		ConnectionURIs []struct {
+			ConnectionURI string `json:"connection_uri"`
+		} `json:"connection_uris"`
+	}
+	if err := p.call(ctx, http.MethodPost, "/projects/"+url.PathEscape(p.ProjectID)+"/branches", request, &created); err != nil {
+		return "", err
+	}
+	if p.Database == "" && p.Role == "" && len(created.ConnectionURIs) > 0 {
+		return created.ConnectionURIs[0].ConnectionURI, nil
+	}
+
+	query := url.Values{"branch_id": {created.Branch.ID}, "database_name": {p.Database}, "role_name": {p.Role}}
+	var connection struct {
+		URI string `json:"uri"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/projects/"+url.PathEscape(p.ProjectID)+"/connection_uri?"+query.Encode(), nil, &connection); err != nil {
+		return "", err
+	}
+	return connection.URI, nil
+}
+
+// DeleteBranch implements Provisioner
+func (p NeonProvisioner) DeleteBranch(ctx context.Context, name string) error {
+	var list struct {
+		Branches []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"branches"`
+	}
+	path := "/projects/" + url.PathEscape(p.ProjectID) + "/branches"
+	if err := p.call(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return err
+	}
+	for _, branch := range list.Branches {
+		if branch.Name == name {
+			return p.call(ctx, http.MethodDelete, path+"/"+url.PathEscape(branch.ID), nil, nil)
+		}
+	}
+	return nil
+}
+
+// call sends `request` as json to `path` of the neon api, and decodes the response into `response` if not nil
+func (p NeonProvisioner) call(ctx context.Context, method string, path string, request interface{}, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = "https://console.neon.tech/api/v2"
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return errors.Wrapf(err, "neon %s %s", method, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return errors.Errorf("neon %s %s: %d %s", method, path, resp.StatusCode, failure.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(response), "neon %s %s", method, path)
+}
@@ -0,0 +1,113 @@
+package dbmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeonProvisioner(t *testing.T) {
+	var requests []string
+	branches := `{"branches":[{"id":"br-main-1","name":"main"},{"id":"br-pr-42","name":"pr-42"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer neon-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"","message":"authentication required"}`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI()+" "+fmtJSON(body))
+		switch r.Method + " " + r.URL.Path {
+		case "POST /projects/dry-sun-1/branches":
+			w.Write([]byte(`{"branch":{"id":"br-pr-43"},"connection_uris":[{"connection_uri":"postgresql://app:pw@ep-1.neon.tech/app"}]}`))
+		case "GET /projects/dry-sun-1/branches":
+			w.Write([]byte(branches))
+		case "GET /projects/dry-sun-1/connection_uri":
+			w.Write([]byte(`{"uri":"postgresql://owner:pw@ep-1.neon.tech/shop"}`))
+		case "DELETE /projects/dry-sun-1/branches/br-pr-42":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"","message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := NeonProvisioner{APIKey: "neon-key", ProjectID: "dry-sun-1", BaseURL: server.URL + "/"}
+	databaseURL, err := provider.CreateBranch(context.Background(), "pr-43")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgresql://app:pw@ep-1.neon.tech/app", databaseURL)
+
+	provider.Parent, provider.Database, provider.Role = "br-main-1", "shop", "owner"
+	databaseURL, err = provider.CreateBranch(context.Background(), "pr-43")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgresql://owner:pw@ep-1.neon.tech/shop", databaseURL)
+
+	assert.NoError(t, provider.DeleteBranch(context.Background(), "pr-42"))
+	assert.NoError(t, provider.DeleteBranch(context.Background(), "pr-44"), "no such branch")
+	assert.Equal(t, []string{
+		`POST /projects/dry-sun-1/branches {"branch":{"name":"pr-43"},"endpoints":[{"type":"read_write"}]}`,
+		`POST /projects/dry-sun-1/branches {"branch":{"name":"pr-43","parent_id":"br-main-1"},"endpoints":[{"type":"read_write"}]}`,
+		`GET /projects/dry-sun-1/connection_uri?branch_id=br-pr-43&database_name=shop&role_name=owner null`,
+		`GET /projects/dry-sun-1/branches null`,
+		`DELETE /projects/dry-sun-1/branches/br-pr-42 null`,
+		`GET /projects/dry-sun-1/branches null`,
+	}, requests)
+
+	_, err = NeonProvisioner{APIKey: "bogus", ProjectID: "dry-sun-1", BaseURL: server.URL}.CreateBranch(context.Background(), "pr-43")
+	assert.EqualError(t, err, "neon POST /projects/dry-sun-1/branches: 401 authentication required")
+}
+
+// fakeProvisioner creates branches at databaseURL, recording calls
+type fakeProvisioner struct {
+	databaseURL string
+	calls       []string
+}
+
+func (p *fakeProvisioner) CreateBranch(_ context.Context, name string) (string, error) {
+	p.calls = append(p.calls, "create "+name)
+	if p.databaseURL == "" {
+		return "", errors.Errorf("quota exceeded")
+	}
+	return p.databaseURL, nil
+}
+
+func (p *fakeProvisioner) DeleteBranch(_ context.Context, name string) error {
+	p.calls = append(p.calls, "delete "+name)
+	return nil
+}
+
+func TestPreviewBranch(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073900_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	store := &fakeStore{versions: []string{"20181222073750"}}
+	var handled []string
+	provisioner := &fakeProvisioner{databaseURL: "1"}
+	preview, err := PreviewBranch(context.Background(), provisioner, "pr-42", dir, "dbmigrate-fake", MigrateOptions{},
+		WithVersionStore(store), WithResultHandler(func(r FileResult) { handled = append(handled, r.Filename) }))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"delete pr-42", "create pr-42"}, provisioner.calls)
+	assert.Equal(t, "pr-42", preview.Branch)
+	assert.Equal(t, []string{"20181222073900"}, preview.Pending)
+	assert.Len(t, preview.Applied, 1)
+	assert.Equal(t, "20181222073900_b.up.sql", preview.Applied[0].Filename)
+	assert.Equal(t, []string{"20181222073900_b.up.sql"}, handled, "result handler of options still called")
+	assert.Equal(t, "", preview.Error)
+
+	_, err = PreviewBranch(context.Background(), &fakeProvisioner{}, "pr-42", dir, "dbmigrate-fake", MigrateOptions{})
+	assert.EqualError(t, err, `unable to create branch "pr-42": quota exceeded`)
+}
+
+func fmtJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,110 @@
+package dbmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// directionChunk is recorded in history for each chunk committed by the `chunk` directive; the version is still pending
+const directionChunk = "chunk"
+
+// chunking is the progress of a file with `-- dbmigrate:chunk <size>` directive
+type chunking struct {
+	size     int    // statements per transaction
+	done     int    // statements committed by earlier, failed, attempts
+	checksum string // of the statements done, see chunkChecksum
+}
+
+// parseChunking returns the chunk size of `value` of `chunk` directive, and how many statements of `currName`
+// were committed in chunks since it was last applied or un-applied, according to history
+func (c *Config) parseChunking(ctx context.Context, r run, currName string, value string) (chunking, error) {
+	size, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || size <= 0 {
+		return chunking{}, errors.Errorf("`chunk` directive requires a positive number of statements, got %q", value)
+	}
+	if r.direction != directionUp {
+		return chunking{}, errors.Errorf("`chunk` directive is only supported in `.up.sql` files")
+	}
+	if r.mode != DbTxnModePerFile {
+		return chunking{}, errors.Errorf("`chunk` directive requires transaction mode %q, not %q", DbTxnModePerFile, r.mode)
+	}
+	entries, err := c.store.History(ctx, r.schema)
+	if err != nil {
+		return chunking{}, errors.Wrapf(err, "`chunk` directive requires history")
+	}
+	currVer, result := c.versionOf(currName), chunking{size: size}
+	for _, entry := range entries {
+		switch {
+		case entry.Version != currVer:
+		case entry.Direction != directionChunk:
+			result.done, result.checksum = 0, ""
+		default:
+			fmt.Sscanf(entry.Remark, "%d/", &result.done)
+			result.checksum = entry.Checksum
+		}
+	}
+	return result, nil
+}
+
+// chunkChecksum returns the checksum of `statements`, recorded with each chunk so the statements already
+// committed are known to be unchanged when resuming, while later statements may be fixed
+func chunkChecksum(statements []string) string {
+	checksum := sha256.Sum256([]byte(strings.Join(statements, ";")))
+	return hex.EncodeToString(checksum[:])
+}
+
+// execChunks executes the statements of `filecontent` after those already done, committing `tx` with a
+// `chunk` history entry every `size` statements, so a failed file resumes where it stopped instead of
+// starting over. Returns the transaction of the last chunk, to be committed with the version
+func (c *Config) execChunks(ctx context.Context, r run, tx ExecCommitRollbacker, txOpts *sql.TxOptions, currName string, k chunking, filecontent []byte, fileResult *FileResult) (ExecCommitRollbacker, error) {
+	var statements []string
+	for _, stmt := range c.statements(filecontent) {
+		if !isBlankStatement(stmt) {
+			statements = append(statements, strings.TrimSpace(stmt))
+		}
+	}
+	if k.done > 0 {
+		if k.done > len(statements) || chunkChecksum(statements[:k.done]) != k.checksum {
+			return tx, errors.Errorf("%s: the first %d statement(s), committed in chunks, have changed; restore them to resume", currName, k.done)
+		}
+		c.logger("[chunk] resuming", currName, "after", k.done, "of", len(statements), "statement(s)")
+	}
+	for i := k.done; i < len(statements); i++ {
+		if err := c.execStatement(ctx, tx, r.mode, i, statements[i], fileResult); err != nil {
+			return tx, errors.Wrapf(err, "%s: statement #%d", currName, i+1)
+		}
+		done := i + 1
+		if done%k.size != 0 || done == len(statements) {
+			continue
+		}
+		if err := c.store.Record(ctx, tx, r.schema, HistoryEntry{
+			Version:   c.versionOf(currName),
+			Direction: directionChunk,
+			AppliedAt: time.Now().UTC(),
+			Checksum:  chunkChecksum(statements[:done]),
+			AppliedBy: c.appliedBy,
+			Remark:    fmt.Sprintf("%d/%d statements", done, len(statements)),
+			RunID:     r.id,
+		}); err != nil {
+			return tx, err
+		}
+		if err := commit(tx); err != nil {
+			return tx, err
+		}
+		r.logChunk(currName, done, len(statements))
+		next, err := c.adapter.BeginTx(ctx, c.db, txOpts)
+		if err != nil {
+			return tx, errors.Wrapf(err, "unable to create transaction")
+		}
+		tx = next
+	}
+	return tx, nil
+}
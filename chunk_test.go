@@ -0,0 +1,134 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingTx is a recordingTx that fails to execute `fail`
+type failingTx struct {
+	recordingTx
+	fail string
+}
+
+func (tx *failingTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if query == tx.fail {
+		return nil, errors.Errorf("failed %s", query)
+	}
+	return tx.recordingTx.ExecContext(ctx, query, args...)
+}
+
+func TestChunkDirective(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	const filename = "20181222073750_seed.up.sql"
+	content := []byte("INSERT 1;\nINSERT 2;\nINSERT 3;\nINSERT 4;\nINSERT 5;\n-- dbmigrate:chunk 2\n")
+	first2, first4 := chunkChecksum([]string{"INSERT 1;", "INSERT 2;"}), chunkChecksum([]string{"INSERT 1;", "INSERT 2;", "INSERT 3;", "INSERT 4;"})
+	testCases := []struct {
+		name            string
+		mode            DbTxnMode
+		content         []byte
+		history         []HistoryEntry
+		fail            string
+		expectedQueries []string
+		expectedChunks  []string
+		expectedHistory []string
+		expectedError   string
+	}{
+		{
+			name:            fileline(),
+			mode:            DbTxnModePerFile,
+			content:         content,
+			expectedQueries: []string{"INSERT 1;", "INSERT 2;", "INSERT 3;", "INSERT 4;", "INSERT 5;"},
+			expectedChunks:  []string{"2/5", "4/5"},
+			expectedHistory: []string{"chunk 2/5 statements", "chunk 4/5 statements", "up "},
+		},
+		{
+			name:            fileline(),
+			mode:            DbTxnModePerFile,
+			content:         content,
+			fail:            "INSERT 4;",
+			expectedQueries: []string{"INSERT 1;", "INSERT 2;", "INSERT 3;"},
+			expectedChunks:  []string{"2/5"},
+			expectedHistory: []string{"chunk 2/5 statements"},
+			expectedError:   "20181222073750_seed.up.sql: statement #4: failed INSERT 4;",
+		},
+		{
+			name:    fileline(),
+			mode:    DbTxnModePerFile,
+			content: content,
+			history: []HistoryEntry{
+				{Version: "20181222073750", Direction: directionChunk, Checksum: first4, Remark: "4/5 statements"},
+				{Version: "20181222073750", Direction: directionDown},
+				{Version: "20181222073750", Direction: directionChunk, Checksum: first2, Remark: "2/5 statements"},
+			},
+			expectedQueries: []string{"INSERT 3;", "INSERT 4;", "INSERT 5;"},
+			expectedChunks:  []string{"4/5"},
+			expectedHistory: []string{"chunk 4/5 statements", "down ", "chunk 2/5 statements", "chunk 4/5 statements", "up "},
+		},
+		{
+			name:            fileline(),
+			mode:            DbTxnModePerFile,
+			content:         []byte("INSERT 1;\nINSERT 2;\nINSERT 3;\nINSERT 4 fixed;\n-- dbmigrate:chunk 2\n"),
+			history:         []HistoryEntry{{Version: "20181222073750", Direction: directionChunk, Checksum: first2, Remark: "2/4 statements"}},
+			expectedQueries: []string{"INSERT 3;", "INSERT 4 fixed;"},
+			expectedHistory: []string{"chunk 2/4 statements", "up "},
+		},
+		{
+			name:            fileline(),
+			mode:            DbTxnModePerFile,
+			content:         []byte("INSERT 1 changed;\nINSERT 2;\nINSERT 3;\n-- dbmigrate:chunk 2\n"),
+			history:         []HistoryEntry{{Version: "20181222073750", Direction: directionChunk, Checksum: first2, Remark: "2/3 statements"}},
+			expectedHistory: []string{"chunk 2/3 statements"},
+			expectedError:   "20181222073750_seed.up.sql: the first 2 statement(s), committed in chunks, have changed; restore them to resume",
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModeAll,
+			content:       content,
+			expectedError: "20181222073750_seed.up.sql: `chunk` directive requires transaction mode \"per-file\", not \"all\"",
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModePerFile,
+			content:       []byte("-- dbmigrate:chunk many\nINSERT 1;\n"),
+			expectedError: "20181222073750_seed.up.sql: `chunk` directive requires a positive number of statements, got \"many\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := fstest.MapFS{filename: &fstest.MapFile{Data: tc.content}}
+			tx := &failingTx{recordingTx: recordingTx{noTx: noTx{db: db}}, fail: tc.fail}
+			adapter := Adapter{BeginTx: func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil }}
+			store := &fakeStore{entries: tc.history}
+			c := &Config{dir: dir, db: db, adapter: adapter, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{filename}
+
+			var chunks []string
+			err := c.Up(context.Background(), MigrateOptions{Mode: tc.mode, AfterChunk: func(name string, done int, total int) {
+				assert.Equal(t, filename, name)
+				chunks = append(chunks, fmt.Sprintf("%d/%d", done, total))
+			}})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedQueries, tx.queries)
+			assert.Equal(t, tc.expectedChunks, chunks)
+			var history []string
+			for _, entry := range store.entries {
+				history = append(history, entry.Direction+" "+entry.Remark)
+			}
+			assert.Equal(t, tc.expectedHistory, history)
+		})
+	}
+}
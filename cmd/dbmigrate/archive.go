@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// extractArchive writes the files archived in `m` by `-archive` into `dir`
+func extractArchive(ctx context.Context, m *dbmigrate.Config, schema *string, dir string) error {
+	files, err := m.Archived(ctx, schema)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := dbmigrate.DirWriter(dir).WriteFile(f.Filename, f.Content); err != nil {
+			return errors.Wrapf(err, "unable to write %s", f.Filename)
+		}
+	}
+	log.Println("[archive]", len(files), "file(s) written to", dir)
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// bootstrap prepares the database of `-url` before connecting to it: `-server-ready`, `-create-db`,
+// `-schema`, `-create-extension` and `-grant-role`
+type bootstrap struct {
+	serverReadyWait  time.Duration
+	readyOptions     dbmigrate.ReadyOptions
+	createDB         bool
+	schema           *string
+	createExtensions string
+	grantRoles       string
+}
+
+// run waits until the server is ready, then creates what is missing; failures to create are
+// left in `errctx` for subsequent actions, e.g. the database may already exist
+func (b bootstrap) run(driverName string, databaseURL string, errctx *error) error {
+	doServerReadyWait := b.serverReadyWait > 0
+	if !doServerReadyWait && !b.createDB && b.schema == nil {
+		return nil
+	}
+	adapter, err := dbmigrate.AdapterFor(driverName)
+	if err != nil {
+		return withErrctx(err, *errctx)
+	}
+
+	if doServerReadyWait {
+		if adapter.BaseDatabaseURL == nil {
+			return errors.Errorf("%q does not support -server-ready", driverName)
+		}
+		connString, _, err := adapter.BaseDatabaseURL(databaseURL)
+		if err != nil {
+			return withErrctx(err, *errctx)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.serverReadyWait)
+		defer cancel()
+		readyOptions := b.readyOptions
+		readyOptions.Logger = log.Println
+		readyOptions.OnRetry = func(event dbmigrate.ReadyEvent) {
+			log.Println(driverName, "[server-ready] attempt", event.Attempt, "failed; retrying in", event.Wait.Round(time.Millisecond).String()+":", event.Err)
+		}
+		if err := dbmigrate.ReadyWaitWithOptions(ctx, driverName, []string{databaseURL, connString}, readyOptions); err != nil {
+			return withErrctx(err, *errctx)
+		}
+	}
+
+	if b.createDB {
+		if adapter.BaseDatabaseURL == nil {
+			return errors.Errorf("%q does not support -create-db", driverName)
+		}
+		if adapter.CreateDatabaseQuery == nil {
+			return errors.Errorf("%q does not support -create-db", driverName)
+		}
+		connString, dbName, err := adapter.BaseDatabaseURL(databaseURL)
+		if err != nil {
+			return withErrctx(err, *errctx)
+		}
+		if err := dbmigrate.ValidateIdentifier(dbName); err != nil {
+			return errors.Wrapf(err, "-create-db")
+		}
+		db, err := sql.Open(driverName, connString)
+		if err != nil {
+			return errors.Wrapf(err, "connect to db")
+		}
+		// leave errors for subsequent actions
+		_, *errctx = db.Exec(adapter.CreateDatabaseQuery(dbName))
+		_ = db.Close()
+	}
+
+	if b.schema != nil && *b.schema != "" {
+		if adapter.CreateSchemaQuery == nil {
+			return errors.Errorf("%q does not support -schema", driverName)
+		}
+		if err := dbmigrate.ValidateIdentifier(*b.schema); err != nil {
+			return errors.Wrapf(err, "-schema")
+		}
+		db, err := sql.Open(driverName, databaseURL)
+		if err != nil {
+			return errors.Wrapf(err, "connect to db")
+		}
+		// leave errors for subsequent actions
+		_, *errctx = db.Exec(adapter.CreateSchemaQuery(*b.schema))
+		_ = db.Close()
+	}
+
+	if b.createExtensions != "" {
+		if adapter.CreateExtensionQuery == nil {
+			return errors.Errorf("%q does not support -create-extension", driverName)
+		}
+		if err := execEach(driverName, databaseURL, adapter.CreateExtensionQuery, b.createExtensions, errctx); err != nil {
+			return err
+		}
+	}
+
+	if b.grantRoles != "" {
+		if adapter.GrantRoleQuery == nil {
+			return errors.Errorf("%q does not support -grant-role", driverName)
+		}
+		if err := execEach(driverName, databaseURL, adapter.GrantRoleQuery, b.grantRoles, errctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execEach runs `query` for each comma separated name in `names`, leaving errors in `errctx` for subsequent actions
+func execEach(driverName string, databaseURL string, query func(string) string, names string, errctx *error) error {
+	db, err := sql.Open(driverName, databaseURL)
+	if err != nil {
+		return errors.Wrapf(err, "connect to db")
+	}
+	defer db.Close()
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, err := db.Exec(query(name)); err != nil {
+			log.Println(err)
+			*errctx = err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// neonProvisioner is configured by NEON_API_KEY and NEON_PROJECT_ID; optionally NEON_PARENT_BRANCH_ID,
+// NEON_DATABASE, NEON_ROLE and NEON_API_URL
+func neonProvisioner() (dbmigrate.NeonProvisioner, error) {
+	p := dbmigrate.NeonProvisioner{
+		APIKey:    os.Getenv("NEON_API_KEY"),
+		ProjectID: os.Getenv("NEON_PROJECT_ID"),
+		Parent:    os.Getenv("NEON_PARENT_BRANCH_ID"),
+		Database:  os.Getenv("NEON_DATABASE"),
+		Role:      os.Getenv("NEON_ROLE"),
+		BaseURL:   os.Getenv("NEON_API_URL"),
+	}
+	if p.APIKey == "" || p.ProjectID == "" {
+		return p, errors.Errorf("NEON_API_KEY and NEON_PROJECT_ID must be set")
+	}
+	return p, nil
+}
+
+// runBranch creates or deletes branch `args[1]` of `p`, or previews pending migrations of `dirname` on it;
+// create prints the database url of the branch, e.g. for a preview deployment of a pull request
+func runBranch(ctx context.Context, p dbmigrate.Provisioner, args []string, format string, dirname string, driverName string, opts dbmigrate.MigrateOptions, options []dbmigrate.Option) error {
+	if len(args) != 2 {
+		return errors.Errorf("usage: dbmigrate branch create|delete|preview <name>")
+	}
+	name := args[1]
+	switch args[0] {
+	case "create":
+		databaseURL, err := p.CreateBranch(ctx, name)
+		if err != nil {
+			return err
+		}
+		log.Println("[branch] created", name, dbmigrate.RedactDatabaseURL(databaseURL))
+		fmt.Println(databaseURL)
+		return nil
+	case "delete":
+		if err := p.DeleteBranch(ctx, name); err != nil {
+			return err
+		}
+		log.Println("[branch] deleted", name)
+		return nil
+	case "preview":
+		if driverName == "" {
+			driverName = "postgres"
+		}
+		preview, err := dbmigrate.PreviewBranch(ctx, p, name, os.DirFS(dirname), driverName, opts, options...)
+		if err != nil {
+			return err
+		}
+		if err := writeBranchPreview(os.Stdout, format, preview); err != nil {
+			return err
+		}
+		if preview.Error != "" {
+			return errors.Errorf("branch %q: %s", name, preview.Error)
+		}
+		return nil
+	default:
+		return errors.Errorf("usage: dbmigrate branch create|delete|preview <name>")
+	}
+}
+
+// writeBranchPreview writes `preview` to `w` as text or json; text lists the files applied to the branch
+// with rows affected and durations, then the error if a migration failed
+func writeBranchPreview(w io.Writer, format string, preview dbmigrate.BranchPreview) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(preview)
+	case "text":
+		fmt.Fprintf(w, "branch %s: %d pending, %d applied in %s\n", preview.Branch, len(preview.Pending), len(preview.Applied), preview.Duration.Round(time.Millisecond))
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, r := range preview.Applied {
+			fmt.Fprintf(writer, "%s\t%d rows\t%s\n", r.Filename, r.RowsAffected, r.Duration.Round(time.Millisecond))
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if preview.Error != "" {
+			fmt.Fprintf(w, "error: %s\n", preview.Error)
+		}
+		return nil
+	default:
+		return errors.Errorf("-format must be `text` or `json`, got %q", format)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// writeComparison writes `differences` between databases `names` to `w` as text or json; text shows
+// whether each database applied the version, with the checksum of its file if recorded
+func writeComparison(w io.Writer, format string, names [2]string, differences []dbmigrate.VersionDifference) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(differences)
+	case "text":
+		if len(differences) == 0 {
+			return nil
+		}
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(writer, "version\t%s\t%s\n", names[0], names[1])
+		for _, d := range differences {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", d.Version, comparisonCell(d.AppliedA, d.ChecksumA), comparisonCell(d.AppliedB, d.ChecksumB))
+		}
+		return writer.Flush()
+	default:
+		return errors.Errorf("-format must be `text` or `json`, got %q", format)
+	}
+}
+
+// comparisonCell is `-` if not applied, else the abbreviated checksum, or `applied` if unknown
+func comparisonCell(applied bool, checksum string) string {
+	switch {
+	case !applied:
+		return "-"
+	case checksum == "":
+		return "applied"
+	case len(checksum) > 12:
+		return checksum[:12]
+	default:
+		return checksum
+	}
+}
+
+// runCompare compares versions applied to the two databases given as `-url` in `args`, connecting to
+// each with `options`, and writes their differences to `w`; fails if any version differs
+func runCompare(ctx context.Context, w io.Writer, args []string, dirname string, driverName string, options []dbmigrate.Option, schema *string, format string) error {
+	var urls stringsFlag
+	compareFlags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	compareFlags.Var(&urls, "url", "database to compare; exactly two")
+	if err := compareFlags.Parse(args); err != nil {
+		return err
+	}
+	if len(urls) != 2 || compareFlags.NArg() != 0 {
+		return errors.Errorf("usage: dbmigrate compare -url A -url B")
+	}
+	var configs []*dbmigrate.Config
+	for _, url := range urls {
+		driver, url, err := dbmigrate.SanitizeDriverNameURL(driverName, url)
+		if err != nil {
+			return err
+		}
+		m, err := dbmigrate.New(os.DirFS(dirname), driver, url, options...)
+		if err != nil {
+			return err
+		}
+		defer m.CloseDB()
+		configs = append(configs, m)
+	}
+	differences, err := dbmigrate.Compare(ctx, configs[0], configs[1], schema)
+	if err != nil {
+		return err
+	}
+	names := [2]string{dbmigrate.RedactDatabaseURL(urls[0]), dbmigrate.RedactDatabaseURL(urls[1])}
+	if err := writeComparison(w, format, names, differences); err != nil {
+		return err
+	}
+	if len(differences) > 0 {
+		return errors.Errorf("%d version(s) differ", len(differences))
+	}
+	log.Println("[compare] same versions applied to both")
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	_ "github.com/MichaelS11/go-cql-driver"
 	"github.com/choonkeat/dbmigrate"
+	"github.com/choonkeat/dbmigrate/sqlsplit"
 	"github.com/pkg/errors"
 )
 
@@ -37,6 +38,7 @@ func init() {
 		BeginTx: func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (dbmigrate.ExecCommitRollbacker, error) {
 			return &noTx{db: db}, nil
 		},
+		SplitOptions: sqlsplit.CQL,
 	})
 }
 
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// createMigration writes a pair of `.up.sql` and `.down.sql` files described by `description` into `dirname`,
+// versioned after the latest file if `afterLatest`
+func createMigration(dirname string, description string, afterLatest bool, opts dbmigrate.CreateOptions) error {
+	now, err := dbmigrate.NextVersion(os.DirFS(dirname), time.Now(), afterLatest)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read from -dir %q", dirname)
+	}
+	upPath, downPath, err := dbmigrate.CreateMigration(dbmigrate.DirWriter(dirname), now, description, opts)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write into -dir %q", dirname)
+	}
+	log.Println("writing", upPath)
+	log.Println("writing", downPath)
+	return nil
+}
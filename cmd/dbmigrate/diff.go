@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// schemaChangesSQL returns the up and down sql of `changes`, with destructive changes commented
+// out for review, and down statements in reverse order
+func schemaChangesSQL(changes []dbmigrate.SchemaChange) (up string, down string) {
+	var ups, downs []string
+	for _, change := range changes {
+		if change.Destructive {
+			ups = append(ups, "-- destructive; uncomment after review\n-- "+change.Up)
+		} else {
+			ups = append(ups, change.Up)
+		}
+		switch {
+		case change.Destructive:
+		case change.Down == "":
+			downs = append([]string{"-- irreversible: " + change.Up}, downs...)
+		default:
+			downs = append([]string{change.Down}, downs...)
+		}
+	}
+	return strings.Join(ups, "\n") + "\n", strings.Join(downs, "\n") + "\n"
+}
+
+// withoutDroppedTables returns `changes` without dropping tables that are not declared
+func withoutDroppedTables(changes []dbmigrate.SchemaChange) []dbmigrate.SchemaChange {
+	var result []dbmigrate.SchemaChange
+	for _, change := range changes {
+		if !change.Destructive || !strings.HasPrefix(change.Up, "DROP TABLE ") {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// diffSchema returns the changes that make the database of `m` match the declarative schema of
+// `schemaFile`, or the JSON Schemas of `jsonSchemaDir`, with the name of that source
+func diffSchema(ctx context.Context, m *dbmigrate.Config, schema *string, schemaFile string, jsonSchemaDir string) ([]dbmigrate.SchemaChange, string, error) {
+	var schemaSQL []byte
+	var err error
+	switch {
+	case schemaFile != "" && jsonSchemaDir == "":
+		schemaSQL, err = os.ReadFile(schemaFile)
+	case jsonSchemaDir != "" && schemaFile == "":
+		schemaFile = jsonSchemaDir
+		schemaSQL, err = dbmigrate.JSONSchemaSQL(os.DirFS(jsonSchemaDir))
+	default:
+		return nil, "", errors.Errorf("usage: dbmigrate diff -schema-file schema.sql | -json-schema-dir dir [-create [describe your change]]")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	changes, err := m.DiffSchema(ctx, schema, schemaSQL)
+	if err != nil {
+		return nil, "", err
+	}
+	if jsonSchemaDir != "" {
+		changes = withoutDroppedTables(changes) // other tables are not described by JSON Schemas
+	}
+	return changes, schemaFile, nil
+}
+
+// writeDiff prints the up sql of `changes` from `source`, or if `create` is set, writes them into
+// a new migration of `create.dirname` for review instead
+func writeDiff(w io.Writer, changes []dbmigrate.SchemaChange, source string, create *diffMigration) error {
+	if len(changes) == 0 {
+		log.Println("[diff] database matches", source)
+		return nil
+	}
+	up, down := schemaChangesSQL(changes)
+	if create == nil {
+		fmt.Fprint(w, up)
+		return nil
+	}
+	description := create.description
+	if description == "" {
+		description = "schema diff"
+	}
+	up = "-- Description: " + description + ", generated from " + source + "; review before applying\n" + up
+	return createMigration(create.dirname, description, create.afterLatest, dbmigrate.CreateOptions{Phase: create.phase, Up: up, Down: down})
+}
+
+// diffMigration is where `diff -create` writes the migration
+type diffMigration struct {
+	dirname     string
+	description string
+	afterLatest bool
+	phase       dbmigrate.Phase
+}
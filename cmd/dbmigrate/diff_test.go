@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDiff(t *testing.T) {
+	changes := []dbmigrate.SchemaChange{{Up: "CREATE TABLE posts (id int);", Down: "DROP TABLE posts;"}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeDiff(&buf, changes, "schema.sql", nil))
+	assert.Equal(t, "CREATE TABLE posts (id int);\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeDiff(&buf, nil, "schema.sql", nil))
+	assert.Equal(t, "", buf.String())
+
+	dir := t.TempDir()
+	assert.NoError(t, writeDiff(&buf, changes, "schema.sql", &diffMigration{dirname: dir}))
+	assert.Equal(t, "", buf.String())
+	upPaths, err := filepath.Glob(filepath.Join(dir, "*_schema-diff.up.sql"))
+	assert.NoError(t, err)
+	if assert.Len(t, upPaths, 1) {
+		up, err := os.ReadFile(upPaths[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "-- Description: schema diff, generated from schema.sql; review before applying\nCREATE TABLE posts (id int);\n", string(up))
+		down, err := os.ReadFile(strings.TrimSuffix(upPaths[0], ".up.sql") + ".down.sql")
+		assert.NoError(t, err)
+		assert.Equal(t, "DROP TABLE posts;\n", string(down))
+	}
+}
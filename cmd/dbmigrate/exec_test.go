@@ -0,0 +1,105 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain runs dbmigrate instead of the tests when DBMIGRATE_TEST_MAIN is set, so tests can run
+// the command line, e.g. `-run-and-exec` which replaces the process
+func TestMain(m *testing.M) {
+	if os.Getenv("DBMIGRATE_TEST_MAIN") != "" {
+		os.Args = append([]string{"dbmigrate"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs dbmigrate with `args`, returning its combined output and exit code
+func runMain(t *testing.T, args ...string) (string, int) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "DBMIGRATE_TEST_MAIN=1")
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(output), exitErr.ExitCode()
+	}
+	assert.NoError(t, err)
+	return string(output), 0
+}
+
+func TestRunAndExec(t *testing.T) {
+	testCases := []struct {
+		name             string
+		upSQL            string
+		flags            []string
+		command          []string
+		expectedOutput   []string
+		unexpectedOutput string
+		expectedExitCode int
+	}{
+		{
+			name:             fileline(),
+			upSQL:            "CREATE TABLE users (id int);",
+			command:          []string{"--", "sh", "-c", "echo exec: $0; exit 3", "server"},
+			expectedOutput:   []string{"[up] 20240101000000_users.up.sql", "exec: server"},
+			expectedExitCode: 3, // of the command, which replaced dbmigrate
+		},
+		{
+			name:             fileline(),
+			upSQL:            "CREATE TABLE users (id int",
+			command:          []string{"--", "sh", "-c", "echo exec: $0", "server"},
+			expectedOutput:   []string{"20240101000000_users.up.sql"},
+			unexpectedOutput: "exec:",
+			expectedExitCode: 1,
+		},
+		{
+			name:             fileline(),
+			upSQL:            "CREATE TABLE users (id int);",
+			flags:            []string{"-tenants", "one,two"},
+			command:          []string{"--", "sh", "-c", "echo exec: $0; exit 3", "server"},
+			expectedOutput:   []string{"[up] one 20240101000000_users.up.sql", "[up] two 20240101000000_users.up.sql", "exec: server"},
+			expectedExitCode: 3,
+		},
+		{
+			name:             fileline(),
+			upSQL:            "CREATE TABLE users (id int);",
+			flags:            []string{"-plan"},
+			command:          []string{"--", "sh", "-c", "echo exec: $0", "server"},
+			expectedOutput:   []string{"-run-and-exec cannot be used with -plan"},
+			unexpectedOutput: "exec:",
+			expectedExitCode: 1,
+		},
+		{
+			name:             fileline(),
+			upSQL:            "CREATE TABLE users (id int);",
+			expectedOutput:   []string{"usage: dbmigrate -run-and-exec [flags] -- command [args...]"},
+			unexpectedOutput: "[up]",
+			expectedExitCode: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirname := t.TempDir()
+			assert.NoError(t, os.WriteFile(filepath.Join(dirname, "20240101000000_users.up.sql"), []byte(tc.upSQL), 0644))
+			assert.NoError(t, os.WriteFile(filepath.Join(dirname, "20240101000000_users.down.sql"), []byte("DROP TABLE users;"), 0644))
+
+			args := append([]string{"-driver", "sqlite3", "-url", filepath.Join(dirname, "app.db"), "-dir", dirname}, tc.flags...)
+			args = append(append(args, "-run-and-exec"), tc.command...)
+			output, exitCode := runMain(t, args...)
+			for _, expected := range tc.expectedOutput {
+				assert.Contains(t, output, expected)
+			}
+			if tc.unexpectedOutput != "" {
+				assert.NotContains(t, output, tc.unexpectedOutput)
+			}
+			assert.Equal(t, tc.expectedExitCode, exitCode, output)
+		})
+	}
+}
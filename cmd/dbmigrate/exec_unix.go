@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// execCommand replaces this process with `args`, so the command receives signals directly,
+// e.g. as PID 1 of a container
+func execCommand(args []string) error {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(syscall.Exec(path, args, os.Environ()), "exec %q", path)
+}
+
+// shellCommand runs `command` with sh, e.g. a `-backup-cmd` with pipes and redirects
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
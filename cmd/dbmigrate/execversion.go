@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// execStdin applies the sql read from `r` as migration `version` of `m`, see dbmigrate.Config.ExecVersion
+func execStdin(ctx context.Context, r io.Reader, m *dbmigrate.Config, opts dbmigrate.MigrateOptions, version string) error {
+	upSQL, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read stdin")
+	}
+	if err := m.CheckWritable(ctx); err != nil {
+		return err
+	}
+	return m.ExecVersion(ctx, opts, version, upSQL)
+}
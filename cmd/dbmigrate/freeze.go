@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// runFreeze freezes migrations of `m` for the reason in `args`, or unfreezes them if `command` is `unfreeze`
+func runFreeze(ctx context.Context, m *dbmigrate.Config, schema *string, command string, args []string) error {
+	if command == "unfreeze" {
+		if err := m.Unfreeze(ctx, schema); err != nil {
+			return err
+		}
+		log.Println("[freeze] unfrozen")
+		return nil
+	}
+	reason := strings.Join(args, " ")
+	if reason == "" {
+		return errors.Errorf("usage: dbmigrate freeze <reason>")
+	}
+	if err := m.Freeze(ctx, schema, reason); err != nil {
+		return err
+	}
+	log.Println("[freeze] `-up` and `-down` refuse to run until `dbmigrate unfreeze`:", reason)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// k8sJob describes a kubernetes Job, or CronJob if Schedule is set, that runs dbmigrate
+type k8sJob struct {
+	Name     string
+	Image    string
+	Schedule string
+	Secret   string // holds DATABASE_URL
+	Driver   string
+	Args     []string
+}
+
+var k8sPodTemplate = template.Must(template.New("pod").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(`restartPolicy: Never
+containers:
+  - name: dbmigrate
+    image: {{ quote .Image }}
+    args:
+{{- range .Args }}
+      - {{ quote . }}
+{{- end }}
+    env:
+      - name: DATABASE_URL
+        valueFrom:
+          secretKeyRef:
+            name: {{ quote .Secret }}
+            key: DATABASE_URL
+{{- if .Driver }}
+      - name: DATABASE_DRIVER
+        value: {{ quote .Driver }}
+{{- end }}
+`))
+
+var k8sJobTemplate = template.Must(template.New("k8s-job").Funcs(template.FuncMap{"quote": strconv.Quote, "indent": indent}).Parse(`apiVersion: batch/v1
+{{- if .Schedule }}
+kind: CronJob
+metadata:
+  name: {{ quote .Name }}
+spec:
+  schedule: {{ quote .Schedule }}
+  concurrencyPolicy: Forbid
+  jobTemplate:
+    spec:
+      backoffLimit: 0
+      template:
+        spec:
+{{ indent 10 .Pod }}
+{{- else }}
+kind: Job
+metadata:
+  name: {{ quote .Name }}
+spec:
+  backoffLimit: 0
+  template:
+    spec:
+{{ indent 6 .Pod }}
+{{- end }}
+`))
+
+func indent(n int, s string) string {
+	prefix := strings.Repeat(" ", n)
+	return prefix + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n"+prefix)
+}
+
+// writeK8sJob writes a kubernetes manifest running dbmigrate with the flags set on `commandLine`
+// before `gen`, except -url and -driver which are passed as env variables
+func writeK8sJob(w io.Writer, commandLine *flag.FlagSet, args []string, driverName string) error {
+	fs := flag.NewFlagSet("gen k8s-job", flag.ContinueOnError)
+	job := k8sJob{Driver: driverName}
+	fs.StringVar(&job.Name, "name", "dbmigrate", "name of the Job or CronJob")
+	fs.StringVar(&job.Image, "image", "choonkeat/dbmigrate", "container image with dbmigrate and your `-dir`")
+	fs.StringVar(&job.Schedule, "schedule", "", "cron schedule; generates a CronJob instead of a Job")
+	fs.StringVar(&job.Secret, "secret", "dbmigrate", "name of the kubernetes secret with DATABASE_URL key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	hasOperation := false
+	commandLine.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "url", "driver":
+			return
+		case "up", "down", "versions-pending", "status", "lint", "check-reversibility":
+			hasOperation = true
+		}
+		job.Args = append(job.Args, "-"+f.Name+"="+f.Value.String())
+	})
+	if !hasOperation {
+		job.Args = append(job.Args, "-up")
+	}
+	var pod strings.Builder
+	if err := k8sPodTemplate.Execute(&pod, job); err != nil {
+		return err
+	}
+	return k8sJobTemplate.Execute(w, struct {
+		k8sJob
+		Pod string
+	}{job, pod.String()})
+}
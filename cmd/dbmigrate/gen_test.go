@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestWriteK8sJob(t *testing.T) {
+	testCases := []struct {
+		name        string
+		commandLine []string
+		args        []string
+		driverName  string
+		golden      string
+	}{
+		{
+			name:        fileline(),
+			commandLine: []string{"-url", "postgres://localhost/app", "-dir", "db/migrations"},
+			driverName:  "postgres",
+			golden:      "k8s-job.yaml",
+		},
+		{
+			name:        fileline(),
+			commandLine: []string{"-driver", "mysql", "-dir", "db/migrations", "-up", "-timeout", "30m"},
+			args:        []string{"-name", "nightly", "-image", "example/app:v1", "-schedule", "0 3 * * *", "-secret", "app-db"},
+			driverName:  "mysql",
+			golden:      "k8s-cronjob.yaml",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			commandLine := flag.NewFlagSet("dbmigrate", flag.ContinueOnError)
+			commandLine.String("url", "", "")
+			commandLine.String("driver", "", "")
+			commandLine.String("dir", "", "")
+			commandLine.String("timeout", "", "")
+			commandLine.Bool("up", false, "")
+			assert.NoError(t, commandLine.Parse(tc.commandLine))
+
+			var buf bytes.Buffer
+			assert.NoError(t, writeK8sJob(&buf, commandLine, tc.args, tc.driverName))
+			golden := filepath.Join("testdata", tc.golden)
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, buf.Bytes(), 0644))
+			}
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), buf.String())
+		})
+	}
+
+	err := writeK8sJob(&bytes.Buffer{}, flag.NewFlagSet("dbmigrate", flag.ContinueOnError), []string{"extra"}, "")
+	assert.EqualError(t, err, `unexpected arguments ["extra"]`)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// writeGraph writes `nodes` to `w` as a mermaid flowchart or a graphviz digraph: files in
+// version order joined by solid arrows, `depends` directives by dotted arrows. Post-deploy files
+// are dashed; pending files are highlighted if `withStatus`, i.e. applied versions were queried
+func writeGraph(w io.Writer, format string, nodes []dbmigrate.GraphNode, withStatus bool) error {
+	switch format {
+	case "mermaid":
+		fmt.Fprintln(w, "flowchart TD")
+		for _, n := range nodes {
+			label := n.Version + " " + n.Name
+			if n.Phase == dbmigrate.PhasePost {
+				label += " (post)"
+			}
+			if n.Description != "" {
+				label += "<br/>" + n.Description
+			}
+			fmt.Fprintf(w, "  v%s[\"%s\"]\n", n.Version, strings.ReplaceAll(label, `"`, "#quot;"))
+		}
+		for i, n := range nodes {
+			if i > 0 {
+				fmt.Fprintf(w, "  v%s --> v%s\n", nodes[i-1].Version, n.Version)
+			}
+			for _, version := range n.Depends {
+				fmt.Fprintf(w, "  v%s -.->|depends| v%s\n", version, n.Version)
+			}
+		}
+		fmt.Fprintln(w, "  classDef pending fill:#fff3cd,stroke:#d39e00")
+		fmt.Fprintln(w, "  classDef post stroke-dasharray:5 5")
+		for _, n := range nodes {
+			if withStatus && !n.Applied {
+				fmt.Fprintf(w, "  class v%s pending\n", n.Version)
+			}
+			if n.Phase == dbmigrate.PhasePost {
+				fmt.Fprintf(w, "  class v%s post\n", n.Version)
+			}
+		}
+		return nil
+	case "dot":
+		fmt.Fprintln(w, "digraph migrations {")
+		fmt.Fprintln(w, "  node [shape=box];")
+		for _, n := range nodes {
+			label := n.Version + " " + n.Name
+			if n.Description != "" {
+				label += "\n" + n.Description
+			}
+			var styles []string
+			if n.Phase == dbmigrate.PhasePost {
+				styles = append(styles, "dashed")
+			}
+			if withStatus && !n.Applied {
+				styles = append(styles, "filled")
+			}
+			fmt.Fprintf(w, "  %s [label=%s", strconv.Quote(n.Version), strconv.Quote(label))
+			if len(styles) > 0 {
+				fmt.Fprintf(w, ", style=%s", strconv.Quote(strings.Join(styles, ",")))
+			}
+			if withStatus && !n.Applied {
+				fmt.Fprint(w, `, fillcolor="#fff3cd"`)
+			}
+			fmt.Fprintln(w, "];")
+		}
+		for i, n := range nodes {
+			if i > 0 {
+				fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(nodes[i-1].Version), strconv.Quote(n.Version))
+			}
+			for _, version := range n.Depends {
+				fmt.Fprintf(w, "  %s -> %s [style=dotted, label=\"depends\"];\n", strconv.Quote(version), strconv.Quote(n.Version))
+			}
+		}
+		fmt.Fprintln(w, "}")
+		return nil
+	}
+	return errors.Errorf("usage: dbmigrate graph [mermaid|dot], got %q", format)
+}
+
+// runGraph writes the migration files of `dirname` to `w` as a graph in the format of `args`, mermaid
+// by default; pending files are highlighted if `m` is given to query applied versions
+func runGraph(ctx context.Context, w io.Writer, dirname string, args []string, m *dbmigrate.Config, schema *string) error {
+	format := "mermaid"
+	if len(args) > 0 {
+		format = args[0]
+	}
+	var applied []string
+	if m != nil {
+		var err error
+		if applied, err = m.AppliedVersions(ctx, schema); err != nil {
+			return err
+		}
+	}
+	nodes, err := dbmigrate.Graph(os.DirFS(dirname), applied)
+	if err != nil {
+		return err
+	}
+	return writeGraph(w, format, nodes, m != nil)
+}
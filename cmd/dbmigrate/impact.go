@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/choonkeat/dbmigrate"
+)
+
+// writeImpact writes `impacts` to `w` as a table; statements blocking queries are marked with `!`
+func writeImpact(w io.Writer, impacts []dbmigrate.Impact) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tfile\tstatement\ttable\trows\tbytes\tlock\tblocks")
+	for _, i := range impacts {
+		mark := ""
+		if i.Blocks != "" {
+			mark = "!"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t#%d\t%s\t%s\t%s\t%s\t%s\n", mark, i.Filename, i.Statement, i.Table, unknownIfNegative(i.Rows), unknownIfNegative(i.Bytes), i.LockLevel, i.Blocks)
+	}
+	return writer.Flush()
+}
+
+func unknownIfNegative(n int64) string {
+	if n < 0 {
+		return "?"
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// lintFiles logs statements of all migration files of `m` that are unsafe during rolling deploys; fails if any
+func lintFiles(m *dbmigrate.Config) error {
+	issues, err := m.LintAll()
+	if err != nil {
+		return err
+	}
+	logLintIssues(issues)
+	if len(issues) > 0 {
+		return errors.Errorf("%d statement(s) unsafe during rolling deploys", len(issues))
+	}
+	return nil
+}
+
+func logLintIssues(issues []dbmigrate.LintIssue) {
+	for _, issue := range issues {
+		if issue.Statement == 0 {
+			log.Println("[lint]", issue.Filename+":", issue.Rule, "-", issue.Message)
+			continue
+		}
+		log.Println("[lint]", fmt.Sprintf("%s statement #%d:", issue.Filename, issue.Statement), issue.Rule, "-", issue.Message)
+	}
+}
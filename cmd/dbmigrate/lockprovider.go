@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/choonkeat/dbmigrate/lockprovider/etcd"
+	"github.com/choonkeat/dbmigrate/lockprovider/redis"
+	"github.com/pkg/errors"
+)
+
+// parseLockURL returns the LockProvider of `-lock-url`, e.g. `redis://:password@host:6379/orders-db?ttl=30s`
+// or `etcd://host:2379/orders-db`; the path is prepended to the lock name, e.g. `orders-db/dbmigrate`
+func parseLockURL(lockURL string) (dbmigrate.LockProvider, error) {
+	u, err := url.Parse(lockURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid -lock-url")
+	}
+	var ttl time.Duration
+	if value := u.Query().Get("ttl"); value != "" {
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return nil, errors.Wrapf(err, "invalid -lock-url ttl")
+		}
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	switch u.Scheme {
+	case "redis":
+		password, _ := u.User.Password()
+		if password == "" && u.User != nil {
+			password = u.User.Username() // redis://password@host
+		}
+		return redis.LockProvider{Addr: u.Host, Password: password, Prefix: prefix, TTL: ttl}, nil
+	case "etcd", "etcds":
+		scheme := "http"
+		if u.Scheme == "etcds" {
+			scheme = "https"
+		}
+		return etcd.LockProvider{Endpoint: scheme + "://" + u.Host, Prefix: prefix, TTL: ttl}, nil
+	}
+	return nil, errors.Errorf("-lock-url must be `redis://`, `etcd://` or `etcds://`, got %q", lockURL)
+}
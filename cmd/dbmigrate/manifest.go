@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// manifestTarget is a target of `-manifest` and what this run did to it
+type manifestTarget struct {
+	dbmigrate.ManifestTarget
+	m        *dbmigrate.Config
+	ran      bool
+	applied  []string // versions applied by this run, to revert only those
+	reverted int
+	err      error
+}
+
+func (t *manifestTarget) schema() *string {
+	return &t.Schema
+}
+
+// runManifest shows pending versions of, or migrates up, each target of `manifest` in order
+func runManifest(ctx context.Context, manifest dbmigrate.Manifest, options []dbmigrate.Option, txOpts *sql.TxOptions, txnMode dbmigrate.DbTxnMode, doPendingVersions bool, doMigrateUp bool, preflight func(context.Context, *dbmigrate.Config, *string) error) error {
+	if !doPendingVersions && !doMigrateUp {
+		return errors.Errorf("-manifest only supports `-versions-pending` or `-up`")
+	}
+
+	targets := make([]*manifestTarget, 0, len(manifest.Targets))
+	for _, mt := range manifest.Targets {
+		m, err := dbmigrate.New(os.DirFS(mt.Dir), mt.Driver, mt.URL, options...)
+		if err != nil {
+			return errors.Wrapf(err, "target %q", mt.Name)
+		}
+		defer m.CloseDB()
+		targets = append(targets, &manifestTarget{ManifestTarget: mt, m: m})
+	}
+
+	if doPendingVersions {
+		for _, t := range targets {
+			versions, err := t.m.PendingVersions(ctx, t.schema())
+			if err != nil {
+				return errors.Wrapf(err, "target %q", t.Name)
+			}
+			for _, v := range versions {
+				fmt.Println(t.Name, v)
+			}
+		}
+		return nil
+	}
+
+	for _, t := range targets {
+		if err := preflight(ctx, t.m, t.schema()); err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+	}
+
+	var failed *manifestTarget
+	for _, t := range targets {
+		before, err := t.m.AppliedVersions(ctx, t.schema())
+		if err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+		t.ran = true
+		t.err = t.m.Up(ctx, dbmigrate.MigrateOptions{TxOptions: txOpts, Schema: t.schema(), Mode: txnMode, AfterFile: filenameLogger("[up] " + t.Name)})
+		t.err = withAbsDir(t.err, t.Dir)
+		if after, err := t.m.AppliedVersions(ctx, t.schema()); err == nil {
+			t.applied = newVersions(before, after)
+		} else if t.err == nil {
+			t.err = errors.Wrapf(err, "unable to query applied versions")
+		}
+		if t.err != nil {
+			failed = t
+			break
+		}
+	}
+
+	var unreverted []string
+	if failed != nil && manifest.Policy == dbmigrate.ManifestPolicyAllOrNothing {
+		for i := len(targets) - 1; i >= 0; i-- {
+			t := targets[i]
+			if len(t.applied) == 0 {
+				continue
+			}
+			if err := t.revert(ctx, txOpts, txnMode); err != nil {
+				log.Println("[summary]", t.Name, "failed to revert", len(t.applied), "file(s):", err.Error())
+				unreverted = append(unreverted, t.Name)
+				continue
+			}
+			t.reverted, t.applied = len(t.applied), nil
+		}
+	}
+
+	for _, t := range targets {
+		switch {
+		case !t.ran:
+			log.Println("[summary]", t.Name, "not migrated")
+		case t.reverted > 0:
+			log.Println("[summary]", t.Name, t.reverted, "file(s) applied then reverted")
+		case t.err != nil:
+			log.Println("[summary]", t.Name, "failed:", t.err.Error())
+		default:
+			log.Println("[summary]", t.Name, len(t.applied), "file(s) applied")
+		}
+	}
+	if len(unreverted) > 0 {
+		return errors.Wrapf(failed.err, "target %q; unable to revert target(s) %s", failed.Name, strings.Join(unreverted, ", "))
+	}
+	if failed != nil {
+		return errors.Wrapf(failed.err, "target %q", failed.Name)
+	}
+	return nil
+}
+
+// revert un-applies exactly `t.applied`, by the run of `-up` that applied them
+func (t *manifestTarget) revert(ctx context.Context, txOpts *sql.TxOptions, txnMode dbmigrate.DbTxnMode) error {
+	runs, err := t.m.Runs(ctx, t.schema())
+	if err != nil {
+		return err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.Direction != "up" || len(run.Versions) == 0 || !sameVersions(run.Versions, t.applied) {
+			continue
+		}
+		return t.m.Down(ctx, dbmigrate.MigrateOptions{TxOptions: txOpts, Schema: t.schema(), Mode: txnMode, RunID: run.ID, AfterFile: filenameLogger("[down] " + t.Name)})
+	}
+	return errors.Errorf("no run of up applied %s", strings.Join(t.applied, ", "))
+}
+
+// newVersions returns versions of `after` that are not in `before`, in ascending order
+func newVersions(before, after []string) []string {
+	applied := map[string]bool{}
+	for _, v := range before {
+		applied[v] = true
+	}
+	var result []string
+	for _, v := range after {
+		if !applied[v] {
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// sameVersions returns true if `a` and `b` have the same versions, in any order
+func sameVersions(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
@@ -0,0 +1,92 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunManifestAllOrNothing(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         map[string]string // of target "a"; target "b" always fails
+		alreadyUp     []dbmigrate.MigrateOptions
+		expectedError string
+		expected      []string // applied versions of target "a" afterwards
+	}{
+		{
+			name: fileline(),
+			files: map[string]string{
+				"20240101000000_a.up.sql":   "CREATE TABLE a (id int);",
+				"20240101000000_a.down.sql": "DROP TABLE a;",
+				"20240102000000_b.up.sql":   "CREATE TABLE b (id int);",
+				"20240102000000_b.down.sql": "DROP TABLE b;",
+				"20240103000000_c.up.sql":   "CREATE TABLE c (id int);",
+				"20240103000000_c.down.sql": "DROP TABLE c;",
+			},
+			alreadyUp: []dbmigrate.MigrateOptions{
+				{Mode: dbmigrate.DbTxnModeNone, Target: "20240101000000"},
+				{Mode: dbmigrate.DbTxnModeNone, File: "20240103000000_c.up.sql", AllowGaps: true},
+			},
+			expectedError: `target "b"`,
+			expected:      []string{"20240101000000", "20240103000000"}, // c was applied before the run, so it is kept
+		},
+		{
+			name: fileline(),
+			files: map[string]string{
+				"20240101000000_a.up.sql":   "CREATE TABLE a (id int);",
+				"20240101000000_a.down.sql": "DROP TABLE a;",
+				"20240102000000_b.up.sql":   "CREATE TABLE b (id int);",
+			},
+			alreadyUp: []dbmigrate.MigrateOptions{
+				{Mode: dbmigrate.DbTxnModeNone, Target: "20240101000000"},
+			},
+			expectedError: `target "b"; unable to revert target(s) a`,
+			expected:      []string{"20240101000000", "20240102000000"}, // b has no down file, so it stays applied
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dirname := t.TempDir()
+			for _, target := range []string{"a", "b"} {
+				assert.NoError(t, os.Mkdir(filepath.Join(dirname, target), 0755))
+			}
+			for name, content := range tc.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(dirname, "a", name), []byte(content), 0644))
+			}
+			assert.NoError(t, os.WriteFile(filepath.Join(dirname, "b", "20240101000000_x.up.sql"), []byte("CREATE TABLE x (id int"), 0644))
+
+			manifest := dbmigrate.Manifest{
+				Policy: dbmigrate.ManifestPolicyAllOrNothing,
+				Targets: []dbmigrate.ManifestTarget{
+					{Name: "a", Driver: "sqlite3", URL: filepath.Join(dirname, "a.db"), Dir: filepath.Join(dirname, "a")},
+					{Name: "b", Driver: "sqlite3", URL: filepath.Join(dirname, "b.db"), Dir: filepath.Join(dirname, "b")},
+				},
+			}
+			m, err := dbmigrate.New(os.DirFS(manifest.Targets[0].Dir), "sqlite3", manifest.Targets[0].URL)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer m.CloseDB()
+			for _, opts := range tc.alreadyUp {
+				assert.NoError(t, m.Up(ctx, opts))
+			}
+
+			preflight := func(context.Context, *dbmigrate.Config, *string) error { return nil }
+			err = runManifest(ctx, manifest, nil, nil, dbmigrate.DbTxnModeAll, false, true, preflight)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+			applied, err := m.AppliedVersions(ctx, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, applied)
+		})
+	}
+}
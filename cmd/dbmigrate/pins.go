@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// readDirPins returns flags pinned by dbmigrate.PinsFilename of `dirname`, and the path of the file
+func readDirPins(dirname string) (dbmigrate.Pins, string, error) {
+	pins, err := dbmigrate.ReadPins(os.DirFS(dirname))
+	return pins, filepath.Join(dirname, dbmigrate.PinsFilename), err
+}
+
+// applyPins sets flags as pinned by `source`, overriding defaults and environment variables. A flag given
+// a different value on the command line is an error; values of repeatable flags are added instead
+func applyPins(pins dbmigrate.Pins, source string) error {
+	given := map[string]string{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = f.Value.String() })
+
+	names := make([]string, 0, len(pins))
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flag.Lookup(name)
+		switch {
+		case f == nil:
+			return errors.Errorf("%s: unknown flag -%s", source, name)
+		case name == "dir" || name == "manifest":
+			return errors.Errorf("%s: -%s cannot be pinned", source, name)
+		}
+		_, repeatable := f.Value.(*stringsFlag)
+		for _, value := range pins[name] {
+			if err := flag.Set(name, value); err != nil {
+				return errors.Wrapf(err, "%s: invalid -%s", source, name)
+			}
+		}
+		if value, ok := given[name]; ok && !repeatable && value != f.Value.String() {
+			return errors.Errorf("-%s=%s conflicts with -%s=%s pinned by %s", name, value, name, f.Value.String(), source)
+		}
+	}
+	return nil
+}
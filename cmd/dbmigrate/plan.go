@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// writePlan writes `plan` to `w` as text, or as json for `-apply -plan-file`
+func writePlan(w io.Writer, format string, plan dbmigrate.Plan) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case "text":
+		for _, f := range plan.Pending {
+			if f.Description != "" {
+				fmt.Fprintln(w, f.Checksum, f.Filename, "--", f.Description)
+			} else {
+				fmt.Fprintln(w, f.Checksum, f.Filename)
+			}
+			if f.Unparsed > 0 {
+				fmt.Fprintf(w, "  tables: %s, and unknown of statement #%d\n", strings.Join(f.Tables, ", "), f.Unparsed)
+			} else if len(f.Tables) > 0 {
+				fmt.Fprintln(w, "  tables:", strings.Join(f.Tables, ", "))
+			}
+		}
+		if len(plan.Impact) == 0 {
+			return nil
+		}
+		fmt.Fprintln(w)
+		return writeImpact(w, plan.Impact)
+	}
+	return errors.Errorf("-format must be `text` or `json` for `-plan`, got %q", format)
+}
+
+// readPlan reads a plan written by `-plan -format json`
+func readPlan(filename string) (plan dbmigrate.Plan, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return plan, err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&plan); err != nil {
+		return plan, errors.Wrapf(err, "invalid plan %q", filename)
+	}
+	return plan, nil
+}
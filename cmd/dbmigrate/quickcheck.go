@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/choonkeat/dbmigrate"
+)
+
+// quickCheck applies the migration files of `dirname` to an in-memory database, logging files that
+// were skipped as unsupported there, see dbmigrate.QuickCheck
+func quickCheck(ctx context.Context, dirname string, options []dbmigrate.Option) error {
+	results, err := dbmigrate.QuickCheck(ctx, os.DirFS(dirname), options...)
+	if err != nil {
+		return err
+	}
+	skipped := 0
+	for _, r := range results {
+		if r.Error != "" {
+			skipped++
+			log.Println("[quick-check] skipped", r.Filename+":", r.Error)
+			continue
+		}
+		log.Println("[quick-check] ok", r.Filename)
+	}
+	log.Println("[summary]", len(results)-skipped, "file(s) applied,", skipped, "skipped")
+	return nil
+}
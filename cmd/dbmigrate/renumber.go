@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// renumberMigration renames the `.up.sql` and `.down.sql` pair of `filename` to
+// a new version derived from `now`, keeping the description part of the name.
+//
+// `isApplied` is consulted before renaming; a nil `isApplied` means the
+// database could not be checked
+func renumberMigration(dirname string, filename string, now time.Time, isApplied func(version string) (bool, error)) error {
+	if !strings.ContainsRune(filename, filepath.Separator) {
+		filename = filepath.Join(dirname, filename)
+	}
+	dir, base := filepath.Dir(filename), filepath.Base(filename)
+	name := strings.TrimSuffix(strings.TrimSuffix(base, ".up.sql"), ".down.sql")
+	if name == base {
+		return errors.Errorf("%q is not a `.up.sql` or `.down.sql` file", filename)
+	}
+	parts := strings.SplitN(name, "_", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("%q is not named as `<version>_<description>`", filename)
+	}
+	oldVersion, description := parts[0], parts[1]
+
+	if isApplied != nil {
+		applied, err := isApplied(oldVersion)
+		if err != nil {
+			return errors.Wrapf(err, "unable to check if version %q is applied", oldVersion)
+		}
+		if applied {
+			return errors.Errorf("version %q is already applied; refusing to renumber", oldVersion)
+		}
+	}
+
+	newName := now.UTC().Format(dbmigrate.VersionLayout) + "_" + description
+	if newName == name {
+		return errors.Errorf("version %q is already current; try again in a second", oldVersion)
+	}
+
+	var renames [][2]string
+	for _, suffix := range []string{".up.sql", ".down.sql"} {
+		src, dst := filepath.Join(dir, name+suffix), filepath.Join(dir, newName+suffix)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue // pair may be incomplete
+		} else if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dst); err == nil {
+			return errors.Errorf("%q already exists", dst)
+		}
+		renames = append(renames, [2]string{src, dst})
+	}
+	if len(renames) == 0 {
+		return errors.Errorf("no migration files found for %q", filepath.Join(dir, name))
+	}
+	for _, pair := range renames {
+		log.Println("renaming", pair[0], "to", pair[1])
+		if err := os.Rename(pair[0], pair[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appliedChecker returns the `isApplied` of renumberMigration, querying the versions applied in `m`
+func appliedChecker(ctx context.Context, m *dbmigrate.Config, schema *string) func(version string) (bool, error) {
+	return func(version string) (bool, error) {
+		applied, err := m.AppliedVersions(ctx, schema)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range applied {
+			if v == version {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileline() string {
+	_, fn, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", fn, line)
+}
+
+func TestRenumberMigration(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		givenFiles    []string
+		givenFilename string
+		givenApplied  func(string) (bool, error)
+		expectedFiles []string
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql", "20200101000000_a.down.sql", "20200102000000_b.up.sql", "20200102000000_b.down.sql"},
+			givenFilename: "20200101000000_a.up.sql",
+			expectedFiles: []string{"20200102000000_b.down.sql", "20200102000000_b.up.sql", "20210304050607_a.down.sql", "20210304050607_a.up.sql"},
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql", "20200101000000_a.down.sql"},
+			givenFilename: "20200101000000_a.down.sql",
+			givenApplied:  func(string) (bool, error) { return false, nil },
+			expectedFiles: []string{"20210304050607_a.down.sql", "20210304050607_a.up.sql"},
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql"},
+			givenFilename: "20200101000000_a.up.sql",
+			expectedFiles: []string{"20210304050607_a.up.sql"},
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql", "20200101000000_a.down.sql"},
+			givenFilename: "20200101000000_a.up.sql",
+			givenApplied: func(version string) (bool, error) {
+				return version == "20200101000000", nil
+			},
+			expectedFiles: []string{"20200101000000_a.down.sql", "20200101000000_a.up.sql"},
+			expectedError: `version "20200101000000" is already applied; refusing to renumber`,
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql"},
+			givenFilename: "20200101000000_a.up.sql",
+			givenApplied:  func(string) (bool, error) { return false, errors.Errorf("connection refused") },
+			expectedFiles: []string{"20200101000000_a.up.sql"},
+			expectedError: `unable to check if version "20200101000000" is applied: connection refused`,
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql", "20200101000000_a.down.sql", "20210304050607_a.down.sql"},
+			givenFilename: "20200101000000_a.up.sql",
+			expectedFiles: []string{"20200101000000_a.down.sql", "20200101000000_a.up.sql", "20210304050607_a.down.sql"},
+			expectedError: `20210304050607_a.down.sql" already exists`,
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20210304050607_a.up.sql"},
+			givenFilename: "20210304050607_a.up.sql",
+			expectedFiles: []string{"20210304050607_a.up.sql"},
+			expectedError: `version "20210304050607" is already current; try again in a second`,
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql"},
+			givenFilename: "20200101000000_a.sql",
+			expectedFiles: []string{"20200101000000_a.up.sql"},
+			expectedError: "is not a `.up.sql` or `.down.sql` file",
+		},
+		{
+			name:          fileline(),
+			givenFiles:    []string{"20200101000000_a.up.sql"},
+			givenFilename: "20200102000000_b.up.sql",
+			expectedFiles: []string{"20200101000000_a.up.sql"},
+			expectedError: "no migration files found for",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dirname, err := ioutil.TempDir("", "renumber")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dirname)
+			for _, name := range tc.givenFiles {
+				if err := ioutil.WriteFile(filepath.Join(dirname, name), []byte("SELECT 1;"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = renumberMigration(dirname, tc.givenFilename, now, tc.givenApplied)
+			if tc.expectedError != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.expectedError)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+
+			infos, err := ioutil.ReadDir(dirname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, info := range infos {
+				names = append(names, info.Name())
+			}
+			sort.Strings(names)
+			assert.Equal(t, tc.expectedFiles, names)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/choonkeat/dbmigrate"
+)
+
+// runRepairIndexes rebuilds invalid indexes of `m`, see dbmigrate.Config.RepairIndexes
+func runRepairIndexes(ctx context.Context, m *dbmigrate.Config, schema *string) error {
+	repairs, err := m.RepairIndexes(ctx, schema)
+	if err != nil {
+		return err
+	}
+	if len(repairs) == 0 {
+		log.Println("[repair-indexes] no invalid index")
+	}
+	return nil
+}
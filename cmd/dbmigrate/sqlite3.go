@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"path/filepath"
 
 	"github.com/choonkeat/dbmigrate"
 	_ "github.com/mattn/go-sqlite3"
@@ -15,12 +16,100 @@ import (
 func init() {
 	dbmigrate.Register("sqlite3", dbmigrate.Adapter{
 		CreateVersionsTable: func(_ *string) string {
-			return `CREATE TABLE dbmigrate_versions (version char(14) NOT NULL PRIMARY KEY)`
+			return `CREATE TABLE dbmigrate_versions (version varchar(255) NOT NULL PRIMARY KEY)`
 		},
 		SelectExistingVersions: func(_ *string) string { return `SELECT version FROM dbmigrate_versions ORDER BY version ASC` },
 		InsertNewVersion:       func(_ *string) string { return `INSERT INTO dbmigrate_versions (version) VALUES (?)` },
 		DeleteOldVersion:       func(_ *string) string { return `DELETE FROM dbmigrate_versions WHERE version = ?` },
-		PingQuery:              "SELECT 1",
+		SelectVersionsColumns: func(_ *string) string {
+			return `SELECT name, type, pk > 0, "notnull" = 1 AND dflt_value IS NULL FROM pragma_table_info('dbmigrate_versions') ORDER BY cid`
+		},
+		RebuildVersionsTable: func(_ *string, namespaced bool) []string {
+			ddl, columns := `version varchar(255) NOT NULL PRIMARY KEY`, `version`
+			if namespaced {
+				ddl, columns = `namespace varchar(255) NOT NULL DEFAULT '', version varchar(255) NOT NULL, PRIMARY KEY (namespace, version)`, `namespace, version`
+			}
+			return []string{
+				`CREATE TABLE dbmigrate_versions_upgrade (` + ddl + `)`,
+				`INSERT INTO dbmigrate_versions_upgrade (` + columns + `) SELECT DISTINCT ` + columns + ` FROM dbmigrate_versions`,
+				`DROP TABLE dbmigrate_versions`,
+				`ALTER TABLE dbmigrate_versions_upgrade RENAME TO dbmigrate_versions`,
+			}
+		},
+		CreateHistoryTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_history (version varchar(255) NOT NULL, direction varchar(4) NOT NULL,` +
+				` applied_at timestamp NOT NULL, duration_ms bigint NOT NULL, checksum char(64) NOT NULL,` +
+				` applied_by varchar(255) NOT NULL, remark varchar(255) NOT NULL, run_id varchar(32) NOT NULL)`
+		},
+		InsertHistory: func(_ *string) string {
+			return `INSERT INTO dbmigrate_history (version, direction, applied_at, duration_ms, checksum, applied_by, remark, run_id)` +
+				` VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		},
+		SelectHistory: func(_ *string) string {
+			return `SELECT version, direction, applied_at, duration_ms, checksum, applied_by, remark, run_id` +
+				` FROM dbmigrate_history ORDER BY applied_at ASC, version ASC`
+		},
+		CreateRunsTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_runs (run_id varchar(32) NOT NULL PRIMARY KEY, direction varchar(4) NOT NULL,` +
+				` started_at timestamp NOT NULL, applied_by varchar(255) NOT NULL, meta text NOT NULL,` +
+				` position_before text NOT NULL, position_after text NOT NULL)`
+		},
+		InsertRun: func(_ *string) string {
+			return `INSERT INTO dbmigrate_runs (run_id, direction, started_at, applied_by, meta, position_before, position_after)` +
+				` VALUES (?, ?, ?, ?, ?, ?, ?)`
+		},
+		SelectRuns: func(_ *string) string {
+			return `SELECT run_id, direction, started_at, applied_by, meta, position_before, position_after` +
+				` FROM dbmigrate_runs ORDER BY started_at ASC, run_id ASC`
+		},
+		CreateFreezeTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_freeze (reason text NOT NULL, frozen_by varchar(255) NOT NULL, frozen_at timestamp NOT NULL)`
+		},
+		InsertFreeze: func(_ *string) string {
+			return `INSERT INTO dbmigrate_freeze (reason, frozen_by, frozen_at) VALUES (?, ?, ?)`
+		},
+		DeleteFreeze: func(_ *string) string { return `DELETE FROM dbmigrate_freeze` },
+		SelectFreeze: func(_ *string) string {
+			return `SELECT reason, frozen_by, frozen_at FROM dbmigrate_freeze ORDER BY frozen_at DESC LIMIT 1`
+		},
+		CreateArchiveTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_archive (version varchar(255) NOT NULL PRIMARY KEY, filename varchar(255) NOT NULL,` +
+				` source varchar(8) NOT NULL, content text NOT NULL, archived_at timestamp NOT NULL, archived_by varchar(255) NOT NULL)`
+		},
+		InsertArchive: func(_ *string) string {
+			return `INSERT INTO dbmigrate_archive (version, filename, source, content, archived_at, archived_by) VALUES (?, ?, ?, ?, ?, ?)`
+		},
+		DeleteArchive: func(_ *string) string { return `DELETE FROM dbmigrate_archive WHERE version = ?` },
+		SelectArchive: func(_ *string) string {
+			return `SELECT version, filename, source, content, archived_at, archived_by FROM dbmigrate_archive ORDER BY version ASC`
+		},
+		SelectArchivedVersions: func(_ *string) string {
+			return `SELECT version FROM dbmigrate_archive WHERE source = ?`
+		},
+		PingQuery:            "SELECT 1",
+		ReadOnlyQuery:        "PRAGMA query_only",
+		TransactionalDDL:     true,
+		ErrorCode:            sqlite3ErrorCode,
+		Translate:            dbmigrate.Translator("sqlite3"),
+		ForeignKeysOffQuery:  "PRAGMA foreign_keys = OFF",
+		ForeignKeyCheckQuery: "PRAGMA foreign_key_check",
+		Savepoints:           true,
+		SelectColumns: func(_ *string) string {
+			return `SELECT m.name, p.name, p.type, CASE WHEN p."notnull" = 0 THEN 'YES' ELSE 'NO' END` +
+				` FROM sqlite_master m JOIN pragma_table_info(m.name) p` +
+				` WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid`
+		},
+		SelectForeignKeys: func(_ *string) string {
+			return `SELECT m.name, p."from", p."table", p."to"` +
+				` FROM sqlite_master m JOIN pragma_foreign_key_list(m.name) p` +
+				` WHERE m.type = 'table' ORDER BY m.name, p.id`
+		},
+		TenantDatabaseURL: func(databaseURL string, tenant string) (string, error) {
+			if err := dbmigrate.ValidateIdentifier(tenant); err != nil {
+				return "", err // e.g. `../other` would be outside the directory of `-url`
+			}
+			return filepath.Join(filepath.Dir(databaseURL), tenant+filepath.Ext(databaseURL)), nil
+		},
 		BeginTx: func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (dbmigrate.ExecCommitRollbacker, error) {
 			return db.BeginTx(ctx, opts)
 		},
@@ -0,0 +1,17 @@
+//go:build cgo
+
+package main
+
+import (
+	"strconv"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqlite3ErrorCode returns the primary result code of a sqlite3 error, e.g. "19" for a constraint violation
+func sqlite3ErrorCode(err error) string {
+	if e, ok := err.(sqlite3.Error); ok {
+		return strconv.Itoa(int(e.Code))
+	}
+	return ""
+}
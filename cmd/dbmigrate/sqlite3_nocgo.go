@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package main
+
+// sqlite3ErrorCode is never called since sqlite3 requires cgo
+func sqlite3ErrorCode(err error) string {
+	return ""
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// sshDialer connects to database servers through a bastion host, with one `ssh -W` process per
+// connection, so private subnets are reachable without a separate tunnel. Authentication is left
+// to ssh, e.g. ssh-agent and ~/.ssh/config
+type sshDialer struct {
+	bastion string // e.g. user@bastion:22
+}
+
+// Dial implements pq.Dialer
+func (d sshDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialTimeout(network, address, 0)
+}
+
+// DialTimeout implements pq.Dialer
+func (d sshDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, errors.Errorf("-ssh cannot dial %s %s", network, address)
+	}
+	args := []string{"-o", "BatchMode=yes", "-W", address}
+	if timeout > 0 {
+		seconds := int(timeout.Round(time.Second) / time.Second)
+		if seconds < 1 {
+			seconds = 1 // ssh takes whole seconds, and 0 means no timeout
+		}
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(seconds))
+	}
+	destination := d.bastion
+	if host, port, err := net.SplitHostPort(d.bastion); err == nil {
+		args = append(args, "-p", port)
+		destination = host
+	}
+	cmd := exec.Command("ssh", append(args, destination)...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "-ssh")
+	}
+	return &sshConn{cmd: cmd, Reader: stdout, WriteCloser: stdin, remote: sshAddr(address)}, nil
+}
+
+// sshConn is a connection through the stdin and stdout of an `ssh -W` process
+type sshConn struct {
+	cmd *exec.Cmd
+	io.Reader
+	io.WriteCloser
+	remote sshAddr
+
+	mu            sync.Mutex
+	closed        bool
+	readDeadline  *time.Timer
+	writeDeadline *time.Timer
+}
+
+func (c *sshConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.WriteCloser.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return sshAddr("ssh") }
+func (c *sshConn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline sets both read and write deadlines. Pipes have no deadlines, so the connection is
+// closed when a deadline passes, failing pending reads and writes instead of timing them out
+func (c *sshConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(&c.readDeadline, t)
+	return nil
+}
+
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(&c.writeDeadline, t)
+	return nil
+}
+
+// setDeadline replaces `timer` with one closing the connection at `t`; a zero `t` means no deadline
+func (c *sshConn) setDeadline(timer **time.Timer, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !t.IsZero() {
+		*timer = time.AfterFunc(time.Until(t), func() { c.Close() })
+	}
+}
+
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
+
+// pqSSHDriver opens postgres connections with its dialer
+type pqSSHDriver struct {
+	dialer sshDialer
+}
+
+func (d pqSSHDriver) Open(name string) (driver.Conn, error) {
+	return pq.DialOpen(d.dialer, name)
+}
+
+// sshDriverURL returns the driver name and url that connect to `databaseURL` of `driverName` through `bastion`
+func sshDriverURL(bastion string, driverName string, databaseURL string) (string, string, error) {
+	dialer := sshDialer{bastion: bastion}
+	switch driverName {
+	case "postgres":
+		adapter, err := dbmigrate.AdapterFor(driverName)
+		if err != nil {
+			return "", "", err
+		}
+		name := "postgres-ssh:" + bastion // sql.Register panics if a name is registered twice
+		if !registered(name) {
+			sql.Register(name, pqSSHDriver{dialer: dialer})
+			dbmigrate.Register(name, adapter)
+		}
+		return name, databaseURL, nil
+	case "mysql":
+		// [user[:password]@][protocol[(address)]]/dbname[?param1=value1]; like mysql.ParseDSN, dbname
+		// is after the last `/`, since the password may contain `/`
+		slash := strings.LastIndex(databaseURL, "/")
+		if slash < 0 {
+			return "", "", errors.Errorf("invalid mysql dsn")
+		}
+		at := strings.LastIndex(databaseURL[:slash], "@") + 1
+		if !strings.HasPrefix(databaseURL[at:], "tcp(") {
+			return "", "", errors.Errorf("-ssh needs a tcp(host:port) address in mysql dsn")
+		}
+		mysql.RegisterDial("ssh", func(addr string) (net.Conn, error) {
+			return dialer.Dial("tcp", addr)
+		})
+		return driverName, databaseURL[:at] + "ssh(" + databaseURL[at+len("tcp("):], nil
+	}
+	return "", "", errors.Errorf("%q does not support -ssh", driverName)
+}
+
+// registered returns true if sql driver `name` is registered
+func registered(name string) bool {
+	for _, driverName := range sql.Drivers() {
+		if driverName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+var statusHeader = []string{"version", "direction", "applied_at", "duration_ms", "checksum", "applied_by", "remark", "run_id", "owner", "description"}
+
+// writeStatus writes history `entries` to `w` as text, csv or json; grouped by owner if `byOwner`
+func writeStatus(w io.Writer, format string, entries []dbmigrate.HistoryEntry, byOwner bool) error {
+	if byOwner {
+		entries = append([]dbmigrate.HistoryEntry(nil), entries...)
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i].Owner, entries[j].Owner
+			return a != b && (b == "" || (a != "" && a < b)) // files without owner last
+		})
+	}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(statusHeader)
+		for _, e := range entries {
+			writer.Write(statusRecord(e))
+		}
+		writer.Flush()
+		return writer.Error()
+	case "text":
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		writeRow := func(cols []string) {
+			fmt.Fprintln(writer, strings.Join(cols, "\t"))
+		}
+		writeRow(statusHeader)
+		for i, e := range entries {
+			if byOwner && (i == 0 || e.Owner != entries[i-1].Owner) {
+				owner := e.Owner
+				if owner == "" {
+					owner = "(no owner)"
+				}
+				fmt.Fprintln(writer, "#", owner)
+			}
+			writeRow(statusRecord(e))
+		}
+		return writer.Flush()
+	default:
+		return errors.Errorf("-format must be `text`, `csv` or `json`, got %q", format)
+	}
+}
+
+func statusRecord(e dbmigrate.HistoryEntry) []string {
+	appliedAt := ""
+	if !e.AppliedAt.IsZero() {
+		appliedAt = e.AppliedAt.Format(time.RFC3339Nano)
+	}
+	return []string{
+		e.Version,
+		e.Direction,
+		appliedAt,
+		strconv.FormatInt(e.Duration.Milliseconds(), 10),
+		e.Checksum,
+		e.AppliedBy,
+		e.Remark,
+		e.RunID,
+		e.Owner,
+		e.Description,
+	}
+}
+
+var runsHeader = []string{"run_id", "direction", "started_at", "applied_by", "versions", "meta", "position_before", "position_after"}
+
+// writeRuns writes `runs` to `w` as text, csv or json
+func writeRuns(w io.Writer, format string, runs []dbmigrate.Run) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(runs)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(runsHeader)
+		for _, r := range runs {
+			writer.Write(runRecord(r))
+		}
+		writer.Flush()
+		return writer.Error()
+	case "text":
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(runsHeader, "\t"))
+		for _, r := range runs {
+			fmt.Fprintln(writer, strings.Join(runRecord(r), "\t"))
+		}
+		return writer.Flush()
+	default:
+		return errors.Errorf("-format must be `text`, `csv` or `json`, got %q", format)
+	}
+}
+
+func runRecord(r dbmigrate.Run) []string {
+	keys := make([]string, 0, len(r.Meta))
+	for key := range r.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	meta := make([]string, 0, len(keys))
+	for _, key := range keys {
+		meta = append(meta, key+"="+r.Meta[key])
+	}
+	return []string{
+		r.ID,
+		r.Direction,
+		r.StartedAt.Format(time.RFC3339Nano),
+		r.AppliedBy,
+		strings.Join(r.Versions, " "),
+		strings.Join(meta, " "),
+		r.PositionBefore,
+		r.PositionAfter,
+	}
+}
+
+// runStatus writes the history of applied versions of `m` to `w`, or its runs if `runs`, see writeStatus and writeRuns
+func runStatus(ctx context.Context, w io.Writer, m *dbmigrate.Config, schema *string, format string, byOwner bool, runs bool) error {
+	if runs {
+		runs, err := m.Runs(ctx, schema)
+		if err != nil {
+			return err
+		}
+		return writeRuns(w, format, runs)
+	}
+	entries, err := m.History(ctx, schema)
+	if err != nil {
+		return err
+	}
+	return writeStatus(w, format, entries, byOwner)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// splitNames returns the non-blank names of a comma separated list
+func splitNames(s string) []string {
+	var result []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// tenantManifest lists `tenants` of `databaseURL` as targets of a manifest
+func tenantManifest(driverName string, databaseURL string, dirname string, tenants []string) (dbmigrate.Manifest, error) {
+	manifest := dbmigrate.Manifest{Policy: dbmigrate.ManifestPolicyStop}
+	adapter, err := dbmigrate.AdapterFor(driverName)
+	if err != nil {
+		return manifest, err
+	}
+	if adapter.TenantDatabaseURL == nil {
+		return manifest, errors.Errorf("%q does not support -tenants", driverName)
+	}
+	for _, tenant := range tenants {
+		tenantURL, err := adapter.TenantDatabaseURL(databaseURL, tenant)
+		if err != nil {
+			return manifest, errors.Wrapf(err, "tenant %q", tenant)
+		}
+		manifest.Targets = append(manifest.Targets, dbmigrate.ManifestTarget{Name: tenant, Driver: driverName, URL: tenantURL, Dir: dirname})
+	}
+	return manifest, nil
+}
+
+// canaryTargets splits targets of `manifest` into canaries, listed in `canary`, and the rest
+func canaryTargets(manifest dbmigrate.Manifest, canary []string) (canaries dbmigrate.Manifest, rest dbmigrate.Manifest, err error) {
+	canaries, rest = dbmigrate.Manifest{Policy: manifest.Policy}, dbmigrate.Manifest{Policy: manifest.Policy}
+	isCanary := map[string]bool{}
+	for _, name := range canary {
+		isCanary[name] = true
+	}
+	for _, t := range manifest.Targets {
+		if isCanary[t.Name] {
+			canaries.Targets = append(canaries.Targets, t)
+			delete(isCanary, t.Name)
+		} else {
+			rest.Targets = append(rest.Targets, t)
+		}
+	}
+	for name := range isCanary {
+		return canaries, rest, errors.Errorf("-canary %q is not in -tenants", name)
+	}
+	return canaries, rest, nil
+}
+
+// verifyTargets runs queries of `verifyFile` against each target of `manifest`
+func verifyTargets(ctx context.Context, manifest dbmigrate.Manifest, verifyFile string) error {
+	if verifyFile == "" {
+		return nil
+	}
+	sqlText, err := ioutil.ReadFile(verifyFile)
+	if err != nil {
+		return err
+	}
+	for _, t := range manifest.Targets {
+		m, err := dbmigrate.New(os.DirFS(t.Dir), t.Driver, t.URL)
+		if err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+		err = m.Verify(ctx, string(sqlText))
+		m.CloseDB()
+		if err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+		log.Println("[verified]", t.Name)
+	}
+	return nil
+}
+
+// runCanary migrates up `canary` targets and verifies them; with `promote`, checks canaries were
+// migrated by an earlier run, then migrates up the rest
+func runCanary(ctx context.Context, manifest dbmigrate.Manifest, canary []string, promote bool, verifyFile string, options []dbmigrate.Option, txOpts *sql.TxOptions, txnMode dbmigrate.DbTxnMode, preflight func(context.Context, *dbmigrate.Config, *string) error) error {
+	canaries, rest, err := canaryTargets(manifest, canary)
+	if err != nil {
+		return err
+	}
+	if !promote {
+		if err := runManifest(ctx, canaries, options, txOpts, txnMode, false, true, preflight); err != nil {
+			return err
+		}
+		if err := verifyTargets(ctx, canaries, verifyFile); err != nil {
+			return err
+		}
+		log.Println("[canary]", len(canaries.Targets), "tenant(s) migrated; run again with `-promote` to migrate", len(rest.Targets), "other tenant(s)")
+		return nil
+	}
+
+	for _, t := range canaries.Targets {
+		m, err := dbmigrate.New(os.DirFS(t.Dir), t.Driver, t.URL, options...)
+		if err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+		pending, err := m.PendingVersions(ctx, &t.Schema)
+		m.CloseDB()
+		if err != nil {
+			return errors.Wrapf(err, "target %q", t.Name)
+		}
+		if len(pending) > 0 {
+			return errors.Errorf("-promote: canary %q has %d pending version(s); run without `-promote` first", t.Name, len(pending))
+		}
+	}
+	if err := verifyTargets(ctx, canaries, verifyFile); err != nil {
+		return err
+	}
+	return runManifest(ctx, rest, options, txOpts, txnMode, false, true, preflight)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// mysqlTLSConfig names the tls.Config registered with the mysql driver by mysqlTLSDatabaseURL
+const mysqlTLSConfig = "dbmigrate"
+
+func init() {
+	adapter, err := dbmigrate.AdapterFor("mysql")
+	if err != nil {
+		return
+	}
+	adapter.TLSDatabaseURL = mysqlTLSDatabaseURL
+	dbmigrate.Register("mysql", adapter)
+}
+
+// mysqlTLSDatabaseURL registers `t` as a tls.Config with the mysql driver, and selects it in `databaseURL`
+func mysqlTLSDatabaseURL(databaseURL string, t dbmigrate.TLSOptions) (string, error) {
+	config := &tls.Config{ServerName: t.ServerName}
+	if t.RootCert != "" {
+		pem, err := ioutil.ReadFile(t.RootCert)
+		if err != nil {
+			return "", errors.Wrapf(err, "-sslrootcert")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return "", errors.Errorf("-sslrootcert: no certificates in %s", t.RootCert)
+		}
+	}
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return "", errors.Wrapf(err, "-sslcert and -sslkey")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if err := mysql.RegisterTLSConfig(mysqlTLSConfig, config); err != nil {
+		return "", err
+	}
+	separator := "?"
+	if strings.Contains(databaseURL, "?") {
+		separator = "&"
+	}
+	return databaseURL + separator + "tls=" + mysqlTLSConfig, nil
+}
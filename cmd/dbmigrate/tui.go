@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// tui is the interactive session of `dbmigrate tui`, e.g. for incident response
+type tui struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	dirname string
+	m       *dbmigrate.Config
+	opts    dbmigrate.MigrateOptions // Up and Down settings from flags
+	timeout time.Duration            // of each query or migration
+	check   func(ctx context.Context, up bool) error
+	nodes   []dbmigrate.GraphNode
+}
+
+const tuiHelp = "commands: <n> preview sql of file n, goto <n> migrate up or down to file n, goto 0 roll back all, r refresh, q quit"
+
+// runTUI lists the files of `dirname` as applied or pending, previews their sql, and migrates up
+// or down to a chosen file after confirmation, until `q` or end of `in`. `check` runs before
+// migrating, like the checks of `-up` and `-down`
+func runTUI(in io.Reader, out io.Writer, dirname string, m *dbmigrate.Config, opts dbmigrate.MigrateOptions, timeout time.Duration, check func(ctx context.Context, up bool) error) error {
+	t := &tui{in: bufio.NewScanner(in), out: out, dirname: dirname, m: m, opts: opts, timeout: timeout, check: check}
+	if err := t.refresh(); err != nil {
+		return err
+	}
+	for {
+		command, ok := t.prompt("> ")
+		if !ok {
+			return nil
+		}
+		action, arg := parseTUICommand(command)
+		var err error
+		switch action {
+		case tuiQuit:
+			return nil
+		case tuiRefresh:
+			err = t.refresh()
+		case tuiGoto:
+			if err = t.migrateTo(arg); err == nil {
+				err = t.refresh()
+			}
+		case tuiPreview:
+			err = t.preview(arg)
+		default:
+			fmt.Fprintln(t.out, tuiHelp)
+		}
+		if err != nil {
+			fmt.Fprintln(t.out, "error:", err)
+		}
+	}
+}
+
+// tuiAction is a command of the tui prompt
+type tuiAction int
+
+const (
+	tuiHelpAction tuiAction = iota
+	tuiQuit
+	tuiRefresh
+	tuiGoto
+	tuiPreview
+)
+
+// parseTUICommand returns the action of `command` typed at the prompt, and its file number if any
+func parseTUICommand(command string) (tuiAction, string) {
+	fields := strings.Fields(command)
+	switch {
+	case command == "q" || command == "quit":
+		return tuiQuit, ""
+	case command == "r" || command == "refresh":
+		return tuiRefresh, ""
+	case len(fields) == 2 && fields[0] == "goto":
+		return tuiGoto, fields[1]
+	case len(fields) == 1 && fields[0] != "?" && fields[0] != "help":
+		return tuiPreview, fields[0]
+	}
+	return tuiHelpAction, ""
+}
+
+// prompt writes `s` and returns the next line of input; false at end of input, e.g. ctrl-d
+func (t *tui) prompt(s string) (string, bool) {
+	fmt.Fprint(t.out, s)
+	if !t.in.Scan() {
+		fmt.Fprintln(t.out)
+		return "", false
+	}
+	return strings.TrimSpace(t.in.Text()), true
+}
+
+// refresh queries applied versions and lists the files
+func (t *tui) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	applied, err := t.m.AppliedVersions(ctx, t.opts.Schema)
+	if err != nil {
+		return err
+	}
+	if t.nodes, err = dbmigrate.Graph(os.DirFS(t.dirname), applied); err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(t.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "#\tversion\tstatus\tphase\tname\tdescription")
+	for i, n := range t.nodes {
+		status := "pending"
+		if n.Applied {
+			status = "applied"
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, n.Version, status, n.Phase, n.Name, n.Description)
+	}
+	writer.Flush()
+	fmt.Fprintln(t.out, tuiHelp)
+	return nil
+}
+
+// selectNode returns the file numbered `arg` in the list of `nodes`, or nil for `0`
+func selectNode(nodes []dbmigrate.GraphNode, arg string) (*dbmigrate.GraphNode, error) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 0 || i > len(nodes) {
+		return nil, errors.Errorf("no file numbered %q; choose 1 to %d", arg, len(nodes))
+	}
+	if i == 0 {
+		return nil, nil
+	}
+	return &nodes[i-1], nil
+}
+
+// preview writes the sql of the `.up.sql` file numbered `arg`, and of its `.down.sql` file if any
+func (t *tui) preview(arg string) error {
+	n, err := selectNode(t.nodes, arg)
+	if err != nil || n == nil {
+		return err
+	}
+	for _, filename := range []string{n.Filename, strings.TrimSuffix(n.Filename, "up.sql") + "down.sql"} {
+		content, err := os.ReadFile(filepath.Join(t.dirname, filename))
+		if os.IsNotExist(err) && filename != n.Filename {
+			fmt.Fprintln(t.out, "--", filename, "does not exist")
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintln(t.out, "--", filename)
+		fmt.Fprintln(t.out, strings.TrimRight(string(content), "\n"))
+	}
+	return nil
+}
+
+// A tuiPlan lists the files that `goto` would apply, or roll back newest first
+type tuiPlan struct {
+	target    string // version to migrate to, `0` to roll back all
+	up        bool
+	filenames []string
+}
+
+// planGoto returns the plan to apply pending files of `nodes` up to the file numbered `arg`, or
+// roll back applied files after it; files on both sides would change is an error
+func planGoto(nodes []dbmigrate.GraphNode, arg string) (tuiPlan, error) {
+	n, err := selectNode(nodes, arg)
+	if err != nil {
+		return tuiPlan{}, err
+	}
+	plan := tuiPlan{target: "0"}
+	if n != nil {
+		plan.target = n.Version
+	}
+	var up, down []string
+	for _, node := range nodes {
+		switch {
+		case !node.Applied && node.Version <= plan.target:
+			up = append(up, node.Filename)
+		case node.Applied && node.Version > plan.target:
+			down = append(down, strings.TrimSuffix(node.Filename, "up.sql")+"down.sql")
+		}
+	}
+	if len(up) > 0 && len(down) > 0 {
+		return tuiPlan{}, errors.Errorf("%d file(s) before and %d file(s) after %s would change; goto an applied or a pending file", len(up), len(down), plan.target)
+	}
+	plan.up, plan.filenames = len(down) == 0, up
+	for i := len(down) - 1; i >= 0; i-- {
+		plan.filenames = append(plan.filenames, down[i]) // newest first
+	}
+	return plan, nil
+}
+
+// migrateTo applies pending files up to the file numbered `arg`, or rolls back applied files
+// after it, once the operator confirms the list of files
+func (t *tui) migrateTo(arg string) error {
+	plan, err := planGoto(t.nodes, arg)
+	if err != nil {
+		return err
+	}
+	if len(plan.filenames) == 0 {
+		fmt.Fprintln(t.out, "nothing to do")
+		return nil
+	}
+	direction := "apply"
+	if !plan.up {
+		direction = "roll back with"
+	}
+	fmt.Fprintf(t.out, "%s %d file(s):\n  %s\n", direction, len(plan.filenames), strings.Join(plan.filenames, "\n  "))
+	if answer, _ := t.prompt("type yes to proceed: "); answer != "yes" {
+		fmt.Fprintln(t.out, "cancelled")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	if err := t.check(ctx, plan.up); err != nil {
+		return err
+	}
+	opts := t.opts
+	opts.Target = plan.target
+	if !plan.up {
+		opts.AfterFile = filenameLogger("[down]")
+		return t.m.Down(ctx, opts)
+	}
+	opts.AfterFile = filenameLogger("[up]")
+	return t.m.Up(ctx, opts)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTUICommand(t *testing.T) {
+	testCases := []struct {
+		given          string
+		expectedAction tuiAction
+		expectedArg    string
+	}{
+		{given: "q", expectedAction: tuiQuit},
+		{given: "quit", expectedAction: tuiQuit},
+		{given: "r", expectedAction: tuiRefresh},
+		{given: "goto 3", expectedAction: tuiGoto, expectedArg: "3"},
+		{given: "goto  0", expectedAction: tuiGoto, expectedArg: "0"},
+		{given: "2", expectedAction: tuiPreview, expectedArg: "2"},
+		{given: "?", expectedAction: tuiHelpAction},
+		{given: "help", expectedAction: tuiHelpAction},
+		{given: "", expectedAction: tuiHelpAction},
+		{given: "goto", expectedAction: tuiPreview, expectedArg: "goto"},
+		{given: "goto 1 2", expectedAction: tuiHelpAction},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			action, arg := parseTUICommand(tc.given)
+			assert.Equal(t, tc.expectedAction, action)
+			assert.Equal(t, tc.expectedArg, arg)
+		})
+	}
+}
+
+func TestPlanGoto(t *testing.T) {
+	nodes := []dbmigrate.GraphNode{
+		{Version: "20240101000000", Filename: "20240101000000_a.up.sql", Applied: true},
+		{Version: "20240102000000", Filename: "20240102000000_b.up.sql", Applied: true},
+		{Version: "20240103000000", Filename: "20240103000000_c.up.sql"},
+		{Version: "20240104000000", Filename: "20240104000000_d.up.sql"},
+	}
+	testCases := []struct {
+		name          string
+		nodes         []dbmigrate.GraphNode
+		arg           string
+		expected      tuiPlan
+		expectedError string
+	}{
+		{
+			name:     fileline(),
+			nodes:    nodes,
+			arg:      "4",
+			expected: tuiPlan{target: "20240104000000", up: true, filenames: []string{"20240103000000_c.up.sql", "20240104000000_d.up.sql"}},
+		},
+		{
+			name:     fileline(),
+			nodes:    nodes,
+			arg:      "0",
+			expected: tuiPlan{target: "0", filenames: []string{"20240102000000_b.down.sql", "20240101000000_a.down.sql"}},
+		},
+		{
+			name:     fileline(),
+			nodes:    nodes,
+			arg:      "1",
+			expected: tuiPlan{target: "20240101000000", filenames: []string{"20240102000000_b.down.sql"}},
+		},
+		{
+			name:     fileline(),
+			nodes:    nodes,
+			arg:      "2",
+			expected: tuiPlan{target: "20240102000000", up: true},
+		},
+		{
+			name: fileline(),
+			nodes: []dbmigrate.GraphNode{
+				{Version: "20240101000000", Filename: "20240101000000_a.up.sql"},
+				{Version: "20240102000000", Filename: "20240102000000_b.up.sql", Applied: true},
+			},
+			arg:           "1",
+			expectedError: "1 file(s) before and 1 file(s) after 20240101000000 would change; goto an applied or a pending file",
+		},
+		{
+			name:          fileline(),
+			nodes:         nodes,
+			arg:           "5",
+			expectedError: `no file numbered "5"; choose 1 to 4`,
+		},
+		{
+			name:          fileline(),
+			nodes:         nodes,
+			arg:           "b",
+			expectedError: `no file numbered "b"; choose 1 to 4`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := planGoto(tc.nodes, tc.arg)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, plan)
+		})
+	}
+}
+
+func TestTUIPreview(t *testing.T) {
+	dirname := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dirname, "20240101000000_a.up.sql"), []byte("CREATE TABLE a (id int);\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dirname, "20240101000000_a.down.sql"), []byte("DROP TABLE a;\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dirname, "20240102000000_b.up.sql"), []byte("SELECT 1;\n"), 0644))
+
+	var out bytes.Buffer
+	tui := &tui{out: &out, dirname: dirname, nodes: []dbmigrate.GraphNode{
+		{Version: "20240101000000", Filename: "20240101000000_a.up.sql"},
+		{Version: "20240102000000", Filename: "20240102000000_b.up.sql"},
+	}}
+	assert.NoError(t, tui.preview("1"))
+	assert.NoError(t, tui.preview("2"))
+	assert.Equal(t, `-- 20240101000000_a.up.sql
+CREATE TABLE a (id int);
+-- 20240101000000_a.down.sql
+DROP TABLE a;
+-- 20240102000000_b.up.sql
+SELECT 1;
+-- 20240102000000_b.down.sql does not exist
+`, out.String())
+}
@@ -0,0 +1,69 @@
+package dbmigrate
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// A VersionDifference is a version applied to only one of two databases, or applied to both from
+// files of different checksums, see Compare
+type VersionDifference struct {
+	Version   string `json:"version"`
+	AppliedA  bool   `json:"applied_a"`
+	AppliedB  bool   `json:"applied_b"`
+	ChecksumA string `json:"checksum_a,omitempty"` // of the file last applied, as recorded in history; "" if unknown
+	ChecksumB string `json:"checksum_b,omitempty"`
+}
+
+// Compare returns the versions that differ between the databases of `a` and `b`, in ascending order,
+// e.g. to tell whether staging is ahead of production. Checksums are compared only if both are recorded
+func Compare(ctx context.Context, a *Config, b *Config, schema *string) ([]VersionDifference, error) {
+	checksumsA, err := a.appliedChecksums(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query versions of a")
+	}
+	checksumsB, err := b.appliedChecksums(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query versions of b")
+	}
+	var result []VersionDifference
+	for version, checksumA := range checksumsA {
+		checksumB, ok := checksumsB[version]
+		if ok && (checksumA == "" || checksumB == "" || checksumA == checksumB) {
+			continue
+		}
+		result = append(result, VersionDifference{Version: version, AppliedA: true, AppliedB: ok, ChecksumA: checksumA, ChecksumB: checksumB})
+	}
+	for version, checksumB := range checksumsB {
+		if _, ok := checksumsA[version]; !ok {
+			result = append(result, VersionDifference{Version: version, AppliedB: true, ChecksumB: checksumB})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// appliedChecksums returns applied versions with the checksum of the file last applied for each; ""
+// if history has none, e.g. applied by an older release
+func (c *Config) appliedChecksums(ctx context.Context, schema *string) (map[string]string, error) {
+	applied, err := c.AppliedVersions(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for _, version := range applied {
+		result[version] = ""
+	}
+	entries, err := c.store.History(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if _, ok := result[entry.Version]; ok && entry.Direction == directionUp {
+			result[entry.Version] = entry.Checksum // oldest first, so the last applied wins
+		}
+	}
+	return result, nil
+}
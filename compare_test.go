@@ -0,0 +1,64 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a        fakeStore
+		b        fakeStore
+		expected []VersionDifference
+	}{
+		{
+			name: fileline(),
+			a:    fakeStore{versions: []string{"20181222073750"}, entries: []HistoryEntry{{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"}}},
+			b:    fakeStore{versions: []string{"20181222073750"}, entries: []HistoryEntry{{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"}}},
+		},
+		{
+			name: fileline(),
+			a: fakeStore{versions: []string{"20181222073750", "20181222073900"}, entries: []HistoryEntry{
+				{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"},
+				{Version: "20181222073900", Direction: directionUp, Checksum: "bbb"},
+			}},
+			b: fakeStore{versions: []string{"20181222073750", "20181222073800"}},
+			expected: []VersionDifference{
+				{Version: "20181222073800", AppliedB: true},
+				{Version: "20181222073900", AppliedA: true, ChecksumA: "bbb"},
+			},
+		},
+		{
+			name: fileline(),
+			a: fakeStore{versions: []string{"20181222073750"}, entries: []HistoryEntry{
+				{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"},
+				{Version: "20181222073750", Direction: directionDown, Checksum: "ddd"},
+				{Version: "20181222073750", Direction: directionUp, Checksum: "ccc"},
+			}},
+			b:        fakeStore{versions: []string{"20181222073750"}, entries: []HistoryEntry{{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"}}},
+			expected: []VersionDifference{{Version: "20181222073750", AppliedA: true, AppliedB: true, ChecksumA: "ccc", ChecksumB: "aaa"}},
+		},
+		{
+			name: fileline(),
+			a: fakeStore{versions: []string{}, entries: []HistoryEntry{
+				{Version: "20181222073750", Direction: directionUp, Checksum: "aaa"},
+				{Version: "20181222073750", Direction: directionDown, Checksum: "ddd"},
+			}},
+			b:        fakeStore{versions: []string{"20181222073750"}},
+			expected: []VersionDifference{{Version: "20181222073750", AppliedB: true}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := &Config{store: &tc.a}, &Config{store: &tc.b}
+			actual, err := Compare(context.Background(), a, b, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
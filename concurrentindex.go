@@ -0,0 +1,91 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var createIndexConcurrently = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)\s+ON\s`)
+
+// concurrentIndexName returns the index created by `filecontent` of a file with `-- dbmigrate:concurrent-index`
+// directive, which must be a single `CREATE INDEX CONCURRENTLY` statement
+func concurrentIndexName(filecontent []byte) (string, error) {
+	var name string
+	for _, stmt := range splitStatements(string(filecontent)) {
+		if isBlankStatement(stmt) {
+			continue
+		}
+		m := createIndexConcurrently.FindStringSubmatch(strings.TrimSpace(stripBlockComments(lintLineComments.ReplaceAllString(stmt, ""))))
+		if m == nil {
+			return "", errors.Errorf("`concurrent-index` directive requires a `CREATE INDEX CONCURRENTLY <name> ON ...` statement")
+		}
+		if name != "" {
+			return "", errors.Errorf("`concurrent-index` directive requires a single statement, so a failed attempt can be retried")
+		}
+		name = m[1]
+	}
+	if name == "" {
+		return "", errors.Errorf("`concurrent-index` directive requires a `CREATE INDEX CONCURRENTLY <name> ON ...` statement")
+	}
+	return name, nil
+}
+
+// indexValid returns whether index `name` is valid, and false if it does not exist
+func (c *Config) indexValid(ctx context.Context, name string) (valid bool, found bool, err error) {
+	var value interface{}
+	switch err := c.db.QueryRowContext(ctx, c.adapter.IndexValidQuery, name).Scan(&value); err {
+	case nil:
+		return truthy(value), true, nil
+	case sql.ErrNoRows:
+		return false, false, nil
+	default:
+		return false, false, errors.Wrapf(err, "unable to check index %s", name)
+	}
+}
+
+// prepareConcurrentIndex returns the index of a file with `-- dbmigrate:concurrent-index` directive, after
+// dropping it if an earlier attempt left it invalid, e.g. failed or interrupted, so it is created again
+// instead of skipped by `IF NOT EXISTS` or failing as a duplicate
+func (c *Config) prepareConcurrentIndex(ctx context.Context, mode DbTxnMode, filename string, filecontent []byte) (string, error) {
+	if c.adapter.IndexValidQuery == "" || c.adapter.DropIndexQuery == nil {
+		return "", errors.Errorf("database does not support `concurrent-index` directive")
+	}
+	if mode != DbTxnModeNone {
+		return "", errors.Errorf("`concurrent-index` directive cannot run inside a transaction, requires transaction mode %q", DbTxnModeNone)
+	}
+	name, err := concurrentIndexName(filecontent)
+	if err != nil {
+		return "", err
+	}
+	valid, found, err := c.indexValid(ctx, name)
+	if err != nil || !found || valid {
+		return name, err
+	}
+	c.logger("[concurrent-index] dropping invalid index", name, "left by an earlier attempt")
+	if _, err := c.exec(ctx, Statement{Filename: filename, SQL: c.adapter.DropIndexQuery(name), Mode: mode, Tx: &noTx{db: c.db}}); err != nil {
+		return "", errors.Wrapf(err, "unable to drop invalid index %s", name)
+	}
+	return name, nil
+}
+
+// verifyConcurrentIndex returns an error unless index `name` was created valid; an invalid index is
+// dropped so the file can be applied again
+func (c *Config) verifyConcurrentIndex(ctx context.Context, mode DbTxnMode, filename string, name string) error {
+	valid, found, err := c.indexValid(ctx, name)
+	switch {
+	case err != nil:
+		return err
+	case !found:
+		return errors.Errorf("index %s was not created", name)
+	case valid:
+		return nil
+	}
+	if _, err := c.exec(ctx, Statement{Filename: filename, SQL: c.adapter.DropIndexQuery(name), Mode: mode, Tx: &noTx{db: c.db}}); err != nil {
+		return errors.Wrapf(err, "index %s is invalid, and unable to drop it", name)
+	}
+	return errors.Errorf("index %s is invalid, e.g. a unique violation, and was dropped; fix the cause and apply again", name)
+}
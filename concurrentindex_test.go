@@ -0,0 +1,135 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentIndexName(t *testing.T) {
+	testCases := []struct {
+		name        string
+		given       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:concurrent-index\nCREATE INDEX CONCURRENTLY users_email ON users (email);\n",
+			expected: "users_email",
+		},
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:concurrent-index\ncreate unique index concurrently if not exists public.\"Users_email\" on users (email)",
+			expected: "public.\"Users_email\"",
+		},
+		{
+			name:        fileline(),
+			given:       "-- dbmigrate:concurrent-index\nCREATE INDEX users_email ON users (email);",
+			expectedErr: "`concurrent-index` directive requires a `CREATE INDEX CONCURRENTLY <name> ON ...` statement",
+		},
+		{
+			name:        fileline(),
+			given:       "CREATE INDEX CONCURRENTLY ON users (email);",
+			expectedErr: "`concurrent-index` directive requires a `CREATE INDEX CONCURRENTLY <name> ON ...` statement",
+		},
+		{
+			name:        fileline(),
+			given:       "CREATE INDEX CONCURRENTLY a ON users (email);\nCREATE INDEX CONCURRENTLY b ON users (name);",
+			expectedErr: "`concurrent-index` directive requires a single statement, so a failed attempt can be retried",
+		},
+		{
+			name:        fileline(),
+			given:       "-- dbmigrate:concurrent-index\n",
+			expectedErr: "`concurrent-index` directive requires a `CREATE INDEX CONCURRENTLY <name> ON ...` statement",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := concurrentIndexName([]byte(tc.given))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestConcurrentIndexDirective(t *testing.T) {
+	const createIndex = "-- dbmigrate:concurrent-index\nCREATE INDEX CONCURRENTLY IF NOT EXISTS users_email ON users (email);"
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte(createIndex)},
+	}
+	testCases := []struct {
+		name          string
+		validValues   string // selected by IndexValidQuery before and after creation, see fakeValuesDriver
+		mode          DbTxnMode
+		expectedSQL   []string
+		expectedError string
+	}{
+		{
+			name:        fileline(),
+			validValues: "1",
+			mode:        DbTxnModeNone,
+			expectedSQL: []string{createIndex},
+		},
+		{
+			name:        fileline(),
+			validValues: "0,1",
+			mode:        DbTxnModeNone,
+			expectedSQL: []string{
+				"DROP INDEX users_email",
+				createIndex,
+			},
+		},
+		{
+			name:        fileline(),
+			validValues: "1,0",
+			mode:        DbTxnModeNone,
+			expectedSQL: []string{
+				createIndex,
+				"DROP INDEX users_email",
+			},
+			expectedError: "20181222073750_a.up.sql: index users_email is invalid, e.g. a unique violation, and was dropped; fix the cause and apply again",
+		},
+		{
+			name:          fileline(),
+			validValues:   "1",
+			mode:          DbTxnModePerFile,
+			expectedError: "20181222073750_a.up.sql: `concurrent-index` directive cannot run inside a transaction, requires transaction mode \"none\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, fakeValues(tc.validValues))
+
+			var executed []string
+			c := &Config{dir: dir, db: db, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.adapter.IndexValidQuery = "valid"
+			c.adapter.DropIndexQuery = func(name string) string { return "DROP INDEX " + name }
+			c.adapter.BeginTx = func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error) {
+				return &noTx{db: db}, nil
+			}
+			WithMiddleware(func(next Executor) Executor {
+				return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+					executed = append(executed, stmt.SQL)
+					return next.Exec(ctx, stmt)
+				})
+			})(c)
+			c.migrationFiles = []string{"20181222073750_a.up.sql"}
+
+			err := c.Up(context.Background(), MigrateOptions{Mode: tc.mode})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedSQL, executed)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSingleConnectionLost is returned in single connection mode when the pinned connection
+// had to be replaced, since session state (locks, variables) would not carry over
+var ErrSingleConnectionLost = errors.Errorf("single connection to database was lost; session state would not carry over")
+
+// openDB returns an sql.DB that runs `afterConnect`, if any, on each new connection; with `single`,
+// it only ever opens one connection
+func openDB(driverName string, databaseURL string, single bool, afterConnect func(context.Context, driver.Conn) error) (*sql.DB, error) {
+	if !single && afterConnect == nil {
+		return sql.Open(driverName, databaseURL)
+	}
+	db, err := sql.Open(driverName, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	var connector driver.Connector = &dsnConnector{dsn: databaseURL, driver: drv}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(databaseURL); err != nil {
+			return nil, err
+		}
+	}
+	if afterConnect != nil {
+		connector = &afterConnectConnector{Connector: connector, afterConnect: afterConnect}
+	}
+	if !single {
+		return sql.OpenDB(connector), nil
+	}
+
+	db = sql.OpenDB(&singleConnector{Connector: connector})
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return db, nil
+}
+
+// afterConnectConnector runs `afterConnect` on each new connection before it is used
+type afterConnectConnector struct {
+	driver.Connector
+	afterConnect func(context.Context, driver.Conn) error
+}
+
+func (a *afterConnectConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := a.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.afterConnect(ctx, conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "after connect")
+	}
+	return conn, nil
+}
+
+// ExecOnConnect returns an Adapter.AfterConnect hook executing `statements` on each new
+// connection, e.g. `SET SESSION sql_require_primary_key=0` or `PRAGMA foreign_keys = ON`
+func ExecOnConnect(statements ...string) func(context.Context, driver.Conn) error {
+	return func(ctx context.Context, conn driver.Conn) error {
+		for _, stmt := range statements {
+			if err := execConn(ctx, conn, stmt); err != nil {
+				return errors.Wrapf(err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// execConn executes `query` on a driver connection without arguments
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// setRole returns an AfterConnect hook switching the session to `role` with the SetRoleQuery of
+// `adapter`, then checking it with CheckRoleQuery
+func setRole(adapter Adapter, role string) func(context.Context, driver.Conn) error {
+	return func(ctx context.Context, conn driver.Conn) error {
+		query := adapter.SetRoleQuery(role)
+		if err := execConn(ctx, conn, query); err != nil {
+			return errors.Wrapf(err, query)
+		}
+		ok, err := queryConnTruthy(ctx, conn, adapter.CheckRoleQuery(role))
+		if err != nil {
+			return errors.Wrapf(err, "unable to check role %q", role)
+		}
+		if !ok {
+			return errors.Errorf("session is not running as role %q after %s", role, query)
+		}
+		return nil
+	}
+}
+
+// queryConnTruthy is queryTruthy on a driver connection without arguments
+func queryConnTruthy(ctx context.Context, conn driver.Conn, query string) (bool, error) {
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		rows, err := queryer.QueryContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			if err != nil {
+				return false, err
+			}
+			return firstValueTruthy(rows)
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(nil)
+	if err != nil {
+		return false, err
+	}
+	return firstValueTruthy(rows)
+}
+
+func firstValueTruthy(rows driver.Rows) (bool, error) {
+	defer rows.Close()
+	values := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(values); err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(values) > 0 && truthy(values[0]), nil
+}
+
+// singleConnector connects once; any later attempt means the first connection was discarded
+type singleConnector struct {
+	driver.Connector
+	mu        sync.Mutex
+	connected bool
+}
+
+func (s *singleConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connected {
+		return nil, ErrSingleConnectionLost
+	}
+	conn, err := s.Connector.Connect(ctx)
+	if err == nil {
+		s.connected = true
+	}
+	return conn, err
+}
+
+// dsnConnector is a driver.Connector for drivers that do not implement driver.DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,140 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConnector struct {
+	driver.Connector
+	count int
+}
+
+func (f *fakeConnector) Connect(_ context.Context) (driver.Conn, error) {
+	f.count++
+	return nil, nil
+}
+
+func TestSingleConnector(t *testing.T) {
+	fake := &fakeConnector{}
+	connector := &singleConnector{Connector: fake}
+
+	_, err := connector.Connect(context.Background())
+	assert.NoError(t, err)
+	_, err = connector.Connect(context.Background())
+	assert.Equal(t, ErrSingleConnectionLost, err)
+	assert.Equal(t, 1, fake.count, "should not reconnect")
+}
+
+// fakeExecerConn records statements executed on it
+type fakeExecerConn struct {
+	driver.Conn
+	statements []string
+	closed     bool
+}
+
+func (f *fakeExecerConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if query == "bogus" {
+		return nil, errors.New("syntax error")
+	}
+	f.statements = append(f.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (f *fakeExecerConn) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeExecerConnector struct {
+	driver.Connector
+	conn *fakeExecerConn
+}
+
+func (f *fakeExecerConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return f.conn, nil
+}
+
+func TestAfterConnectConnector(t *testing.T) {
+	fake := &fakeExecerConnector{conn: &fakeExecerConn{}}
+	connector := &afterConnectConnector{Connector: fake, afterConnect: ExecOnConnect("SET a = 1", "SET b = 2")}
+
+	conn, err := connector.Connect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, fake.conn, conn)
+	assert.Equal(t, []string{"SET a = 1", "SET b = 2"}, fake.conn.statements)
+
+	fake.conn = &fakeExecerConn{}
+	connector.afterConnect = ExecOnConnect("bogus")
+	_, err = connector.Connect(context.Background())
+	assert.EqualError(t, err, "after connect: bogus: syntax error")
+	assert.True(t, fake.conn.closed, "should close connection that failed")
+}
+
+func TestWithAfterConnect(t *testing.T) {
+	var calls []string
+	hook := func(name string) func(context.Context, driver.Conn) error {
+		return func(context.Context, driver.Conn) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	c := &Config{adapter: Adapter{AfterConnect: hook("adapter")}}
+	WithAfterConnect(hook("option"))(c)
+	assert.NoError(t, c.adapter.AfterConnect(context.Background(), nil))
+	assert.Equal(t, []string{"adapter", "option"}, calls)
+}
+
+// fakeRoleConn runs as the role of its last `SET ROLE` statement
+type fakeRoleConn struct {
+	fakeExecerConn
+	role string
+}
+
+func (f *fakeRoleConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.HasPrefix(query, "SET ROLE ") && query != "SET ROLE ignored" {
+		f.role = strings.TrimPrefix(query, "SET ROLE ")
+	}
+	return f.fakeExecerConn.ExecContext(ctx, query, args)
+}
+
+func (f *fakeRoleConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRowsCursor{fakeRows{columns: []string{"value"}, values: [][]driver.Value{{query == "SELECT current_user = "+f.role}}}}, nil
+}
+
+func TestSetRole(t *testing.T) {
+	adapter := Adapter{
+		SetRoleQuery:   func(role string) string { return "SET ROLE " + role },
+		CheckRoleQuery: func(role string) string { return "SELECT current_user = " + role },
+	}
+	testCases := []struct {
+		name          string
+		role          string
+		expectedError string
+	}{
+		{
+			name: fileline(),
+			role: "app",
+		},
+		{
+			name:          fileline(),
+			role:          "ignored",
+			expectedError: `session is not running as role "ignored" after SET ROLE ignored`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := setRole(adapter, tc.role)(context.Background(), &fakeRoleConn{})
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// preparer is a transaction that prepares statements, e.g. *sql.Tx
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// copySource is a `-- dbmigrate:copy <table> from <file>` directive
+type copySource struct {
+	table    string
+	filename string // `.csv` or `.tsv` file in `dir`, relative to the migration file
+}
+
+// parseCopySources returns the sources of `value` of `copy` directives, of the migration file `currName`
+func parseCopySources(currName string, value string) ([]copySource, error) {
+	var result []copySource
+	for _, directive := range strings.Split(value, ",") {
+		fields := strings.Fields(directive)
+		if len(fields) != 3 || strings.ToLower(fields[1]) != "from" {
+			return nil, errors.Errorf("`copy` directive must be `-- dbmigrate:copy <table> from <file>`, got %q", strings.TrimSpace(directive))
+		}
+		if err := ValidateIdentifier(strings.ReplaceAll(fields[0], ".", "_")); err != nil {
+			return nil, errors.Wrapf(err, "`copy` directive")
+		}
+		if ext := path.Ext(fields[2]); ext != ".csv" && ext != ".tsv" {
+			return nil, errors.Errorf("`copy` directive requires a `.csv` or `.tsv` file, got %q", fields[2])
+		}
+		result = append(result, copySource{table: fields[0], filename: path.Join(path.Dir(currName), fields[2])})
+	}
+	return result, nil
+}
+
+// copyFiles streams the rows of each file of `copy` directives of `currName` into its table inside `tx`, after
+// the statements of the file, e.g. to seed large tables without gigantic INSERT statements. The first line of
+// each file names the columns; empty values are NULL
+func (c *Config) copyFiles(ctx context.Context, tx ExecCommitRollbacker, mode DbTxnMode, currName string, value string, fileResult *FileResult) error {
+	copyFile := c.copyFile
+	switch {
+	case c.adapter.CopyFromQuery != nil:
+		if _, ok := tx.(preparer); mode == DbTxnModeNone || !ok {
+			return errors.Errorf("`copy` directive requires a transaction, not transaction mode %q", mode)
+		}
+	case c.adapter.LoadDataQuery != nil:
+		if c.registerReader == nil {
+			return errors.Errorf("`copy` directive requires local infile to be enabled, see WithLocalInfile")
+		}
+		copyFile = c.loadDataFile
+	default:
+		return errors.Errorf("database does not support `copy` directive")
+	}
+	sources, err := parseCopySources(currName, value)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		rows, err := copyFile(ctx, tx, source)
+		if err != nil {
+			return errors.Wrapf(err, "copy %s from %s", source.table, source.filename)
+		}
+		fileResult.RowsAffected += rows
+		fileResult.Statements = append(fileResult.Statements, StatementResult{SQL: "-- copy " + source.table + " from " + source.filename, RowsAffected: rows})
+	}
+	return nil
+}
+
+// copyReader returns a reader of the csv or tsv `filename`
+func copyReader(r io.Reader, filename string) *csv.Reader {
+	reader := csv.NewReader(r)
+	if path.Ext(filename) == ".tsv" {
+		reader.Comma, reader.LazyQuotes = '\t', true
+	}
+	reader.ReuseRecord = true
+	return reader
+}
+
+// copyHeader returns the column names of the first line of `reader`
+func copyHeader(reader *csv.Reader) ([]string, error) {
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.Errorf("missing header of column names")
+	} else if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), header...), nil
+}
+
+// copyFile streams the rows of `source` with CopyFromQuery, returning how many were copied
+func (c *Config) copyFile(ctx context.Context, tx ExecCommitRollbacker, source copySource) (int64, error) {
+	f, err := c.dir.Open(source.filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader := copyReader(f, source.filename)
+	columns, err := copyHeader(reader)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.(preparer).PrepareContext(ctx, c.adapter.CopyFromQuery(source.table, columns))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	var count int64
+	args := make([]interface{}, len(columns))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+		for i, value := range record {
+			if value == "" {
+				args[i] = nil
+			} else {
+				args[i] = value
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return count, errors.Wrapf(err, "line %d", count+2)
+		}
+		count++
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil { // flushes the rows
+		return count, err
+	}
+	return count, nil
+}
+
+// loadDataReaders counts readers registered with WithLocalInfile, to name each uniquely
+var loadDataReaders int64
+
+// loadDataFile loads the rows of `source` with LoadDataQuery from a reader registered for the
+// duration of the statement, returning how many were loaded
+func (c *Config) loadDataFile(ctx context.Context, tx ExecCommitRollbacker, source copySource) (int64, error) {
+	f, err := c.dir.Open(source.filename)
+	if err != nil {
+		return 0, err
+	}
+	columns, err := copyHeader(copyReader(f, source.filename))
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	data, err := c.dir.Open(source.filename)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+	name := "dbmigrate-" + strconv.FormatInt(atomic.AddInt64(&loadDataReaders, 1), 10)
+	c.registerReader(name, func() io.Reader { return struct{ io.Reader }{data} }) // hides Close from the driver
+	defer c.deregisterReader(name)
+	result, err := tx.ExecContext(ctx, c.adapter.LoadDataQuery(name, source.table, columns, path.Ext(source.filename) == ".tsv"))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
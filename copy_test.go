@@ -0,0 +1,191 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// preparingTx is a recordingTx that prepares statements, like *sql.Tx
+type preparingTx struct {
+	recordingTx
+}
+
+func (tx *preparingTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.db.PrepareContext(ctx, query)
+}
+
+func TestParseCopySources(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      []copySource
+		expectedError string
+	}{
+		{
+			name:     fileline(),
+			value:    "countries from countries.csv",
+			expected: []copySource{{table: "countries", filename: "seeds/countries.csv"}},
+		},
+		{
+			name:  fileline(),
+			value: "public.countries FROM data/countries.tsv,cities from cities.csv",
+			expected: []copySource{
+				{table: "public.countries", filename: "seeds/data/countries.tsv"},
+				{table: "cities", filename: "seeds/cities.csv"},
+			},
+		},
+		{
+			name:          fileline(),
+			value:         "countries countries.csv",
+			expectedError: "`copy` directive must be `-- dbmigrate:copy <table> from <file>`, got \"countries countries.csv\"",
+		},
+		{
+			name:          fileline(),
+			value:         "countries from countries.json",
+			expectedError: "`copy` directive requires a `.csv` or `.tsv` file, got \"countries.json\"",
+		},
+		{
+			name:          fileline(),
+			value:         "countries;drop from countries.csv",
+			expectedError: "`copy` directive: identifier \"countries;drop\" has unexpected character ';' at position 10",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseCopySources("seeds/20181222073750_a.up.sql", tc.value)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCopyDirective(t *testing.T) {
+	copying := Adapter{CopyFromQuery: pgCopyFromQuery}
+	loading := Adapter{LoadDataQuery: mysqlLoadDataQuery}
+	testCases := []struct {
+		name          string
+		adapter       Adapter
+		mode          DbTxnMode
+		localInfile   bool
+		seed          string
+		expectedLog   []string // statements, then data read by the driver
+		expectedRows  int64
+		expectedError string
+	}{
+		{
+			name:    fileline(),
+			adapter: copying,
+			mode:    DbTxnModePerFile,
+			seed:    "code,Name\nsg,Singapore\nxx,\n",
+			expectedLog: []string{
+				`COPY "countries" ("code", "name") FROM STDIN [sg Singapore]`,
+				`COPY "countries" ("code", "name") FROM STDIN [xx <nil>]`,
+				`COPY "countries" ("code", "name") FROM STDIN`,
+			},
+			expectedRows: 2,
+		},
+		{
+			name:          fileline(),
+			adapter:       copying,
+			mode:          DbTxnModePerFile,
+			seed:          "code,name\nsg\n",
+			expectedError: "20181222073750_a.up.sql: copy countries from countries.csv: record on line 2: wrong number of fields",
+		},
+		{
+			name:          fileline(),
+			adapter:       copying,
+			mode:          DbTxnModePerFile,
+			seed:          "",
+			expectedError: "20181222073750_a.up.sql: copy countries from countries.csv: missing header of column names",
+		},
+		{
+			name:          fileline(),
+			adapter:       copying,
+			mode:          DbTxnModeNone,
+			seed:          "code,name\n",
+			expectedError: "20181222073750_a.up.sql: `copy` directive requires a transaction, not transaction mode \"none\"",
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModePerFile,
+			seed:          "code,name\n",
+			expectedError: "20181222073750_a.up.sql: database does not support `copy` directive",
+		},
+		{
+			name:        fileline(),
+			adapter:     loading,
+			mode:        DbTxnModeNone,
+			localInfile: true,
+			seed:        "code,Name\nsg,Singapore\n",
+			expectedLog: []string{
+				"LOAD DATA LOCAL INFILE 'Reader::dbmigrate-1' INTO TABLE `countries` CHARACTER SET utf8mb4" +
+					` FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' IGNORE 1 LINES` +
+					" (@c1, @c2) SET `code` = NULLIF(@c1, ''), `Name` = NULLIF(TRIM(TRAILING '\\r' FROM @c2), '')",
+				"code,Name\nsg,Singapore\n",
+			},
+		},
+		{
+			name:          fileline(),
+			adapter:       loading,
+			mode:          DbTxnModePerFile,
+			seed:          "code,name\n",
+			expectedError: "20181222073750_a.up.sql: `copy` directive requires local infile to be enabled, see WithLocalInfile",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, fake := openFakeDB(t, nil)
+			var read []string
+			dir := fstest.MapFS{
+				"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("-- dbmigrate:copy countries from countries.csv\n")},
+				"countries.csv":           &fstest.MapFile{Data: []byte(tc.seed)},
+			}
+			tx := &preparingTx{recordingTx{noTx: noTx{db: db}}}
+			tc.adapter.BeginTx = func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil }
+			readers := map[string]func() io.Reader{}
+			var results []FileResult
+			store := &fakeStore{}
+			c := &Config{dir: dir, db: db, adapter: tc.adapter, store: store, logger: func(...interface{}) {}, resultHandler: func(r FileResult) { results = append(results, r) }}
+			c.migrationFiles = []string{"20181222073750_a.up.sql"}
+			if tc.localInfile {
+				loadDataReaders = 0
+				WithLocalInfile(
+					func(name string, handler func() io.Reader) { readers[name] = handler },
+					func(name string) {
+						data, _ := ioutil.ReadAll(readers[name]()) // as if read by the driver
+						read = append(read, string(data))
+						delete(readers, name)
+					},
+				)(c)
+			}
+
+			err := c.Up(context.Background(), MigrateOptions{Mode: tc.mode})
+			assert.Empty(t, readers)
+			assert.Equal(t, tc.expectedLog, append(fake.executed(), read...))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Empty(t, store.entries)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, store.entries, 1)
+			if assert.Len(t, results, 1) {
+				assert.Equal(t, tc.expectedRows, results[0].RowsAffected)
+			}
+		})
+	}
+}
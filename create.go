@@ -0,0 +1,147 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A WritableDir is where CreateMigration writes migration files
+type WritableDir interface {
+	// WriteFile creates file `name` with `data`, failing if it exists
+	WriteFile(name string, data []byte) error
+	// Path returns how `name` is reported, e.g. joined with the directory
+	Path(name string) string
+}
+
+// DirWriter is a directory of the local filesystem, created if needed on the first WriteFile
+type DirWriter string
+
+// WriteFile creates file `name` in the directory with `data`, failing if it exists
+func (d DirWriter) WriteFile(name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create %q", string(d))
+	}
+	f, err := os.OpenFile(d.Path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Path returns `name` joined with the directory
+func (d DirWriter) Path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+// CreateOptions customizes the files of CreateMigration
+type CreateOptions struct {
+	Phase        Phase  // PhasePost names the files `.post.up.sql` and `.post.down.sql`; otherwise pre-deploy
+	Up           string // sql of the `.up.sql` file, e.g. from a schema diff tool
+	Down         string // sql of the `.down.sql` file
+	UpTemplate   string // text/template of the `.up.sql` file, given a CreateTemplateData; "" means `{{.Up}}`
+	DownTemplate string // text/template of the `.down.sql` file; "" means `{{.Down}}`
+}
+
+// CreateTemplateData is given to the templates of CreateOptions
+type CreateTemplateData struct {
+	Version     string // e.g. `20181222073750`
+	Name        string // sanitized description, e.g. `create-users`
+	Description string // as given to CreateMigration
+	Up          string // from CreateOptions
+	Down        string
+}
+
+var migrationNameSanitizer = regexp.MustCompile(`\W+`)
+
+// migrationName returns `<version>_<description>` for a migration created at `now`, with
+// non-word characters of `description` replaced by `-`
+func migrationName(now time.Time, description string) string {
+	s := migrationNameSanitizer.ReplaceAllString(strings.ToLower(description), "-")
+	return fmt.Sprintf("%s_%s", now.UTC().Format(VersionLayout), strings.Trim(s, "-"))
+}
+
+// NextVersion returns when to version a new migration file of `dir`, in UTC and whole seconds: `now`,
+// or one second after the latest version in `dir` if that is not earlier, so files created within the
+// same second, e.g. by code generators, still get increasing versions. With `afterLatest`, always one
+// second after the latest version, so generated batches are the same whenever they run. Versions that
+// are not timestamps in VersionLayout are ignored; a missing `dir` has no versions
+func NextVersion(dir fs.FS, now time.Time, afterLatest bool) (time.Time, error) {
+	result := now.UTC().Truncate(time.Second)
+	filenames, err := listMigrationFiles(dir)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, currName := range filenames {
+		if !strings.HasSuffix(currName, ".sql") {
+			continue
+		}
+		if t, err := time.Parse(VersionLayout, strings.Split(currName, "_")[0]); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	if latest.IsZero() {
+		return result, nil
+	}
+	if afterLatest || !result.After(latest) {
+		return latest.Add(time.Second), nil
+	}
+	return result, nil
+}
+
+// CreateMigration writes a new `.up.sql` and `.down.sql` pair into `dir`, versioned by `now`,
+// and returns their paths; e.g. for code generators to emit files as `dbmigrate -create` does
+func CreateMigration(dir WritableDir, now time.Time, description string, opts CreateOptions) (upPath string, downPath string, err error) {
+	base := migrationName(now, description)
+	data := CreateTemplateData{
+		Version:     now.UTC().Format(VersionLayout),
+		Name:        strings.SplitN(base, "_", 2)[1],
+		Description: description,
+		Up:          opts.Up,
+		Down:        opts.Down,
+	}
+	if opts.Phase == PhasePost {
+		base += ".post"
+	}
+	filenames := []string{base + ".up.sql", base + ".down.sql"}
+	texts := []string{opts.UpTemplate, opts.DownTemplate}
+	if texts[0] == "" {
+		texts[0] = "{{.Up}}"
+	}
+	if texts[1] == "" {
+		texts[1] = "{{.Down}}"
+	}
+	contents := make([][]byte, len(filenames))
+	for i, filename := range filenames {
+		var buf bytes.Buffer
+		t, err := template.New(filename).Parse(texts[i])
+		if err == nil {
+			err = t.Execute(&buf, data)
+		}
+		if err != nil {
+			return "", "", errors.Wrapf(err, "invalid template of %s", filename)
+		}
+		contents[i] = buf.Bytes()
+	}
+	for i, filename := range filenames {
+		if err := dir.WriteFile(filename, contents[i]); err != nil {
+			return "", "", errors.Wrapf(err, "unable to write %s", dir.Path(filename))
+		}
+	}
+	return dir.Path(filenames[0]), dir.Path(filenames[1]), nil
+}
@@ -0,0 +1,117 @@
+package dbmigrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMigration(t *testing.T) {
+	now := time.Date(2018, 12, 22, 7, 37, 50, 0, time.UTC)
+	testCases := []struct {
+		name            string
+		description     string
+		opts            CreateOptions
+		expectedUp      string
+		expectedDown    string
+		expectedUpSQL   string
+		expectedDownSQL string
+		expectedErr     string
+	}{
+		{
+			name:         fileline(),
+			description:  "Create Users!",
+			expectedUp:   "20181222073750_create-users.up.sql",
+			expectedDown: "20181222073750_create-users.down.sql",
+		},
+		{
+			name:            fileline(),
+			description:     "drop legacy",
+			opts:            CreateOptions{Phase: PhasePost, Up: "DROP TABLE legacy;\n", Down: "CREATE TABLE legacy (id int);\n"},
+			expectedUp:      "20181222073750_drop-legacy.post.up.sql",
+			expectedDown:    "20181222073750_drop-legacy.post.down.sql",
+			expectedUpSQL:   "DROP TABLE legacy;\n",
+			expectedDownSQL: "CREATE TABLE legacy (id int);\n",
+		},
+		{
+			name:          fileline(),
+			description:   "add email",
+			opts:          CreateOptions{Up: "ALTER TABLE users ADD email text;", UpTemplate: "-- Description: {{.Description}} ({{.Version}})\n{{.Up}}\n"},
+			expectedUp:    "20181222073750_add-email.up.sql",
+			expectedDown:  "20181222073750_add-email.down.sql",
+			expectedUpSQL: "-- Description: add email (20181222073750)\nALTER TABLE users ADD email text;\n",
+		},
+		{
+			name:        fileline(),
+			description: "bad",
+			opts:        CreateOptions{DownTemplate: "{{.Bogus}}"},
+			expectedErr: `invalid template of 20181222073750_bad.down.sql: template: 20181222073750_bad.down.sql:1:2: executing "20181222073750_bad.down.sql" at <.Bogus>: can't evaluate field Bogus in type dbmigrate.CreateTemplateData`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirname, err := ioutil.TempDir("", "dbmigrate")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dirname)
+			dir := DirWriter(filepath.Join(dirname, "migrations"))
+
+			upPath, downPath, err := CreateMigration(dir, now, tc.description, tc.opts)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, dir.Path(tc.expectedUp), upPath)
+			assert.Equal(t, dir.Path(tc.expectedDown), downPath)
+			for path, expected := range map[string]string{upPath: tc.expectedUpSQL, downPath: tc.expectedDownSQL} {
+				content, err := ioutil.ReadFile(path)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+
+			_, _, err = CreateMigration(dir, now, tc.description, tc.opts)
+			assert.Error(t, err, "should not overwrite existing files")
+		})
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	now := time.Date(2018, 12, 22, 15, 37, 50, 500, time.FixedZone("SGT", 8*60*60))
+	dir := fstest.MapFS{
+		"20181222073748_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073749_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"0001_custom.up.sql":      &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"README.md":               &fstest.MapFile{Data: []byte("99999999999999")},
+	}
+	testCases := []struct {
+		name        string
+		dir         fstest.MapFS
+		now         time.Time
+		afterLatest bool
+		expected    string
+	}{
+		{name: fileline(), dir: fstest.MapFS{}, now: now, expected: "20181222073750"},
+		{name: fileline(), dir: dir, now: now, expected: "20181222073750"},
+		{name: fileline(), dir: dir, now: now.Add(-time.Second), expected: "20181222073750"},
+		{name: fileline(), dir: dir, now: now.Add(-time.Hour), expected: "20181222073750"},
+		{name: fileline(), dir: dir, now: now.Add(time.Hour), afterLatest: true, expected: "20181222073750"},
+		{name: fileline(), dir: fstest.MapFS{}, now: now, afterLatest: true, expected: "20181222073750"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextVersion(tc.dir, tc.now, tc.afterLatest)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got.Format(VersionLayout))
+			assert.Equal(t, time.UTC, got.Location())
+		})
+	}
+
+	got, err := NextVersion(os.DirFS(filepath.Join(os.TempDir(), "dbmigrate-missing-dir")), now, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "20181222073750", got.Format(VersionLayout))
+}
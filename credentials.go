@@ -0,0 +1,88 @@
+package dbmigrate
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate/internal/lease"
+	"github.com/pkg/errors"
+)
+
+// A CredentialsProvider fetches short-lived database credentials when a run starts, so the
+// database url needs no static password; see WithCredentials, and the provider in credentials/vault
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// Credentials for connecting to the database
+type Credentials struct {
+	Username string
+	Password string
+	TTL      time.Duration                   // 0 means they do not expire
+	Renew    func(ctx context.Context) error // extends TTL while in use; nil means not renewable
+	Revoke   func(ctx context.Context) error // called by CloseDB; nil means they expire on their own
+}
+
+// UseCredentials returns `databaseURL` of `driverName` connecting as credentials fetched from
+// `provider`, which are renewed until `release` is called, if they expire
+func UseCredentials(ctx context.Context, provider CredentialsProvider, driverName string, databaseURL string, logger func(...interface{})) (string, func() error, error) {
+	creds, err := provider.Credentials(ctx)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "unable to fetch database credentials")
+	}
+	if databaseURL, err = credentialsURL(driverName, databaseURL, creds); err != nil {
+		if creds.Revoke != nil {
+			creds.Revoke(ctx)
+		}
+		return "", nil, err
+	}
+	stop := func() {}
+	if creds.TTL > 0 && creds.Renew != nil {
+		stop = lease.KeepAlive(creds.TTL, func(ctx context.Context) error {
+			err := creds.Renew(ctx)
+			if err != nil {
+				logger("[credentials] unable to renew:", err.Error())
+			}
+			return err
+		})
+	}
+	release := func() error {
+		stop()
+		if creds.Revoke == nil {
+			return nil
+		}
+		return creds.Revoke(context.Background())
+	}
+	return databaseURL, release, nil
+}
+
+// credentialsURL returns `databaseURL` of `driverName` connecting as `creds` instead
+func credentialsURL(driverName string, databaseURL string, creds Credentials) (string, error) {
+	if strings.Contains(databaseURL, "://") {
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid database url")
+		}
+		u.User = url.UserPassword(creds.Username, creds.Password)
+		return u.String(), nil
+	}
+	switch driverName {
+	case "postgres":
+		quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+		return strings.TrimSpace(databaseURL) + " user='" + quote(creds.Username) + "' password='" + quote(creds.Password) + "'", nil
+	case "mysql":
+		// [user[:password]@][protocol[(address)]]/dbname[?param1=value1]; like mysql.ParseDSN, dbname
+		// is after the last `/`, since the password may contain `/`
+		slash := strings.LastIndex(databaseURL, "/")
+		if slash < 0 {
+			return "", errors.Errorf("invalid mysql dsn")
+		}
+		if at := strings.LastIndex(databaseURL[:slash], "@"); at >= 0 {
+			databaseURL = databaseURL[at+1:]
+		}
+		return creds.Username + ":" + creds.Password + "@" + databaseURL, nil
+	}
+	return "", errors.Errorf("%q does not support credentials from a provider", driverName)
+}
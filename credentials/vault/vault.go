@@ -0,0 +1,100 @@
+// Package vault fetches dynamic database credentials for dbmigrate from Hashicorp Vault
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+)
+
+// CredentialsProvider fetches dynamic database credentials from a Hashicorp Vault database
+// secrets engine; the lease is renewed while the migration runs, and revoked by CloseDB
+type CredentialsProvider struct {
+	Address string       // e.g. https://vault:8200
+	Token   string       // sent as X-Vault-Token
+	Path    string       // e.g. database/creds/migrator
+	Client  *http.Client // default http.DefaultClient
+}
+
+var _ dbmigrate.CredentialsProvider = CredentialsProvider{}
+
+// Credentials implements dbmigrate.CredentialsProvider
+func (p CredentialsProvider) Credentials(ctx context.Context) (dbmigrate.Credentials, error) {
+	var secret struct {
+		LeaseID       string `json:"lease_id"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+		Data          struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"data"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(p.Path, "/"), nil, &secret); err != nil {
+		return dbmigrate.Credentials{}, err
+	}
+	if secret.Data.Username == "" {
+		return dbmigrate.Credentials{}, errors.Errorf("vault %s: no username in response", p.Path)
+	}
+	creds := dbmigrate.Credentials{
+		Username: secret.Data.Username,
+		Password: secret.Data.Password,
+		TTL:      time.Duration(secret.LeaseDuration) * time.Second,
+	}
+	if secret.LeaseID == "" {
+		return creds, nil
+	}
+	if secret.Renewable {
+		creds.Renew = func(ctx context.Context) error {
+			return p.call(ctx, http.MethodPut, "/v1/sys/leases/renew", map[string]interface{}{"lease_id": secret.LeaseID, "increment": secret.LeaseDuration}, nil)
+		}
+	}
+	creds.Revoke = func(ctx context.Context) error {
+		return p.call(ctx, http.MethodPut, "/v1/sys/leases/revoke", map[string]interface{}{"lease_id": secret.LeaseID}, nil)
+	}
+	return creds, nil
+}
+
+// call sends `request` as json to `path` of vault, and decodes the response into `response` if not nil
+func (p CredentialsProvider) call(ctx context.Context, method string, path string, request interface{}, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(p.Address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return errors.Wrapf(err, "vault %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return errors.Errorf("vault %s: %d %s", path, resp.StatusCode, strings.Join(failure.Errors, "; "))
+	}
+	if response == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(response), "vault %s", path)
+}
@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+fmtJSON(body))
+		switch r.URL.Path {
+		case "/v1/database/creds/migrator":
+			w.Write([]byte(`{"lease_id":"database/creds/migrator/abc","lease_duration":3600,"renewable":true,"data":{"username":"v-migrator-abc","password":"A1a-xyz"}}`))
+		case "/v1/sys/leases/renew", "/v1/sys/leases/revoke":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := CredentialsProvider{Address: server.URL + "/", Token: "s.token", Path: "database/creds/migrator"}
+	creds, err := provider.Credentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "v-migrator-abc", creds.Username)
+	assert.Equal(t, "A1a-xyz", creds.Password)
+	assert.Equal(t, time.Hour, creds.TTL)
+	assert.NoError(t, creds.Renew(context.Background()))
+	assert.NoError(t, creds.Revoke(context.Background()))
+	assert.Equal(t, []string{
+		`GET /v1/database/creds/migrator null`,
+		`PUT /v1/sys/leases/renew {"increment":3600,"lease_id":"database/creds/migrator/abc"}`,
+		`PUT /v1/sys/leases/revoke {"lease_id":"database/creds/migrator/abc"}`,
+	}, requests)
+
+	_, err = CredentialsProvider{Address: server.URL, Token: "bogus", Path: "database/creds/migrator"}.Credentials(context.Background())
+	assert.EqualError(t, err, "vault /v1/database/creds/migrator: 403 permission denied")
+}
+
+func fmtJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,67 @@
+package dbmigrate
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var descriptionHeader = regexp.MustCompile(`(?i)^--\s*description:\s*`)
+
+// parseDescription returns the `-- Description: <text>` comment of the leading comment block of
+// `filecontent`, joined with the comment lines following it until a blank comment line
+func parseDescription(filecontent []byte) string {
+	var lines []string
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(filecontent))
+	scanner.Buffer(nil, len(filecontent)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" && !found:
+			continue
+		case !strings.HasPrefix(line, "--"):
+			return strings.Join(lines, " ") // end of leading comment block
+		case strings.HasPrefix(line, directivePrefix):
+			continue
+		case !found && descriptionHeader.MatchString(line):
+			found = true
+			line = descriptionHeader.ReplaceAllString(line, "")
+		case !found:
+			continue
+		default:
+			line = strings.TrimSpace(strings.TrimPrefix(line, "--"))
+			if line == "" {
+				return strings.Join(lines, " ")
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// FileDescription returns the `-- Description:` comment of `filename`, or "" if none
+func (c *Config) FileDescription(filename string) string {
+	filecontent, err := c.fileContent(filename)
+	if err != nil {
+		return ""
+	}
+	return parseDescription(filecontent)
+}
+
+// versionDescriptions returns the description of each version with a described `.up.sql` file
+func (c *Config) versionDescriptions() map[string]string {
+	result := map[string]string{}
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, "up.sql") {
+			continue
+		}
+		if description := c.FileDescription(currName); description != "" {
+			result[c.versionOf(currName)] = description
+		}
+	}
+	return result
+}
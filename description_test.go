@@ -0,0 +1,47 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDescription(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected string
+	}{
+		{
+			name:     fileline(),
+			given:    "CREATE TABLE users (id int);",
+			expected: "",
+		},
+		{
+			name:     fileline(),
+			given:    "\n-- Description: backfill user emails\nUPDATE users SET email = lower(email);",
+			expected: "backfill user emails",
+		},
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:owner team-a\n-- description:  split name into\n--   first and last name\n-- dbmigrate:phase post\n--\n-- notes that are not the description\nALTER TABLE users ADD first_name text;",
+			expected: "split name into first and last name",
+		},
+		{
+			name:     fileline(),
+			given:    "-- just a comment\n-- Description: found after other comments\n",
+			expected: "found after other comments",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1;\n-- Description: not in the leading comment block\n",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseDescription([]byte(tc.given)))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package dbmigrate
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	dsnPassword      = regexp.MustCompile(`^([^:@/]*):.*@(tcp|unix|\(|/)`) // up to the last `@` before the address, passwords may contain `@`
+	keyValuePassword = regexp.MustCompile(`(password\s*=\s*)('(\\'|[^'])*'|\S+)`)
+)
+
+// RedactDatabaseURL replaces the password in `databaseURL` with `xxxxx`, so it can be logged.
+// Understands URLs, mysql DSNs (`user:pass@tcp(host)/db`) and `key=value` connection strings
+func RedactDatabaseURL(databaseURL string) string {
+	if strings.Contains(databaseURL, "://") {
+		if u, err := url.Parse(databaseURL); err == nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			}
+			q := u.Query()
+			if q.Get("password") != "" {
+				q.Set("password", "xxxxx")
+				u.RawQuery = q.Encode()
+			}
+			return u.String()
+		}
+	}
+	if keyValuePassword.MatchString(databaseURL) {
+		return keyValuePassword.ReplaceAllString(databaseURL, "${1}xxxxx")
+	}
+	return dsnPassword.ReplaceAllString(databaseURL, "${1}:xxxxx@${2}")
+}
+
+// Capabilities returns which optional features the adapter supports, keyed by command line flag or directive
+func (a Adapter) Capabilities() map[string]bool {
+	return map[string]bool{
+		"server-ready":        a.PingQuery != "" && a.BaseDatabaseURL != nil,
+		"create-db":           a.CreateDatabaseQuery != nil && a.BaseDatabaseURL != nil,
+		"schema":              a.CreateSchemaQuery != nil,
+		"create-extension":    a.CreateExtensionQuery != nil,
+		"grant-role":          a.GrantRoleQuery != nil,
+		"wait-writable":       a.ReadOnlyQuery != "",
+		"wait-replica-lag":    a.ReplicaLagQuery != "",
+		"check-reversibility": a.TransactionalDDL,
+		"doc":                 a.SelectColumns != nil && a.SelectForeignKeys != nil,
+		"diff":                a.SelectColumns != nil && a.SelectForeignKeys != nil && a.NormalizeType != nil,
+		"ignore-error":        a.ErrorCode != nil,
+		"savepoints":          a.Savepoints,
+		"status":              a.SelectHistory != nil,
+		"runs":                a.CreateRunsTable != nil && a.SelectRuns != nil,
+		"log-position":        a.LogPositionQuery != "",
+		"freeze":              a.CreateFreezeTable != nil,
+		"exec":                a.CreateArchiveTable != nil,
+		"archive":             a.CreateArchiveTable != nil && a.SelectArchive != nil,
+		"impact-sizes":        a.SelectTableSizes != nil,
+		"impact-locks":        a.LockLevel != nil,
+		"blockers":            a.SelectBlockers != nil && a.TerminateSessionQuery != "",
+		"tenants":             a.TenantDatabaseURL != nil,
+		"tls":                 a.TLSDatabaseURL != nil,
+		"lock":                a.LockQuery != "" && a.UnlockQuery != "",
+		"portable":            a.Translate != nil,
+		"defer-foreign-keys":  a.ForeignKeysOffQuery != "" && a.ForeignKeyCheckQuery != "",
+		"defer-constraints":   a.DeferConstraintsQuery != "",
+		"copy":                a.CopyFromQuery != nil || a.LoadDataQuery != nil,
+		"reconnect":           a.TransactionalDDL,
+		"concurrent-index":    a.IndexValidQuery != "" && a.DropIndexQuery != nil,
+		"repair-indexes":      a.SelectInvalidIndexes != nil && a.DropIndexQuery != nil,
+		"upgrade-meta":        a.SelectVersionsColumns != nil && a.RebuildVersionsTable != nil,
+		"requires":            a.HasPrivilegeQuery != "",
+		"run-as":              a.SetRoleQuery != nil && a.CheckRoleQuery != nil,
+		"fixup":               a.SelectObjects != nil,
+		"versions-schema":     a.CreateSchemaQuery != nil,
+	}
+}
+
+// Adapter returns the Adapter used by Config
+func (c *Config) Adapter() Adapter {
+	return c.adapter
+}
+
+// MigrationFiles returns the names of all files found in `dir`
+func (c *Config) MigrationFiles() []string {
+	return append([]string(nil), c.migrationFiles...)
+}
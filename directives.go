@@ -0,0 +1,63 @@
+package dbmigrate
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+const directivePrefix = "-- dbmigrate:"
+
+// directives are `-- dbmigrate:<name> <value>` comment lines found in a migration file,
+// e.g. `-- dbmigrate:txn-isolation serializable`
+//
+// Repeated directives have their values joined with `,`
+type directives map[string]string
+
+func parseDirectives(filecontent []byte) directives {
+	result := directives{}
+	scanner := bufio.NewScanner(bytes.NewReader(filecontent))
+	scanner.Buffer(nil, len(filecontent)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, directivePrefix) {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, directivePrefix), " ", 2)
+		name, value := strings.TrimSpace(fields[0]), ""
+		if len(fields) > 1 {
+			value = strings.TrimSpace(fields[1])
+		}
+		if existing, ok := result[name]; ok && existing != "" {
+			value = existing + "," + value
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// has returns true if directive `name` is present
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// allowsEnv returns false if `-- dbmigrate:only env=...` excludes `env`; an empty `env` is always allowed
+func (d directives) allowsEnv(env string) bool {
+	value, ok := d["only"]
+	if !ok || env == "" {
+		return true
+	}
+	for _, field := range strings.Fields(value) {
+		if !strings.HasPrefix(field, "env=") {
+			continue
+		}
+		for _, allowed := range strings.Split(strings.TrimPrefix(field, "env="), ",") {
+			if strings.TrimSpace(allowed) == env {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
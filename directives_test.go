@@ -0,0 +1,60 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectives(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected directives
+	}{
+		{
+			name:     fileline(),
+			given:    "CREATE TABLE foo (id int);",
+			expected: directives{},
+		},
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:txn-isolation serializable\nUPDATE foo SET id = 1;",
+			expected: directives{"txn-isolation": "serializable"},
+		},
+		{
+			name:     fileline(),
+			given:    "  --  dbmigrate:txn-isolation serializable\n-- dbmigrate:foo\n",
+			expected: directives{"foo": ""},
+		},
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:depends 1\n-- dbmigrate:depends   2 \r\n",
+			expected: directives{"depends": "1,2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseDirectives([]byte(tc.given)))
+		})
+	}
+}
+
+func TestDirectivesAllowsEnv(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		env      string
+		expected bool
+	}{
+		{name: fileline(), given: "", env: "production", expected: true},
+		{name: fileline(), given: "-- dbmigrate:only env=dev,staging", env: "", expected: true},
+		{name: fileline(), given: "-- dbmigrate:only env=dev,staging", env: "staging", expected: true},
+		{name: fileline(), given: "-- dbmigrate:only env=dev,staging", env: "production", expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseDirectives([]byte(tc.given)).allowsEnv(tc.env))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package dbmigrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ModifiedFiles returns `.up.sql` files of applied versions whose content changed since they
+// were applied, according to checksums in history. Versions without a recorded checksum are
+// not checked
+func (c *Config) ModifiedFiles(ctx context.Context, schema *string) ([]string, error) {
+	entries, err := c.History(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query history")
+	}
+	checksums := map[string]string{} // latest checksum of each applied version
+	for _, entry := range entries {
+		switch {
+		case entry.Direction == directionDown:
+			delete(checksums, entry.Version)
+		case entry.Direction == directionUp && entry.Checksum != "":
+			checksums[entry.Version] = entry.Checksum
+		}
+	}
+
+	var result []string
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, "up.sql") {
+			continue
+		}
+		checksum, ok := checksums[c.versionOf(currName)]
+		if !ok {
+			continue
+		}
+		sum, err := c.fileChecksum(currName)
+		if err != nil {
+			return nil, err
+		}
+		if sum != checksum {
+			result = append(result, currName)
+		}
+	}
+	return result, nil
+}
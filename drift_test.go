@@ -0,0 +1,43 @@
+package dbmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModifiedFiles(t *testing.T) {
+	checksum := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"20181222073750_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"20181222073900_b.up.sql":   {Data: []byte("CREATE TABLE b (id int); -- edited")},
+		"20181222073901_c.up.sql":   {Data: []byte("CREATE TABLE c (id int); -- edited")},
+		"20181222073902_d.up.sql":   {Data: []byte("CREATE TABLE d (id int); -- edited")},
+		"20181222073903_e.up.sql":   {Data: []byte("CREATE TABLE e (id int); -- edited")},
+		"20181222073904_f.up.sql":   {Data: []byte("\xEF\xBB\xBFCREATE TABLE f (id int);")},
+	}
+	store := &fakeStore{entries: []HistoryEntry{
+		{Version: "20181222073750", Direction: "up", Checksum: checksum("CREATE TABLE a (id int);")},
+		{Version: "20181222073900", Direction: "up", Checksum: checksum("CREATE TABLE b (id int);")},
+		{Version: "20181222073901", Direction: "up", Checksum: checksum("CREATE TABLE c (id int);")},
+		{Version: "20181222073901", Direction: "down", Checksum: checksum("")},
+		{Version: "20181222073902", Direction: "up", Remark: "no history"},
+		{Version: "20181222073904", Direction: "up", Checksum: checksum("\xEF\xBB\xBFCREATE TABLE f (id int);")},
+	}}
+	c := &Config{dir: dir, store: store}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+
+	actual, err := c.ModifiedFiles(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20181222073900_b.up.sql"}, actual)
+}
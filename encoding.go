@@ -0,0 +1,54 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	utf8BOM   = []byte{0xEF, 0xBB, 0xBF}
+	otherBOMs = []struct {
+		encoding string
+		bom      []byte
+	}{
+		// utf-32 first, since utf-32le starts with the utf-16le byte order mark
+		{"UTF-32LE", []byte{0xFF, 0xFE, 0x00, 0x00}},
+		{"UTF-32BE", []byte{0x00, 0x00, 0xFE, 0xFF}},
+		{"UTF-16LE", []byte{0xFF, 0xFE}},
+		{"UTF-16BE", []byte{0xFE, 0xFF}},
+	}
+)
+
+// decodeFile returns `filecontent` without its UTF-8 byte order mark, as saved by some Windows
+// editors. Other encodings are rejected, naming `filename` and the offending byte offset
+func decodeFile(filename string, filecontent []byte) ([]byte, error) {
+	for _, other := range otherBOMs {
+		if bytes.HasPrefix(filecontent, other.bom) {
+			return nil, errors.Errorf("%s: file is %s encoded; save it as UTF-8", filename, other.encoding)
+		}
+	}
+	filecontent = bytes.TrimPrefix(filecontent, utf8BOM)
+	if offset := bytes.IndexByte(filecontent, 0); offset >= 0 {
+		return nil, errors.Errorf("%s: NUL byte at offset %d; is the file UTF-16 encoded? save it as UTF-8", filename, offset)
+	}
+	for offset := 0; offset < len(filecontent); {
+		r, size := utf8.DecodeRune(filecontent[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return nil, errors.Errorf("%s: invalid UTF-8 at byte offset %d; save the file as UTF-8", filename, offset)
+		}
+		offset += size
+	}
+	return filecontent, nil
+}
+
+// normalizeFile returns `filecontent` with CRLF line endings as LF, and without trailing NUL and
+// other control characters, e.g. Ctrl-Z end-of-file markers, left behind by Windows editors
+func normalizeFile(filecontent []byte) []byte {
+	filecontent = bytes.ReplaceAll(filecontent, []byte("\r\n"), []byte("\n"))
+	return bytes.TrimRightFunc(filecontent, func(r rune) bool {
+		return r != '\n' && r != '\t' && unicode.IsControl(r)
+	})
+}
@@ -0,0 +1,96 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFile(t *testing.T) {
+	testCases := []struct {
+		name          string
+		given         []byte
+		expected      []byte
+		expectedError string
+	}{
+		{
+			name:     fileline(),
+			given:    []byte("SELECT 'é';"),
+			expected: []byte("SELECT 'é';"),
+		},
+		{
+			name:     fileline(),
+			given:    []byte("\xEF\xBB\xBFSELECT 1;"),
+			expected: []byte("SELECT 1;"),
+		},
+		{
+			name:          fileline(),
+			given:         []byte("\xFF\xFES\x00E\x00"),
+			expectedError: "a.up.sql: file is UTF-16LE encoded; save it as UTF-8",
+		},
+		{
+			name:          fileline(),
+			given:         []byte("\xFF\xFE\x00\x00S\x00\x00\x00"),
+			expectedError: "a.up.sql: file is UTF-32LE encoded; save it as UTF-8",
+		},
+		{
+			name:          fileline(),
+			given:         []byte("S\x00E\x00"),
+			expectedError: "a.up.sql: NUL byte at offset 1; is the file UTF-16 encoded? save it as UTF-8",
+		},
+		{
+			name:          fileline(),
+			given:         []byte("SELECT 'caf\xE9';"),
+			expectedError: "a.up.sql: invalid UTF-8 at byte offset 11; save the file as UTF-8",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := decodeFile("a.up.sql", tc.given)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestNormalizeFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected string
+	}{
+		{
+			name:     fileline(),
+			given:    "SELECT 1;\nSELECT 2;\n",
+			expected: "SELECT 1;\nSELECT 2;\n",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1;\r\nSELECT 2;\r\n",
+			expected: "SELECT 1;\nSELECT 2;\n",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1;\n\x00\x00",
+			expected: "SELECT 1;\n",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT '\x01';\r\n\x1a",
+			expected: "SELECT '\x01';\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(normalizeFile([]byte(tc.given))))
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	directionUp   = "up"
+	directionDown = "down"
+	directionSkip = "skip" // history only; version is left pending
+)
+
+// run holds the settings of one Up or Down call
+type run struct {
+	id          string
+	direction   string
+	txOpts      *sql.TxOptions
+	schema      *string
+	mode        DbTxnMode
+	maxFiles    int
+	maxDuration time.Duration
+	beforeFile  func(string) error
+	logFilename func(string)
+	logSkipped  func(string)
+	logChunk    func(filename string, done int, total int)
+	archive     string // source of files archived in `dbmigrate_archive`, see WithArchive; "" means not archived
+	lock        *migrationLock
+	applied     map[string]bool // versions queried again after reconnecting, see WithReconnect; nil until then
+}
+
+func newRun(direction string, opts MigrateOptions, lock *migrationLock) run {
+	r := run{
+		id:          newRunID(time.Now()),
+		direction:   direction,
+		txOpts:      opts.TxOptions,
+		schema:      opts.Schema,
+		mode:        opts.Mode,
+		maxFiles:    opts.TxMaxFiles,
+		maxDuration: opts.TxMaxDuration,
+		beforeFile:  opts.BeforeFile,
+		logFilename: opts.AfterFile,
+		logSkipped:  opts.AfterSkip,
+		logChunk:    opts.AfterChunk,
+		lock:        lock,
+	}
+	if r.txOpts == nil {
+		r.txOpts = &sql.TxOptions{}
+	}
+	if r.beforeFile == nil {
+		r.beforeFile = func(string) error { return nil }
+	}
+	if r.logFilename == nil {
+		r.logFilename = func(string) {}
+	}
+	if r.logSkipped == nil {
+		r.logSkipped = func(string) {}
+	}
+	if r.logChunk == nil {
+		r.logChunk = func(string, int, int) {}
+	}
+	return r
+}
+
+// newRunID returns a sortable, unique id for files applied together
+func newRunID(now time.Time) string {
+	random := make([]byte, 4)
+	rand.Read(random)
+	return now.UTC().Format("20060102150405") + "-" + hex.EncodeToString(random)
+}
+
+// txFull returns true if a DbTxnModeAll transaction holding `files` for `elapsed` should be
+// committed before the next file, as capped by TxMaxFiles and TxMaxDuration of MigrateOptions
+func (r run) txFull(files int, elapsed time.Duration) bool {
+	return (r.maxFiles > 0 && files >= r.maxFiles) || (r.maxDuration > 0 && elapsed >= r.maxDuration)
+}
+
+// runFiles executes `filenames` in order, bookkeeping each file in the same transaction
+func (c *Config) runFiles(ctx context.Context, r run, filenames []string) error {
+	if err := c.checkWindows(filenames, time.Now()); err != nil {
+		return err
+	}
+	if err := r.lock.covers(filenames); err != nil {
+		return err
+	}
+	if err := c.checkPrivileges(ctx, filenames); err != nil {
+		return err
+	}
+	if err := c.checkBlockers(ctx, filenames); err != nil {
+		return err
+	}
+	if len(filenames) > 0 && c.backup != nil {
+		c.logger("[backup] before applying", len(filenames), "file(s)")
+		if err := c.backup(ctx, filenames); err != nil {
+			return errors.Wrapf(err, "backup failed; no file was applied")
+		}
+	}
+	if len(filenames) > 0 && r.archive != "" {
+		if err := c.createArchiveTable(ctx, r.schema); err != nil {
+			return err
+		}
+	}
+	if len(filenames) > 0 {
+		finishRun, err := c.recordRun(ctx, r)
+		if err != nil {
+			return err
+		}
+		defer finishRun() // after the deferred rollback below
+	}
+
+	var tx ExecCommitRollbacker
+	started, nextWarning, filesInTx := time.Now(), c.longTxn, 0
+	if r.mode == DbTxnModeAll {
+		var err error
+		if tx, err = c.adapter.BeginTx(ctx, c.db, r.txOpts); err != nil {
+			return errors.Wrapf(err, "unable to create transaction")
+		}
+		defer func() { tx.Rollback() }() // ok to fail rollback if we did `tx.Commit`; tx may be restarted below
+	}
+
+	for i, currName := range filenames {
+		if r.mode == DbTxnModeAll && filesInTx > 0 && r.txFull(filesInTx, time.Since(started)) {
+			if err := c.checkForeignKeys(ctx, tx); err != nil {
+				return err
+			}
+			if err := commit(tx); err != nil {
+				return err
+			}
+			c.logger("[txn] committed", filesInTx, "file(s); beginning a new transaction,", len(filenames)-i, "file(s) remaining")
+			var err error
+			if tx, err = c.adapter.BeginTx(ctx, c.db, r.txOpts); err != nil {
+				return errors.Wrapf(err, "unable to create transaction")
+			}
+			started, nextWarning, filesInTx = time.Now(), c.longTxn, 0
+		}
+		if r.done(c.versionOf(currName)) {
+			c.logger("[reconnect]", currName, "was migrated", r.direction, "by another process meanwhile")
+			continue
+		}
+		filesInTx++
+		r.lock.progress(ctx, currName)
+		if err := r.beforeFile(currName); err != nil {
+			return errors.Wrapf(err, currName)
+		}
+		ran, err := c.runFileReconnecting(ctx, &r, tx, currName)
+		if err != nil {
+			if owner := c.FileOwner(currName); owner != "" {
+				return errors.Wrapf(err, "owner %s", owner)
+			}
+			return err
+		}
+		if ran {
+			r.logFilename(currName)
+		} else {
+			r.logSkipped(currName)
+		}
+		if r.mode == DbTxnModeAll {
+			if err := c.checkLongTransaction(time.Since(started), len(filenames)-i-1, &nextWarning); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.checkForeignKeys(ctx, tx); err != nil {
+		return err
+	}
+	if r.mode != DbTxnModeAll {
+		return nil
+	}
+	if err := commit(tx); err != nil {
+		return err
+	}
+	if elapsed := time.Since(started); c.longTxn > 0 && elapsed >= c.longTxn {
+		c.logger("[long-txn] transaction was open for", elapsed.Round(time.Second).String()+"; consider transaction mode", DbTxnModePerFile.String(), "for future runs")
+	}
+	return nil
+}
+
+// runFile executes one file, inside `tx` for DbTxnModeAll or its own transaction otherwise.
+// Returns false if the file was skipped
+func (c *Config) runFile(ctx context.Context, r run, tx ExecCommitRollbacker, currName string) (bool, error) {
+	currVer := c.versionOf(currName)
+	filecontent, err := c.fileContent(currName)
+	if err != nil {
+		return false, errors.Wrapf(err, currName)
+	}
+	checksum, err := c.fileChecksum(currName)
+	if err != nil {
+		return false, err
+	}
+	d := parseDirectives(filecontent)
+	if filecontent, err = c.translate(filecontent); err != nil {
+		return false, errors.Wrapf(err, currName)
+	}
+
+	if r.direction == directionUp && c.skipVersions[currVer] {
+		c.logger("[skip]", currName, "is in skip list and is left pending")
+		if tx == nil {
+			tx = &noTx{db: c.db}
+		}
+		return false, c.store.Record(ctx, tx, r.schema, HistoryEntry{
+			Version:   currVer,
+			Direction: directionSkip,
+			AppliedAt: time.Now().UTC(),
+			Checksum:  checksum,
+			AppliedBy: c.appliedBy,
+			Remark:    "skipped",
+			RunID:     r.id,
+		})
+	}
+
+	ran, remark := true, ""
+	if !d.allowsEnv(c.env) {
+		left, recorded := "left pending", "recorded as applied"
+		if r.direction == directionDown {
+			left, recorded = "left applied; not rolled back", "recorded as rolled back"
+		}
+		if c.envSkipPolicy == EnvSkipPending {
+			c.logger("[skip]", currName, "is not for env", c.env, "and is", left)
+			return false, nil
+		}
+		c.logger("[skip]", currName, "is not for env", c.env, "and is", recorded)
+		filecontent, ran, remark = nil, false, "skipped: not for env "+c.env
+	}
+
+	fileTxOpts := *r.txOpts
+	if value, ok := d["txn-isolation"]; ok && ran {
+		if fileTxOpts.Isolation, err = ParseIsolationLevel(value); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+		if r.mode != DbTxnModePerFile && fileTxOpts.Isolation != r.txOpts.Isolation {
+			return false, errors.Errorf("%s: txn-isolation %q requires transaction mode %q", currName, value, DbTxnModePerFile)
+		}
+	}
+
+	var chunk chunking
+	if ran && d.has("chunk") {
+		if chunk, err = c.parseChunking(ctx, r, currName, d["chunk"]); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	}
+
+	switch r.mode {
+	case DbTxnModePerFile:
+		if tx, err = c.adapter.BeginTx(ctx, c.db, &fileTxOpts); err != nil {
+			return false, errors.Wrapf(err, "unable to create transaction")
+		}
+		defer func() { tx.Rollback() }() // ok to fail rollback if we did `tx.Commit`; tx may be restarted by `chunk` directive
+	case DbTxnModeNone:
+		tx = &noTx{db: c.db}
+	}
+
+	if ran && d.has("defer-constraints") {
+		if err := c.deferConstraints(ctx, tx, r.mode, currName); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	}
+
+	var index string
+	if ran && d.has("concurrent-index") {
+		if index, err = c.prepareConcurrentIndex(ctx, r.mode, currName, filecontent); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	}
+
+	if ran && isBlankStatement(string(filecontent)) && d.has("copy") {
+		filecontent = nil // only copies rows
+	} else if ran && isBlankStatement(string(filecontent)) {
+		c.logger("[empty]", currName, "has no statements and is recorded as applied")
+		filecontent, remark = nil, "empty"
+	}
+
+	started := time.Now()
+	fileResult := FileResult{Filename: currName, Version: currVer, Owner: d["owner"], Statements: []StatementResult{}}
+	if len(bytes.TrimSpace(filecontent)) == 0 {
+		// treat empty file as success; don't run it
+	} else if chunk.size > 0 {
+		if tx, err = c.execChunks(ctx, r, tx, &fileTxOpts, currName, chunk, filecontent, &fileResult); err != nil {
+			return false, err
+		}
+	} else if !c.splitStatements {
+		if err := c.execStatement(ctx, tx, r.mode, 0, string(filecontent), &fileResult); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	} else {
+		for i, stmt := range c.statements(filecontent) {
+			if isBlankStatement(stmt) {
+				continue
+			}
+			if err := c.execStatement(ctx, tx, r.mode, i, stmt, &fileResult); err != nil {
+				return false, errors.Wrapf(err, "%s: statement #%d", currName, i+1)
+			}
+		}
+	}
+	if ran && d.has("copy") {
+		if err := c.copyFiles(ctx, tx, r.mode, currName, d["copy"], &fileResult); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	}
+	fileResult.Duration = time.Since(started)
+	if index != "" {
+		if err := c.verifyConcurrentIndex(ctx, r.mode, currName, index); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+	}
+
+	if err := c.store.Record(ctx, tx, r.schema, HistoryEntry{
+		Version:   currVer,
+		Direction: r.direction,
+		AppliedAt: started.UTC(),
+		Duration:  fileResult.Duration,
+		Checksum:  checksum,
+		AppliedBy: c.appliedBy,
+		Remark:    remark,
+		RunID:     r.id,
+	}); err != nil {
+		return false, err
+	}
+	if r.archive != "" {
+		if err := c.archiveFile(ctx, tx, r, currName); err != nil {
+			return false, err
+		}
+	}
+
+	if r.mode == DbTxnModePerFile {
+		if err := c.checkForeignKeys(ctx, tx); err != nil {
+			return false, errors.Wrapf(err, currName)
+		}
+		if err := commit(tx); err != nil {
+			return false, err
+		}
+	}
+	if ran {
+		c.resultHandler(fileResult)
+	}
+	return ran, nil
+}
+
+// execStatement executes `stmt`; if it has a `-- dbmigrate:ignore-error <codes>` directive and fails
+// with one of those error codes, the error is recorded in `fileResult` and the statement is
+// rolled back to a savepoint where the database supports it
+func (c *Config) execStatement(ctx context.Context, tx ExecCommitRollbacker, mode DbTxnMode, i int, stmt string, fileResult *FileResult) error {
+	exec := func(sqlText string) (sql.Result, error) {
+		return c.exec(ctx, Statement{Filename: fileResult.Filename, SQL: sqlText, Mode: mode, Tx: tx})
+	}
+	ignoreCodes, ok := parseDirectives([]byte(stmt))["ignore-error"]
+	if !ok {
+		result, err := exec(stmt)
+		if err != nil {
+			return err
+		}
+		fileResult.add(stmt, result)
+		return nil
+	}
+	if c.adapter.ErrorCode == nil {
+		return errors.Errorf("database does not support `ignore-error` directive")
+	}
+
+	savepoint := fmt.Sprintf("dbmigrate_stmt_%d", i)
+	useSavepoint := mode != DbTxnModeNone && c.adapter.Savepoints
+	if useSavepoint {
+		if _, err := exec("SAVEPOINT " + savepoint); err != nil {
+			return errors.Wrapf(err, "unable to create savepoint")
+		}
+	}
+	result, err := exec(stmt)
+	if err == nil {
+		fileResult.add(stmt, result)
+		if useSavepoint {
+			_, err = exec("RELEASE SAVEPOINT " + savepoint)
+		}
+		return err
+	}
+
+	code := c.adapter.ErrorCode(err)
+	for _, ignoreCode := range strings.Split(ignoreCodes, ",") {
+		if code == "" || strings.TrimSpace(ignoreCode) != code {
+			continue
+		}
+		if useSavepoint {
+			if _, rberr := exec("ROLLBACK TO SAVEPOINT " + savepoint); rberr != nil {
+				return errors.Wrapf(rberr, "unable to rollback to savepoint after %s", err.Error())
+			}
+		}
+		c.logger("[ignore-error]", fileResult.Filename, code, err.Error())
+		fileResult.Statements = append(fileResult.Statements, StatementResult{SQL: stmt, RowsAffected: -1, IgnoredError: err.Error()})
+		return nil
+	}
+	return err
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"os"
 	"time"
@@ -28,7 +27,9 @@ func simpleDbmigrateUp() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	return m.MigrateUp(ctx, &sql.TxOptions{}, nil, func(currentFilename string) {
-		fmt.Println("[migrate up]", currentFilename) // optional print out of which file was migrated
+	return m.Up(ctx, dbmigrate.MigrateOptions{
+		AfterFile: func(currentFilename string) {
+			fmt.Println("[migrate up]", currentFilename) // optional print out of which file was migrated
+		},
 	})
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"os"
 	"time"
@@ -14,7 +13,7 @@ import (
 func sqlite3DbmigrateUp() error {
 	dbmigrate.Register("sqlite3", dbmigrate.Adapter{
 		CreateVersionsTable: func(_ *string) string {
-			return `CREATE TABLE dbmigrate_versions (version char(14) NOT NULL PRIMARY KEY)`
+			return `CREATE TABLE dbmigrate_versions (version varchar(255) NOT NULL PRIMARY KEY)`
 		},
 		SelectExistingVersions: func(_ *string) string { return `SELECT version FROM dbmigrate_versions ORDER BY version ASC` },
 		InsertNewVersion:       func(_ *string) string { return `INSERT INTO dbmigrate_versions (version) VALUES (?)` },
@@ -38,7 +37,9 @@ func sqlite3DbmigrateUp() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	return m.MigrateUp(ctx, &sql.TxOptions{}, nil, func(currentFilename string) {
-		fmt.Println("[migrate up]", currentFilename) // optional print out of which file was migrated
+	return m.Up(ctx, dbmigrate.MigrateOptions{
+		AfterFile: func(currentFilename string) {
+			fmt.Println("[migrate up]", currentFilename) // optional print out of which file was migrated
+		},
 	})
 }
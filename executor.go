@@ -0,0 +1,124 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate/sqlsplit"
+)
+
+// A Statement is one sql statement of a migration file, or a savepoint dbmigrate executes around it
+type Statement struct {
+	Filename string
+	SQL      string
+	Mode     DbTxnMode
+	Tx       ExecCommitRollbacker // transaction of the file, or the database itself with DbTxnModeNone
+}
+
+// Executor executes the statements of migration files, in every transaction mode
+type Executor interface {
+	Exec(ctx context.Context, stmt Statement) (sql.Result, error)
+}
+
+// ExecutorFunc adapts a function into an Executor
+type ExecutorFunc func(ctx context.Context, stmt Statement) (sql.Result, error)
+
+// Exec calls f(ctx, stmt)
+func (f ExecutorFunc) Exec(ctx context.Context, stmt Statement) (sql.Result, error) {
+	return f(ctx, stmt)
+}
+
+// Middleware wraps an Executor, e.g. to time, retry, log or route statements; see WithMiddleware
+type Middleware func(next Executor) Executor
+
+// exec executes `stmt` through the middlewares of WithMiddleware, the first one outermost
+func (c *Config) exec(ctx context.Context, stmt Statement) (sql.Result, error) {
+	var executor Executor = ExecutorFunc(c.execLogged)
+	if c.stripComments {
+		executor = StripCommentsMiddleware(c.adapter.SplitOptions)(executor)
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		executor = c.middlewares[i](executor)
+	}
+	return executor.Exec(ctx, stmt)
+}
+
+// TimingMiddleware logs how long each statement took
+func TimingMiddleware(logger func(...interface{})) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			started := time.Now()
+			result, err := next.Exec(ctx, stmt)
+			logger("[timing]", stmt.Filename, time.Since(started).String(), summarizeSQL(stmt.SQL))
+			return result, err
+		})
+	}
+}
+
+// LoggingMiddleware logs each statement before it is executed, and its error if any
+func LoggingMiddleware(logger func(...interface{})) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			logger("[exec]", stmt.Filename, summarizeSQL(stmt.SQL))
+			result, err := next.Exec(ctx, stmt)
+			if err != nil {
+				logger("[exec]", stmt.Filename, "error:", err.Error())
+			}
+			return result, err
+		})
+	}
+}
+
+// RetryMiddleware retries a statement that failed with a `retryable` error, up to `attempts` times
+// in total, waiting `delay` in between. Only DbTxnModeNone statements are retried: a failed
+// statement aborts the transaction of other modes, e.g. in postgres
+func RetryMiddleware(attempts int, delay time.Duration, retryable func(error) bool) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			result, err := next.Exec(ctx, stmt)
+			for attempt := 1; err != nil && attempt < attempts && stmt.Mode == DbTxnModeNone && retryable(err); attempt++ {
+				select {
+				case <-ctx.Done():
+					return result, err
+				case <-time.After(delay):
+				}
+				result, err = next.Exec(ctx, stmt)
+			}
+			return result, err
+		})
+	}
+}
+
+// DryRunMiddleware logs each statement instead of executing it. Versions are still recorded by the
+// VersionStore, so use it with a store that is thrown away, or a transaction mode other than
+// DbTxnModeNone and a later middleware or BeforeFile that fails the run
+func DryRunMiddleware(logger func(...interface{})) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			logger("[dry-run]", stmt.Filename, summarizeSQL(stmt.SQL))
+			return driver.RowsAffected(0), nil
+		})
+	}
+}
+
+// StripCommentsMiddleware removes comments from each statement before it is executed, for drivers and
+// proxies that reject them, see sqlsplit.StripComments; a statement of only comments is not executed
+func StripCommentsMiddleware(opts sqlsplit.Options) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			stmt.SQL = sqlsplit.StripComments(stmt.SQL, opts)
+			if isBlankStatement(stmt.SQL) {
+				return driver.RowsAffected(0), nil
+			}
+			return next.Exec(ctx, stmt)
+		})
+	}
+}
+
+// summarizeSQL returns `sqlText` on one line, for logs
+func summarizeSQL(sqlText string) string {
+	return strings.Join(strings.Fields(sqlText), " ")
+}
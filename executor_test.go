@@ -0,0 +1,123 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	var calls []string
+	named := func(name string) Middleware {
+		return func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+				calls = append(calls, name+" "+stmt.SQL)
+				return next.Exec(ctx, stmt)
+			})
+		}
+	}
+	c := &Config{}
+	WithMiddleware(named("outer"), named("inner"))(c)
+	_, err := c.exec(context.Background(), Statement{Filename: "20240102120000_a.up.sql", SQL: "SELECT 1", Tx: &noTx{db: db}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer SELECT 1", "inner SELECT 1"}, calls)
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	errTransient := errors.Errorf("deadlock detected")
+	testCases := []struct {
+		name          string
+		mode          DbTxnMode
+		failures      int
+		expectedCalls int
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			mode:          DbTxnModeNone,
+			failures:      2,
+			expectedCalls: 3,
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModeNone,
+			failures:      5,
+			expectedCalls: 3,
+			expectedError: "deadlock detected",
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModeAll,
+			failures:      1,
+			expectedCalls: 1,
+			expectedError: "deadlock detected",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			executor := RetryMiddleware(3, time.Millisecond, func(err error) bool { return err == errTransient })(
+				ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+					if calls++; calls <= tc.failures {
+						return nil, errTransient
+					}
+					return nil, nil
+				}))
+			_, err := executor.Exec(context.Background(), Statement{SQL: "UPDATE t SET a = 1", Mode: tc.mode})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestDryRunMiddleware(t *testing.T) {
+	var logs []string
+	logger := func(args ...interface{}) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(args...))) }
+	executor := DryRunMiddleware(logger)(ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+		t.Fatal("dry run should not execute statements")
+		return nil, nil
+	}))
+	result, err := executor.Exec(context.Background(), Statement{Filename: "20240102120000_a.up.sql", SQL: "UPDATE t\n   SET a = 1"})
+	assert.NoError(t, err)
+	rows, err := result.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rows)
+	assert.Equal(t, []string{"[dry-run] 20240102120000_a.up.sql UPDATE t SET a = 1"}, logs)
+}
+
+func TestWithoutComments(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	const filename = "20181222073750_a.up.sql"
+	dir := fstest.MapFS{filename: &fstest.MapFile{Data: []byte("-- create\nCREATE TABLE t (id int); -- trailing\n/* only a comment */;\nINSERT INTO t VALUES (1) /* one */;\n")}}
+	var logged []string
+	tx := &recordingTx{noTx: noTx{db: db}}
+	adapter := Adapter{BeginTx: func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil }}
+	c := &Config{dir: dir, db: db, adapter: adapter, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{filename}
+	WithStatementSplitting()(c)
+	WithoutComments()(c)
+	WithMiddleware(func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+			logged = append(logged, stmt.SQL)
+			return next.Exec(ctx, stmt)
+		})
+	})(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModePerFile}))
+	assert.Equal(t, []string{"\nCREATE TABLE t (id int);", "\nINSERT INTO t VALUES (1)  ;"}, tx.queries)
+	assert.Equal(t, "-- create\nCREATE TABLE t (id int);", logged[0], "middlewares see statements as written")
+}
@@ -0,0 +1,167 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResponder answers `query` with `args` on connection number `conn`; nil rows select nothing
+type fakeResponder func(conn int, query string, args []driver.Value) (*fakeRows, error)
+
+// fakeDB is a database/sql driver scripted by each test: statements are answered by `respond`,
+// one at a time, and recorded in `statements`. Open one with openFakeDB, so tests share no state
+type fakeDB struct {
+	respond fakeResponder
+	driver  driver.Driver // returned by Driver, when not fakeDriver
+
+	mu         sync.Mutex
+	conns      int
+	statements []string // executed or queried, followed by their arguments if any
+}
+
+// fakeRows are selected by fakeDB, each of `values` in the order of `columns`
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// fakeNoResult answers an Exec with no driver.Result, as go-sqlite3 does when the sql ends with a comment
+var fakeNoResult = &fakeRows{}
+
+// openFakeDB returns a database answering statements with `respond`, closed after `t`
+func openFakeDB(t testing.TB, respond fakeResponder) (*sql.DB, *fakeDB) {
+	f := &fakeDB{respond: respond}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// fakeValues answers each query with the next of comma separated numbers `values` in a `value`
+// column; the last one repeats
+func fakeValues(values string) fakeResponder {
+	remaining := strings.Split(values, ",")
+	return func(int, string, []driver.Value) (*fakeRows, error) {
+		value, err := strconv.ParseFloat(remaining[0], 64)
+		if len(remaining) > 1 {
+			remaining = remaining[1:]
+		}
+		return &fakeRows{columns: []string{"value"}, values: [][]driver.Value{{value}}}, err
+	}
+}
+
+// executed returns the statements recorded so far
+func (f *fakeDB) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.statements...)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conns++
+	return &fakeConn{f: f, id: f.conns}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	if f.driver == nil {
+		return fakeDriver{}
+	}
+	return f.driver
+}
+
+func (f *fakeDB) answer(conn int, query string, args []driver.Value) (*fakeRows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statement := query
+	if len(args) > 0 {
+		statement += " " + fmt.Sprint(args)
+	}
+	f.statements = append(f.statements, statement)
+	if f.respond == nil {
+		return nil, nil
+	}
+	return f.respond(conn, query, args)
+}
+
+// fakeDriver opens a fakeDB answering with fakeValues of the DSN; registered as "dbmigrate-fake"
+// for code that connects by driver name, e.g. New
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return (&fakeDB{respond: fakeValues(dsn)}).Connect(context.Background())
+}
+
+type fakeConn struct {
+	f  *fakeDB
+	id int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.c.f.answer(s.c.id, s.query, args)
+	if err != nil || rows == fakeNoResult {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.c.f.answer(s.c.id, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return &fakeRowsCursor{fakeRows: *rows}, nil
+}
+
+// fakeRowsCursor reads fakeRows, so the same fakeRows can be answered more than once
+type fakeRowsCursor struct {
+	fakeRows
+}
+
+func (r *fakeRowsCursor) Columns() []string { return r.columns }
+func (r *fakeRowsCursor) Close() error      { return nil }
+func (r *fakeRowsCursor) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("dbmigrate-fake", fakeDriver{})
+	Register("dbmigrate-fake", Adapter{
+		PingQuery: "SELECT 1",
+		BeginTx: func(_ context.Context, db *sql.DB, _ *sql.TxOptions) (ExecCommitRollbacker, error) {
+			return &noTx{db: db}, nil
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package dbmigrate
+
+import (
+	"strings"
+)
+
+// A Migration describes a migration file, e.g. for WithFileFilter
+type Migration struct {
+	Filename    string
+	Version     string
+	Direction   string            // "up" or "down"
+	Phase       Phase             // see FilePhase
+	Owner       string            // from `-- dbmigrate:owner` directive
+	Description string            // from `-- Description:` comment
+	Directives  map[string]string // `-- dbmigrate:<name> <value>` comment lines, e.g. a custom `-- dbmigrate:service billing`
+}
+
+// migration describes migration file `filename`; a file that cannot be read has no directives
+func (c *Config) migration(filename string) Migration {
+	result := Migration{
+		Filename:   filename,
+		Version:    c.versionOf(filename),
+		Direction:  directionUp,
+		Phase:      FilePhase(filename),
+		Directives: map[string]string{},
+	}
+	if strings.HasSuffix(filename, "down.sql") {
+		result.Direction = directionDown
+	}
+	if filecontent, err := c.fileContent(filename); err == nil {
+		result.Directives = parseDirectives(filecontent)
+		result.Owner = result.Directives["owner"]
+		result.Description = parseDescription(filecontent)
+	}
+	return result
+}
+
+// filtered returns false if WithFileFilter excludes migration file `filename`
+func (c *Config) filtered(filename string) bool {
+	return c.fileFilter == nil || c.fileFilter(c.migration(filename))
+}
@@ -0,0 +1,95 @@
+package dbmigrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigration(t *testing.T) {
+	c := &Config{dir: fstest.MapFS{
+		"20181222073750_seed.post.up.sql": &fstest.MapFile{Data: []byte("-- Description: sample rows\n-- dbmigrate:owner payments\n-- dbmigrate:service billing\nINSERT INTO t VALUES (1);")},
+	}}
+	assert.Equal(t, Migration{
+		Filename:    "20181222073750_seed.post.up.sql",
+		Version:     "20181222073750",
+		Direction:   directionUp,
+		Phase:       PhasePost,
+		Owner:       "payments",
+		Description: "sample rows",
+		Directives:  map[string]string{"owner": "payments", "service": "billing"},
+	}, c.migration("20181222073750_seed.post.up.sql"))
+
+	assert.Equal(t, Migration{
+		Filename:   "20181222073900_missing.down.sql",
+		Version:    "20181222073900",
+		Direction:  directionDown,
+		Phase:      PhasePre,
+		Directives: map[string]string{},
+	}, c.migration("20181222073900_missing.down.sql"))
+}
+
+func TestWithFileFilter(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073900_seed", "20181222073901_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+	noSeeds := func(m Migration) bool { return !strings.Contains(m.Filename, "_seed.") }
+
+	testCases := []struct {
+		name          string
+		applied       []string
+		down          bool
+		opts          MigrateOptions
+		expectedFiles []string
+	}{
+		{
+			name:          fileline(),
+			expectedFiles: []string{"20181222073750_a.up.sql", "20181222073901_c.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750", "20181222073900", "20181222073901"},
+			down:          true,
+			opts:          MigrateOptions{Steps: 2},
+			expectedFiles: []string{"20181222073901_c.down.sql", "20181222073750_a.down.sql"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{dir: dir, db: db, store: &fakeStore{versions: tc.applied}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			WithFileFilter(noSeeds)(c)
+			for name := range dir {
+				c.migrationFiles = append(c.migrationFiles, name)
+			}
+			sort.Strings(c.migrationFiles)
+
+			var files []string
+			tc.opts.Mode = DbTxnModeNone
+			tc.opts.AfterFile = func(filename string) { files = append(files, filename) }
+			if tc.down {
+				assert.NoError(t, c.Down(context.Background(), tc.opts))
+			} else {
+				assert.NoError(t, c.Up(context.Background(), tc.opts))
+			}
+			assert.Equal(t, tc.expectedFiles, files)
+		})
+	}
+
+	c := &Config{dir: dir, db: db, store: &fakeStore{}}
+	WithFileFilter(noSeeds)(c)
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+	pending, err := c.PendingVersions(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20181222073750", "20181222073901"}, pending)
+}
@@ -0,0 +1,67 @@
+package dbmigrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dbObject is a table, view or sequence listed by Adapter.SelectObjects
+type dbObject struct {
+	Kind string // e.g. `TABLE`, `VIEW` or `SEQUENCE`
+	Name string // quoted and qualified by schema where applicable
+}
+
+// selectObjects returns the objects in `schema`; nil if there are no WithObjectFixups
+func (c *Config) selectObjects(ctx context.Context, schema *string) (map[dbObject]bool, error) {
+	if len(c.objectFixups) == 0 {
+		return nil, nil
+	}
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectObjects(schema))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list objects")
+	}
+	defer rows.Close()
+	objects := map[dbObject]bool{}
+	for rows.Next() {
+		var o dbObject
+		if err := rows.Scan(&o.Kind, &o.Name); err != nil {
+			return nil, err
+		}
+		objects[o] = true
+	}
+	return objects, rows.Err()
+}
+
+// fixupObjects executes each WithObjectFixups statement for every object in `schema` that is not
+// in `before`, i.e. created by the run, with `{kind}` and `{object}` replaced
+func (c *Config) fixupObjects(ctx context.Context, schema *string, before map[dbObject]bool) error {
+	if before == nil {
+		return nil
+	}
+	after, err := c.selectObjects(ctx, schema)
+	if err != nil {
+		return err
+	}
+	var created []dbObject
+	for o := range after {
+		if !before[o] {
+			created = append(created, o)
+		}
+	}
+	sort.Slice(created, func(i, j int) bool { return created[i].Name < created[j].Name })
+
+	for _, o := range created {
+		replacer := strings.NewReplacer("{kind}", o.Kind, "{object}", o.Name)
+		for _, fixup := range c.objectFixups {
+			stmt := replacer.Replace(fixup)
+			if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+				return errors.Wrapf(err, "fixup %s", stmt)
+			}
+			c.logger("[fixup]", stmt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixupObjects(t *testing.T) {
+	var objects [][]driver.Value
+	db, fake := openFakeDB(t, func(int, string, []driver.Value) (*fakeRows, error) {
+		return &fakeRows{columns: []string{"kind", "name"}, values: objects}, nil
+	})
+
+	c := &Config{db: db, adapter: Adapter{SelectObjects: func(*string) string { return "objects" }}, logger: func(...interface{}) {}}
+	before, err := c.selectObjects(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, before, "no fixups, no need to list")
+
+	WithObjectFixups("GRANT SELECT ON {object} TO app_ro", "ALTER {kind} {object} OWNER TO app")(c)
+	objects = [][]driver.Value{{"TABLE", `public."users"`}}
+	before, err = c.selectObjects(context.Background(), nil)
+	assert.NoError(t, err)
+
+	objects = [][]driver.Value{{"TABLE", `public."users"`}, {"VIEW", `public."active_users"`}, {"SEQUENCE", `public."orders_id_seq"`}}
+	assert.NoError(t, c.fixupObjects(context.Background(), nil, before))
+	assert.Equal(t, []string{
+		"objects",
+		"objects",
+		`GRANT SELECT ON public."active_users" TO app_ro`,
+		`ALTER VIEW public."active_users" OWNER TO app`,
+		`GRANT SELECT ON public."orders_id_seq" TO app_ro`,
+		`ALTER SEQUENCE public."orders_id_seq" OWNER TO app`,
+	}, fake.executed())
+}
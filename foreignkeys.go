@@ -0,0 +1,75 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// queryer is implemented by *sql.Tx and *sql.DB
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// checkForeignKeys returns an error if ForeignKeyCheckQuery of the adapter reports violations
+// with WithDeferredForeignKeys; queried within `tx` where possible, so violations are rolled back
+func (c *Config) checkForeignKeys(ctx context.Context, tx ExecCommitRollbacker) error {
+	if !c.deferForeignKeys {
+		return nil
+	}
+	var q queryer = c.db
+	if txq, ok := tx.(queryer); ok {
+		q = txq
+	}
+	rows, err := q.QueryContext(ctx, c.adapter.ForeignKeyCheckQuery)
+	if err != nil {
+		return errors.Wrapf(err, "unable to check foreign keys")
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	count, example := 0, ""
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		if count == 0 && len(values) > 0 {
+			if b, ok := values[0].([]byte); ok {
+				values[0] = string(b)
+			}
+			example = fmt.Sprint(values[0])
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.Errorf("%d foreign key violation(s), e.g. in %s", count, example)
+	}
+	return nil
+}
+
+// deferConstraints runs DeferConstraintsQuery of the adapter for a file with `-- dbmigrate:defer-constraints`
+// directive, so rows linked by foreign keys can be reordered within the transaction and are
+// only checked at commit. With DbTxnModeAll, the following files of the run are deferred too
+func (c *Config) deferConstraints(ctx context.Context, tx ExecCommitRollbacker, mode DbTxnMode, filename string) error {
+	if c.adapter.DeferConstraintsQuery == "" {
+		return errors.Errorf("database does not support `defer-constraints` directive")
+	}
+	if mode == DbTxnModeNone {
+		return errors.Errorf("`defer-constraints` directive requires a transaction, not transaction mode %q", mode)
+	}
+	_, err := c.exec(ctx, Statement{Filename: filename, SQL: c.adapter.DeferConstraintsQuery, Mode: mode, Tx: tx})
+	return errors.Wrapf(err, "unable to defer constraints")
+}
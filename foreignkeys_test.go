@@ -0,0 +1,94 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckForeignKeys(t *testing.T) {
+	testCases := []struct {
+		name          string
+		violations    [][]driver.Value
+		deferred      bool
+		expectedError string
+	}{
+		{
+			name:       fileline(),
+			violations: [][]driver.Value{{[]byte("child"), int64(1), "parent", int64(0)}},
+			deferred:   false,
+		},
+		{
+			name:     fileline(),
+			deferred: true,
+		},
+		{
+			name:          fileline(),
+			violations:    [][]driver.Value{{[]byte("child"), int64(1), "parent", int64(0)}},
+			deferred:      true,
+			expectedError: "1 foreign key violation(s), e.g. in child",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, func(int, string, []driver.Value) (*fakeRows, error) {
+				return &fakeRows{columns: []string{"table", "rowid", "parent", "fkid"}, values: tc.violations}, nil
+			})
+			c := &Config{
+				db:               db,
+				deferForeignKeys: tc.deferred,
+				adapter:          Adapter{ForeignKeyCheckQuery: "PRAGMA foreign_key_check"},
+			}
+			err := c.checkForeignKeys(context.Background(), nil)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equal(t, tc.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestDeferConstraints(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	testCases := []struct {
+		name          string
+		query         string
+		mode          DbTxnMode
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			query:         "",
+			mode:          DbTxnModeAll,
+			expectedError: "database does not support `defer-constraints` directive",
+		},
+		{
+			name:          fileline(),
+			query:         "SET CONSTRAINTS ALL DEFERRED",
+			mode:          DbTxnModeNone,
+			expectedError: "`defer-constraints` directive requires a transaction, not transaction mode \"none\"",
+		},
+		{
+			name:  fileline(),
+			query: "SET CONSTRAINTS ALL DEFERRED",
+			mode:  DbTxnModePerFile,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{db: db, adapter: Adapter{DeferConstraintsQuery: tc.query}}
+			err := c.deferConstraints(context.Background(), &noTx{db: db}, tc.mode, "20240102120000_swap.up.sql")
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equal(t, tc.expectedError, err.Error())
+			}
+		})
+	}
+}
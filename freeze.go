@@ -0,0 +1,88 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Freeze stops Up and Down from applying files until Unfreeze, e.g. during an incident or a long
+// data migration, whoever triggers them; see WithIgnoreFreeze
+type Freeze struct {
+	Reason   string    `json:"reason"`
+	FrozenBy string    `json:"frozen_by"` // WithAppliedBy of the process that froze migrations, or its host and pid
+	FrozenAt time.Time `json:"frozen_at"`
+}
+
+// Freeze stores a Freeze with `reason` in the database, replacing an earlier one
+func (c *Config) Freeze(ctx context.Context, schema *string, reason string) error {
+	if c.adapter.CreateFreezeTable == nil {
+		return errors.Errorf("database does not support freeze")
+	}
+	if _, err := c.db.ExecContext(ctx, c.adapter.CreateFreezeTable(schema)); err != nil {
+		return errors.Wrapf(err, "unable to create freeze table")
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create transaction")
+	}
+	defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
+	if _, err := tx.ExecContext(ctx, c.adapter.DeleteFreeze(schema)); err != nil {
+		return errors.Wrapf(err, "unable to replace freeze")
+	}
+	frozenBy := c.appliedBy
+	if frozenBy == "" {
+		frozenBy = processName()
+	}
+	if _, err := tx.ExecContext(ctx, c.adapter.InsertFreeze(schema), reason, frozenBy, time.Now().UTC()); err != nil {
+		return errors.Wrapf(err, "unable to freeze")
+	}
+	return commit(tx)
+}
+
+// Unfreeze removes the Freeze from the database, if any
+func (c *Config) Unfreeze(ctx context.Context, schema *string) error {
+	if c.adapter.CreateFreezeTable == nil {
+		return errors.Errorf("database does not support freeze")
+	}
+	if _, err := c.db.ExecContext(ctx, c.adapter.CreateFreezeTable(schema)); err != nil {
+		return errors.Wrapf(err, "unable to create freeze table")
+	}
+	_, err := c.db.ExecContext(ctx, c.adapter.DeleteFreeze(schema))
+	return errors.Wrapf(err, "unable to unfreeze")
+}
+
+// Frozen returns the Freeze stored in the database; nil if none, or the adapter does not support it
+func (c *Config) Frozen(ctx context.Context, schema *string) (*Freeze, error) {
+	if c.adapter.CreateFreezeTable == nil {
+		return nil, nil
+	}
+	if _, err := c.db.ExecContext(ctx, c.adapter.CreateFreezeTable(schema)); err != nil {
+		return nil, errors.Wrapf(err, "unable to create freeze table")
+	}
+	var f Freeze
+	switch err := c.db.QueryRowContext(ctx, c.adapter.SelectFreeze(schema)).Scan(&f.Reason, &f.FrozenBy, &f.FrozenAt); err {
+	case nil:
+		return &f, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(err, "unable to query freeze")
+	}
+}
+
+// checkFrozen returns an error if migrations are frozen, unless WithIgnoreFreeze
+func (c *Config) checkFrozen(ctx context.Context, schema *string) error {
+	f, err := c.Frozen(ctx, schema)
+	if err != nil || f == nil {
+		return err
+	}
+	since := f.FrozenAt.Local().Format(time.RFC3339)
+	if c.ignoreFreeze {
+		c.logger("[freeze] ignoring freeze by", f.FrozenBy, "since", since+":", f.Reason)
+		return nil
+	}
+	return errors.Errorf("migrations are frozen by %s since %s: %s; unfreeze, or override with -ignore-freeze", f.FrozenBy, since, f.Reason)
+}
@@ -0,0 +1,76 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeze(t *testing.T) {
+	var frozen []driver.Value // row kept from `INSERT` until `DELETE`
+	db, _ := openFakeDB(t, func(_ int, query string, args []driver.Value) (*fakeRows, error) {
+		switch query {
+		case "INSERT":
+			frozen = args
+		case "DELETE":
+			frozen = nil
+		case "SELECT":
+			rows := &fakeRows{columns: []string{"reason", "frozen_by", "frozen_at"}}
+			if frozen != nil {
+				rows.values = [][]driver.Value{frozen}
+			}
+			return rows, nil
+		}
+		return nil, nil
+	})
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	ctx := context.Background()
+	c := &Config{dir: dir, db: db, store: &fakeStore{}, appliedBy: "dba", logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073750_a.down.sql"}
+
+	f, err := c.Frozen(ctx, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, f, "adapter does not support freeze")
+	assert.EqualError(t, c.Freeze(ctx, nil, "incident"), "database does not support freeze")
+
+	c.adapter.CreateFreezeTable = func(*string) string { return "CREATE" }
+	c.adapter.InsertFreeze = func(*string) string { return "INSERT" }
+	c.adapter.DeleteFreeze = func(*string) string { return "DELETE" }
+	c.adapter.SelectFreeze = func(*string) string { return "SELECT" }
+	c.adapter.BeginTx = func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error) {
+		return &noTx{db: db}, nil
+	}
+
+	assert.NoError(t, c.Freeze(ctx, nil, "incident 42"))
+	f, err = c.Frozen(ctx, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, f) {
+		assert.Equal(t, "incident 42", f.Reason)
+		assert.Equal(t, "dba", f.FrozenBy)
+		assert.WithinDuration(t, time.Now(), f.FrozenAt, time.Minute)
+	}
+	err = c.Up(ctx, MigrateOptions{Mode: DbTxnModeNone})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "migrations are frozen by dba since ")
+		assert.Contains(t, err.Error(), ": incident 42; unfreeze, or override with -ignore-freeze")
+	}
+
+	WithIgnoreFreeze()(c)
+	assert.NoError(t, c.Up(ctx, MigrateOptions{Mode: DbTxnModeNone}))
+
+	c.ignoreFreeze = false
+	assert.NoError(t, c.Unfreeze(ctx, nil))
+	f, err = c.Frozen(ctx, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+	assert.NoError(t, c.Up(ctx, MigrateOptions{Mode: DbTxnModeNone}))
+}
@@ -0,0 +1,85 @@
+package dbmigrate
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A GraphNode is an `.up.sql` file in the result of Graph
+type GraphNode struct {
+	Version     string   `json:"version"`
+	Name        string   `json:"name"` // from filename, e.g. `create-users`
+	Filename    string   `json:"filename"`
+	Phase       Phase    `json:"phase"`
+	Description string   `json:"description,omitempty"` // from `-- Description:` comment
+	Depends     []string `json:"depends,omitempty"`     // from `-- dbmigrate:depends <version>, ...`
+	Applied     bool     `json:"applied"`               // version is in `applied` given to Graph
+}
+
+// Graph returns the `.up.sql` files of `dir` in version order, e.g. to draw a timeline of a big
+// migration campaign. Versions that a file relies on can be declared with
+// `-- dbmigrate:depends <version>, ...`; each must be the version of an earlier file
+func Graph(dir fs.FS, applied []string) ([]GraphNode, error) {
+	migrationFiles, err := listMigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{dir: dir, normalize: true, migrationFiles: migrationFiles}
+	isApplied := map[string]bool{}
+	for _, version := range applied {
+		isApplied[version] = true
+	}
+
+	var filenames []string
+	for _, currName := range c.migrationFiles {
+		if strings.HasSuffix(currName, "up.sql") {
+			filenames = append(filenames, currName)
+		}
+	}
+	sort.Strings(filenames)
+
+	var result []GraphNode
+	earlier := map[string]bool{}
+	for _, currName := range filenames {
+		if _, err := c.fileContent(currName); err != nil {
+			return nil, err // c.migration ignores unreadable files
+		}
+		m := c.migration(currName)
+		node := GraphNode{
+			Version:     m.Version,
+			Name:        graphNodeName(currName),
+			Filename:    currName,
+			Phase:       m.Phase,
+			Description: m.Description,
+			Applied:     isApplied[m.Version],
+		}
+		for _, version := range strings.Split(m.Directives["depends"], ",") {
+			if version = strings.TrimSpace(version); version == "" {
+				continue
+			}
+			if !earlier[version] {
+				return nil, errors.Errorf("%s: depends on %s, which is not the version of an earlier file", currName, version)
+			}
+			node.Depends = append(node.Depends, version)
+		}
+		earlier[m.Version] = true
+		result = append(result, node)
+	}
+	return result, nil
+}
+
+// graphNodeName returns the description part of migration file `name`, e.g. `create-users`
+func graphNodeName(name string) string {
+	name = path.Base(name)
+	for _, suffix := range []string{".post.up.sql", ".up.sql"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if i := strings.Index(name, "_"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
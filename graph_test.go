@@ -0,0 +1,56 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dir         fstest.MapFS
+		applied     []string
+		expected    []GraphNode
+		expectedErr string
+	}{
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_create-users.up.sql":       {Data: []byte("-- Description: users of the app\nCREATE TABLE users (id int);")},
+				"20181222073750_create-users.down.sql":     {Data: []byte("DROP TABLE users;")},
+				"20181222073900_backfill-emails.up.sql":    {Data: []byte("-- dbmigrate:depends 20181222073750\nUPDATE users SET email = '';")},
+				"20181222074000_drop-legacy.post.up.sql":   {Data: []byte("-- dbmigrate:depends 20181222073750, 20181222073900\nDROP TABLE legacy;")},
+				"20181222074000_drop-legacy.post.down.sql": {Data: []byte("CREATE TABLE legacy (id int);")},
+				"20181222074100_add-index.up.sql":          {Data: []byte("CREATE INDEX idx ON users (email);")},
+			},
+			applied: []string{"20181222073750"},
+			expected: []GraphNode{
+				{Version: "20181222073750", Name: "create-users", Filename: "20181222073750_create-users.up.sql", Phase: PhasePre, Description: "users of the app", Applied: true},
+				{Version: "20181222073900", Name: "backfill-emails", Filename: "20181222073900_backfill-emails.up.sql", Phase: PhasePre, Depends: []string{"20181222073750"}},
+				{Version: "20181222074000", Name: "drop-legacy", Filename: "20181222074000_drop-legacy.post.up.sql", Phase: PhasePost, Depends: []string{"20181222073750", "20181222073900"}},
+				{Version: "20181222074100", Name: "add-index", Filename: "20181222074100_add-index.up.sql", Phase: PhasePre},
+			},
+		},
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_a.up.sql": {Data: []byte("-- dbmigrate:depends 20181222073900\nSELECT 1;")},
+				"20181222073900_b.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			expectedErr: "20181222073750_a.up.sql: depends on 20181222073900, which is not the version of an earlier file",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes, err := Graph(tc.dir, tc.applied)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, nodes)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoryEntry is one applied (or reverted) migration file recorded in `dbmigrate_history`
+type HistoryEntry struct {
+	Version     string        `json:"version"`
+	Direction   string        `json:"direction"`
+	AppliedAt   time.Time     `json:"applied_at"`
+	Duration    time.Duration `json:"duration"`
+	Checksum    string        `json:"checksum"`
+	AppliedBy   string        `json:"applied_by"`
+	Remark      string        `json:"remark,omitempty"`
+	RunID       string        `json:"run_id"`
+	Owner       string        `json:"owner,omitempty"`       // from `-- dbmigrate:owner` directive of the file in `dir`
+	Description string        `json:"description,omitempty"` // from `-- Description:` comment of the file in `dir`
+}
+
+// History returns applied (and reverted) versions, oldest first
+func (c *Config) History(ctx context.Context, schema *string) ([]HistoryEntry, error) {
+	entries, err := c.store.History(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	owners, descriptions := c.versionOwners(), c.versionDescriptions()
+	for i := range entries {
+		entries[i].Owner = owners[entries[i].Version]
+		entries[i].Description = descriptions[entries[i].Version]
+	}
+	return entries, nil
+}
+
+// parseTimestamp converts a scanned timestamp column; some drivers, e.g. mysql without
+// `parseTime=true`, return text instead of time.Time
+func parseTimestamp(value interface{}) (time.Time, error) {
+	var s string
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return time.Time{}, errors.Errorf("unsupported timestamp %#v", value)
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.Errorf("unsupported timestamp %q", s)
+}
@@ -0,0 +1,69 @@
+package dbmigrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	expected := time.Date(2018, 12, 22, 10, 20, 1, 439000000, time.UTC)
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected time.Time
+		wantErr  bool
+	}{
+		{
+			name:     fileline(),
+			value:    expected.In(time.FixedZone("SGT", 8*3600)),
+			expected: expected,
+		},
+		{
+			name:     fileline(),
+			value:    []byte("2018-12-22 10:20:01.439"),
+			expected: expected,
+		},
+		{
+			name:     fileline(),
+			value:    "2018-12-22 18:20:01.439+08:00",
+			expected: expected,
+		},
+		{
+			name:     fileline(),
+			value:    "2018-12-22T10:20:01.439Z",
+			expected: expected,
+		},
+		{
+			name:    fileline(),
+			value:   "yesterday",
+			wantErr: true,
+		},
+		{
+			name:    fileline(),
+			value:   int64(1545474001),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseTimestamp(tc.value)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	now := time.Date(2018, 12, 22, 10, 20, 1, 0, time.FixedZone("SGT", 8*3600))
+	a, b := newRunID(now), newRunID(now)
+	assert.Regexp(t, `^20181222022001-[0-9a-f]{8}$`, a)
+	assert.NotEqual(t, a, b)
+}
@@ -0,0 +1,37 @@
+package dbmigrate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxIdentifierLength is the postgres limit; mysql allows 64
+const maxIdentifierLength = 63
+
+// ValidateIdentifier returns an error unless `name` is a plausible schema, database or tenant name:
+// letters, digits, `_`, `$` or `-`, starting with a letter or `_`. Such names are quoted in generated
+// sql, but may also end up in connection urls and file names, e.g. when they come from tenant input
+func ValidateIdentifier(name string) error {
+	if name == "" {
+		return errors.Errorf("identifier is empty")
+	}
+	if len(name) > maxIdentifierLength {
+		return errors.Errorf("identifier %q is longer than %d characters", name, maxIdentifierLength)
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && (r == '$' || r == '-' || ('0' <= r && r <= '9')):
+		default:
+			return errors.Errorf("identifier %q has unexpected character %q at position %d", name, r, i+1)
+		}
+	}
+	return nil
+}
+
+// pgName quotes `s` as a postgres identifier, folded to lowercase like an unquoted identifier, so
+// `MySchema` refers to the same schema as before quoting while `my-schema` also works
+func pgName(s string) string {
+	return pgIdentifier(strings.ToLower(s))
+}
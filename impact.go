@@ -0,0 +1,124 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An Impact estimates the cost of a pending statement, so risky migrations can be scheduled
+type Impact struct {
+	Filename  string `json:"filename"`
+	Statement int    `json:"statement"` // 1-based position in file
+	Table     string `json:"table,omitempty"`
+	LockLevel string `json:"lock_level,omitempty"` // e.g. ACCESS EXCLUSIVE; empty if unknown
+	Blocks    string `json:"blocks,omitempty"`     // "reads and writes", "writes" or empty
+	Rows      int64  `json:"rows"`                 // estimated; -1 if unknown
+	Bytes     int64  `json:"bytes"`                // -1 if unknown
+}
+
+var impactTable = regexp.MustCompile(`^(?:ALTER TABLE|UPDATE|DELETE FROM|INSERT INTO|TRUNCATE(?: TABLE)?|DROP TABLE|VACUUM FULL|CLUSTER|REINDEX TABLE|LOCK(?: TABLE)?|CREATE (?:UNIQUE )?INDEX (?:CONCURRENTLY )?(?:IF NOT EXISTS )?(?:\S+ )?ON)(?: IF EXISTS)?(?: ONLY)? ([\w."]+)`)
+
+// statementTable returns the table name, without schema, that a normalized statement changes
+func statementTable(stmt string) string {
+	m := impactTable.FindStringSubmatch(stmt)
+	if m == nil {
+		return ""
+	}
+	parts := strings.Split(m[1], ".")
+	return strings.Trim(parts[len(parts)-1], `"`)
+}
+
+var (
+	pgShareUpdateExclusive = regexp.MustCompile(`^(CREATE (UNIQUE )?INDEX CONCURRENTLY|DROP INDEX CONCURRENTLY|REINDEX .*CONCURRENTLY|VACUUM$|VACUUM [^F]|ANALYZE|ALTER TABLE .* VALIDATE CONSTRAINT)`)
+	pgShare                = regexp.MustCompile(`^(CREATE (UNIQUE )?INDEX|REINDEX)`)
+	pgShareRowExclusive    = regexp.MustCompile(`^(ALTER TABLE .* ADD (CONSTRAINT \S+ )?FOREIGN KEY|CREATE TRIGGER)`)
+	pgAccessExclusive      = regexp.MustCompile(`^(ALTER TABLE|DROP TABLE|DROP INDEX|TRUNCATE|VACUUM FULL|CLUSTER|LOCK)`)
+	pgRowExclusive         = regexp.MustCompile(`^(UPDATE|DELETE|INSERT|MERGE)`)
+)
+
+// pgLockLevel returns the table lock a normalized statement takes in postgres
+func pgLockLevel(stmt string) string {
+	switch {
+	case pgShareUpdateExclusive.MatchString(stmt):
+		return "SHARE UPDATE EXCLUSIVE"
+	case pgShare.MatchString(stmt):
+		return "SHARE"
+	case pgShareRowExclusive.MatchString(stmt):
+		return "SHARE ROW EXCLUSIVE"
+	case pgAccessExclusive.MatchString(stmt):
+		return "ACCESS EXCLUSIVE"
+	case pgRowExclusive.MatchString(stmt):
+		return "ROW EXCLUSIVE"
+	}
+	return ""
+}
+
+// lockBlocks returns what concurrent queries a lock level blocks
+func lockBlocks(lockLevel string) string {
+	switch lockLevel {
+	case "ACCESS EXCLUSIVE":
+		return "reads and writes"
+	case "SHARE", "SHARE ROW EXCLUSIVE", "EXCLUSIVE":
+		return "writes"
+	}
+	return ""
+}
+
+type tableSize struct {
+	rows, bytes int64
+}
+
+// Impact returns the estimated impact of each statement in pending `up.sql` files
+func (c *Config) Impact(ctx context.Context, schema *string) ([]Impact, error) {
+	migratedVersions, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+
+	sizes := map[string]tableSize{}
+	if c.adapter.SelectTableSizes != nil {
+		rows, err := c.db.QueryContext(ctx, c.adapter.SelectTableSizes(schema))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to query table sizes")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			var size tableSize
+			if err := rows.Scan(&name, &size.rows, &size.bytes); err != nil {
+				return nil, err
+			}
+			sizes[strings.ToUpper(name)] = size
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []Impact
+	for _, currName := range c.pendingFiles(migratedVersions) {
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, err
+		}
+		for i, stmt := range splitStatements(string(filecontent)) {
+			if isBlankStatement(stmt) {
+				continue
+			}
+			normalized := normalizeStatement(stmt)
+			impact := Impact{Filename: currName, Statement: i + 1, Table: strings.ToLower(statementTable(normalized)), Rows: -1, Bytes: -1}
+			if c.adapter.LockLevel != nil {
+				impact.LockLevel = c.adapter.LockLevel(normalized)
+				impact.Blocks = lockBlocks(impact.LockLevel)
+			}
+			if size, ok := sizes[strings.ToUpper(impact.Table)]; ok {
+				impact.Rows, impact.Bytes = size.rows, size.bytes
+			}
+			result = append(result, impact)
+		}
+	}
+	return result, nil
+}
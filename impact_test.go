@@ -0,0 +1,78 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementImpact(t *testing.T) {
+	testCases := []struct {
+		name      string
+		given     string
+		table     string
+		lockLevel string
+		blocks    string
+	}{
+		{
+			name:      fileline(),
+			given:     "alter table public.users\n  add column age int; -- why",
+			table:     "USERS",
+			lockLevel: "ACCESS EXCLUSIVE",
+			blocks:    "reads and writes",
+		},
+		{
+			name:      fileline(),
+			given:     "CREATE INDEX idx_users_email ON users (email)",
+			table:     "USERS",
+			lockLevel: "SHARE",
+			blocks:    "writes",
+		},
+		{
+			name:      fileline(),
+			given:     "CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx ON \"Users\" (email)",
+			table:     "USERS",
+			lockLevel: "SHARE UPDATE EXCLUSIVE",
+		},
+		{
+			name:      fileline(),
+			given:     "ALTER TABLE orders ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID",
+			table:     "ORDERS",
+			lockLevel: "SHARE ROW EXCLUSIVE",
+			blocks:    "writes",
+		},
+		{
+			name:      fileline(),
+			given:     "ALTER TABLE orders VALIDATE CONSTRAINT fk_user",
+			table:     "ORDERS",
+			lockLevel: "SHARE UPDATE EXCLUSIVE",
+		},
+		{
+			name:      fileline(),
+			given:     "UPDATE users SET active = true WHERE active IS NULL",
+			table:     "USERS",
+			lockLevel: "ROW EXCLUSIVE",
+		},
+		{
+			name:      fileline(),
+			given:     "TRUNCATE TABLE ONLY sessions",
+			table:     "SESSIONS",
+			lockLevel: "ACCESS EXCLUSIVE",
+			blocks:    "reads and writes",
+		},
+		{
+			name:  fileline(),
+			given: "CREATE TABLE users (id int)",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			normalized := normalizeStatement(tc.given)
+			assert.Equal(t, tc.table, statementTable(normalized))
+			assert.Equal(t, tc.lockLevel, pgLockLevel(normalized))
+			assert.Equal(t, tc.blocks, lockBlocks(pgLockLevel(normalized)))
+		})
+	}
+}
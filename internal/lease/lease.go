@@ -0,0 +1,62 @@
+// Package lease has the helpers shared by lock and credentials providers whose leases expire
+// unless renewed
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	DefaultTTL           = 30 * time.Second      // of locks held by providers, unless configured
+	DefaultRetryInterval = time.Second           // between attempts while a lock is held elsewhere
+	MinRenewInterval     = 10 * time.Millisecond // of KeepAlive, e.g. for a ttl under 30ms
+)
+
+// ProcessName identifies this process, e.g. `web-1[42]`
+func ProcessName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s[%d]", hostname, os.Getpid())
+}
+
+// Token identifies the holder of a lock, so only the holder renews or releases it
+func Token() string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	return ProcessName() + "-" + hex.EncodeToString(random)
+}
+
+// KeepAlive calls `renew` every third of `ttl`, but not more often than MinRenewInterval, until
+// the returned func is called
+func KeepAlive(ttl time.Duration, renew func(context.Context) error) (stop func()) {
+	interval := ttl / 3
+	if interval < MinRenewInterval {
+		interval = MinRenewInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renew(ctx) // a failed renewal is retried until the lease expires
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,35 @@
+package lease
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAlive(t *testing.T) {
+	testCases := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{name: "renews every third of ttl", ttl: 30 * time.Millisecond},
+		{name: "tiny ttl is clamped instead of panicking", ttl: time.Nanosecond},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var renewals int32
+			stop := KeepAlive(tc.ttl, func(context.Context) error {
+				atomic.AddInt32(&renewals, 1)
+				return nil
+			})
+			time.Sleep(5 * MinRenewInterval)
+			stop()
+			count := atomic.LoadInt32(&renewals)
+			assert.True(t, count > 0 && count <= 5, "renewed %d times", count)
+			time.Sleep(2 * MinRenewInterval)
+			assert.Equal(t, count, atomic.LoadInt32(&renewals), "not renewed after stop")
+		})
+	}
+}
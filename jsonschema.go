@@ -0,0 +1,184 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jsonSchema is the subset of a JSON Schema that JSONSchemaSQL reads
+type jsonSchema struct {
+	Title      string          `json:"title"`
+	Table      string          `json:"x-table"` // overrides the table name derived from title or filename
+	Required   []string        `json:"required"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// jsonSchemaProperty is a property of a jsonSchema, stored as a column
+type jsonSchemaProperty struct {
+	Type   interface{} `json:"type"` // e.g. "string", or ["string", "null"]
+	Format string      `json:"format"`
+	Index  bool        `json:"x-index"`  // creates an index on the column
+	Unique bool        `json:"x-unique"` // creates a unique index on the column
+}
+
+var nonWordRuns = regexp.MustCompile(`[^a-z0-9]+`)
+
+// snakeCase returns `s` in lowercase with runs of other characters replaced by `_`, e.g. `OrderPlaced` as `order_placed`
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' && i > 0 && s[i-1] >= 'a' && s[i-1] <= 'z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.Trim(nonWordRuns.ReplaceAllString(strings.ToLower(b.String()), "_"), "_")
+}
+
+// jsonSchemaColumnType returns the postgres column type of `p`
+func jsonSchemaColumnType(p jsonSchemaProperty) (string, bool) {
+	types, nullable := []string{}, false
+	switch t := p.Type.(type) {
+	case string:
+		types = append(types, t)
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s == "null" {
+				nullable = true
+			} else if ok {
+				types = append(types, s)
+			}
+		}
+	}
+	if len(types) != 1 {
+		return "jsonb", nullable
+	}
+	switch types[0] {
+	case "string":
+		switch p.Format {
+		case "date-time":
+			return "timestamptz", nullable
+		case "date":
+			return "date", nullable
+		case "uuid":
+			return "uuid", nullable
+		}
+		return "text", nullable
+	case "integer":
+		return "bigint", nullable
+	case "number":
+		return "double precision", nullable
+	case "boolean":
+		return "boolean", nullable
+	}
+	return "jsonb", nullable
+}
+
+// orderedKeys returns the keys of json object `raw` in the order they are written
+func orderedKeys(raw json.RawMessage) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, token.(string))
+		var skip json.RawMessage
+		if err := decoder.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// jsonSchemaTable returns `CREATE TABLE` and `CREATE INDEX` statements storing documents of JSON Schema `content`
+func jsonSchemaTable(filename string, content []byte) (string, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return "", errors.Wrapf(err, filename)
+	}
+	table := schema.Table
+	if table == "" && schema.Title != "" {
+		table = snakeCase(schema.Title)
+	} else if table == "" {
+		table = snakeCase(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+	}
+	if err := ValidateIdentifier(table); err != nil {
+		return "", errors.Wrapf(err, "%s: invalid table name", filename)
+	}
+	var properties map[string]jsonSchemaProperty
+	if err := json.Unmarshal(schema.Properties, &properties); err != nil || len(properties) == 0 {
+		return "", errors.Errorf("%s: no properties to store as columns", filename)
+	}
+	keys, err := orderedKeys(schema.Properties)
+	if err != nil {
+		return "", errors.Wrapf(err, filename)
+	}
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	var columns, indexes []string
+	for _, key := range keys {
+		column := snakeCase(key)
+		typ, nullable := jsonSchemaColumnType(properties[key])
+		definition := column + " " + typ
+		switch {
+		case column == "id":
+			definition += " PRIMARY KEY"
+		case required[key] && !nullable:
+			definition += " NOT NULL"
+		}
+		columns = append(columns, definition)
+		if p := properties[key]; p.Unique {
+			indexes = append(indexes, fmt.Sprintf("CREATE UNIQUE INDEX %s_%s_key ON %s (%s);", table, column, table, column))
+		} else if p.Index {
+			indexes = append(indexes, fmt.Sprintf("CREATE INDEX %s_%s_idx ON %s (%s);", table, column, table, column))
+		}
+	}
+	return "CREATE TABLE " + table + " (\n\t" + strings.Join(columns, ",\n\t") + "\n);\n" + strings.Join(append(indexes, ""), "\n"), nil
+}
+
+// JSONSchemaSQL returns a declarative schema, for DiffSchema, with a table per JSON Schema file
+// (`*.json`) in `dir`, e.g. one per event type. Properties are stored as typed columns; `id` is
+// the primary key, `required` properties are NOT NULL, and `"x-index": true` or `"x-unique": true`
+// index a column. The table is named by `x-table`, or else `title` or the filename in snake_case
+func JSONSchemaSQL(dir fs.FS) ([]byte, error) {
+	var filenames []string
+	err := fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(name, ".json") {
+			filenames = append(filenames, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+	var buf bytes.Buffer
+	for _, filename := range filenames {
+		content, err := fs.ReadFile(dir, filename)
+		if err != nil {
+			return nil, err
+		}
+		statements, err := jsonSchemaTable(filename, content)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "-- %s\n%s\n", filename, statements)
+	}
+	return buf.Bytes(), nil
+}
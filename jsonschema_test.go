@@ -0,0 +1,95 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchemaSQL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    fstest.MapFS
+		expected string
+		wantErr  string
+	}{
+		{
+			name: fileline(),
+			files: fstest.MapFS{
+				"events/order_placed.json": {Data: []byte(`{
+					"title": "OrderPlaced",
+					"type": "object",
+					"required": ["id", "orderId", "placedAt", "total"],
+					"properties": {
+						"id": {"type": "string", "format": "uuid"},
+						"orderId": {"type": "integer", "x-index": true},
+						"placedAt": {"type": "string", "format": "date-time"},
+						"total": {"type": "number"},
+						"coupon": {"type": ["string", "null"], "x-unique": true},
+						"gift": {"type": "boolean"},
+						"items": {"type": "array", "items": {"type": "object"}}
+					}
+				}`)},
+				"events/user-signed-up.json": {Data: []byte(`{"required": ["email"], "properties": {"email": {"type": ["string", "null"]}}}`)},
+				"README.md":                  {Data: []byte(`not a schema`)},
+			},
+			expected: `-- events/order_placed.json
+CREATE TABLE order_placed (
+	id uuid PRIMARY KEY,
+	order_id bigint NOT NULL,
+	placed_at timestamptz NOT NULL,
+	total double precision NOT NULL,
+	coupon text,
+	gift boolean,
+	items jsonb
+);
+CREATE INDEX order_placed_order_id_idx ON order_placed (order_id);
+CREATE UNIQUE INDEX order_placed_coupon_key ON order_placed (coupon);
+
+-- events/user-signed-up.json
+CREATE TABLE user_signed_up (
+	email text
+);
+
+`,
+		},
+		{
+			name:     fileline(),
+			files:    fstest.MapFS{"a.json": {Data: []byte(`{"x-table": "orders", "properties": {"id": {"type": "integer"}}}`)}},
+			expected: "-- a.json\nCREATE TABLE orders (\n\tid bigint PRIMARY KEY\n);\n\n",
+		},
+		{
+			name:    fileline(),
+			files:   fstest.MapFS{"a.json": {Data: []byte(`{"title": "empty"}`)}},
+			wantErr: "a.json: no properties to store as columns",
+		},
+		{
+			name:    fileline(),
+			files:   fstest.MapFS{"a.json": {Data: []byte(`{"x-table": "drop table x;--", "properties": {"id": {"type": "integer"}}}`)}},
+			wantErr: `a.json: invalid table name: identifier "drop table x;--" has unexpected character ' ' at position 5`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := JSONSchemaSQL(tc.files)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(got))
+		})
+	}
+}
+
+func TestJSONSchemaSQLDiff(t *testing.T) {
+	schemaSQL, err := JSONSchemaSQL(fstest.MapFS{"orders.json": {Data: []byte(`{"properties": {"id": {"type": "integer"}, "ref": {"type": "string", "x-index": true}}}`)}})
+	assert.NoError(t, err)
+	declared, err := parseSchema(string(schemaSQL))
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaChange{
+		{Up: "CREATE TABLE orders (\n\tid bigint PRIMARY KEY,\n\tref text\n);\nCREATE INDEX orders_ref_idx ON orders (ref);", Down: "DROP TABLE orders;"},
+	}, diffSchema(declared, nil, pgNormalizeType))
+}
@@ -1,17 +1,23 @@
 package dbmigrate
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/choonkeat/dbmigrate/sqlsplit"
 	"github.com/derekparker/trie"
 	"github.com/pkg/errors"
 )
@@ -36,43 +42,63 @@ func SanitizeDriverNameURL(driverName string, databaseURL string) (dbdriver stri
 	return "", databaseURL, RequireDriverName
 }
 
-// ReadyWait for server to be ready, and try to create db and connect again
-func ReadyWait(ctx context.Context, driverName string, databaseURLs []string, logger func(...interface{})) error {
-	logger(driverName, "checking connection")
-	adapter, err := AdapterFor(driverName)
-	if err != nil {
-		return err
-	}
-
-	count := len(databaseURLs)
-	curr := -1
-	for {
-		curr = (curr + 1) % count
-		db, err := sql.Open(driverName, databaseURLs[curr])
-		if err == nil {
-			logger(driverName, "server up")
-			var num int
-			if err = db.QueryRow(adapter.PingQuery).Scan(&num); err == nil {
-				logger(driverName, "connected")
-				return db.Close()
-			}
-			db.Close()
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(time.Second):
-			logger(driverName, "retrying...", err)
-		}
-	}
-}
-
 // A Config holds on to an open database to perform dbmigrate
 type Config struct {
 	dir            fs.FS
 	db             *sql.DB
 	adapter        Adapter
 	migrationFiles []string
+	virtualFiles   map[string][]byte // see AddVirtual
+
+	dbSettings         []func(*sql.DB)
+	singleConnection   bool
+	logger             func(...interface{})
+	env                string
+	envSkipPolicy      EnvSkipPolicy
+	resultHandler      func(FileResult)
+	splitStatements    bool
+	appliedBy          string
+	store              VersionStore
+	skipVersions       map[string]bool
+	phase              Phase
+	windows            map[string]Window
+	forceWindows       bool
+	migrationLock      bool
+	lockProvider       LockProvider
+	allowEmpty         bool
+	versionPattern     *regexp.Regexp
+	deferForeignKeys   bool
+	runAs              string
+	objectFixups       []string
+	sqlLog             io.Writer
+	longTxn            time.Duration
+	longTxnPolicy      LongTransactionPolicy
+	versionsSchema     string
+	middlewares        []Middleware
+	fileFilter         func(Migration) bool
+	modules            []Module
+	namespace          string
+	lockTimeout        time.Duration
+	lockedPolicy       LockedPolicy
+	normalize          bool
+	credentials        CredentialsProvider
+	releaseCredentials func() error
+	runMeta            map[string]string
+	backup             func(ctx context.Context, filenames []string) error
+	blockerAge         time.Duration
+	blockerPolicy      BlockerPolicy
+	tableLocks         bool
+	lockName           string
+	maxVersion         string
+	ignoreFreeze       bool
+	verbose            bool
+	archive            bool
+	registerReader     func(name string, handler func() io.Reader)
+	deregisterReader   func(name string)
+	reconnect          *ReconnectOptions
+	stripComments      bool
+	driverName         string
+	databaseURL        string
 }
 
 // New returns an instance of &Config
@@ -81,7 +107,7 @@ type Config struct {
 // - database driver is unsupported (try adding support via `dbmigrate.Register`)
 // - database fails to connect or retrieve existing versions
 // - unable to read list of files from `dir`
-func New(dir fs.FS, driverName string, databaseURL string) (*Config, error) {
+func New(dir fs.FS, driverName string, databaseURL string, options ...Option) (*Config, error) {
 	driverName, databaseURL, err := SanitizeDriverNameURL(driverName, databaseURL)
 	if err != nil {
 		return nil, errors.Wrapf(err, "see `--help` for more details.")
@@ -90,61 +116,135 @@ func New(dir fs.FS, driverName string, databaseURL string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	db, err := sql.Open(driverName, databaseURL)
+	c := &Config{
+		dir:           dir,
+		adapter:       adapter,
+		logger:        func(...interface{}) {},
+		resultHandler: func(FileResult) {},
+		migrationLock: true,
+		normalize:     true,
+		driverName:    driverName,
+		databaseURL:   databaseURL,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.deferForeignKeys {
+		if c.adapter.ForeignKeysOffQuery == "" || c.adapter.ForeignKeyCheckQuery == "" {
+			return nil, errors.Errorf("%q does not support deferring foreign keys", driverName)
+		}
+		WithAfterConnect(ExecOnConnect(c.adapter.ForeignKeysOffQuery))(c)
+	}
+	if len(c.objectFixups) > 0 && c.adapter.SelectObjects == nil {
+		return nil, errors.Errorf("%q does not support fixups of new objects", driverName)
+	}
+	if c.runAs != "" {
+		if c.adapter.SetRoleQuery == nil || c.adapter.CheckRoleQuery == nil {
+			return nil, errors.Errorf("%q does not support running as another role", driverName)
+		}
+		WithAfterConnect(setRole(c.adapter, c.runAs))(c)
+	}
+
+	if c.credentials != nil {
+		if databaseURL, c.releaseCredentials, err = UseCredentials(context.Background(), c.credentials, driverName, databaseURL, c.logger); err != nil {
+			return nil, err
+		}
+		c.databaseURL = databaseURL
+	}
+
+	db, err := openDB(driverName, databaseURL, c.singleConnection, c.adapter.AfterConnect)
 	if err != nil {
+		if c.releaseCredentials != nil {
+			c.releaseCredentials()
+		}
 		return nil, errors.Wrapf(err, "unable to connect to -url")
 	}
-
-	var migrationFiles []string
-	err = fs.WalkDir(dir, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	if !c.singleConnection {
+		for _, setting := range c.dbSettings {
+			setting(db)
 		}
-		if d.IsDir() {
-			return nil
+	}
+	c.db = db
+	if c.store == nil {
+		c.store = &sqlStore{db: db, adapter: adapter}
+	}
+	if store, ok := c.store.(*sqlStore); ok && c.verbose {
+		store.trace = c.logger
+	}
+	if c.versionsSchema != "" {
+		if err := c.useVersionsSchema(); err != nil {
+			c.CloseDB()
+			return nil, err
 		}
-		fp := path
-		if !strings.HasSuffix(path, ".sql") &&
-			strings.HasSuffix(d.Name(), ".sql") {
-			fp = filepath.Join(path, d.Name())
+	}
+
+	if c.namespace != "" || len(c.modules) > 0 {
+		if err := c.useNamespaces(); err != nil {
+			c.CloseDB()
+			return nil, err
 		}
-		migrationFiles = append(migrationFiles, fp)
-		return nil
-	})
+	}
+
+	migrationFiles, err := listMigrationFiles(dir)
 	if err != nil {
+		c.CloseDB()
 		return nil, errors.Wrapf(err, "unable to read from directory %q", dir)
 	}
+	c.migrationFiles = c.withoutNewerFiles(migrationFiles)
+	if err := c.addVirtualFiles(); err != nil {
+		c.CloseDB()
+		return nil, err
+	}
+	if err := c.checkVersions(); err != nil {
+		c.CloseDB()
+		return nil, err
+	}
 
-	return &Config{
-		dir:            dir,
-		db:             db,
-		adapter:        adapter,
-		migrationFiles: migrationFiles,
-	}, nil
+	versions, err := readIgnoreFile(dir)
+	if err != nil {
+		c.CloseDB()
+		return nil, err
+	}
+	WithSkipVersions(versions...)(c)
+
+	return c, nil
 }
 
 // CloseDB should be run when Config is no longer in use; ideally `defer CloseDB` after every `New`
 func (c *Config) CloseDB() error {
-	return c.db.Close()
+	err := c.db.Close()
+	if c.releaseCredentials != nil {
+		if rerr := c.releaseCredentials(); err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
 
 func (c *Config) existingVersions(ctx context.Context, schema *string) (*trie.Trie, error) {
-	// best effort create before we select; if the table is not there, next query will fail anyway
-	_, errctx := c.db.ExecContext(ctx, c.adapter.CreateVersionsTable(schema))
-	rows, err := c.db.QueryContext(ctx, c.adapter.SelectExistingVersions(schema))
+	versions, err := c.AppliedVersions(ctx, schema)
 	if err != nil {
-		return nil, errors.Wrap(err, errctx.Error())
+		return nil, err
 	}
-	defer rows.Close()
-
 	result := trie.New()
-	for rows.Next() {
-		var s string
-		if err := rows.Scan(&s); err != nil {
-			return nil, err
-		}
-		result.Add(strings.TrimSpace(s), 1)
+	for _, s := range versions {
+		result.Add(s, 1)
+	}
+	return result, nil
+}
+
+// AppliedVersions returns a slice of version strings that are applied in the database
+func (c *Config) AppliedVersions(ctx context.Context, schema *string) ([]string, error) {
+	versions, err := c.store.AppliedVersions(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(versions))
+	for _, s := range versions {
+		result = append(result, strings.TrimSpace(s))
 	}
+	sort.Strings(result)
 	return result, nil
 }
 
@@ -155,7 +255,7 @@ func (c *Config) PendingVersions(ctx context.Context, schema *string) ([]string,
 		return nil, errors.Wrapf(err, "unable to query existing versions")
 	}
 
-	migrationFiles := c.migrationFiles
+	migrationFiles := append([]string(nil), c.migrationFiles...) // copy; Config may be reused
 	sort.SliceStable(migrationFiles, func(i int, j int) bool {
 		return strings.Compare(migrationFiles[i], migrationFiles[j]) == -1 // in ascending order
 	})
@@ -166,7 +266,13 @@ func (c *Config) PendingVersions(ctx context.Context, schema *string) ([]string,
 		if !strings.HasSuffix(currName, "up.sql") {
 			continue // skip if this isn't a `up.sql`
 		}
-		currVer := strings.Split(currName, "_")[0]
+		if !c.phase.includes(currName) {
+			continue // skip if not in this phase
+		}
+		if !c.filtered(currName) {
+			continue // skip if excluded by WithFileFilter
+		}
+		currVer := c.versionOf(currName)
 		if _, found := migratedVersions.Find(currVer); found {
 			continue // skip if we've migrated this version
 		}
@@ -175,6 +281,38 @@ func (c *Config) PendingVersions(ctx context.Context, schema *string) ([]string,
 	return result, nil
 }
 
+// UnknownVersions returns a slice of version strings that are applied in the database but not found in `dir`
+//
+// This usually means the current checkout is missing somebody else's migration
+func (c *Config) UnknownVersions(ctx context.Context, schema *string) ([]string, error) {
+	appliedVersions, err := c.AppliedVersions(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+
+	archivedVersions, err := c.archivedVersions(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	knownVersions := trie.New()
+	for _, currName := range c.migrationFiles {
+		knownVersions.Add(c.versionOf(currName), 1)
+	}
+
+	result := []string{}
+	for _, currVer := range appliedVersions {
+		if _, found := knownVersions.Find(currVer); found {
+			continue // skip if we have the file
+		}
+		if archivedVersions[currVer] {
+			continue // applied by ExecVersion
+		}
+		result = append(result, currVer)
+	}
+	return result, nil
+}
+
 // ExecCommitRollbacker interface for sql.Tx
 type ExecCommitRollbacker interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
@@ -186,123 +324,129 @@ type ExecCommitRollbacker interface {
 //
 // Transaction is committed on success, rollback on error. Different databases will behave
 // differently, e.g. postgres & sqlite3 can rollback DDL changes but mysql cannot
+//
+// Deprecated: use Up
 func (c *Config) MigrateUp(ctx context.Context, txOpts *sql.TxOptions, schema *string, logFilename func(string)) error {
-	migratedVersions, err := c.existingVersions(ctx, schema)
-	if err != nil {
-		return errors.Wrapf(err, "unable to query existing versions")
-	}
+	return c.Up(ctx, MigrateOptions{TxOptions: txOpts, Schema: schema, AfterFile: logFilename})
+}
 
-	tx, err := c.adapter.BeginTx(ctx, c.db, txOpts)
-	if err != nil {
-		return errors.Wrapf(err, "unable to create transaction")
-	}
-	defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
+// MigrateUpWithMode applies pending migrations in ascending order, grouped into transactions by `mode`
+//
+// Deprecated: use Up
+func (c *Config) MigrateUpWithMode(ctx context.Context, txOpts *sql.TxOptions, schema *string, logFilename func(string), mode DbTxnMode) error {
+	return c.Up(ctx, MigrateOptions{TxOptions: txOpts, Schema: schema, AfterFile: logFilename, Mode: mode})
+}
 
-	migrationFiles := c.migrationFiles
+// pendingFiles returns `up.sql` files whose version is not in `migratedVersions`, in ascending order
+func (c *Config) pendingFiles(migratedVersions *trie.Trie) []string {
+	migrationFiles := append([]string(nil), c.migrationFiles...) // copy; Config may be reused
 	sort.SliceStable(migrationFiles, func(i int, j int) bool {
 		return strings.Compare(migrationFiles[i], migrationFiles[j]) == -1 // in ascending order
 	})
 
+	var filenames []string
 	for i := range migrationFiles {
 		currName := migrationFiles[i]
 		if !strings.HasSuffix(currName, "up.sql") {
 			continue // skip if this isn't a `up.sql`
 		}
-		currVer := strings.Split(currName, "_")[0]
-		if _, found := migratedVersions.Find(currVer); found {
-			continue // skip if we've migrated this version
+		if !c.phase.includes(currName) {
+			continue // skip if not in this phase
 		}
-
-		// read the file, run the sql and insert a row into `dbmigrate_versions`
-		filecontent, err := c.fileContent(currName)
-		if err != nil {
-			return errors.Wrapf(err, currName)
-		}
-
-		if len(bytes.TrimSpace(filecontent)) == 0 {
-			// treat empty file as success; don't run it
-		} else if _, err := tx.ExecContext(ctx, string(filecontent)); err != nil {
-			return errors.Wrapf(err, currName)
+		if !c.filtered(currName) {
+			continue // skip if excluded by WithFileFilter
 		}
-		if _, err := tx.ExecContext(ctx, c.adapter.InsertNewVersion(schema), currVer); err != nil {
-			return errors.Wrapf(err, "fail to register version %q", currVer)
+		currVer := c.versionOf(currName)
+		if _, found := migratedVersions.Find(currVer); found {
+			continue // skip if we've migrated this version
 		}
-		logFilename(currName)
-	}
-	err = tx.Commit()
-	if err != nil && err.Error() == "pq: unexpected transaction status idle" {
-		return nil // ignore this error
+		filenames = append(filenames, currName)
 	}
-	return errors.Wrapf(err, "unable to commit transaction")
+	return filenames
 }
 
 // MigrateDown un-applies at most N migrations in descending order, in a transaction
 //
 // Transaction is committed on success, rollback on error. Different databases will behave
 // differently, e.g. postgres & sqlite3 can rollback DDL changes but mysql cannot
+//
+// Deprecated: use Down
 func (c *Config) MigrateDown(ctx context.Context, txOpts *sql.TxOptions, schema *string, logFilename func(string), downStep int) error {
-	migratedVersions, err := c.existingVersions(ctx, schema)
-	if err != nil {
-		return errors.Wrapf(err, "unable to query existing versions")
-	}
+	return c.MigrateDownWithMode(ctx, txOpts, schema, logFilename, downStep, DbTxnModeAll)
+}
 
-	tx, err := c.adapter.BeginTx(ctx, c.db, txOpts)
-	if err != nil {
-		return errors.Wrapf(err, "unable to create transaction")
+// MigrateDownWithMode un-applies at most N migrations in descending order, grouped into transactions by `mode`
+//
+// Deprecated: use Down
+func (c *Config) MigrateDownWithMode(ctx context.Context, txOpts *sql.TxOptions, schema *string, logFilename func(string), downStep int, mode DbTxnMode) error {
+	if downStep <= 0 {
+		return nil // nothing to un-apply
 	}
-	defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
-
-	migrationFiles := c.migrationFiles
-	sort.SliceStable(migrationFiles, func(i int, j int) bool {
-		return strings.Compare(migrationFiles[i], migrationFiles[j]) == 1 // descending order
-	})
+	return c.Down(ctx, MigrateOptions{TxOptions: txOpts, Schema: schema, AfterFile: logFilename, Steps: downStep, Mode: mode})
+}
 
-	counted := 0
-	for i := range migrationFiles {
-		currName := migrationFiles[i]
-		if !strings.HasSuffix(currName, "down.sql") {
-			continue // skip if this isn't a `down.sql`
+// listMigrationFiles returns the names of files in `dir`, except IgnoreFilename and PinsFilename
+func listMigrationFiles(dir fs.FS) ([]string, error) {
+	var migrationFiles []string
+	err := fs.WalkDir(dir, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-		currVer := strings.Split(currName, "_")[0]
-		if _, found := migratedVersions.Find(currVer); !found {
-			continue // skip if we've NOT migrated this version
+		if d.IsDir() {
+			return nil
 		}
-		counted++
-		if counted > downStep {
-			break // time to stop
+		if path == IgnoreFilename || path == PinsFilename {
+			return nil
 		}
-
-		// read the file, run the sql and delete row from `dbmigrate_versions`
-		filecontent, err := c.fileContent(currName)
-		if err != nil {
-			return errors.Wrapf(err, currName)
+		fp := path
+		if !strings.HasSuffix(path, ".sql") &&
+			strings.HasSuffix(d.Name(), ".sql") {
+			fp = filepath.Join(path, d.Name())
 		}
+		migrationFiles = append(migrationFiles, fp)
+		return nil
+	})
+	return migrationFiles, err
+}
 
-		if len(bytes.TrimSpace(filecontent)) == 0 {
-			// treat empty file as success; don't run it
-		} else if _, err := tx.ExecContext(ctx, string(filecontent)); err != nil {
-			return errors.Wrapf(err, currName)
-		}
-		if _, err := tx.ExecContext(ctx, c.adapter.DeleteOldVersion(schema), currVer); err != nil {
-			return errors.Wrapf(err, "fail to unregister version %q", currVer)
-		}
-		logFilename(currName)
+// fileContent returns content of `currName` as executed; see decodeFile and normalizeFile
+func (c *Config) fileContent(currName string) ([]byte, error) {
+	filecontent, err := c.readFile(currName)
+	if err != nil {
+		return nil, err
 	}
-	err = tx.Commit()
-	if err != nil && err.Error() == "pq: unexpected transaction status idle" {
-		return nil // ignore this error; already commited
+	if c.normalize {
+		filecontent = normalizeFile(filecontent)
 	}
-	return errors.Wrapf(err, "unable to commit transaction")
+	return decodeFile(currName, filecontent)
 }
 
-func (c *Config) fileContent(currName string) ([]byte, error) {
+// fileChecksum returns sha256 of `currName` as it is on disk, so checksums recorded in history
+// do not change with how files are decoded and normalized
+func (c *Config) fileChecksum(currName string) (string, error) {
+	filecontent, err := c.readFile(currName)
+	if err != nil {
+		return "", err
+	}
+	checksum := sha256.Sum256(filecontent)
+	return hex.EncodeToString(checksum[:]), nil
+}
+
+func (c *Config) readFile(currName string) ([]byte, error) {
+	if filecontent, ok := c.virtualFiles[currName]; ok {
+		return filecontent, nil
+	}
 	f, err := c.dir.Open(currName)
 	if err != nil {
 		return nil, errors.Wrapf(err, currName)
 	}
 	defer f.Close()
 
-	return ioutil.ReadAll(f)
+	filecontent, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, currName)
+	}
+	return filecontent, nil
 }
 
 // Register a new adapter.
@@ -315,28 +459,238 @@ func Register(name string, value Adapter) {
 
 // Adapter defines raw sql statements to run for an sql.DB adapter
 type Adapter struct {
-	CreateVersionsTable    func(*string) string
-	SelectExistingVersions func(*string) string
-	InsertNewVersion       func(*string) string
-	DeleteOldVersion       func(*string) string
-	PingQuery              string                                                     // `""` means does NOT support -server-ready
-	CreateDatabaseQuery    func(string) string                                        // nil means does NOT support -create-db
-	CreateSchemaQuery      func(string) string                                        // nil means does NOT support -schema
-	BaseDatabaseURL        func(string) (connString string, dbName string, err error) // nil means does not support -server-ready nor -create-db
-	BeginTx                func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error)
+	CreateVersionsTable     func(*string) string
+	SelectExistingVersions  func(*string) string
+	InsertNewVersion        func(*string) string
+	DeleteOldVersion        func(*string) string
+	WidenVersionColumn      func(schema *string, table string) string                  // alters `version` column of a legacy char(14) table to fit any version; nil means column type does not truncate
+	SelectVersionsColumns   func(*string) string                                       // selects name, type, whether in the primary key, and whether NOT NULL without a default, of columns of the versions table; nil means incompatible definitions are not reported
+	RebuildVersionsTable    func(schema *string, namespaced bool) []string             // recreates the versions table, with `namespace` column if `namespaced`, keeping its distinct rows; nil means does NOT support -upgrade-meta
+	PingQuery               string                                                     // `""` means does NOT support -server-ready
+	CreateDatabaseQuery     func(string) string                                        // quotes the name; nil means does NOT support -create-db
+	CreateSchemaQuery       func(string) string                                        // quotes the name; nil means does NOT support -schema
+	CreateExtensionQuery    func(string) string                                        // nil means does NOT support -create-extension
+	GrantRoleQuery          func(string) string                                        // creates role if missing and grants it to current user; nil means does NOT support -grant-role
+	BaseDatabaseURL         func(string) (connString string, dbName string, err error) // nil means does not support -server-ready nor -create-db
+	BeginTx                 func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error)
+	ReadOnlyQuery           string                                                  // selects true when database is read-only, e.g. a replica; `""` means does NOT support the check
+	ReplicaLagQuery         string                                                  // selects the largest replication lag of replicas in seconds, 0 if none; `""` means does NOT support -wait-replica-lag
+	TransactionalDDL        bool                                                    // DDL can be rolled back; false means does NOT support -check-reversibility
+	SelectColumns           func(*string) string                                    // selects table name, column name, type, nullable (`YES` or `NO`); nil means does NOT support -doc
+	SelectForeignKeys       func(*string) string                                    // selects table name, column name, foreign table name, foreign column name; nil means does NOT support -doc
+	NormalizeType           func(string) string                                     // returns a declared column type as selected by SelectColumns; nil means does NOT support `diff`
+	ErrorCode               func(error) string                                      // returns driver error code, e.g. SQLSTATE; nil means does NOT support `ignore-error` directive
+	Savepoints              bool                                                    // supports SAVEPOINT, ROLLBACK TO SAVEPOINT and RELEASE SAVEPOINT
+	CreateHistoryTable      func(*string) string                                    // nil means does NOT record history
+	InsertHistory           func(*string) string                                    // inserts version, direction, applied_at, duration_ms, checksum, applied_by, remark, run_id
+	SelectHistory           func(*string) string                                    // selects the same columns as InsertHistory, oldest first; nil means does NOT support -status
+	CreateRunsTable         func(*string) string                                    // nil means does NOT record runs
+	InsertRun               func(*string) string                                    // inserts run_id, direction, started_at, applied_by, meta as json, position_before, position_after
+	SelectRuns              func(*string) string                                    // selects the same columns as InsertRun, oldest first
+	UpdateRunPosition       func(*string) string                                    // sets position_after of run_id, given in that order
+	CreateFreezeTable       func(*string) string                                    // nil means does NOT support freeze
+	InsertFreeze            func(*string) string                                    // inserts reason, frozen_by, frozen_at
+	DeleteFreeze            func(*string) string                                    // deletes all rows
+	SelectFreeze            func(*string) string                                    // selects the same columns as InsertFreeze of one row
+	CreateArchiveTable      func(*string) string                                    // nil means does NOT support `dbmigrate exec` nor WithArchive
+	InsertArchive           func(*string) string                                    // inserts version, filename, source, content, archived_at, archived_by
+	DeleteArchive           func(*string) string                                    // deletes the row of version
+	SelectArchive           func(*string) string                                    // selects the same columns as InsertArchive, ordered by version
+	SelectArchivedVersions  func(*string) string                                    // selects version of rows of the source given as the only argument
+	LogPositionQuery        string                                                  // selects the current WAL LSN or GTID set for point-in-time recovery; `""` means runs do NOT record positions
+	SelectTableSizes        func(*string) string                                    // selects table name, estimated rows, total bytes; nil means -impact does NOT report sizes
+	SelectObjects           func(*string) string                                    // selects kind (e.g. `TABLE`) and quoted name of tables, views and sequences; nil means does NOT support -fixup
+	LockLevel               func(string) string                                     // returns table lock taken by a statement in uppercase without comments; nil means -impact does NOT report locks
+	SelectBlockers          func(tables []string) string                            // selects id, state, transaction age in seconds and query of other sessions in a transaction older than seconds given as the only argument, locking any of `tables`; nil means does NOT support -blockers-older-than
+	TerminateSessionQuery   string                                                  // terminates the session of the id given as the only argument
+	TenantDatabaseURL       func(databaseURL string, tenant string) (string, error) // connects to a tenant schema or database; nil means does NOT support -tenants
+	TLSDatabaseURL          func(databaseURL string, t TLSOptions) (string, error)  // connects with certificates of `t`; nil means does NOT support -sslrootcert, -sslcert, -sslkey nor -tls-server-name
+	LockQuery               string                                                  // waits for advisory lock named by the only argument, selects true when acquired; `""` means does NOT support locks
+	TryLockQuery            string                                                  // like LockQuery without waiting, selects false when held elsewhere
+	UnlockQuery             string                                                  // releases advisory lock named by the only argument
+	CreateProgressTable     func(*string) string                                    // nil means does NOT report the file being applied to processes waiting for the lock
+	InsertProgress          func(*string) string                                    // inserts process, filename, started_at
+	DeleteProgress          func(*string) string                                    // deletes all rows
+	SelectProgress          func(*string) string                                    // selects process, filename, started_at of one row
+	ForeignKeysOffQuery     string                                                  // disables foreign key enforcement of a connection; `""` means does NOT support WithDeferredForeignKeys
+	ForeignKeyCheckQuery    string                                                  // selects foreign key violations, e.g. `PRAGMA foreign_key_check`
+	DeferConstraintsQuery   string                                                  // defers constraint checks to commit; `""` means does NOT support `defer-constraints` directive
+	CopyFromQuery           func(table string, columns []string) string             // streams rows given to each Exec of its prepared statement, flushed by an Exec without arguments, see pq.CopyIn; nil means does NOT support `copy` directive
+	LoadDataQuery           func(string, string, []string, bool) string             // loads rows of reader name, into table, of columns, from a csv or tsv (true) file registered by WithLocalInfile; nil means does NOT support `copy` directive, unless CopyFromQuery
+	ConnectionLostCodes     []string                                                // error codes, as returned by ErrorCode, meaning the connection was lost, e.g. the server shut down; nil means only driver.ErrBadConn and network errors, see WithReconnect
+	IndexValidQuery         string                                                  // selects whether the index named by the only argument is valid, no row if missing; `""` means does NOT support `concurrent-index` directive
+	DropIndexQuery          func(string) string                                     // drops the index named as written, without blocking writes
+	SelectInvalidIndexes    func(*string) string                                    // selects qualified name and a statement creating it again without blocking writes, of invalid indexes; nil means does NOT support -repair-indexes
+	HasPrivilegeQuery       string                                                  // selects true if the session has the privilege, e.g. SUPERUSER, or is a member of the role given as the only argument; `""` means does NOT support `requires` directive
+	SetRoleQuery            func(string) string                                     // switches the session to a role; nil means does NOT support -run-as
+	CheckRoleQuery          func(string) string                                     // selects true if the session runs as the role
+	AfterConnect            func(context.Context, driver.Conn) error                // runs on each new connection, e.g. to set session parameters, see ExecOnConnect; nil means none
+	Translate               func([]byte) []byte                                     // rewrites files with `-- dbmigrate:portable` directive, see Translator; nil means does NOT support portable files
+	AddNamespaceColumn      func(*string) []string                                  // adds `namespace` column, default '', to the versions table as part of its primary key, and to the history table; nil means namespaces are kept as version prefixes
+	SelectNamespaceVersions func(*string) string                                    // like SelectExistingVersions, of the namespace given as the only argument
+	InsertNamespaceVersion  func(*string) string                                    // inserts namespace, version
+	DeleteNamespaceVersion  func(*string) string                                    // deletes namespace, version
+	InsertNamespaceHistory  func(*string) string                                    // like InsertHistory, with namespace first
+	SelectNamespaceHistory  func(*string) string                                    // like SelectHistory, of the namespace given as the only argument
+	SplitOptions            sqlsplit.Options                                        // how WithStatementSplitting splits files, e.g. mysql `#` comments; zero value splits as any database would
 }
 
 func fqName(schema *string, name string) string {
 	if schema == nil || *schema == "" {
 		return name
 	}
-	return *schema + "." + name
+	return pgName(*schema) + "." + name
+}
+
+// sqlLiteral quotes `s` as an sql string literal
+func sqlLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlLiterals quotes each of `values` as an sql string literal, separated by commas
+func sqlLiterals(values []string) string {
+	quoted := make([]string, len(values))
+	for i, s := range values {
+		quoted[i] = sqlLiteral(s)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// pgIdentifier quotes `s` as a postgres identifier
+func pgIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// mysqlIdentifier quotes `s` as a mysql identifier
+func mysqlIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// versionColumnType fits versions other than 14-digit timestamps, see WithVersionPattern;
+// tables created with char(14) can be altered with WidenVersionColumns
+const versionColumnType = `varchar(255)`
+
+const historyColumns = `version, direction, applied_at, duration_ms, checksum, applied_by, remark, run_id`
+
+// namespaceColumnDDL is the column added by AddNamespaceColumn of adapters
+const namespaceColumnDDL = `namespace ` + versionColumnType + ` NOT NULL DEFAULT ''`
+
+// rebuildVersionsTable returns statements copying distinct versions, cast as `castType`, of the versions table into a new
+// `dbmigrate_versions_upgrade` table, and dropping it; `name` qualifies a table name, see RebuildVersionsTable of adapters
+func rebuildVersionsTable(name func(string) string, namespaced bool, castType string) []string {
+	ddl, columns, selected := `version `+versionColumnType+` NOT NULL PRIMARY KEY`, `version`, `CAST(version AS `+castType+`)`
+	if namespaced {
+		ddl = namespaceColumnDDL + `, version ` + versionColumnType + ` NOT NULL, PRIMARY KEY (namespace, version)`
+		columns, selected = `namespace, `+columns, `namespace, `+selected
+	}
+	return []string{
+		`CREATE TABLE ` + name("dbmigrate_versions_upgrade") + ` (` + ddl + `)`,
+		`INSERT INTO ` + name("dbmigrate_versions_upgrade") + ` (` + columns + `) SELECT DISTINCT ` + selected + ` FROM ` + name("dbmigrate_versions"),
+		`DROP TABLE ` + name("dbmigrate_versions"),
+	}
+}
+
+// historyColumnsDDL returns column definitions of `dbmigrate_history` given the timestamp column type
+func historyColumnsDDL(timestampType string) string {
+	return `version ` + versionColumnType + ` NOT NULL, direction varchar(4) NOT NULL, applied_at ` + timestampType + ` NOT NULL,` +
+		` duration_ms bigint NOT NULL, checksum char(64) NOT NULL, applied_by varchar(255) NOT NULL,` +
+		` remark varchar(255) NOT NULL, run_id varchar(32) NOT NULL`
+}
+
+// runColumns of `dbmigrate_runs` in the order of InsertRun and SelectRuns of adapters
+const runColumns = `run_id, direction, started_at, applied_by, meta, position_before, position_after`
+
+// runColumnsDDL returns column definitions of `dbmigrate_runs` given the timestamp column type
+func runColumnsDDL(timestampType string) string {
+	return `run_id varchar(32) NOT NULL PRIMARY KEY, direction varchar(4) NOT NULL, started_at ` + timestampType + ` NOT NULL,` +
+		` applied_by varchar(255) NOT NULL, meta text NOT NULL, position_before text NOT NULL, position_after text NOT NULL`
+}
+
+// pgHasPrivilegeQuery selects true if the current role has a role attribute, e.g. SUPERUSER or CREATEROLE,
+// or is a member of a role, e.g. rds_superuser, given as the only argument
+const pgHasPrivilegeQuery = `SELECT CASE upper($1::text)` +
+	` WHEN 'SUPERUSER' THEN r.rolsuper` +
+	` WHEN 'CREATEROLE' THEN r.rolsuper OR r.rolcreaterole` +
+	` WHEN 'CREATEDB' THEN r.rolsuper OR r.rolcreatedb` +
+	` WHEN 'REPLICATION' THEN r.rolsuper OR r.rolreplication` +
+	` WHEN 'BYPASSRLS' THEN r.rolsuper OR r.rolbypassrls` +
+	` ELSE EXISTS (SELECT 1 FROM pg_roles m WHERE m.rolname = $1::text AND pg_has_role(current_user, m.oid, 'MEMBER')) END` +
+	` FROM pg_roles r WHERE r.rolname = current_user`
+
+// pgCopyFromQuery returns `COPY ... FROM STDIN` of `columns` of `table`, with identifiers folded to lower case
+// as if unquoted, e.g. a csv header `Name` copies into column `name`
+func pgCopyFromQuery(table string, columns []string) string {
+	names := strings.Split(table, ".")
+	for i, name := range names {
+		names[i] = pgName(name)
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgName(strings.TrimSpace(column))
+	}
+	return `COPY ` + strings.Join(names, ".") + ` (` + strings.Join(quoted, ", ") + `) FROM STDIN`
+}
+
+// mysqlLoadDataQuery returns `LOAD DATA LOCAL INFILE` of the csv or tsv file registered as `reader`, skipping
+// its header line of `columns`. Empty values are NULL, like `COPY` of postgres, and `\r` of `\r\n` lines is dropped
+func mysqlLoadDataQuery(reader string, table string, columns []string, tsv bool) string {
+	names := strings.Split(table, ".")
+	for i, name := range names {
+		names[i] = mysqlIdentifier(name)
+	}
+	separator := `','`
+	if tsv {
+		separator = `'\t'`
+	}
+	variables, assignments := make([]string, len(columns)), make([]string, len(columns))
+	for i, column := range columns {
+		variables[i] = "@c" + strconv.Itoa(i+1)
+		value := variables[i]
+		if i == len(columns)-1 {
+			value = `TRIM(TRAILING '\r' FROM ` + value + `)`
+		}
+		assignments[i] = mysqlIdentifier(strings.TrimSpace(column)) + ` = NULLIF(` + value + `, '')`
+	}
+	return `LOAD DATA LOCAL INFILE 'Reader::` + reader + `' INTO TABLE ` + strings.Join(names, ".") + ` CHARACTER SET utf8mb4` +
+		` FIELDS TERMINATED BY ` + separator + ` OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' IGNORE 1 LINES` +
+		` (` + strings.Join(variables, ", ") + `) SET ` + strings.Join(assignments, ", ")
+}
+
+// archiveColumns are the columns of `dbmigrate_archive`
+const archiveColumns = `version, filename, source, content, archived_at, archived_by`
+
+// archiveColumnsDDL returns column definitions of `dbmigrate_archive` given the timestamp and compressed content column types
+func archiveColumnsDDL(timestampType string, contentType string) string {
+	return `version ` + versionColumnType + ` NOT NULL PRIMARY KEY, filename varchar(255) NOT NULL, source varchar(8) NOT NULL,` +
+		` content ` + contentType + ` NOT NULL, archived_at ` + timestampType + ` NOT NULL, archived_by varchar(255) NOT NULL`
+}
+
+// freezeColumns are the columns of `dbmigrate_freeze`
+const freezeColumns = `reason, frozen_by, frozen_at`
+
+// freezeColumnsDDL returns column definitions of `dbmigrate_freeze` given the timestamp column type
+func freezeColumnsDDL(timestampType string) string {
+	return `reason text NOT NULL, frozen_by varchar(255) NOT NULL, frozen_at ` + timestampType + ` NOT NULL`
+}
+
+// progressColumnsDDL returns column definitions of `dbmigrate_progress` given the timestamp column type
+func progressColumnsDDL(timestampType string) string {
+	return `process varchar(255) NOT NULL, filename varchar(255) NOT NULL, started_at ` + timestampType + ` NOT NULL`
+}
+
+var mysqlErrorNumber = regexp.MustCompile(`^Error (\d+):`)
+
+func pgSchemaLiteral(schema *string) string {
+	if schema == nil || *schema == "" {
+		return "current_schema()"
+	}
+	return sqlLiteral(strings.ToLower(*schema))
 }
 
 var adapters = map[string]Adapter{
 	"postgres": {
 		CreateVersionsTable: func(schema *string) string {
-			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_versions") + ` (version char(14) NOT NULL PRIMARY KEY)`
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_versions") + ` (version ` + versionColumnType + ` NOT NULL PRIMARY KEY)`
 		},
 		SelectExistingVersions: func(schema *string) string {
 			return `SELECT version FROM ` + fqName(schema, "dbmigrate_versions") + ` ORDER BY version ASC`
@@ -347,7 +701,160 @@ var adapters = map[string]Adapter{
 		DeleteOldVersion: func(schema *string) string {
 			return `DELETE FROM ` + fqName(schema, "dbmigrate_versions") + ` WHERE version = $1`
 		},
-		PingQuery: "SELECT 1",
+		WidenVersionColumn: func(schema *string, table string) string {
+			return `ALTER TABLE ` + fqName(schema, table) + ` ALTER COLUMN version TYPE ` + versionColumnType
+		},
+		SelectVersionsColumns: func(schema *string) string {
+			return `SELECT a.attname, format_type(a.atttypid, a.atttypmod), COALESCE(a.attnum = ANY(i.indkey), false), a.attnotnull AND NOT a.atthasdef` +
+				` FROM pg_attribute a LEFT JOIN pg_index i ON i.indrelid = a.attrelid AND i.indisprimary` +
+				` WHERE a.attrelid = to_regclass(` + sqlLiteral(fqName(schema, "dbmigrate_versions")) + `) AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum`
+		},
+		RebuildVersionsTable: func(schema *string, namespaced bool) []string {
+			return append(rebuildVersionsTable(func(name string) string { return fqName(schema, name) }, namespaced, versionColumnType),
+				`ALTER TABLE `+fqName(schema, "dbmigrate_versions_upgrade")+` RENAME TO dbmigrate_versions`,
+				`ALTER TABLE `+fqName(schema, "dbmigrate_versions")+` RENAME CONSTRAINT dbmigrate_versions_upgrade_pkey TO dbmigrate_versions_pkey`,
+			)
+		},
+		CreateHistoryTable: func(schema *string) string {
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_history") + ` (` + historyColumnsDDL("timestamptz") + `)`
+		},
+		InsertHistory: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_history") + ` (` + historyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		},
+		SelectHistory: func(schema *string) string {
+			return `SELECT ` + historyColumns + ` FROM ` + fqName(schema, "dbmigrate_history") + ` ORDER BY applied_at ASC, version ASC`
+		},
+		CreateRunsTable: func(schema *string) string {
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_runs") + ` (` + runColumnsDDL("timestamptz") + `)`
+		},
+		InsertRun: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_runs") + ` (` + runColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		},
+		UpdateRunPosition: func(schema *string) string {
+			return `UPDATE ` + fqName(schema, "dbmigrate_runs") + ` SET position_after = $1 WHERE run_id = $2`
+		},
+		SelectRuns: func(schema *string) string {
+			return `SELECT ` + runColumns + ` FROM ` + fqName(schema, "dbmigrate_runs") + ` ORDER BY started_at ASC, run_id ASC`
+		},
+		CreateFreezeTable: func(schema *string) string {
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_freeze") + ` (` + freezeColumnsDDL("timestamptz") + `)`
+		},
+		InsertFreeze: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_freeze") + ` (` + freezeColumns + `) VALUES ($1, $2, $3)`
+		},
+		DeleteFreeze: func(schema *string) string { return `DELETE FROM ` + fqName(schema, "dbmigrate_freeze") },
+		SelectFreeze: func(schema *string) string {
+			return `SELECT ` + freezeColumns + ` FROM ` + fqName(schema, "dbmigrate_freeze") + ` ORDER BY frozen_at DESC LIMIT 1`
+		},
+		CreateArchiveTable: func(schema *string) string {
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_archive") + ` (` + archiveColumnsDDL("timestamptz", "text") + `)`
+		},
+		InsertArchive: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_archive") + ` (` + archiveColumns + `) VALUES ($1, $2, $3, $4, $5, $6)`
+		},
+		DeleteArchive: func(schema *string) string {
+			return `DELETE FROM ` + fqName(schema, "dbmigrate_archive") + ` WHERE version = $1`
+		},
+		SelectArchive: func(schema *string) string {
+			return `SELECT ` + archiveColumns + ` FROM ` + fqName(schema, "dbmigrate_archive") + ` ORDER BY version ASC`
+		},
+		SelectArchivedVersions: func(schema *string) string {
+			return `SELECT version FROM ` + fqName(schema, "dbmigrate_archive") + ` WHERE source = $1`
+		},
+		AddNamespaceColumn: func(schema *string) []string {
+			return []string{
+				`ALTER TABLE ` + fqName(schema, "dbmigrate_versions") + ` ADD COLUMN IF NOT EXISTS ` + namespaceColumnDDL,
+				`ALTER TABLE ` + fqName(schema, "dbmigrate_versions") + ` DROP CONSTRAINT IF EXISTS dbmigrate_versions_pkey`,
+				`ALTER TABLE ` + fqName(schema, "dbmigrate_versions") + ` ADD PRIMARY KEY (namespace, version)`,
+				`ALTER TABLE ` + fqName(schema, "dbmigrate_history") + ` ADD COLUMN IF NOT EXISTS ` + namespaceColumnDDL,
+			}
+		},
+		SelectNamespaceVersions: func(schema *string) string {
+			return `SELECT version FROM ` + fqName(schema, "dbmigrate_versions") + ` WHERE namespace = $1 ORDER BY version ASC`
+		},
+		InsertNamespaceVersion: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_versions") + ` (namespace, version) VALUES ($1, $2)`
+		},
+		DeleteNamespaceVersion: func(schema *string) string {
+			return `DELETE FROM ` + fqName(schema, "dbmigrate_versions") + ` WHERE namespace = $1 AND version = $2`
+		},
+		InsertNamespaceHistory: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_history") + ` (namespace, ` + historyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+		},
+		SelectNamespaceHistory: func(schema *string) string {
+			return `SELECT ` + historyColumns + ` FROM ` + fqName(schema, "dbmigrate_history") + ` WHERE namespace = $1 ORDER BY applied_at ASC, version ASC`
+		},
+		PingQuery:        "SELECT 1",
+		ReadOnlyQuery:    "SELECT pg_is_in_recovery()",
+		ReplicaLagQuery:  "SELECT COALESCE(EXTRACT(EPOCH FROM MAX(replay_lag)), 0) FROM pg_stat_replication",
+		LogPositionQuery: "SELECT pg_current_wal_lsn()::text",
+		TransactionalDDL: true,
+		ErrorCode: func(err error) string {
+			if e, ok := err.(interface{ SQLState() string }); ok {
+				return e.SQLState()
+			}
+			return ""
+		},
+		Savepoints:            true,
+		DeferConstraintsQuery: "SET CONSTRAINTS ALL DEFERRED",
+		CopyFromQuery:         pgCopyFromQuery,
+		ConnectionLostCodes:   []string{"08000", "08003", "08006", "57P01", "57P02", "57P03"},
+		SplitOptions:          sqlsplit.Postgres,
+		HasPrivilegeQuery:     pgHasPrivilegeQuery,
+		IndexValidQuery:       `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`,
+		DropIndexQuery: func(name string) string {
+			return "DROP INDEX CONCURRENTLY IF EXISTS " + name
+		},
+		SelectInvalidIndexes: func(schema *string) string {
+			return `SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname),` +
+				` regexp_replace(pg_get_indexdef(i.indexrelid), '^CREATE (UNIQUE )?INDEX ', 'CREATE \1INDEX CONCURRENTLY ')` +
+				` FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid JOIN pg_namespace n ON n.oid = c.relnamespace` +
+				` WHERE NOT i.indisvalid AND n.nspname = ` + pgSchemaLiteral(schema)
+		},
+		SelectObjects: func(schema *string) string {
+			return `SELECT CASE c.relkind WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW' WHEN 'S' THEN 'SEQUENCE' ELSE 'TABLE' END,` +
+				` quote_ident(n.nspname) || '.' || quote_ident(c.relname) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace` +
+				` WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S') AND n.nspname = ` + pgSchemaLiteral(schema) + ` AND c.relname NOT LIKE 'dbmigrate\_%'`
+		},
+		SelectTableSizes: func(schema *string) string {
+			return `SELECT c.relname, GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid) FROM pg_class c` +
+				` JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.relkind IN ('r', 'p') AND n.nspname = ` + pgSchemaLiteral(schema)
+		},
+		TerminateSessionQuery: `SELECT pg_terminate_backend($1::int)`,
+		SelectBlockers: func(tables []string) string {
+			return `SELECT DISTINCT a.pid::text, COALESCE(a.state, ''), EXTRACT(EPOCH FROM now() - a.xact_start), COALESCE(a.query, '')` +
+				` FROM pg_stat_activity a JOIN pg_locks l ON l.pid = a.pid JOIN pg_class c ON c.oid = l.relation` +
+				` WHERE a.pid <> pg_backend_pid() AND a.xact_start < now() - $1 * interval '1 second' AND c.relname IN (` + sqlLiterals(tables) + `)`
+		},
+		LockLevel:    pgLockLevel,
+		LockQuery:    `SELECT true FROM (SELECT pg_advisory_lock(hashtext($1))) l`,
+		TryLockQuery: `SELECT pg_try_advisory_lock(hashtext($1))`,
+		UnlockQuery:  `SELECT pg_advisory_unlock(hashtext($1))`,
+		CreateProgressTable: func(schema *string) string {
+			return `CREATE TABLE IF NOT EXISTS ` + fqName(schema, "dbmigrate_progress") + ` (` + progressColumnsDDL("timestamptz") + `)`
+		},
+		InsertProgress: func(schema *string) string {
+			return `INSERT INTO ` + fqName(schema, "dbmigrate_progress") + ` (process, filename, started_at) VALUES ($1, $2, $3)`
+		},
+		DeleteProgress: func(schema *string) string { return `DELETE FROM ` + fqName(schema, "dbmigrate_progress") },
+		SelectProgress: func(schema *string) string {
+			return `SELECT process, filename, started_at FROM ` + fqName(schema, "dbmigrate_progress") + ` ORDER BY started_at DESC LIMIT 1`
+		},
+		TenantDatabaseURL: pgTenantDatabaseURL,
+		TLSDatabaseURL:    pgTLSDatabaseURL,
+		Translate:         Translator("postgres"),
+		NormalizeType:     pgNormalizeType,
+		SelectColumns: func(schema *string) string {
+			return `SELECT table_name, column_name, data_type, is_nullable FROM information_schema.columns` +
+				` WHERE table_schema = ` + pgSchemaLiteral(schema) + ` ORDER BY table_name, ordinal_position`
+		},
+		SelectForeignKeys: func(schema *string) string {
+			return `SELECT kcu.table_name, kcu.column_name, ccu.table_name, ccu.column_name` +
+				` FROM information_schema.table_constraints tc` +
+				` JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema` +
+				` JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_name = tc.constraint_name AND ccu.table_schema = tc.table_schema` +
+				` WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = ` + pgSchemaLiteral(schema) + ` ORDER BY 1, 2`
+		},
 		BaseDatabaseURL: func(databaseURL string) (string, string, error) {
 			paths := strings.Split(databaseURL, "/")
 			pathlen := len(paths)
@@ -360,23 +867,151 @@ var adapters = map[string]Adapter{
 			return strings.Join(basePaths, "?"), requestURI[0], nil
 		},
 		CreateDatabaseQuery: func(dbName string) string {
-			return "CREATE DATABASE " + dbName
+			return "CREATE DATABASE " + pgName(dbName)
 		},
 		CreateSchemaQuery: func(schemaName string) string {
-			return "CREATE SCHEMA IF NOT EXISTS " + schemaName
+			return "CREATE SCHEMA IF NOT EXISTS " + pgName(schemaName)
+		},
+		CreateExtensionQuery: func(extName string) string {
+			return "CREATE EXTENSION IF NOT EXISTS " + pgIdentifier(extName)
 		},
+		GrantRoleQuery: func(roleName string) string {
+			return "DO $$ BEGIN CREATE ROLE " + pgIdentifier(roleName) + "; EXCEPTION WHEN duplicate_object THEN NULL; END $$;" +
+				" GRANT " + pgIdentifier(roleName) + " TO CURRENT_USER"
+		},
+		SetRoleQuery:   func(roleName string) string { return "SET ROLE " + pgIdentifier(roleName) },
+		CheckRoleQuery: func(roleName string) string { return "SELECT current_user = " + sqlLiteral(roleName) },
 		BeginTx: func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error) {
 			return db.BeginTx(ctx, opts)
 		},
 	},
 	"mysql": {
 		CreateVersionsTable: func(_ *string) string {
-			return `CREATE TABLE dbmigrate_versions (version char(14) NOT NULL PRIMARY KEY)`
+			return `CREATE TABLE dbmigrate_versions (version ` + versionColumnType + ` NOT NULL PRIMARY KEY)`
 		},
 		SelectExistingVersions: func(_ *string) string { return `SELECT version FROM dbmigrate_versions ORDER BY version ASC` },
 		InsertNewVersion:       func(_ *string) string { return `INSERT INTO dbmigrate_versions (version) VALUES (?)` },
 		DeleteOldVersion:       func(_ *string) string { return `DELETE FROM dbmigrate_versions WHERE version = ?` },
-		PingQuery:              "SELECT 1",
+		WidenVersionColumn: func(_ *string, table string) string {
+			return `ALTER TABLE ` + table + ` MODIFY version ` + versionColumnType + ` NOT NULL`
+		},
+		SelectVersionsColumns: func(_ *string) string {
+			return `SELECT column_name, column_type, column_key = 'PRI', is_nullable = 'NO' AND column_default IS NULL AND extra NOT LIKE '%auto_increment%'` +
+				` FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'dbmigrate_versions' ORDER BY ordinal_position`
+		},
+		RebuildVersionsTable: func(_ *string, namespaced bool) []string {
+			return append(rebuildVersionsTable(func(name string) string { return name }, namespaced, "char(255)"),
+				`RENAME TABLE dbmigrate_versions_upgrade TO dbmigrate_versions`,
+			)
+		},
+		PingQuery:        "SELECT 1",
+		ReadOnlyQuery:    "SELECT @@global.read_only",
+		LogPositionQuery: "SELECT @@global.gtid_executed", // empty unless gtid_mode is ON
+		SelectBlockers: func(tables []string) string {
+			return `SELECT DISTINCT p.ID, p.COMMAND, TIMESTAMPDIFF(SECOND, t.trx_started, NOW()), COALESCE(p.INFO, '')` +
+				` FROM information_schema.INNODB_TRX t JOIN information_schema.PROCESSLIST p ON p.ID = t.trx_mysql_thread_id` +
+				` JOIN performance_schema.threads th ON th.PROCESSLIST_ID = p.ID JOIN performance_schema.metadata_locks m ON m.OWNER_THREAD_ID = th.THREAD_ID` +
+				` WHERE p.ID <> CONNECTION_ID() AND t.trx_started < NOW() - INTERVAL ? SECOND` +
+				` AND m.OBJECT_TYPE = 'TABLE' AND m.OBJECT_SCHEMA = DATABASE() AND m.OBJECT_NAME IN (` + sqlLiterals(tables) + `)`
+		},
+		TerminateSessionQuery: "KILL ?",
+		HasPrivilegeQuery: `SELECT COUNT(*) FROM information_schema.user_privileges WHERE privilege_type = UPPER(?)` +
+			` AND grantee = CONCAT(CHAR(39), SUBSTRING_INDEX(CURRENT_USER(), '@', 1), CHAR(39), '@', CHAR(39), SUBSTRING_INDEX(CURRENT_USER(), '@', -1), CHAR(39))`,
+		CreateHistoryTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_history (` + historyColumnsDDL("datetime(6)") + `)`
+		},
+		InsertHistory: func(_ *string) string {
+			return `INSERT INTO dbmigrate_history (` + historyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		},
+		SelectHistory: func(_ *string) string {
+			return `SELECT ` + historyColumns + ` FROM dbmigrate_history ORDER BY applied_at ASC, version ASC`
+		},
+		CreateRunsTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_runs (` + runColumnsDDL("datetime(6)") + `)`
+		},
+		InsertRun: func(_ *string) string {
+			return `INSERT INTO dbmigrate_runs (` + runColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+		},
+		UpdateRunPosition: func(_ *string) string { return `UPDATE dbmigrate_runs SET position_after = ? WHERE run_id = ?` },
+		SelectRuns: func(_ *string) string {
+			return `SELECT ` + runColumns + ` FROM dbmigrate_runs ORDER BY started_at ASC, run_id ASC`
+		},
+		CreateFreezeTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_freeze (` + freezeColumnsDDL("datetime(6)") + `)`
+		},
+		InsertFreeze: func(_ *string) string { return `INSERT INTO dbmigrate_freeze (` + freezeColumns + `) VALUES (?, ?, ?)` },
+		DeleteFreeze: func(_ *string) string { return `DELETE FROM dbmigrate_freeze` },
+		SelectFreeze: func(_ *string) string {
+			return `SELECT ` + freezeColumns + ` FROM dbmigrate_freeze ORDER BY frozen_at DESC LIMIT 1`
+		},
+		CreateArchiveTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_archive (` + archiveColumnsDDL("datetime(6)", "mediumtext") + `)`
+		},
+		InsertArchive: func(_ *string) string {
+			return `INSERT INTO dbmigrate_archive (` + archiveColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+		},
+		DeleteArchive: func(_ *string) string { return `DELETE FROM dbmigrate_archive WHERE version = ?` },
+		SelectArchive: func(_ *string) string {
+			return `SELECT ` + archiveColumns + ` FROM dbmigrate_archive ORDER BY version ASC`
+		},
+		SelectArchivedVersions: func(_ *string) string { return `SELECT version FROM dbmigrate_archive WHERE source = ?` },
+		LoadDataQuery:          mysqlLoadDataQuery,
+		SplitOptions:           sqlsplit.MySQL,
+		AddNamespaceColumn: func(_ *string) []string {
+			return []string{
+				`ALTER TABLE dbmigrate_versions ADD COLUMN ` + namespaceColumnDDL + ` FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (namespace, version)`,
+				`ALTER TABLE dbmigrate_history ADD COLUMN ` + namespaceColumnDDL,
+			}
+		},
+		SelectNamespaceVersions: func(_ *string) string {
+			return `SELECT version FROM dbmigrate_versions WHERE namespace = ? ORDER BY version ASC`
+		},
+		InsertNamespaceVersion: func(_ *string) string { return `INSERT INTO dbmigrate_versions (namespace, version) VALUES (?, ?)` },
+		DeleteNamespaceVersion: func(_ *string) string { return `DELETE FROM dbmigrate_versions WHERE namespace = ? AND version = ?` },
+		InsertNamespaceHistory: func(_ *string) string {
+			return `INSERT INTO dbmigrate_history (namespace, ` + historyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		},
+		SelectNamespaceHistory: func(_ *string) string {
+			return `SELECT ` + historyColumns + ` FROM dbmigrate_history WHERE namespace = ? ORDER BY applied_at ASC, version ASC`
+		},
+		ErrorCode: func(err error) string {
+			if m := mysqlErrorNumber.FindStringSubmatch(err.Error()); m != nil {
+				return m[1]
+			}
+			return ""
+		},
+		Savepoints:        true,
+		TenantDatabaseURL: mysqlTenantDatabaseURL,
+		Translate:         Translator("mysql"),
+		LockQuery:         `SELECT GET_LOCK(?, -1)`,
+		TryLockQuery:      `SELECT GET_LOCK(?, 0)`,
+		UnlockQuery:       `SELECT RELEASE_LOCK(?)`,
+		CreateProgressTable: func(_ *string) string {
+			return `CREATE TABLE IF NOT EXISTS dbmigrate_progress (` + progressColumnsDDL("datetime(6)") + `)`
+		},
+		InsertProgress: func(_ *string) string {
+			return `INSERT INTO dbmigrate_progress (process, filename, started_at) VALUES (?, ?, ?)`
+		},
+		DeleteProgress: func(_ *string) string { return `DELETE FROM dbmigrate_progress` },
+		SelectProgress: func(_ *string) string {
+			return `SELECT process, filename, started_at FROM dbmigrate_progress ORDER BY started_at DESC LIMIT 1`
+		},
+		SelectObjects: func(_ *string) string {
+			return `SELECT CASE table_type WHEN 'VIEW' THEN 'VIEW' ELSE 'TABLE' END, CONCAT(CHAR(96), REPLACE(table_name, CHAR(96), REPEAT(CHAR(96), 2)), CHAR(96))` +
+				` FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name NOT LIKE 'dbmigrate\\_%'`
+		},
+		SelectTableSizes: func(_ *string) string {
+			return `SELECT table_name, COALESCE(table_rows, 0), COALESCE(data_length + index_length, 0) FROM information_schema.tables` +
+				` WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'`
+		},
+		SelectColumns: func(_ *string) string {
+			return `SELECT table_name, column_name, column_type, is_nullable FROM information_schema.columns` +
+				` WHERE table_schema = DATABASE() ORDER BY table_name, ordinal_position`
+		},
+		SelectForeignKeys: func(_ *string) string {
+			return `SELECT table_name, column_name, referenced_table_name, referenced_column_name FROM information_schema.key_column_usage` +
+				` WHERE table_schema = DATABASE() AND referenced_table_name IS NOT NULL ORDER BY 1, 2`
+		},
 		BaseDatabaseURL: func(databaseURL string) (string, string, error) {
 			paths := strings.Split(databaseURL, "/")
 			pathlen := len(paths)
@@ -389,7 +1024,7 @@ var adapters = map[string]Adapter{
 			return strings.Join(basePaths, "?"), requestURI[0], nil
 		},
 		CreateDatabaseQuery: func(dbName string) string {
-			return "CREATE DATABASE " + dbName
+			return "CREATE DATABASE " + mysqlIdentifier(dbName)
 		},
 		BeginTx: func(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (ExecCommitRollbacker, error) {
 			return db.BeginTx(ctx, opts)
@@ -1,9 +1,15 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"runtime"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -176,3 +182,159 @@ func TestBaseDatabaseURL(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresBootstrapQueries(t *testing.T) {
+	adapter, err := AdapterFor("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`, adapter.CreateExtensionQuery("uuid-ossp"))
+	assert.Equal(t, `DO $$ BEGIN CREATE ROLE "app_rw"; EXCEPTION WHEN duplicate_object THEN NULL; END $$; GRANT "app_rw" TO CURRENT_USER`, adapter.GrantRoleQuery("app_rw"))
+	assert.Equal(t, `CREATE EXTENSION IF NOT EXISTS "a""b"`, adapter.CreateExtensionQuery(`a"b`))
+}
+
+func TestUnknownVersions(t *testing.T) {
+	testCases := []struct {
+		name             string
+		givenFiles       []string
+		givenApplied     []string
+		expectedVersions []string
+	}{
+		{
+			name:             fileline(),
+			givenFiles:       []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"},
+			givenApplied:     []string{"20181222073750"},
+			expectedVersions: []string{},
+		},
+		{
+			name:             fileline(),
+			givenFiles:       []string{"20181222073750_a.up.sql"},
+			givenApplied:     []string{"20181222073750", "20181222073900", "20181222074000"},
+			expectedVersions: []string{"20181222073900", "20181222074000"},
+		},
+		{
+			name:             fileline(),
+			givenApplied:     []string{"20181222073750"},
+			expectedVersions: []string{"20181222073750"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{store: &fakeStore{versions: tc.givenApplied}, migrationFiles: tc.givenFiles}
+			versions, err := c.UnknownVersions(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedVersions, versions)
+		})
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		givenOptions    []Option
+		expectedMaxOpen int
+		expectedIdle    int
+		expectedExpired bool
+	}{
+		{
+			name:            fileline(),
+			expectedMaxOpen: 0,
+			expectedIdle:    2,
+		},
+		{
+			name:            fileline(),
+			givenOptions:    []Option{WithMaxOpenConns(5), WithMaxIdleConns(1)},
+			expectedMaxOpen: 5,
+			expectedIdle:    1,
+		},
+		{
+			name:            fileline(),
+			givenOptions:    []Option{WithMaxOpenConns(2), WithMaxIdleConns(3)},
+			expectedMaxOpen: 2,
+			expectedIdle:    2,
+		},
+		{
+			name:            fileline(),
+			givenOptions:    []Option{WithConnMaxLifetime(time.Millisecond)},
+			expectedIdle:    2,
+			expectedExpired: true,
+		},
+		{
+			name:            fileline(),
+			givenOptions:    []Option{WithSingleConnection(), WithMaxOpenConns(5), WithMaxIdleConns(3), WithConnMaxLifetime(time.Millisecond)},
+			expectedMaxOpen: 1,
+			expectedIdle:    1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(fstest.MapFS{}, "dbmigrate-fake", "1", tc.givenOptions...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.CloseDB()
+			assert.Equal(t, tc.expectedMaxOpen, c.db.Stats().MaxOpenConnections)
+
+			// hold as many connections as allowed, up to 3, then return them to the pool
+			var conns []*sql.Conn
+			for i := 0; i < 3 && (tc.expectedMaxOpen == 0 || i < tc.expectedMaxOpen); i++ {
+				conn, err := c.db.Conn(context.Background())
+				assert.NoError(t, err)
+				conns = append(conns, conn)
+			}
+			for _, conn := range conns {
+				conn.Close()
+			}
+			assert.Equal(t, tc.expectedIdle, c.db.Stats().Idle, "idle connections")
+
+			time.Sleep(5 * time.Millisecond)
+			assert.NoError(t, c.db.PingContext(context.Background()))
+			assert.Equal(t, tc.expectedExpired, c.db.Stats().MaxLifetimeClosed > 0, "connections expired")
+		})
+	}
+}
+
+func TestSingleConnectionSession(t *testing.T) {
+	testCases := []struct {
+		name             string
+		givenOptions     []Option
+		expectedConnects int32
+	}{
+		{
+			name:             fileline(),
+			givenOptions:     []Option{WithConnMaxLifetime(time.Millisecond)},
+			expectedConnects: 3,
+		},
+		{
+			name:             fileline(),
+			givenOptions:     []Option{WithConnMaxLifetime(time.Millisecond), WithSingleConnection()},
+			expectedConnects: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var connects int32
+			session := func(ctx context.Context, conn driver.Conn) error {
+				atomic.AddInt32(&connects, 1)
+				return ExecOnConnect("SET search_path = app")(ctx, conn)
+			}
+			c, err := New(fstest.MapFS{}, "dbmigrate-fake", "1", append(tc.givenOptions, WithAfterConnect(session))...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.CloseDB()
+
+			// a new connection would start a new session, without the settings of the last one
+			for i := 0; i < 3; i++ {
+				_, err := c.db.ExecContext(context.Background(), "CREATE TABLE t (id int)")
+				assert.NoError(t, err)
+				time.Sleep(5 * time.Millisecond)
+			}
+			assert.Equal(t, tc.expectedConnects, atomic.LoadInt32(&connects), "sessions started")
+		})
+	}
+}
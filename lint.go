@@ -0,0 +1,123 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A LintIssue is a statement that is unsafe while old and new code run side by side during a
+// rolling deploy. Silence it with `-- dbmigrate:allow-unsafe <rule>` before the statement
+type LintIssue struct {
+	Filename  string `json:"filename"`
+	Statement int    `json:"statement"` // 1-based position in file; 0 for the file as a whole
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+}
+
+var (
+	lintAlterTable   = regexp.MustCompile(`^ALTER TABLE\b`)
+	lintDropColumn   = regexp.MustCompile(`\bDROP COLUMN\b`)
+	lintAddColumn    = regexp.MustCompile(`\bADD (COLUMN )?.*\bNOT NULL\b`)
+	lintDefault      = regexp.MustCompile(`\bDEFAULT\b`)
+	lintSetNotNull   = regexp.MustCompile(`\bALTER (COLUMN )?\S+ SET NOT NULL\b`)
+	lintRename       = regexp.MustCompile(`\bRENAME\b`)
+	lintRenameTable  = regexp.MustCompile(`^RENAME TABLE\b`)
+	lintWhitespace   = regexp.MustCompile(`\s+`)
+	lintLineComments = regexp.MustCompile(`--[^\n]*`)
+)
+
+// lintRules checks a normalized statement of a file in `phase`, returning rule and message of issues
+var lintRules = []func(stmt string, phase Phase) (string, string){
+	func(stmt string, phase Phase) (string, string) {
+		if phase == PhasePre && lintAlterTable.MatchString(stmt) && lintDropColumn.MatchString(stmt) {
+			return "drop-column", "DROP COLUMN breaks code still reading the column; move it to a `.post.up.sql` file"
+		}
+		return "", ""
+	},
+	func(stmt string, _ Phase) (string, string) {
+		if !lintAlterTable.MatchString(stmt) {
+			return "", ""
+		}
+		if lintSetNotNull.MatchString(stmt) || (lintAddColumn.MatchString(stmt) && !lintDefault.MatchString(stmt)) {
+			return "not-null-without-default", "NOT NULL without DEFAULT fails inserts by code not yet deployed, and scans the whole table"
+		}
+		return "", ""
+	},
+	func(stmt string, _ Phase) (string, string) {
+		if lintRenameTable.MatchString(stmt) || (lintAlterTable.MatchString(stmt) && lintRename.MatchString(stmt)) {
+			return "rename", "renaming breaks code still using the old name; add the new name, backfill, then drop the old name in post phase"
+		}
+		return "", ""
+	},
+}
+
+// normalizeStatement returns `stmt` in uppercase, without comments, with single spaces
+func normalizeStatement(stmt string) string {
+	s := lintLineComments.ReplaceAllString(stripBlockComments(stmt), "")
+	return strings.ToUpper(strings.TrimSpace(lintWhitespace.ReplaceAllString(s, " ")))
+}
+
+// LintFile returns issues of statements in `filecontent` that are unsafe during rolling
+// deploys, unless allowed by `-- dbmigrate:allow-unsafe <rule>` directives. An `up.sql`
+// file without statements nor `copy` directives is reported as `empty-file`, since someone likely forgot to write it
+func LintFile(filename string, filecontent []byte) []LintIssue {
+	var result []LintIssue
+	if d := parseDirectives(filecontent); strings.HasSuffix(filename, "up.sql") && isBlankStatement(string(filecontent)) &&
+		!d.has("copy") && !strings.Contains(d["allow-unsafe"], "empty-file") {
+		result = append(result, LintIssue{Filename: filename, Rule: "empty-file", Message: "file has no statements, but will be recorded as applied; did you forget to write it?"})
+	}
+	phase := FilePhase(filename)
+	for i, stmt := range splitStatements(string(filecontent)) {
+		if isBlankStatement(stmt) {
+			continue
+		}
+		allowed := map[string]bool{}
+		for _, rule := range strings.Split(parseDirectives([]byte(stmt))["allow-unsafe"], ",") {
+			allowed[strings.TrimSpace(rule)] = true
+		}
+		normalized := normalizeStatement(stmt)
+		for _, check := range lintRules {
+			rule, message := check(normalized, phase)
+			if rule == "" || allowed[rule] {
+				continue
+			}
+			result = append(result, LintIssue{Filename: filename, Statement: i + 1, Rule: rule, Message: message})
+		}
+	}
+	return result
+}
+
+// LintPending returns issues of pending `up.sql` files; see LintFile
+func (c *Config) LintPending(ctx context.Context, schema *string) ([]LintIssue, error) {
+	migratedVersions, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	return c.lintFiles(c.pendingFiles(migratedVersions))
+}
+
+// LintAll returns issues of all `up.sql` files; see LintFile
+func (c *Config) LintAll() ([]LintIssue, error) {
+	var filenames []string
+	for _, currName := range c.migrationFiles {
+		if strings.HasSuffix(currName, "up.sql") {
+			filenames = append(filenames, currName)
+		}
+	}
+	return c.lintFiles(filenames)
+}
+
+func (c *Config) lintFiles(filenames []string) ([]LintIssue, error) {
+	var result []LintIssue
+	for _, currName := range filenames {
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, LintFile(currName, filecontent)...)
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		given    string
+		expected []LintIssue
+	}{
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "CREATE TABLE users (id int NOT NULL, name text NOT NULL);\nALTER TABLE users ADD COLUMN email text;",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "alter table users\n  drop column name;",
+			expected: []LintIssue{{Filename: "20181222073750_a.up.sql", Statement: 1, Rule: "drop-column"}},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.post.up.sql",
+			given:    "ALTER TABLE users DROP COLUMN name;",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "ALTER TABLE users ADD COLUMN age int NOT NULL;\nALTER TABLE users ADD COLUMN active bool NOT NULL DEFAULT true;\nALTER TABLE users ALTER COLUMN email SET NOT NULL;",
+			expected: []LintIssue{
+				{Filename: "20181222073750_a.up.sql", Statement: 1, Rule: "not-null-without-default"},
+				{Filename: "20181222073750_a.up.sql", Statement: 3, Rule: "not-null-without-default"},
+			},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "ALTER TABLE users RENAME COLUMN name TO full_name;\nRENAME TABLE users TO people;\n-- rename table later\nSELECT 1;",
+			expected: []LintIssue{
+				{Filename: "20181222073750_a.up.sql", Statement: 1, Rule: "rename"},
+				{Filename: "20181222073750_a.up.sql", Statement: 2, Rule: "rename"},
+			},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "-- dbmigrate:allow-unsafe rename\nALTER TABLE users RENAME TO people;\nALTER TABLE people RENAME TO persons;",
+			expected: []LintIssue{{Filename: "20181222073750_a.up.sql", Statement: 2, Rule: "rename"}},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "-- dbmigrate:allow-unsafe drop-column, rename\nALTER TABLE users DROP COLUMN name, RENAME TO people;",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "\n-- TODO\n/* later */\n",
+			expected: []LintIssue{{Filename: "20181222073750_a.up.sql", Rule: "empty-file"}},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "-- dbmigrate:allow-unsafe empty-file\n",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.up.sql",
+			given:    "-- dbmigrate:copy countries from countries.csv\n",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073750_a.down.sql",
+			given:    "",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual := LintFile(tc.filename, []byte(tc.given))
+			for i := range actual {
+				assert.NotEmpty(t, actual[i].Message)
+				actual[i].Message = ""
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationLockName is the advisory lock held while migrating up or down. Applications can
+// `Lock` the same name, e.g. to run startup tasks only after migrations are done
+const MigrationLockName = "dbmigrate"
+
+// ErrLocked is returned by TryLock when the lock is held elsewhere
+var ErrLocked = errors.Errorf("lock is held by another session")
+
+// ErrLockTimeout is returned when the migration lock is not acquired within WithLockTimeout
+var ErrLockTimeout = errors.Errorf("timed out waiting for the migration lock; is another process migrating?")
+
+// An AdvisoryLock is held on a dedicated connection, or the only session of WithSingleConnection,
+// until Unlock
+type AdvisoryLock struct {
+	conn    *sql.Conn
+	db      *sql.DB // when conn is nil, the lock is held by the only session of db, see keepOnSession
+	adapter Adapter
+	name    string
+}
+
+// Lock waits until advisory lock `name` is acquired, or `ctx` is done. Locks are shared by all
+// sessions of the database, including other processes running dbmigrate or `Lock`
+func Lock(ctx context.Context, db *sql.DB, name string) (*AdvisoryLock, error) {
+	adapter, err := adapterOf(db)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, db, adapter, name, false)
+}
+
+// TryLock acquires advisory lock `name` without waiting; returns ErrLocked if it is held elsewhere
+func TryLock(ctx context.Context, db *sql.DB, name string) (*AdvisoryLock, error) {
+	adapter, err := adapterOf(db)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, db, adapter, name, true)
+}
+
+// adapterOf returns the adapter registered for the driver of `db`, found by opening each
+// registered driver name that has an adapter
+func adapterOf(db *sql.DB) (Adapter, error) {
+	driverType := reflect.TypeOf(db.Driver())
+	for _, name := range sql.Drivers() {
+		adapter, ok := adapters[name]
+		if !ok {
+			continue
+		}
+		probe, err := sql.Open(name, "")
+		if err != nil {
+			continue // e.g. driver.DriverContext rejecting an empty DSN
+		}
+		matched := reflect.TypeOf(probe.Driver()) == driverType
+		probe.Close()
+		if matched {
+			if adapter.LockQuery == "" || adapter.UnlockQuery == "" {
+				return adapter, errors.Errorf("%q does not support advisory locks", name)
+			}
+			return adapter, nil
+		}
+	}
+	return Adapter{}, errors.Errorf("no adapter registered for driver %T", db.Driver())
+}
+
+func acquireLock(ctx context.Context, db *sql.DB, adapter Adapter, name string, try bool) (*AdvisoryLock, error) {
+	query := adapter.LockQuery
+	if try {
+		query = adapter.TryLockQuery
+	}
+	if query == "" || adapter.UnlockQuery == "" {
+		return nil, errors.Errorf("database does not support advisory locks")
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect for lock %q", name)
+	}
+	ok, err := queryTruthy(ctx, conn, query, name)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "unable to acquire lock %q", name)
+	}
+	if !ok {
+		conn.Close()
+		return nil, ErrLocked
+	}
+	return &AdvisoryLock{conn: conn, db: db, adapter: adapter, name: name}, nil
+}
+
+// keepOnSession returns the lock connection to `db`, which must have only one session, e.g.
+// WithSingleConnection; the session keeps holding the lock, and is not starved by it
+func (l *AdvisoryLock) keepOnSession() {
+	l.conn.Close()
+	l.conn = nil
+}
+
+// Unlock releases the lock and its connection
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	var session queryRower = l.db
+	if l.conn != nil {
+		defer l.conn.Close()
+		session = l.conn
+	}
+	if _, err := queryTruthy(ctx, session, l.adapter.UnlockQuery, l.name); err != nil {
+		return errors.Wrapf(err, "unable to release lock %q", l.name)
+	}
+	return nil
+}
+
+// queryRower is implemented by *sql.DB and *sql.Conn
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryTruthy returns true unless `query` selects false, 0 or null
+func queryTruthy(ctx context.Context, conn queryRower, query string, args ...interface{}) (bool, error) {
+	var value interface{}
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&value); err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// truthy returns false for false, 0 or null selected by a query
+func truthy(value interface{}) bool {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	switch strings.ToLower(fmt.Sprint(value)) {
+	case "false", "f", "0", "<nil>":
+		return false
+	}
+	return true
+}
+
+// lockMigrations holds MigrationLockName, or the lock of WithLockName, from WithLockProvider, or else on
+// a dedicated connection of the database, so migrations wait for each other; no-op if disabled or
+// unsupported by the adapter. While waiting on the database, logs what the holder is applying, see migrationLock.progress
+func (c *Config) lockMigrations(ctx context.Context, schema *string, direction string) (*migrationLock, error) {
+	if !c.migrationLock {
+		return nil, nil
+	}
+	acquire := c.acquireMigrations
+	if c.tableLocks {
+		if len(c.modules) > 0 {
+			return nil, errors.Errorf("table locks do not support modules")
+		}
+		filenames, err := c.filesToLock(ctx, schema, direction)
+		if err != nil {
+			return nil, err
+		}
+		names, err := c.tableLockNames(filenames)
+		if err != nil {
+			return nil, err
+		}
+		acquire = func(_ context.Context, lockCtx context.Context) (*migrationLock, error) {
+			return c.acquireTables(lockCtx, names)
+		}
+	}
+	if c.lockTimeout <= 0 {
+		return acquire(ctx, ctx)
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, c.lockTimeout)
+	defer cancel()
+	lock, err := acquire(ctx, lockCtx)
+	if err != nil && lockCtx.Err() != nil && ctx.Err() == nil {
+		return nil, ErrLockTimeout
+	}
+	return lock, err
+}
+
+// acquireMigrations is lockMigrations, waiting for the lock until `lockCtx` is done
+func (c *Config) acquireMigrations(ctx context.Context, lockCtx context.Context) (*migrationLock, error) {
+	name := c.migrationLockName()
+	if c.lockProvider != nil {
+		c.logger("[lock] acquiring", name, "from lock provider")
+		release, err := c.lockProvider.Lock(lockCtx, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to acquire lock %q", name)
+		}
+		return &migrationLock{c: c, release: release}, nil
+	}
+	if c.adapter.LockQuery == "" || c.adapter.UnlockQuery == "" {
+		return nil, nil
+	}
+	c.logger("[lock] acquiring", name)
+	lock, err := c.acquireMigrationLock(lockCtx, name)
+	if err != nil {
+		return nil, err
+	}
+	if c.singleConnection {
+		lock.keepOnSession() // progress is not recorded, the only session runs migrations
+	}
+	l := &migrationLock{c: c, conn: lock.conn, process: processName(), release: lock.Unlock}
+	if name != MigrationLockName {
+		l.conn = nil // dbmigrate_progress has one row, shared by all lock names
+	}
+	l.setupProgress(ctx)
+	return l, nil
+}
+
+// acquireMigrationLock tries lock `name` first, so the holder can be reported before waiting
+func (c *Config) acquireMigrationLock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	if c.adapter.TryLockQuery != "" {
+		lock, err := acquireLock(ctx, c.db, c.adapter, name, true)
+		if err != ErrLocked {
+			return lock, err
+		}
+		if name != MigrationLockName {
+			c.logger("[lock] waiting;", describeProgress(nil, nil))
+		} else {
+			c.logger("[lock] waiting;", describeProgress(c.lockHolderProgress(ctx, c.db)))
+		}
+	}
+	return acquireLock(ctx, c.db, c.adapter, name, false)
+}
+
+// migrationLockName is the lock of WithLockName, or MigrationLockName
+func (c *Config) migrationLockName() string {
+	if c.lockName == "" {
+		return MigrationLockName
+	}
+	return c.lockName
+}
+
+// acquireTables holds the table locks `names` of WithTableLocks, from WithLockProvider, or else on
+// dedicated connections of the database, waiting until `ctx` is done
+func (c *Config) acquireTables(ctx context.Context, names []string) (*migrationLock, error) {
+	var releases []func(context.Context) error
+	release := func(ctx context.Context) error {
+		var result error
+		for i := len(releases) - 1; i >= 0; i-- {
+			if err := releases[i](ctx); err != nil && result == nil {
+				result = err
+			}
+		}
+		return result
+	}
+	if c.lockProvider == nil && (c.adapter.LockQuery == "" || c.adapter.UnlockQuery == "") {
+		return nil, errors.Errorf("%q does not support advisory locks, required by table locks", c.driverName)
+	}
+	if len(names) > 0 {
+		c.logger("[lock] acquiring", strings.Join(names, ", "))
+	}
+	for _, name := range names {
+		var unlock func(context.Context) error
+		if c.lockProvider != nil {
+			var err error
+			if unlock, err = c.lockProvider.Lock(ctx, name); err != nil {
+				release(context.Background())
+				return nil, errors.Wrapf(err, "unable to acquire lock %q", name)
+			}
+		} else {
+			lock, err := acquireLock(ctx, c.db, c.adapter, name, false)
+			if err != nil {
+				release(context.Background())
+				return nil, err
+			}
+			if c.singleConnection {
+				lock.keepOnSession()
+			}
+			unlock = lock.Unlock
+		}
+		releases = append(releases, unlock)
+	}
+	return &migrationLock{c: c, release: release, tables: names}, nil
+}
@@ -0,0 +1,183 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLockDriver is fakeDriver registered with an adapter supporting advisory locks, see openFakeLockDB
+type fakeLockDriver struct{ fakeDriver }
+
+func init() {
+	sql.Register("dbmigrate-fake-lock", fakeLockDriver{})
+	Register("dbmigrate-fake-lock", Adapter{LockQuery: "lock", TryLockQuery: "trylock", UnlockQuery: "unlock"})
+}
+
+// openFakeLockDB returns a database holding advisory locks per connection with queries "lock",
+// "trylock" and "unlock"; other queries select nothing
+func openFakeLockDB(t testing.TB) (*sql.DB, *fakeDB) {
+	owners := map[string]int{}
+	db, fake := openFakeDB(t, func(conn int, query string, args []driver.Value) (*fakeRows, error) {
+		if query != "lock" && query != "trylock" && query != "unlock" {
+			return nil, nil
+		}
+		name := args[0].(string)
+		owner, held := owners[name]
+		locked := int64(1)
+		switch {
+		case query == "unlock" && owner == conn:
+			delete(owners, name)
+		case query == "unlock", held && owner != conn:
+			locked = 0
+		default:
+			owners[name] = conn
+		}
+		return &fakeRows{columns: []string{"locked"}, values: [][]driver.Value{{locked}}}, nil
+	})
+	fake.driver = fakeLockDriver{}
+	return db, fake
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openFakeLockDB(t)
+
+	lock, err := Lock(ctx, db, MigrationLockName)
+	assert.NoError(t, err)
+
+	_, err = TryLock(ctx, db, MigrationLockName)
+	assert.Equal(t, ErrLocked, err)
+
+	other, err := TryLock(ctx, db, "startup")
+	assert.NoError(t, err, "different names do not conflict")
+	assert.NoError(t, other.Unlock(ctx))
+
+	assert.NoError(t, lock.Unlock(ctx))
+	again, err := TryLock(ctx, db, MigrationLockName)
+	assert.NoError(t, err)
+	assert.NoError(t, again.Unlock(ctx))
+
+	nolock, _ := openFakeDB(t, nil)
+	_, err = Lock(ctx, nolock, MigrationLockName)
+	assert.EqualError(t, err, `"dbmigrate-fake" does not support advisory locks`)
+}
+
+func TestLockMigrations(t *testing.T) {
+	testCases := []struct {
+		name             string
+		singleConnection bool
+	}{
+		{name: fileline()},
+		{name: fileline(), singleConnection: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, fake := openFakeLockDB(t)
+			adapter, err := AdapterFor("dbmigrate-fake-lock")
+			assert.NoError(t, err)
+			adapter.BeginTx = func(_ context.Context, db *sql.DB, _ *sql.TxOptions) (ExecCommitRollbacker, error) {
+				return &noTx{db: db}, nil
+			}
+			if tc.singleConnection {
+				db.SetMaxOpenConns(1)
+			}
+			c := &Config{dir: fstest.MapFS{"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")}}, db: db, adapter: adapter, store: &fakeStore{}, migrationLock: true, singleConnection: tc.singleConnection, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{"20181222073750_a.up.sql"}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			assert.NoError(t, c.Up(ctx, MigrateOptions{Mode: DbTxnModeAll}), "lock does not starve the pool")
+			assert.Equal(t, []string{"trylock [dbmigrate]", "SELECT 1;", "unlock [dbmigrate]"}, fake.executed())
+		})
+	}
+}
+
+// heldLockProvider is a LockProvider whose lock is held elsewhere until `ctx` is done
+type heldLockProvider struct{}
+
+func (heldLockProvider) Lock(ctx context.Context, _ string) (func(context.Context) error, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// recordingLockProvider is a LockProvider that records each lock and unlock
+type recordingLockProvider struct {
+	calls []string
+}
+
+func (p *recordingLockProvider) Lock(_ context.Context, name string) (func(context.Context) error, error) {
+	p.calls = append(p.calls, "lock "+name)
+	return func(context.Context) error {
+		p.calls = append(p.calls, "unlock "+name)
+		return nil
+	}, nil
+}
+
+// catchingUpStore reports versions as applied from its second call, as if by another process
+type catchingUpStore struct {
+	fakeStore
+	calls int
+}
+
+func (s *catchingUpStore) AppliedVersions(ctx context.Context, schema *string) ([]string, error) {
+	if s.calls++; s.calls < 2 {
+		return nil, nil
+	}
+	return s.versions, nil
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	testCases := []struct {
+		name          string
+		policy        LockedPolicy
+		down          bool
+		expectedCalls int
+		expectedError error
+	}{
+		{name: fileline(), policy: LockedFail, expectedError: ErrLockTimeout},
+		{name: fileline(), policy: LockedWait, expectedCalls: 2},
+		{name: fileline(), policy: LockedWait, down: true, expectedError: ErrLockTimeout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &catchingUpStore{fakeStore: fakeStore{versions: []string{"20181222073750"}}}
+			c := &Config{dir: dir, store: store, migrationLock: true, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{"20181222073750_a.down.sql", "20181222073750_a.up.sql"}
+			WithLockProvider(heldLockProvider{})(c)
+			WithLockTimeout(10*time.Millisecond, tc.policy)(c)
+
+			var err error
+			if tc.down {
+				err = c.Down(context.Background(), MigrateOptions{Steps: 1})
+			} else {
+				err = c.Up(context.Background(), MigrateOptions{})
+			}
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedCalls, store.calls)
+		})
+	}
+}
+
+func TestWithLockName(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	provider := &recordingLockProvider{}
+	c := &Config{dir: fstest.MapFS{"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")}}, db: db, migrationLock: true, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql"}
+	WithVersionStore(&fakeRunStore{})(c)
+	WithLockProvider(provider)(c)
+	WithLockName("payments-svc")(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+	assert.Equal(t, []string{"lock payments-svc", "unlock payments-svc"}, provider.calls)
+}
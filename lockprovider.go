@@ -0,0 +1,13 @@
+package dbmigrate
+
+import (
+	"context"
+)
+
+// A LockProvider holds locks outside of the migrated database, so processes migrating databases
+// without advisory locks still wait for each other; see WithLockProvider, and the providers in
+// lockprovider/redis and lockprovider/etcd
+type LockProvider interface {
+	// Lock waits until lock `name` is acquired, or `ctx` is done; `release` gives it up
+	Lock(ctx context.Context, name string) (release func(context.Context) error, err error)
+}
@@ -0,0 +1,125 @@
+// Package etcd holds dbmigrate locks in etcd, for databases without advisory locks
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/choonkeat/dbmigrate/internal/lease"
+	"github.com/pkg/errors"
+)
+
+// LockProvider holds locks as etcd keys attached to a lease, through the JSON gateway of
+// etcd v3.4+; the lease is kept alive while held, so a crashed process releases its lock after TTL
+type LockProvider struct {
+	Endpoint      string        // e.g. http://localhost:2379
+	Prefix        string        // prepended to lock names, e.g. one per migrated database
+	TTL           time.Duration // lease ttl, rounded up to seconds; default 30s
+	RetryInterval time.Duration // wait between attempts while the lock is held elsewhere; default 1s
+	Client        *http.Client  // default http.DefaultClient
+}
+
+var _ dbmigrate.LockProvider = LockProvider{}
+
+// Lock implements dbmigrate.LockProvider
+func (p LockProvider) Lock(ctx context.Context, name string) (func(context.Context) error, error) {
+	ttl, retry := p.TTL, p.RetryInterval
+	if ttl <= 0 {
+		ttl = lease.DefaultTTL
+	}
+	if retry <= 0 {
+		retry = lease.DefaultRetryInterval
+	}
+	ttlSeconds := int64((ttl + time.Second - 1) / time.Second)
+
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := p.call(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": ttlSeconds}, &grant); err != nil {
+		return nil, err
+	}
+	revoke := func(ctx context.Context) error {
+		return p.call(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": grant.ID}, nil)
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte(p.Prefix + name))
+	txn := map[string]interface{}{
+		"compare": []interface{}{
+			map[string]interface{}{"key": key, "target": "CREATE", "create_revision": "0"},
+		},
+		"success": []interface{}{
+			map[string]interface{}{"request_put": map[string]interface{}{
+				"key":   key,
+				"value": base64.StdEncoding.EncodeToString([]byte(lease.Token())),
+				"lease": grant.ID,
+			}},
+		},
+	}
+	for {
+		var result struct {
+			Succeeded bool `json:"succeeded"`
+		}
+		if err := p.call(ctx, "/v3/kv/txn", txn, &result); err != nil {
+			revoke(context.Background())
+			return nil, err
+		}
+		if result.Succeeded {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			revoke(context.Background())
+			return nil, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+
+	stop := lease.KeepAlive(time.Duration(ttlSeconds)*time.Second, func(ctx context.Context) error {
+		return p.call(ctx, "/v3/lease/keepalive", map[string]interface{}{"ID": grant.ID}, nil)
+	})
+	return func(ctx context.Context) error {
+		stop()
+		return revoke(ctx) // deletes the key attached to the lease
+	}, nil
+}
+
+// call posts `request` as json to `path` of the etcd gateway, and decodes the response into `response` if not nil
+func (p LockProvider) call(ctx context.Context, path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(p.Endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return errors.Wrapf(err, "etcd %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return errors.Errorf("etcd %s: %d %s", path, resp.StatusCode, failure.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(response), "etcd %s", path)
+}
@@ -0,0 +1,74 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEtcd understands just enough of the etcd gateway requests of LockProvider
+type fakeEtcd struct {
+	mu     sync.Mutex
+	leases int
+	keys   map[string]string // key to lease
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.leases++
+		json.NewEncoder(w).Encode(map[string]string{"ID": string(rune('0' + f.leases))})
+	case "/v3/lease/revoke":
+		for key, lease := range f.keys {
+			if lease == body["ID"] {
+				delete(f.keys, key)
+			}
+		}
+		w.Write([]byte(`{}`))
+	case "/v3/kv/txn":
+		put := body["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{})
+		key := put["key"].(string)
+		_, exists := f.keys[key]
+		if !exists {
+			f.keys[key] = put["lease"].(string)
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"succeeded": !exists})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+func TestLockProvider(t *testing.T) {
+	f := &fakeEtcd{keys: map[string]string{}}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	provider := LockProvider{Endpoint: server.URL + "/", Prefix: "app/", RetryInterval: time.Millisecond}
+	release, err := provider.Lock(context.Background(), dbmigrate.MigrationLockName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"YXBwL2RibWlncmF0ZQ==": "1"}, f.keys)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = provider.Lock(ctx, dbmigrate.MigrationLockName)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err), "should wait while held")
+
+	assert.NoError(t, release(context.Background()))
+	assert.Empty(t, f.keys)
+
+	_, err = LockProvider{Endpoint: server.URL + "/bogus"}.Lock(context.Background(), dbmigrate.MigrationLockName)
+	assert.EqualError(t, err, "etcd /v3/lease/grant: 404 not found")
+}
@@ -0,0 +1,159 @@
+// Package redis holds dbmigrate locks in redis, for databases without advisory locks
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/choonkeat/dbmigrate/internal/lease"
+	"github.com/pkg/errors"
+)
+
+// LockProvider holds locks as redis keys set with `SET key token NX PX ttl`, renewing
+// their expiry while held, so a crashed process releases its lock after TTL
+type LockProvider struct {
+	Addr          string        // host:port of the redis server
+	Password      string        // sent with AUTH if not empty
+	Prefix        string        // prepended to lock names, e.g. one per migrated database
+	TTL           time.Duration // expiry of the key; default 30s
+	RetryInterval time.Duration // wait between attempts while the lock is held elsewhere; default 1s
+}
+
+const (
+	redisRenewScript   = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+var _ dbmigrate.LockProvider = LockProvider{}
+
+// Lock implements dbmigrate.LockProvider
+func (p LockProvider) Lock(ctx context.Context, name string) (func(context.Context) error, error) {
+	ttl, retry := p.TTL, p.RetryInterval
+	if ttl <= 0 {
+		ttl = lease.DefaultTTL
+	}
+	if retry <= 0 {
+		retry = lease.DefaultRetryInterval
+	}
+	conn, err := dialRedis(ctx, p.Addr, p.Password)
+	if err != nil {
+		return nil, err
+	}
+	key, token, ttlMS := p.Prefix+name, lease.Token(), strconv.FormatInt(ttl.Milliseconds(), 10)
+	for {
+		reply, err := conn.do("SET", key, token, "NX", "PX", ttlMS)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if reply == "OK" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+
+	stop := lease.KeepAlive(ttl, func(_ context.Context) error {
+		_, err := conn.do("EVAL", redisRenewScript, "1", key, token, ttlMS)
+		return err
+	})
+	return func(_ context.Context) error {
+		stop()
+		defer conn.Close()
+		reply, err := conn.do("EVAL", redisReleaseScript, "1", key, token)
+		if err != nil {
+			return err
+		}
+		if reply != "1" {
+			return errors.Errorf("lock %q had expired before release", key)
+		}
+		return nil
+	}, nil
+}
+
+// redisConn sends commands with the redis serialization protocol, one at a time
+type redisConn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRedis(ctx context.Context, addr string, password string) (*redisConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to redis")
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "unable to authenticate to redis")
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply as a string; a nil reply is ""
+func (c *redisConn) do(args ...string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return "", errors.Wrapf(err, "redis %s", args[0])
+	}
+	reply, err := readRedisReply(c.reader)
+	return reply, errors.Wrapf(err, "redis %s", args[0])
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// readRedisReply reads a simple string, error, integer or bulk string reply
+func readRedisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid reply %q", line)
+		}
+		if size < 0 {
+			return "", nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data[:size]), nil
+	}
+	return "", errors.Errorf("unsupported reply %q", line)
+}
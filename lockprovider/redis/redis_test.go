@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileline() string {
+	_, fn, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", fn, line)
+}
+
+// fakeRedis understands just enough of SET NX PX and the EVAL scripts of LockProvider
+type fakeRedis struct {
+	mu       sync.Mutex
+	keys     map[string]string
+	listener net.Listener
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{keys: map[string]string{}, listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, count)
+		for i := range args {
+			reader.ReadString('\n') // $size
+			arg, _ := reader.ReadString('\n')
+			args[i] = strings.TrimSuffix(arg, "\r\n")
+		}
+		fmt.Fprint(conn, f.reply(args))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case args[0] == "SET":
+		if _, ok := f.keys[args[1]]; ok {
+			return "$-1\r\n"
+		}
+		f.keys[args[1]] = args[2]
+		return "+OK\r\n"
+	case args[0] == "EVAL" && f.keys[args[3]] != args[4]:
+		return ":0\r\n"
+	case args[0] == "EVAL" && args[1] == redisReleaseScript:
+		delete(f.keys, args[3])
+	}
+	return ":1\r\n"
+}
+
+func TestLockProvider(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.listener.Close()
+
+	provider := LockProvider{Addr: f.listener.Addr().String(), Prefix: "app/", RetryInterval: time.Millisecond}
+	release, err := provider.Lock(context.Background(), dbmigrate.MigrationLockName)
+	assert.NoError(t, err)
+	assert.Contains(t, f.keys, "app/dbmigrate")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = provider.Lock(ctx, dbmigrate.MigrationLockName)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err), "should wait while held")
+
+	assert.NoError(t, release(context.Background()))
+	assert.NotContains(t, f.keys, "app/dbmigrate")
+
+	release, err = provider.Lock(context.Background(), dbmigrate.MigrationLockName)
+	assert.NoError(t, err)
+	f.mu.Lock()
+	f.keys["app/dbmigrate"] = "someone else"
+	f.mu.Unlock()
+	assert.EqualError(t, release(context.Background()), `lock "app/dbmigrate" had expired before release`)
+}
+
+func TestReadRedisReply(t *testing.T) {
+	testCases := []struct {
+		name          string
+		given         string
+		expected      string
+		expectedError string
+	}{
+		{name: fileline(), given: "+OK\r\n", expected: "OK"},
+		{name: fileline(), given: ":1\r\n", expected: "1"},
+		{name: fileline(), given: "$5\r\nhello\r\n", expected: "hello"},
+		{name: fileline(), given: "$-1\r\n", expected: ""},
+		{name: fileline(), given: "-ERR wrong\r\n", expectedError: "ERR wrong"},
+		{name: fileline(), given: "*1\r\n", expectedError: `unsupported reply "*1"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := readRedisReply(bufio.NewReader(strings.NewReader(tc.given)))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
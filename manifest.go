@@ -0,0 +1,75 @@
+package dbmigrate
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Manifest policies when a target fails to migrate
+const (
+	ManifestPolicyStop         = "stop"           // stop; targets migrated earlier stay migrated
+	ManifestPolicyAllOrNothing = "all-or-nothing" // stop and migrate down what earlier targets applied in this run
+)
+
+// Manifest lists databases that are migrated together, in order
+type Manifest struct {
+	Policy  string           `json:"policy"`
+	Flags   Pins             `json:"flags"` // command line flags pinned for all targets, see PinsFilename
+	Targets []ManifestTarget `json:"targets"`
+}
+
+// ManifestTarget is one database of a Manifest. Values may refer to environment
+// variables, e.g. `"url": "${DATABASE_URL}"`
+type ManifestTarget struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	URL    string `json:"url"`
+	Dir    string `json:"dir"`
+	Schema string `json:"schema"`
+}
+
+// ParseManifest decodes a json Manifest from `r`, expanding environment variables
+func ParseManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return m, errors.Wrapf(err, "invalid manifest")
+	}
+
+	switch m.Policy {
+	case "":
+		m.Policy = ManifestPolicyStop
+	case ManifestPolicyStop, ManifestPolicyAllOrNothing:
+	default:
+		return m, errors.Errorf("manifest policy must be %q or %q, got %q", ManifestPolicyStop, ManifestPolicyAllOrNothing, m.Policy)
+	}
+	if len(m.Targets) == 0 {
+		return m, errors.Errorf("manifest has no targets")
+	}
+
+	names := map[string]bool{}
+	for i, t := range m.Targets {
+		t.Name = strings.TrimSpace(os.ExpandEnv(t.Name))
+		t.Driver = os.ExpandEnv(t.Driver)
+		t.URL = os.ExpandEnv(t.URL)
+		t.Dir = os.ExpandEnv(t.Dir)
+		t.Schema = os.ExpandEnv(t.Schema)
+		if t.Name == "" {
+			return m, errors.Errorf("manifest target #%d has no name", i+1)
+		}
+		if names[t.Name] {
+			return m, errors.Errorf("manifest target %q is listed more than once", t.Name)
+		}
+		if t.Dir == "" {
+			return m, errors.Errorf("manifest target %q has no dir", t.Name)
+		}
+		names[t.Name] = true
+		m.Targets[i] = t
+	}
+	return m, nil
+}
@@ -0,0 +1,93 @@
+package dbmigrate
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseManifest(t *testing.T) {
+	if original, ok := os.LookupEnv("TEST_MANIFEST_URL"); ok {
+		defer os.Setenv("TEST_MANIFEST_URL", original)
+	} else {
+		defer os.Unsetenv("TEST_MANIFEST_URL")
+	}
+	os.Setenv("TEST_MANIFEST_URL", "postgres://localhost/app") // not t.Setenv, which needs go 1.17
+	testCases := []struct {
+		name     string
+		given    string
+		expected Manifest
+		wantErr  string
+	}{
+		{
+			name:  fileline(),
+			given: `{"targets": [{"name": "primary", "driver": "postgres", "url": "${TEST_MANIFEST_URL}", "dir": "db/migrations"}]}`,
+			expected: Manifest{
+				Policy:  ManifestPolicyStop,
+				Targets: []ManifestTarget{{Name: "primary", Driver: "postgres", URL: "postgres://localhost/app", Dir: "db/migrations"}},
+			},
+		},
+		{
+			name:  fileline(),
+			given: `{"policy": "all-or-nothing", "targets": [{"name": "a", "dir": "a"}, {"name": "b", "dir": "b", "schema": "x"}]}`,
+			expected: Manifest{
+				Policy:  ManifestPolicyAllOrNothing,
+				Targets: []ManifestTarget{{Name: "a", Dir: "a"}, {Name: "b", Dir: "b", Schema: "x"}},
+			},
+		},
+		{
+			name:  fileline(),
+			given: `{"flags": {"txn-mode": "per-file", "strict": true}, "targets": [{"name": "a", "dir": "a"}]}`,
+			expected: Manifest{
+				Policy:  ManifestPolicyStop,
+				Flags:   Pins{"txn-mode": {"per-file"}, "strict": {"true"}},
+				Targets: []ManifestTarget{{Name: "a", Dir: "a"}},
+			},
+		},
+		{
+			name:    fileline(),
+			given:   `{"policy": "best-effort", "targets": [{"name": "a", "dir": "a"}]}`,
+			wantErr: `manifest policy must be "stop" or "all-or-nothing", got "best-effort"`,
+		},
+		{
+			name:    fileline(),
+			given:   `{"targets": []}`,
+			wantErr: `manifest has no targets`,
+		},
+		{
+			name:    fileline(),
+			given:   `{"targets": [{"name": "a", "dir": "a"}, {"name": "a", "dir": "b"}]}`,
+			wantErr: `manifest target "a" is listed more than once`,
+		},
+		{
+			name:    fileline(),
+			given:   `{"targets": [{"dir": "a"}]}`,
+			wantErr: `manifest target #1 has no name`,
+		},
+		{
+			name:    fileline(),
+			given:   `{"targets": [{"name": "a"}]}`,
+			wantErr: `manifest target "a" has no dir`,
+		},
+		{
+			name:    fileline(),
+			given:   `{"targets": [{"name": "a", "dir": "a", "database": "x"}]}`,
+			wantErr: `invalid manifest: json: unknown field "database"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseManifest(strings.NewReader(tc.given))
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
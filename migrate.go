@@ -0,0 +1,289 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekparker/trie"
+	"github.com/pkg/errors"
+)
+
+// ErrNoMigrationFiles is returned by Up when `dir` has no `.up.sql` files, e.g. a mistyped directory;
+// see WithAllowEmpty
+var ErrNoMigrationFiles = errors.Errorf("no `.up.sql` files found")
+
+// MigrateOptions are the settings of one Up or Down call.
+// The zero value applies every pending file in one transaction, holding the migration lock
+type MigrateOptions struct {
+	TxOptions     *sql.TxOptions // nil means database defaults
+	Schema        *string
+	Mode          DbTxnMode
+	TxMaxFiles    int           // with DbTxnModeAll, commit and begin a new transaction after this many files; 0 means no limit
+	TxMaxDuration time.Duration // with DbTxnModeAll, commit and begin a new transaction after a file ends past this; 0 means no limit
+	NoLock        bool          // do not hold the migration lock during this call, see also WithoutMigrationLock
+	Target        string        // Up applies versions up to and including Target; Down un-applies versions after Target; "" means no limit
+	Steps         int           // at most this many files; 0 means no limit for Up, and is required unless Target or RunID is set for Down
+	RunID         string        // Down un-applies versions applied by this run of Up, see Runs; LastRun means the latest
+	Strict        bool          // fail if the database has versions not found in `dir`
+	File          string        // Up applies only this pending `.up.sql` file
+	AllowGaps     bool          // with File, apply it even if earlier versions are pending
+
+	BeforeFile func(filename string) error                // called before each file; an error stops the migration
+	AfterFile  func(filename string)                      // called after each file is applied
+	AfterSkip  func(filename string)                      // called after each file skipped by WithSkipVersions or WithEnv, applied or not
+	AfterChunk func(filename string, done int, total int) // called after each chunk of statements of a file with `chunk` directive is committed
+}
+
+// Up applies pending migrations in ascending order, grouped into transactions by `opts.Mode`
+//
+// Transaction is committed on success, rollback on error. Different databases will behave
+// differently, e.g. postgres & sqlite3 can rollback DDL changes but mysql cannot
+func (c *Config) Up(ctx context.Context, opts MigrateOptions) error {
+	if !c.allowEmpty && !c.hasUpFiles() {
+		return ErrNoMigrationFiles
+	}
+	migratedVersions, lock, err := c.prepareRun(ctx, opts, directionUp)
+	if err == ErrLockTimeout && c.lockedPolicy == LockedWait {
+		return c.waitCurrent(ctx, opts.Schema)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	var filenames []string
+	pending := c.pendingFiles(migratedVersions)
+	if opts.File != "" {
+		if filenames, err = pendingFile(pending, opts.File, opts.AllowGaps); err != nil {
+			return err
+		}
+		pending = nil
+	}
+	for _, currName := range pending {
+		if opts.Target != "" && c.versionOf(currName) > opts.Target {
+			break // pendingFiles are in ascending order
+		}
+		if opts.Steps > 0 && len(filenames) >= opts.Steps {
+			break
+		}
+		filenames = append(filenames, currName)
+	}
+
+	before, err := c.selectObjects(ctx, opts.Schema)
+	if err != nil {
+		return err
+	}
+
+	if err = c.upModules(ctx, opts); err == nil {
+		// run the sql and insert a row into `dbmigrate_versions`
+		r := newRun(directionUp, opts, lock)
+		if c.archive {
+			r.archive = archiveSourceDir
+		}
+		err = c.runFiles(ctx, r, filenames)
+	}
+
+	// modules, and files committed before a failure, may have created objects too
+	if fixupErr := c.fixupObjects(ctx, opts.Schema, before); fixupErr != nil {
+		if err != nil {
+			c.logger("[fixup]", fixupErr.Error())
+			return err
+		}
+		return fixupErr
+	}
+	return err
+}
+
+// pendingFile returns the pending file at path `filename` relative to dir, or the only pending file
+// with its base name; earlier pending files are not allowed unless `allowGaps`
+func pendingFile(pending []string, filename string, allowGaps bool) ([]string, error) {
+	filename = path.Clean(filepath.ToSlash(filename))
+	index := -1
+	for i, currName := range pending {
+		if path.Clean(filepath.ToSlash(currName)) == filename {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		var matches []int
+		for i, currName := range pending {
+			if path.Base(filepath.ToSlash(currName)) == path.Base(filename) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) > 1 {
+			return nil, errors.Errorf("%s: %d pending files are named so, e.g. %s and %s; give its path relative to dir", filename, len(matches), pending[matches[0]], pending[matches[1]])
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("%s: not a pending `.up.sql` file", filename)
+		}
+		index = matches[0]
+	}
+	if index > 0 && !allowGaps {
+		return nil, errors.Errorf("%s: %d earlier version(s) are pending, e.g. %s; allow gaps to apply it first", pending[index], index, pending[0])
+	}
+	return []string{pending[index]}, nil
+}
+
+// Down un-applies migrations in descending order, grouped into transactions by `opts.Mode`;
+// `opts.Steps`, `opts.Target` or `opts.RunID` is required
+func (c *Config) Down(ctx context.Context, opts MigrateOptions) error {
+	if opts.Steps <= 0 && opts.Target == "" && opts.RunID == "" {
+		return errors.Errorf("down requires steps, target version or run id")
+	}
+	migratedVersions, lock, err := c.prepareRun(ctx, opts, directionDown)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	var run Run
+	runVersions, laterVersions := map[string]bool{}, map[string]bool{}
+	if opts.RunID != "" {
+		if run, laterVersions, err = c.appliedRun(ctx, opts.Schema, opts.RunID, migratedVersions); err != nil {
+			return err
+		}
+		reversible := map[string]bool{}
+		for _, currName := range c.migrationFiles {
+			if strings.HasSuffix(currName, "down.sql") {
+				reversible[c.versionOf(currName)] = true
+			}
+		}
+		for _, version := range run.Versions {
+			if !reversible[version] {
+				return errors.Errorf("version %s of run %s has no `.down.sql` file; cannot revert the run", version, run.ID)
+			}
+			runVersions[version] = true
+		}
+		c.logger("[down-run]", run.ID, "has", len(run.Versions), "version(s) still applied")
+	}
+
+	migrationFiles := append([]string(nil), c.migrationFiles...) // copy; Config may be reused
+	sort.SliceStable(migrationFiles, func(i int, j int) bool {
+		return strings.Compare(migrationFiles[i], migrationFiles[j]) == 1 // descending order
+	})
+
+	var filenames []string
+	for i := range migrationFiles {
+		currName := migrationFiles[i]
+		if !strings.HasSuffix(currName, "down.sql") {
+			continue // skip if this isn't a `down.sql`
+		}
+		currVer := c.versionOf(currName)
+		if _, found := migratedVersions.Find(currVer); !found {
+			continue // skip if we've NOT migrated this version
+		}
+		if opts.Target != "" && currVer <= opts.Target {
+			break // reached target version
+		}
+		if run.ID != "" && currVer < run.Versions[0] {
+			break // reached versions before the run
+		}
+		if run.ID != "" && laterVersions[currVer] {
+			return errors.Errorf("%s was applied after run %s; roll it back first", currName, run.ID)
+		}
+		if run.ID != "" && !runVersions[currVer] {
+			continue // skip if applied before the run, e.g. the run filled a gap
+		}
+		if !c.filtered(currName) {
+			continue // skip if excluded by WithFileFilter
+		}
+		if opts.Steps > 0 && len(filenames) >= opts.Steps {
+			break // time to stop
+		}
+		filenames = append(filenames, currName)
+	}
+
+	// run the sql and delete row from `dbmigrate_versions`
+	r := newRun(directionDown, opts, lock)
+	if c.archive {
+		r.archive = archiveSourceDir
+	}
+	return c.runFiles(ctx, r, filenames)
+}
+
+// waitCurrent polls every second until no version is pending, e.g. applied by the holder of the migration lock
+func (c *Config) waitCurrent(ctx context.Context, schema *string) error {
+	for {
+		pending, err := c.PendingVersions(ctx, schema)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			c.logger("[lock] pending versions were applied by another process")
+			return nil
+		}
+		c.logger("[lock] held by another process; waiting for", len(pending), "pending version(s) to be applied")
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "%d version(s) still pending", len(pending))
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *Config) hasUpFiles() bool {
+	for _, currName := range c.migrationFiles {
+		if strings.HasSuffix(currName, "up.sql") {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareRun holds the migration lock unless `opts.NoLock`, and returns the applied versions
+func (c *Config) prepareRun(ctx context.Context, opts MigrateOptions, direction string) (*trie.Trie, *migrationLock, error) {
+	if opts.Schema != nil && *opts.Schema != "" {
+		if err := ValidateIdentifier(*opts.Schema); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid schema")
+		}
+	}
+	if opts.Mode == DbTxnModeAll && keptElsewhere(c.store) {
+		return nil, nil, errors.Errorf("versions kept in another database are recorded as each file runs and cannot be rolled back with the files; use transaction mode %s", DbTxnModePerFile)
+	}
+	var lock *migrationLock
+	if !opts.NoLock {
+		var err error
+		if lock, err = c.lockMigrations(ctx, opts.Schema, direction); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := c.checkFrozen(ctx, opts.Schema); err != nil {
+		lock.unlock()
+		return nil, nil, err
+	}
+
+	if opts.Strict {
+		unknownVersions, err := c.UnknownVersions(ctx, opts.Schema)
+		if err != nil {
+			lock.unlock()
+			return nil, nil, err
+		}
+		if len(unknownVersions) > 0 {
+			lock.unlock()
+			return nil, nil, errors.Errorf("%d version(s) applied in database but not found in dir: %s", len(unknownVersions), strings.Join(unknownVersions, ", "))
+		}
+	}
+
+	applied, err := c.AppliedVersions(ctx, opts.Schema)
+	if err != nil {
+		lock.unlock()
+		return nil, nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	if truncated := c.truncatedVersions(applied); len(truncated) > 0 {
+		lock.unlock()
+		return nil, nil, errors.Errorf("applied version(s) %s look truncated by the versions table; widen its version column first", strings.Join(truncated, ", "))
+	}
+	migratedVersions := trie.New()
+	for _, v := range applied {
+		migratedVersions.Add(v, 1)
+	}
+	return migratedVersions, lock, nil
+}
@@ -0,0 +1,554 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpDown(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073900_b", "20181222073901_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+
+	testCases := []struct {
+		name          string
+		applied       []string
+		down          bool
+		opts          MigrateOptions
+		expectedFiles []string
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			expectedFiles: []string{"20181222073900_b.up.sql", "20181222073901_c.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{Steps: 1},
+			expectedFiles: []string{"20181222073900_b.up.sql"},
+		},
+		{
+			name:          fileline(),
+			opts:          MigrateOptions{Target: "20181222073900"},
+			expectedFiles: []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{Strict: true},
+			expectedFiles: []string{"20181222073900_b.up.sql", "20181222073901_c.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750", "20181222073800"},
+			opts:          MigrateOptions{Strict: true},
+			expectedError: "1 version(s) applied in database but not found in dir: 20181222073800",
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"2018122207"},
+			expectedError: "applied version(s) 2018122207 look truncated by the versions table; widen its version column first",
+		},
+		{
+			name: fileline(),
+			opts: MigrateOptions{BeforeFile: func(filename string) error {
+				if strings.HasPrefix(filename, "20181222073900") {
+					return errors.New("stop")
+				}
+				return nil
+			}},
+			expectedFiles: []string{"20181222073750_a.up.sql"},
+			expectedError: "20181222073900_b.up.sql: stop",
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{File: "20181222073900_b.up.sql"},
+			expectedFiles: []string{"20181222073900_b.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{File: "db/migrations/20181222073901_c.up.sql"},
+			expectedError: "20181222073901_c.up.sql: 1 earlier version(s) are pending, e.g. 20181222073900_b.up.sql; allow gaps to apply it first",
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{File: "20181222073901_c.up.sql", AllowGaps: true},
+			expectedFiles: []string{"20181222073901_c.up.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			opts:          MigrateOptions{File: "20181222073750_a.up.sql"},
+			expectedError: "20181222073750_a.up.sql: not a pending `.up.sql` file",
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750", "20181222073900", "20181222073901"},
+			down:          true,
+			opts:          MigrateOptions{Steps: 1},
+			expectedFiles: []string{"20181222073901_c.down.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750", "20181222073900", "20181222073901"},
+			down:          true,
+			opts:          MigrateOptions{Target: "20181222073750"},
+			expectedFiles: []string{"20181222073901_c.down.sql", "20181222073900_b.down.sql"},
+		},
+		{
+			name:          fileline(),
+			applied:       []string{"20181222073750"},
+			down:          true,
+			expectedError: "down requires steps, target version or run id",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{dir: dir, db: db, store: &fakeStore{versions: tc.applied}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			for name := range dir {
+				c.migrationFiles = append(c.migrationFiles, name)
+			}
+			var files []string
+			tc.opts.Mode = DbTxnModeNone
+			tc.opts.AfterFile = func(filename string) { files = append(files, filename) }
+
+			var err error
+			if tc.down {
+				err = c.Down(context.Background(), tc.opts)
+			} else {
+				err = c.Up(context.Background(), tc.opts)
+			}
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedFiles, files)
+		})
+	}
+}
+
+func TestPendingFile(t *testing.T) {
+	pending := []string{"a/20181222073750_x.up.sql", "a/20181222073752_y.up.sql", "b/20181222073751_x.up.sql", "b/20181222073752_y.up.sql"}
+	testCases := []struct {
+		name          string
+		filename      string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     fileline(),
+			filename: "./b/../b/20181222073751_x.up.sql",
+			expected: []string{"b/20181222073751_x.up.sql"},
+		},
+		{
+			name:     fileline(),
+			filename: "20181222073751_x.up.sql",
+			expected: []string{"b/20181222073751_x.up.sql"},
+		},
+		{
+			name:          fileline(),
+			filename:      "20181222073752_y.up.sql",
+			expectedError: "20181222073752_y.up.sql: 2 pending files are named so, e.g. a/20181222073752_y.up.sql and b/20181222073752_y.up.sql; give its path relative to dir",
+		},
+		{
+			name:     fileline(),
+			filename: "a/20181222073752_y.up.sql",
+			expected: []string{"a/20181222073752_y.up.sql"},
+		},
+		{
+			name:          fileline(),
+			filename:      "c/20181222073753_z.up.sql",
+			expectedError: "c/20181222073753_z.up.sql: not a pending `.up.sql` file",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := pendingFile(pending, tc.filename, true)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, files)
+		})
+	}
+}
+
+func TestUpEmptyDir(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	c := &Config{dir: fstest.MapFS{}, db: db, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.down.sql"}
+	assert.Equal(t, ErrNoMigrationFiles, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+
+	WithAllowEmpty()(c)
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+}
+
+func TestUpEmptyFile(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("-- TODO\n")},
+		"20181222073751_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	var logs []string
+	store := &fakeStore{}
+	c := &Config{dir: dir, db: db, store: store, logger: func(args ...interface{}) { logs = append(logs, fmt.Sprint(args...)) }, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073751_b.up.sql"}
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+
+	if assert.Len(t, store.entries, 2) {
+		assert.Equal(t, "empty", store.entries[0].Remark)
+		assert.Equal(t, "", store.entries[1].Remark)
+	}
+	assert.Contains(t, logs, fmt.Sprint("[empty]", "20181222073750_a.up.sql", "has no statements and is recorded as applied"))
+}
+
+func TestUpAfterSkip(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073751_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073752_c.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	c := &Config{dir: dir, db: db, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073751_b.up.sql", "20181222073752_c.up.sql"}
+	WithSkipVersions("20181222073751")(c)
+
+	var applied, skipped []string
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{
+		Mode:      DbTxnModeNone,
+		AfterFile: func(filename string) { applied = append(applied, filename) },
+		AfterSkip: func(filename string) { skipped = append(skipped, filename) },
+	}))
+	assert.Equal(t, []string{"20181222073750_a.up.sql", "20181222073752_c.up.sql"}, applied)
+	assert.Equal(t, []string{"20181222073751_b.up.sql"}, skipped)
+}
+
+func TestWithBackup(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073751_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	store := &fakeStore{}
+	c := &Config{dir: dir, db: db, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073751_b.up.sql"}
+
+	var backedUp [][]string
+	WithBackup(func(_ context.Context, filenames []string) error {
+		backedUp = append(backedUp, filenames)
+		return errors.Errorf("disk full")
+	})(c)
+	assert.EqualError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}), "backup failed; no file was applied: disk full")
+	assert.Equal(t, [][]string{{"20181222073750_a.up.sql", "20181222073751_b.up.sql"}}, backedUp)
+	assert.Empty(t, store.entries)
+
+	store.versions = []string{"20181222073750", "20181222073751"}
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+	assert.Len(t, backedUp, 1, "no backup when nothing is pending")
+}
+
+// countingTx counts commits of transactions begun by its adapter
+type countingTx struct {
+	noTx
+	commits *int
+}
+
+func (tx *countingTx) Commit() error {
+	*tx.commits++
+	return nil
+}
+
+func TestUpTxMaxFiles(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073900_b", "20181222073901_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+
+	testCases := []struct {
+		name            string
+		opts            MigrateOptions
+		expectedCommits int
+	}{
+		{name: fileline(), opts: MigrateOptions{}, expectedCommits: 1},
+		{name: fileline(), opts: MigrateOptions{TxMaxFiles: 1}, expectedCommits: 3},
+		{name: fileline(), opts: MigrateOptions{TxMaxFiles: 2}, expectedCommits: 2},
+		{name: fileline(), opts: MigrateOptions{TxMaxDuration: time.Nanosecond}, expectedCommits: 3},
+		{name: fileline(), opts: MigrateOptions{TxMaxFiles: 1, Mode: DbTxnModePerFile}, expectedCommits: 3},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			commits := 0
+			c := &Config{dir: dir, db: db, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.adapter.BeginTx = func(_ context.Context, db *sql.DB, _ *sql.TxOptions) (ExecCommitRollbacker, error) {
+				return &countingTx{noTx: noTx{db: db}, commits: &commits}, nil
+			}
+			for name := range dir {
+				c.migrationFiles = append(c.migrationFiles, name)
+			}
+			sort.Strings(c.migrationFiles)
+
+			assert.NoError(t, c.Up(context.Background(), tc.opts))
+			assert.Equal(t, tc.expectedCommits, commits)
+		})
+	}
+}
+
+func TestRunFilesModes(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073900_b", "20181222073901_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 'up';")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 'down';")}
+	}
+	failOn := func(filename string) Middleware {
+		return func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, stmt Statement) (sql.Result, error) {
+				if stmt.Filename == filename {
+					return nil, errors.New("boom")
+				}
+				return next.Exec(ctx, stmt)
+			})
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		mode             DbTxnMode
+		down             bool
+		failOn           string
+		expectedFiles    []string
+		expectedVersions []string
+		expectedCommits  int
+		expectedError    string
+	}{
+		{
+			name:             fileline(),
+			mode:             DbTxnModeAll,
+			expectedFiles:    []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql", "20181222073901_c.up.sql"},
+			expectedVersions: []string{"20181222073750", "20181222073900", "20181222073901"},
+			expectedCommits:  1,
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModePerFile,
+			expectedFiles:    []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql", "20181222073901_c.up.sql"},
+			expectedVersions: []string{"20181222073750", "20181222073900", "20181222073901"},
+			expectedCommits:  3,
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeNone,
+			expectedFiles:    []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql", "20181222073901_c.up.sql"},
+			expectedVersions: []string{"20181222073750", "20181222073900", "20181222073901"},
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeAll,
+			down:             true,
+			expectedFiles:    []string{"20181222073901_c.down.sql", "20181222073900_b.down.sql", "20181222073750_a.down.sql"},
+			expectedVersions: []string{"20181222073901", "20181222073900", "20181222073750"},
+			expectedCommits:  1,
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModePerFile,
+			down:             true,
+			expectedFiles:    []string{"20181222073901_c.down.sql", "20181222073900_b.down.sql", "20181222073750_a.down.sql"},
+			expectedVersions: []string{"20181222073901", "20181222073900", "20181222073750"},
+			expectedCommits:  3,
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeNone,
+			down:             true,
+			expectedFiles:    []string{"20181222073901_c.down.sql", "20181222073900_b.down.sql", "20181222073750_a.down.sql"},
+			expectedVersions: []string{"20181222073901", "20181222073900", "20181222073750"},
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeAll,
+			failOn:           "20181222073900_b.up.sql",
+			expectedFiles:    []string{"20181222073750_a.up.sql"},
+			expectedVersions: []string{"20181222073750"},
+			expectedError:    "20181222073900_b.up.sql: boom",
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModePerFile,
+			failOn:           "20181222073900_b.up.sql",
+			expectedFiles:    []string{"20181222073750_a.up.sql"},
+			expectedVersions: []string{"20181222073750"},
+			expectedCommits:  1,
+			expectedError:    "20181222073900_b.up.sql: boom",
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeNone,
+			failOn:           "20181222073900_b.up.sql",
+			expectedFiles:    []string{"20181222073750_a.up.sql"},
+			expectedVersions: []string{"20181222073750"},
+			expectedError:    "20181222073900_b.up.sql: boom",
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeAll,
+			down:             true,
+			failOn:           "20181222073900_b.down.sql",
+			expectedFiles:    []string{"20181222073901_c.down.sql"},
+			expectedVersions: []string{"20181222073901"},
+			expectedError:    "20181222073900_b.down.sql: boom",
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModePerFile,
+			down:             true,
+			failOn:           "20181222073900_b.down.sql",
+			expectedFiles:    []string{"20181222073901_c.down.sql"},
+			expectedVersions: []string{"20181222073901"},
+			expectedCommits:  1,
+			expectedError:    "20181222073900_b.down.sql: boom",
+		},
+		{
+			name:             fileline(),
+			mode:             DbTxnModeNone,
+			down:             true,
+			failOn:           "20181222073900_b.down.sql",
+			expectedFiles:    []string{"20181222073901_c.down.sql"},
+			expectedVersions: []string{"20181222073901"},
+			expectedError:    "20181222073900_b.down.sql: boom",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			commits := 0
+			store := &fakeStore{}
+			c := &Config{dir: dir, db: db, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.adapter.BeginTx = func(_ context.Context, db *sql.DB, _ *sql.TxOptions) (ExecCommitRollbacker, error) {
+				return &countingTx{noTx: noTx{db: db}, commits: &commits}, nil
+			}
+			if tc.failOn != "" {
+				WithMiddleware(failOn(tc.failOn))(c)
+			}
+			for name := range dir {
+				c.migrationFiles = append(c.migrationFiles, name)
+			}
+			sort.Strings(c.migrationFiles)
+
+			var files []string
+			opts := MigrateOptions{Mode: tc.mode, AfterFile: func(filename string) { files = append(files, filename) }}
+			var err error
+			direction := directionUp
+			if tc.down {
+				store.versions = []string{"20181222073750", "20181222073900", "20181222073901"}
+				opts.Steps = 3
+				direction = directionDown
+				err = c.Down(context.Background(), opts)
+			} else {
+				err = c.Up(context.Background(), opts)
+			}
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedFiles, files)
+			assert.Equal(t, tc.expectedCommits, commits)
+
+			var versions []string
+			for _, entry := range store.entries {
+				versions = append(versions, entry.Version)
+				assert.Equal(t, direction, entry.Direction)
+			}
+			assert.Equal(t, tc.expectedVersions, versions)
+		})
+	}
+}
+
+func TestEnvSkipLog(t *testing.T) {
+	testCases := []struct {
+		name        string
+		down        bool
+		policy      EnvSkipPolicy
+		expectedLog string
+	}{
+		{
+			name:        fileline(),
+			policy:      EnvSkipPending,
+			expectedLog: "[skip] 20181222073750_a.up.sql is not for env production and is left pending",
+		},
+		{
+			name:        fileline(),
+			policy:      EnvSkipRecord,
+			expectedLog: "[skip] 20181222073750_a.up.sql is not for env production and is recorded as applied",
+		},
+		{
+			name:        fileline(),
+			down:        true,
+			policy:      EnvSkipPending,
+			expectedLog: "[skip] 20181222073750_a.down.sql is not for env production and is left applied; not rolled back",
+		},
+		{
+			name:        fileline(),
+			down:        true,
+			policy:      EnvSkipRecord,
+			expectedLog: "[skip] 20181222073750_a.down.sql is not for env production and is recorded as rolled back",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, nil)
+			dir := fstest.MapFS{
+				"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("-- dbmigrate:only env=dev\nINSERT INTO users VALUES ('test');")},
+				"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("-- dbmigrate:only env=dev\nDELETE FROM users;")},
+			}
+			var logs []string
+			logger := func(args ...interface{}) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(args...))) }
+			adapter := Adapter{BeginTx: func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) {
+				return &noTx{db: db}, nil
+			}}
+			store := &fakeStore{}
+			c := &Config{dir: dir, db: db, adapter: adapter, store: store, logger: logger, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{"20181222073750_a.down.sql", "20181222073750_a.up.sql"}
+			WithEnv("production", tc.policy)(c)
+
+			if tc.down {
+				store.versions = []string{"20181222073750"}
+				assert.NoError(t, c.Down(context.Background(), MigrateOptions{Steps: 1}))
+			} else {
+				assert.NoError(t, c.Up(context.Background(), MigrateOptions{}))
+			}
+			assert.Contains(t, logs, tc.expectedLog)
+		})
+	}
+}
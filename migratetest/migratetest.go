@@ -0,0 +1,96 @@
+// Package migratetest starts a database in a docker container for a test, with migrations applied,
+// so packages using dbmigrate need no test bootstrap of their own
+//
+//	func TestOrders(t *testing.T) {
+//		databaseURL := migratetest.WithPostgresContainer(t, os.DirFS("../db/migrations"))
+//		db, err := sql.Open("postgres", databaseURL)
+//		...
+//	}
+package migratetest
+
+import (
+	"context"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/dbmigrate"
+	_ "github.com/go-sql-driver/mysql" // registers "mysql"
+	_ "github.com/lib/pq"              // registers "postgres"
+	"github.com/pkg/errors"
+)
+
+// Images of the containers; change before starting a container, e.g. in TestMain, to test another version
+var (
+	PostgresImage = "postgres"
+	MySQLImage    = "mysql"
+)
+
+// errNoDocker means the docker command line is not installed
+var errNoDocker = errors.Errorf("docker not found in PATH")
+
+// docker runs the docker command line with `args`, returning its trimmed output
+var docker = func(args ...string) (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", errNoDocker
+	}
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "docker %s: %s", args[0], strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// WithPostgresContainer starts a postgres container for `t`, applies migrations of `dir` to it with `options`,
+// and returns its database url. The container is removed when `t` and its subtests finish.
+// `t` is skipped if docker is not installed
+func WithPostgresContainer(t testing.TB, dir fs.FS, options ...dbmigrate.Option) string {
+	t.Helper()
+	address := startContainer(t, PostgresImage, "5432", "-e", "POSTGRES_PASSWORD=password", "-e", "POSTGRES_DB=migratetest")
+	databaseURL := "postgres://postgres:password@" + address + "/migratetest?sslmode=disable"
+	migrate(t, dir, "postgres", databaseURL, options)
+	return databaseURL
+}
+
+// WithMySQLContainer starts a mysql container for `t`, applies migrations of `dir` to it with `options`,
+// and returns its database url. The container is removed when `t` and its subtests finish.
+// `t` is skipped if docker is not installed
+func WithMySQLContainer(t testing.TB, dir fs.FS, options ...dbmigrate.Option) string {
+	t.Helper()
+	address := startContainer(t, MySQLImage, "3306", "-e", "MYSQL_ROOT_PASSWORD=password", "-e", "MYSQL_DATABASE=migratetest")
+	databaseURL := "root:password@tcp(" + address + ")/migratetest?multiStatements=true"
+	migrate(t, dir, "mysql", databaseURL, options)
+	return databaseURL
+}
+
+// startContainer runs `image` with `args`, publishing `port` on a random port of localhost, and returns its address
+func startContainer(t testing.TB, image string, port string, args ...string) string {
+	t.Helper()
+	id, err := docker(append(append([]string{"run", "--rm", "-d", "-p", "127.0.0.1::" + port}, args...), image)...)
+	if err == errNoDocker {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := docker("rm", "-f", id); err != nil {
+			t.Log(err)
+		}
+	})
+
+	published, err := docker("port", id, port+"/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitN(published, "\n", 2)[0] // one line per address, e.g. ipv4 and ipv6
+}
+
+// migrate waits for the database to be ready, then applies migrations of `dir`
+func migrate(t testing.TB, dir fs.FS, driverName string, databaseURL string, options []dbmigrate.Option) {
+	t.Helper()
+	options = append([]dbmigrate.Option{dbmigrate.WithLogger(t.Log)}, options...)
+	if err := dbmigrate.AutoMigrate(context.Background(), dir, driverName, databaseURL, options...); err != nil {
+		t.Fatalf("unable to migrate %s: %s", dbmigrate.RedactDatabaseURL(databaseURL), err)
+	}
+}
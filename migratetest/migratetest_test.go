@@ -0,0 +1,85 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/choonkeat/dbmigrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartContainer(t *testing.T) {
+	defer func(original func(...string) (string, error)) { docker = original }(docker)
+	var calls []string
+	docker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		switch args[0] {
+		case "run":
+			return "c0ffee", nil
+		case "port":
+			return "127.0.0.1:49153\n[::1]:49153", nil
+		}
+		return "", nil
+	}
+
+	var address string
+	t.Run("container", func(t *testing.T) {
+		address = startContainer(t, "postgres:16", "5432", "-e", "POSTGRES_PASSWORD=password")
+		assert.Equal(t, []string{"run --rm -d -p 127.0.0.1::5432 -e POSTGRES_PASSWORD=password postgres:16", "port c0ffee 5432/tcp"}, calls)
+	})
+	assert.Equal(t, "127.0.0.1:49153", address)
+	assert.Equal(t, "rm -f c0ffee", calls[len(calls)-1], "removed after the test")
+
+	docker = func(...string) (string, error) { return "", errNoDocker }
+	reached := false
+	t.Run("no docker", func(t *testing.T) {
+		startContainer(t, "postgres:16", "5432")
+		reached = true
+	})
+	assert.False(t, reached, "skipped")
+}
+
+func TestWithPostgresContainer(t *testing.T) {
+	if os.Getenv("MIGRATETEST_DOCKER") == "" {
+		t.Skip("set MIGRATETEST_DOCKER=1 to start a postgres container")
+	}
+	dir := fstest.MapFS{
+		"20181222073750_orders.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE orders (id int);")},
+		"20181222073750_orders.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE orders;")},
+	}
+	db, err := sql.Open("postgres", WithPostgresContainer(t, dir))
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO orders (id) VALUES (1)")
+	assert.NoError(t, err)
+}
+
+func TestPostgresAdvisoryLock(t *testing.T) {
+	if os.Getenv("MIGRATETEST_DOCKER") == "" {
+		t.Skip("set MIGRATETEST_DOCKER=1 to start a postgres container")
+	}
+	dir := fstest.MapFS{
+		"20181222073750_orders.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE orders (id int);")},
+		"20181222073750_orders.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE orders;")},
+	}
+	databaseURL := WithPostgresContainer(t, dir) // migrated up while holding the migration lock
+	db, err := sql.Open("postgres", databaseURL)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	lock, err := dbmigrate.Lock(ctx, db, dbmigrate.MigrationLockName)
+	assert.NoError(t, err)
+	_, err = dbmigrate.TryLock(ctx, db, dbmigrate.MigrationLockName)
+	assert.Equal(t, dbmigrate.ErrLocked, err, "held by another session")
+	assert.NoError(t, lock.Unlock(ctx))
+
+	m, err := dbmigrate.New(dir, "postgres", databaseURL)
+	assert.NoError(t, err)
+	defer m.CloseDB()
+	assert.NoError(t, m.Down(ctx, dbmigrate.MigrateOptions{Steps: 1}))
+}
@@ -0,0 +1,86 @@
+package dbmigrate
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/pkg/errors"
+)
+
+// A Module is a set of migration files exported by a Go library, e.g. a job queue or an outbox,
+// for host applications to mount with WithModules. Its files are named like any migration file
+type Module struct {
+	Name   string // e.g. the import path of the library, for logs and errors
+	FS     fs.FS  // migration files of the module
+	Prefix string // namespace of the module's versions, see WithNamespace
+}
+
+// useNamespaces keeps the versions of WithNamespace, and of each Module of WithModules, apart
+func (c *Config) useNamespaces() error {
+	if c.namespace != "" {
+		if err := ValidateIdentifier(c.namespace); err != nil {
+			return errors.Wrapf(err, "invalid namespace")
+		}
+	}
+	prefixes := map[string]string{}
+	for _, module := range c.modules {
+		if err := ValidateIdentifier(module.Prefix); err != nil {
+			return errors.Wrapf(err, "module %s: invalid prefix", module.Name)
+		}
+		if name, ok := prefixes[module.Prefix]; ok {
+			return errors.Errorf("modules %s and %s have the same prefix %q", name, module.Name, module.Prefix)
+		}
+		prefixes[module.Prefix] = module.Name
+		if module.FS == nil {
+			return errors.Errorf("module %s has no FS", module.Name)
+		}
+	}
+	c.store = namespaceStore(c.store, c.namespace)
+	return nil
+}
+
+// moduleConfig returns a Config applying the files of `module` with the settings of `c`
+func (c *Config) moduleConfig(module Module) (*Config, error) {
+	migrationFiles, err := listMigrationFiles(module.FS)
+	if err != nil {
+		return nil, errors.Wrapf(err, "module %s", module.Name)
+	}
+	mc := *c
+	mc.dir = module.FS
+	mc.migrationFiles = migrationFiles
+	mc.virtualFiles = nil
+	mc.modules = nil
+	mc.skipVersions = nil
+	mc.objectFixups = nil // objects of modules are fixed up with those of `c`
+	mc.namespace = module.Prefix
+	mc.store = namespaceStore(c.store, module.Prefix)
+	if err := mc.checkVersions(); err != nil {
+		return nil, errors.Wrapf(err, "module %s", module.Name)
+	}
+	return &mc, nil
+}
+
+// upModules applies pending files of each Module of WithModules in turn, while `c` holds the migration lock
+func (c *Config) upModules(ctx context.Context, opts MigrateOptions) error {
+	for _, module := range c.modules {
+		mc, err := c.moduleConfig(module)
+		if err != nil {
+			return err
+		}
+		moduleOpts := MigrateOptions{
+			TxOptions:     opts.TxOptions,
+			Schema:        opts.Schema,
+			Mode:          opts.Mode,
+			TxMaxFiles:    opts.TxMaxFiles,
+			TxMaxDuration: opts.TxMaxDuration,
+			NoLock:        true,
+			Strict:        opts.Strict,
+			BeforeFile:    opts.BeforeFile,
+			AfterFile:     opts.AfterFile,
+		}
+		if err := mc.Up(ctx, moduleOpts); err != nil && err != ErrNoMigrationFiles {
+			return errors.Wrapf(err, "module %s", module.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithModules(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	jobs := Module{Name: "example.com/jobs", Prefix: "jobs", FS: fstest.MapFS{
+		"20181222073700_jobs.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE jobs (id int);")},
+		"20181222073700_jobs.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE jobs;")},
+	}}
+	store := &fakeStore{}
+	c := &Config{
+		dir:            fstest.MapFS{"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")}},
+		migrationFiles: []string{"20181222073750_a.up.sql"},
+		db:             db,
+		store:          store,
+		logger:         func(...interface{}) {},
+		resultHandler:  func(FileResult) {},
+	}
+	WithModules(jobs)(c)
+	assert.NoError(t, c.useNamespaces())
+
+	var files []string
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone, AfterFile: func(filename string) { files = append(files, filename) }}))
+	assert.Equal(t, []string{"20181222073700_jobs.up.sql", "20181222073750_a.up.sql"}, files)
+
+	var versions []string
+	for _, entry := range store.entries {
+		versions = append(versions, entry.Version)
+	}
+	assert.Equal(t, []string{"jobs/20181222073700", "20181222073750"}, versions)
+
+	testCases := []struct {
+		name          string
+		modules       []Module
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			modules:       []Module{{Name: "example.com/jobs", Prefix: "", FS: jobs.FS}},
+			expectedError: "module example.com/jobs: invalid prefix: identifier is empty",
+		},
+		{
+			name:          fileline(),
+			modules:       []Module{jobs, {Name: "example.com/queue", Prefix: "jobs", FS: jobs.FS}},
+			expectedError: `modules example.com/jobs and example.com/queue have the same prefix "jobs"`,
+		},
+		{
+			name:          fileline(),
+			modules:       []Module{{Name: "example.com/jobs", Prefix: "jobs"}},
+			expectedError: "module example.com/jobs has no FS",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{store: &fakeStore{}}
+			WithModules(tc.modules...)(c)
+			assert.EqualError(t, c.useNamespaces(), tc.expectedError)
+		})
+	}
+}
+
+func TestWithModulesFixups(t *testing.T) {
+	var objects [][]driver.Value
+	db, fake := openFakeDB(t, func(_ int, query string, _ []driver.Value) (*fakeRows, error) {
+		switch query {
+		case "objects":
+			return &fakeRows{columns: []string{"kind", "name"}, values: objects}, nil
+		case "CREATE TABLE jobs (id int);":
+			objects = append(objects, []driver.Value{"TABLE", `public."jobs"`})
+		}
+		return nil, nil
+	})
+
+	jobs := Module{Name: "example.com/jobs", Prefix: "jobs", FS: fstest.MapFS{
+		"20181222073700_jobs.up.sql": &fstest.MapFile{Data: []byte("CREATE TABLE jobs (id int);")},
+	}}
+	c := &Config{
+		dir:            fstest.MapFS{"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")}},
+		migrationFiles: []string{"20181222073750_a.up.sql"},
+		db:             db,
+		adapter:        Adapter{SelectObjects: func(*string) string { return "objects" }},
+		store:          &fakeStore{},
+		logger:         func(...interface{}) {},
+		resultHandler:  func(FileResult) {},
+	}
+	WithModules(jobs)(c)
+	WithObjectFixups("GRANT SELECT ON {object} TO app_ro")(c)
+	assert.NoError(t, c.useNamespaces())
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+	assert.Equal(t, []string{
+		"objects",
+		"CREATE TABLE jobs (id int);",
+		"SELECT 1;",
+		"objects",
+		`GRANT SELECT ON public."jobs" TO app_ro`,
+	}, fake.executed())
+}
@@ -0,0 +1,80 @@
+package dbmigrate
+
+import (
+	"context"
+	"strings"
+)
+
+// moduleSeparator joins a namespace and a version in a VersionStore without namespace column
+const moduleSeparator = "/"
+
+// namespaceStore returns `store` keeping the versions of `namespace` apart from others: in the
+// namespace column where the adapter of an sql store supports it, as version prefixes otherwise
+func namespaceStore(store VersionStore, namespace string) VersionStore {
+	if namespaced, ok := store.(namespacedStore); ok {
+		store = namespaced.VersionStore
+	}
+	if s, ok := store.(*sqlStore); ok && s.adapter.AddNamespaceColumn != nil {
+		return &sqlStore{db: s.db, adapter: s.adapter, ownTx: s.ownTx, schema: s.schema, namespace: &namespace, trace: s.trace}
+	}
+	return namespacedStore{VersionStore: store, prefix: namespace}
+}
+
+// namespacedStore keeps the versions of one namespace in a VersionStore shared with others, as
+// `<prefix>/<version>`; versions of namespace "" have no prefix
+type namespacedStore struct {
+	VersionStore
+	prefix string
+}
+
+// own returns `version` without the prefix of the store, and false if it belongs to another namespace
+func (s namespacedStore) own(version string) (string, bool) {
+	if s.prefix == "" {
+		return version, !strings.Contains(version, moduleSeparator)
+	}
+	if !strings.HasPrefix(version, s.prefix+moduleSeparator) {
+		return "", false
+	}
+	return strings.TrimPrefix(version, s.prefix+moduleSeparator), true
+}
+
+func (s namespacedStore) namespaced(version string) string {
+	if s.prefix == "" {
+		return version
+	}
+	return s.prefix + moduleSeparator + version
+}
+
+func (s namespacedStore) AppliedVersions(ctx context.Context, schema *string) ([]string, error) {
+	versions, err := s.VersionStore.AppliedVersions(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, version := range versions {
+		if version, ok := s.own(strings.TrimSpace(version)); ok {
+			result = append(result, version)
+		}
+	}
+	return result, nil
+}
+
+func (s namespacedStore) Record(ctx context.Context, tx ExecCommitRollbacker, schema *string, entry HistoryEntry) error {
+	entry.Version = s.namespaced(entry.Version)
+	return s.VersionStore.Record(ctx, tx, schema, entry)
+}
+
+func (s namespacedStore) History(ctx context.Context, schema *string) ([]HistoryEntry, error) {
+	entries, err := s.VersionStore.History(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	var result []HistoryEntry
+	for _, entry := range entries {
+		if version, ok := s.own(entry.Version); ok {
+			entry.Version = version
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
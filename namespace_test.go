@@ -0,0 +1,77 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespacedStore(t *testing.T) {
+	store := &fakeStore{
+		versions: []string{"20181222073750", "jobs/20181222073800", "outbox/20181222073800"},
+		entries: []HistoryEntry{
+			{Version: "20181222073750", Direction: directionUp},
+			{Version: "jobs/20181222073800", Direction: directionUp},
+		},
+	}
+	testCases := []struct {
+		name             string
+		prefix           string
+		expectedVersions []string
+		expectedHistory  []HistoryEntry
+	}{
+		{
+			name:             fileline(),
+			prefix:           "",
+			expectedVersions: []string{"20181222073750"},
+			expectedHistory:  []HistoryEntry{{Version: "20181222073750", Direction: directionUp}},
+		},
+		{
+			name:             fileline(),
+			prefix:           "jobs",
+			expectedVersions: []string{"20181222073800"},
+			expectedHistory:  []HistoryEntry{{Version: "20181222073800", Direction: directionUp}},
+		},
+		{
+			name:             fileline(),
+			prefix:           "job",
+			expectedVersions: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := namespacedStore{VersionStore: store, prefix: tc.prefix}
+			versions, err := s.AppliedVersions(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedVersions, versions)
+
+			history, err := s.History(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedHistory, history)
+		})
+	}
+}
+
+func TestNamespaceStore(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	fake := &fakeStore{}
+	assert.Equal(t, namespacedStore{VersionStore: fake, prefix: "jobs"}, namespaceStore(fake, "jobs"))
+	assert.Equal(t, namespacedStore{VersionStore: fake, prefix: "jobs"}, namespaceStore(namespacedStore{VersionStore: fake}, "jobs"))
+
+	sqlite := &sqlStore{db: db, adapter: Adapter{InsertNewVersion: func(*string) string { return "insert" }}}
+	assert.Equal(t, namespacedStore{VersionStore: sqlite, prefix: "jobs"}, namespaceStore(sqlite, "jobs"))
+
+	store := namespaceStore(&sqlStore{db: db, adapter: adapters["postgres"]}, "jobs")
+	if assert.IsType(t, &sqlStore{}, store) {
+		assert.Equal(t, "jobs", *store.(*sqlStore).namespace)
+	}
+
+	tx := &recordingTx{noTx: noTx{db: db}}
+	assert.NoError(t, store.Record(context.Background(), tx, nil, HistoryEntry{Version: "20181222073750", Direction: directionDown}))
+	assert.Equal(t, []string{
+		`DELETE FROM dbmigrate_versions WHERE namespace = $1 AND version = $2`,
+		`INSERT INTO dbmigrate_history (namespace, ` + historyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+	}, tx.queries)
+}
@@ -0,0 +1,430 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// An Option customizes the Config returned by `New`
+type Option func(*Config)
+
+// WithMaxOpenConns sets the maximum number of open connections to the database; see `sql.DB.SetMaxOpenConns`
+func WithMaxOpenConns(n int) Option {
+	return func(c *Config) {
+		c.dbSettings = append(c.dbSettings, func(db *sql.DB) { db.SetMaxOpenConns(n) })
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections to the database; see `sql.DB.SetMaxIdleConns`
+func WithMaxIdleConns(n int) Option {
+	return func(c *Config) {
+		c.dbSettings = append(c.dbSettings, func(db *sql.DB) { db.SetMaxIdleConns(n) })
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time a connection may be reused; see `sql.DB.SetConnMaxLifetime`
+//
+// Useful when connecting through cloud proxies that drop long-lived connections
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(c *Config) {
+		c.dbSettings = append(c.dbSettings, func(db *sql.DB) { db.SetConnMaxLifetime(d) })
+	}
+}
+
+// WithSingleConnection pins one database connection for the entire run, so locks and
+// session settings made by one statement are seen by the next. Pool settings are ignored.
+//
+// If that connection is lost, statements fail with ErrSingleConnectionLost instead of
+// silently continuing on a new session
+func WithSingleConnection() Option {
+	return func(c *Config) {
+		c.singleConnection = true
+	}
+}
+
+// WithLogger receives notices, e.g. files skipped; ignored by default
+func WithLogger(logger func(...interface{})) Option {
+	return func(c *Config) {
+		c.logger = logger
+	}
+}
+
+// EnvSkipPolicy decides what happens to files whose `-- dbmigrate:only env=...` directive excludes the current env
+type EnvSkipPolicy int
+
+const (
+	// EnvSkipRecord does not run the file, but records its version as applied
+	EnvSkipRecord EnvSkipPolicy = iota
+	// EnvSkipPending does not run the file, and leaves its version pending
+	EnvSkipPending
+)
+
+// WithEnv sets the current environment, e.g. `production`, for `-- dbmigrate:only env=dev,staging` directives.
+// When env is not set, those directives are ignored and all files are run
+func WithEnv(env string, policy EnvSkipPolicy) Option {
+	return func(c *Config) {
+		c.env = env
+		c.envSkipPolicy = policy
+	}
+}
+
+// WithResultHandler receives a FileResult after each migration file is executed, e.g. to check
+// a backfill updated the expected number of rows
+func WithResultHandler(handler func(FileResult)) Option {
+	return func(c *Config) {
+		c.resultHandler = handler
+	}
+}
+
+// WithStatementSplitting executes each statement of a file separately, so rows affected are
+// reported per statement and `-- dbmigrate:ignore-error` directives apply to the statement that follows
+func WithStatementSplitting() Option {
+	return func(c *Config) {
+		c.splitStatements = true
+	}
+}
+
+// WithAppliedBy records `name` as the `applied_by` of history entries, e.g. a username or CI job
+func WithAppliedBy(name string) Option {
+	return func(c *Config) {
+		c.appliedBy = name
+	}
+}
+
+// WithVersionStore keeps track of applied versions in `store` instead of the migrated database
+func WithVersionStore(store VersionStore) Option {
+	return func(c *Config) {
+		c.store = store
+	}
+}
+
+// WithSkipVersions leaves `versions` pending during MigrateUp, e.g. to deploy past a broken
+// migration in an emergency. Skips are recorded in history until the versions are applied
+func WithSkipVersions(versions ...string) Option {
+	return func(c *Config) {
+		if c.skipVersions == nil {
+			c.skipVersions = map[string]bool{}
+		}
+		for _, v := range versions {
+			c.skipVersions[strings.TrimSpace(v)] = true
+		}
+	}
+}
+
+// WithPhase only considers migration files of `phase` as pending, e.g. PhasePre before code
+// deploy and PhasePost after; see FilePhase
+func WithPhase(phase Phase) Option {
+	return func(c *Config) {
+		c.phase = phase
+	}
+}
+
+// WithWindow configures window `name` for files with a `-- dbmigrate:window <name>` directive;
+// such files fail to run outside the window
+func WithWindow(name string, window Window) Option {
+	return func(c *Config) {
+		if c.windows == nil {
+			c.windows = map[string]Window{}
+		}
+		c.windows[name] = window
+	}
+}
+
+// WithForcedWindows runs files outside of their windows, logging them instead of failing
+func WithForcedWindows() Option {
+	return func(c *Config) {
+		c.forceWindows = true
+	}
+}
+
+// WithoutMigrationLock migrates without holding MigrationLockName, e.g. behind a connection
+// pooler in transaction mode where session-level advisory locks do not work
+func WithoutMigrationLock() Option {
+	return func(c *Config) {
+		c.migrationLock = false
+	}
+}
+
+// WithLockProvider holds MigrationLockName from `provider` instead of a database advisory lock, e.g.
+// the providers of lockprovider/redis or lockprovider/etcd for databases without locks like cassandra
+func WithLockProvider(provider LockProvider) Option {
+	return func(c *Config) {
+		c.lockProvider = provider
+	}
+}
+
+// WithAllowEmpty lets Up succeed when `dir` has no `.up.sql` files, instead of ErrNoMigrationFiles
+func WithAllowEmpty() Option {
+	return func(c *Config) {
+		c.allowEmpty = true
+	}
+}
+
+// WithVersionPattern accepts migration files whose version, the prefix before `_`, matches `pattern`
+// instead of a 14-digit timestamp in VersionLayout; the versions table should fit such versions
+func WithVersionPattern(pattern *regexp.Regexp) Option {
+	return func(c *Config) {
+		c.versionPattern = pattern
+	}
+}
+
+// WithAfterConnect runs `hook` on each new connection, after the adapter's own AfterConnect if any,
+// e.g. ExecOnConnect(`SET SESSION sql_require_primary_key=0`)
+func WithAfterConnect(hook func(context.Context, driver.Conn) error) Option {
+	return func(c *Config) {
+		before := c.adapter.AfterConnect
+		if before == nil {
+			c.adapter.AfterConnect = hook
+			return
+		}
+		c.adapter.AfterConnect = func(ctx context.Context, conn driver.Conn) error {
+			if err := before(ctx, conn); err != nil {
+				return err
+			}
+			return hook(ctx, conn)
+		}
+	}
+}
+
+// WithDeferredForeignKeys disables foreign key enforcement while migrating, e.g. for the sqlite3
+// rename-copy-drop pattern of restructuring tables; violations found by the adapter's
+// ForeignKeyCheckQuery fail the run before each transaction commits
+func WithDeferredForeignKeys() Option {
+	return func(c *Config) {
+		c.deferForeignKeys = true
+	}
+}
+
+// LongTransactionPolicy decides what happens when a DbTxnModeAll transaction is open longer than WithLongTransaction allows
+type LongTransactionPolicy int
+
+const (
+	// LongTransactionWarn logs the elapsed time and files remaining, then continues
+	LongTransactionWarn LongTransactionPolicy = iota
+	// LongTransactionFail rolls back the transaction before the next file
+	LongTransactionFail
+)
+
+// WithLongTransaction applies `policy` when a DbTxnModeAll transaction has been open longer than `threshold`,
+// since a transaction held for hours bloats postgres tables and blocks vacuum
+func WithLongTransaction(threshold time.Duration, policy LongTransactionPolicy) Option {
+	return func(c *Config) {
+		c.longTxn = threshold
+		c.longTxnPolicy = policy
+	}
+}
+
+// WithRunAs switches each database session to `role` after connecting, e.g. `SET ROLE app` on postgres,
+// so objects created by migrations are owned by the application role rather than the deploy user.
+// Connections fail unless the session is verified to run as `role`
+func WithRunAs(role string) Option {
+	return func(c *Config) {
+		c.runAs = role
+	}
+}
+
+// WithObjectFixups executes `statements` after Up for each table, view or sequence it created, with
+// `{kind}` and `{object}` replaced, e.g. `GRANT SELECT ON {object} TO app_ro` or `ALTER {kind} {object} OWNER TO app`
+func WithObjectFixups(statements ...string) Option {
+	return func(c *Config) {
+		c.objectFixups = append(c.objectFixups, statements...)
+	}
+}
+
+// WithSQLLog appends each statement executed for migration files to `w`, after an sql comment
+// with its timestamp, file, duration and rows affected or error, e.g. for auditors
+func WithSQLLog(w io.Writer) Option {
+	return func(c *Config) {
+		c.sqlLog = w
+	}
+}
+
+// WithVersionsSchema keeps the `dbmigrate_versions` and `dbmigrate_history` tables in `schema`, created
+// if missing, regardless of the schema given to Up, Down and others for the migration files
+func WithVersionsSchema(schema string) Option {
+	return func(c *Config) {
+		c.versionsSchema = schema
+	}
+}
+
+// WithMiddleware wraps the execution of each statement of migration files in `middlewares`, the
+// first one outermost, e.g. WithMiddleware(TimingMiddleware(log.Println)) or one routing SELECT
+// checks to a replica
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Config) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithFileFilter only applies and un-applies migration files that `filter` returns true for, e.g. to skip
+// seed files in production, or run only files with a `-- dbmigrate:service <name>` directive of this service.
+// Excluded files are left pending
+func WithFileFilter(filter func(Migration) bool) Option {
+	return func(c *Config) {
+		c.fileFilter = filter
+	}
+}
+
+// WithModules mounts migration sets exported by Go libraries. Up applies the pending files of each
+// module, in order, before those of `dir`; versions of each module are kept apart under its Prefix.
+// Down and other methods only concern the files of `dir`
+func WithModules(modules ...Module) Option {
+	return func(c *Config) {
+		c.modules = append(c.modules, modules...)
+	}
+}
+
+// WithNamespace keeps track of versions of `namespace` only, so several sets of migration files, e.g. of
+// services in a mono-repo, can share one versions table. Versions are kept in a `namespace` column
+// where supported, e.g. postgres and mysql, or recorded as `<namespace>/<version>` otherwise.
+// Without WithNamespace, versions of every namespace are seen
+func WithNamespace(namespace string) Option {
+	return func(c *Config) {
+		c.namespace = namespace
+	}
+}
+
+// LockedPolicy decides what Up does when the migration lock is not acquired within WithLockTimeout
+type LockedPolicy int
+
+const (
+	// LockedFail returns ErrLockTimeout
+	LockedFail LockedPolicy = iota
+	// LockedWait polls every second until no version is pending, i.e. the lock holder applied them,
+	// then returns without applying any; Down still returns ErrLockTimeout
+	LockedWait
+)
+
+// WithLockTimeout stops waiting for the migration lock after `timeout`, then applies `policy`, e.g.
+// LockedWait when migrating on app startup, where failing the process is undesirable
+func WithLockTimeout(timeout time.Duration, policy LockedPolicy) Option {
+	return func(c *Config) {
+		c.lockTimeout = timeout
+		c.lockedPolicy = policy
+	}
+}
+
+// WithoutNormalization executes files as they are; by default CRLF line endings are converted
+// to LF, and trailing NUL and control characters are stripped
+func WithoutNormalization() Option {
+	return func(c *Config) {
+		c.normalize = false
+	}
+}
+
+// WithCredentials connects as credentials fetched from `provider` when New is called, e.g.
+// vault.CredentialsProvider of credentials/vault, instead of the user and password in the database url
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(c *Config) {
+		c.credentials = provider
+	}
+}
+
+// WithRunMeta records `meta` with each run in `dbmigrate_runs`, e.g. git sha, pull request url
+// or deployer; see Runs
+func WithRunMeta(meta map[string]string) Option {
+	return func(c *Config) {
+		c.runMeta = meta
+	}
+}
+
+// WithBackup calls `backup` before Up or Down applies any of `filenames`, e.g. to dump the
+// database; an error aborts the run before anything is applied
+func WithBackup(backup func(ctx context.Context, filenames []string) error) Option {
+	return func(c *Config) {
+		c.backup = backup
+	}
+}
+
+// WithBlockerCheck looks for sessions with a transaction open for over `olderThan`, e.g. idle in
+// transaction, that hold locks on tables that pending files alter, before applying any file,
+// then applies `policy`
+func WithBlockerCheck(olderThan time.Duration, policy BlockerPolicy) Option {
+	return func(c *Config) {
+		c.blockerAge = olderThan
+		c.blockerPolicy = policy
+	}
+}
+
+// WithTableLocks holds an advisory lock per table that pending files change or read, e.g.
+// `dbmigrate:users`, instead of MigrationLockName, so services migrating disjoint tables of a
+// shared database do not wait for each other. Files whose tables cannot be parsed must declare
+// them with `-- dbmigrate:tables <table>, ...`. Every process migrating the database should use it
+func WithTableLocks() Option {
+	return func(c *Config) {
+		c.tableLocks = true
+	}
+}
+
+// WithLockName holds lock `name` instead of MigrationLockName, e.g. `payments-svc`, so services
+// sharing one database migrate their own files concurrently, while runs of one service still wait
+// for each other. The file being applied is then not reported to waiting processes
+func WithLockName(name string) Option {
+	return func(c *Config) {
+		c.lockName = name
+	}
+}
+
+// WithMaxVersion ignores migration files with a version after `version`, as if they were not in
+// `dir`, so a build only moves the schema as far as the files it shipped with, e.g. a canary of old
+// code reading a shared volume with newer files. Versions applied by newer builds are then unknown
+func WithMaxVersion(version string) Option {
+	return func(c *Config) {
+		c.maxVersion = version
+	}
+}
+
+// WithIgnoreFreeze lets Up and Down apply files while migrations are frozen, see Config.Freeze
+func WithIgnoreFreeze() Option {
+	return func(c *Config) {
+		c.ignoreFreeze = true
+	}
+}
+
+// WithVerbose logs the bookkeeping statements of the version store, e.g. creating the versions
+// table or inserting a version, with their arguments, since they differ by adapter, schema and namespace
+func WithVerbose() Option {
+	return func(c *Config) {
+		c.verbose = true
+	}
+}
+
+// WithArchive keeps each file applied by Up, compressed, in `dbmigrate_archive` in the same transaction,
+// and removes it when migrated down, so the database describes its schema even if `dir` is lost; see Archived
+func WithArchive() Option {
+	return func(c *Config) {
+		c.archive = true
+	}
+}
+
+// WithLocalInfile lets the `copy` directive load files with `LOAD DATA LOCAL INFILE` on mysql, by registering
+// a reader of each file under a unique name with `register` and removing it with `deregister`, i.e.
+// mysql.RegisterReaderHandler and mysql.DeregisterReaderHandler. The server must allow `local_infile`
+func WithLocalInfile(register func(name string, handler func() io.Reader), deregister func(name string)) Option {
+	return func(c *Config) {
+		c.registerReader, c.deregisterReader = register, deregister
+	}
+}
+
+// WithReconnect survives losing the database connection during Up or Down with DbTxnModePerFile, e.g. when
+// a serverless database scales to zero mid-run: the file being applied, rolled back with its connection, is
+// applied again after reconnecting, acquiring the migration lock again and querying applied versions again.
+// Only for databases with transactional DDL, since a file may be applied twice otherwise
+func WithReconnect(opts ReconnectOptions) Option {
+	return func(c *Config) {
+		c.reconnect = &opts
+	}
+}
+
+// WithoutComments removes comments from each statement right before it is executed, after any WithMiddleware,
+// for drivers and proxies that reject them, e.g. older cql. Directives in comments still apply
+func WithoutComments() Option {
+	return func(c *Config) {
+		c.stripComments = true
+	}
+}
@@ -0,0 +1,28 @@
+package dbmigrate
+
+import (
+	"strings"
+)
+
+// FileOwner returns the team in `-- dbmigrate:owner <team>` directive of `filename`, or "" if none
+func (c *Config) FileOwner(filename string) string {
+	filecontent, err := c.fileContent(filename)
+	if err != nil {
+		return ""
+	}
+	return parseDirectives(filecontent)["owner"]
+}
+
+// versionOwners returns the owner of each version with an owned `.up.sql` file
+func (c *Config) versionOwners() map[string]string {
+	result := map[string]string{}
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, "up.sql") {
+			continue
+		}
+		if owner := c.FileOwner(currName); owner != "" {
+			result[c.versionOf(currName)] = owner
+		}
+	}
+	return result
+}
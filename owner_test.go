@@ -0,0 +1,39 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryOwner(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   {Data: []byte("-- dbmigrate:owner team-payments\nCREATE TABLE a (id int);")},
+		"20181222073750_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"20181222073900_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+	}
+	store := &fakeStore{entries: []HistoryEntry{
+		{Version: "20181222073750", Direction: "up"},
+		{Version: "20181222073900", Direction: "up"},
+		{Version: "20181222073750", Direction: "down"},
+		{Version: "20181222070000", Direction: "up"},
+	}}
+	c := &Config{dir: dir, store: store}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+
+	assert.Equal(t, "team-payments", c.FileOwner("20181222073750_a.up.sql"))
+	assert.Equal(t, "", c.FileOwner("20181222073900_b.up.sql"))
+	assert.Equal(t, "", c.FileOwner("missing.up.sql"))
+
+	entries, err := c.History(context.Background(), nil)
+	assert.NoError(t, err)
+	var owners []string
+	for _, e := range entries {
+		owners = append(owners, e.Owner)
+	}
+	assert.Equal(t, []string{"team-payments", "", "team-payments", ""}, owners)
+}
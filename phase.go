@@ -0,0 +1,42 @@
+package dbmigrate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Phase of a deploy to run migrations in, for expand/contract workflows
+type Phase string
+
+// Phases; files named `*.post.up.sql` are PhasePost, all other files are PhasePre
+const (
+	PhaseAll  Phase = "all"  // every file
+	PhasePre  Phase = "pre"  // before code deploy, e.g. additive changes
+	PhasePost Phase = "post" // after code deploy, e.g. destructive cleanup
+)
+
+// ParsePhase returns the Phase named `s`
+func ParsePhase(s string) (Phase, error) {
+	switch p := Phase(strings.TrimSpace(s)); p {
+	case PhaseAll, PhasePre, PhasePost:
+		return p, nil
+	case "":
+		return PhaseAll, nil
+	default:
+		return "", errors.Errorf("phase must be %q, %q or %q, got %q", PhaseAll, PhasePre, PhasePost, s)
+	}
+}
+
+// FilePhase returns the phase of migration file `name`
+func FilePhase(name string) Phase {
+	if strings.HasSuffix(name, ".post.up.sql") || strings.HasSuffix(name, ".post.down.sql") {
+		return PhasePost
+	}
+	return PhasePre
+}
+
+// includes returns true if migration file `name` runs in phase `p`
+func (p Phase) includes(name string) bool {
+	return p == "" || p == PhaseAll || FilePhase(name) == p
+}
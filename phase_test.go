@@ -0,0 +1,60 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePhase(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected Phase
+		wantErr  bool
+	}{
+		{name: fileline(), given: "", expected: PhaseAll},
+		{name: fileline(), given: "all", expected: PhaseAll},
+		{name: fileline(), given: "pre", expected: PhasePre},
+		{name: fileline(), given: " post ", expected: PhasePost},
+		{name: fileline(), given: "during", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParsePhase(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestPhaseIncludes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		phase    Phase
+		filename string
+		expected bool
+	}{
+		{name: fileline(), phase: "", filename: "20181222073750_a.post.up.sql", expected: true},
+		{name: fileline(), phase: PhaseAll, filename: "20181222073750_a.up.sql", expected: true},
+		{name: fileline(), phase: PhasePre, filename: "20181222073750_a.up.sql", expected: true},
+		{name: fileline(), phase: PhasePre, filename: "20181222073750_a.pre.up.sql", expected: true},
+		{name: fileline(), phase: PhasePre, filename: "20181222073750_a.post.up.sql", expected: false},
+		{name: fileline(), phase: PhasePost, filename: "20181222073750_a.post.up.sql", expected: true},
+		{name: fileline(), phase: PhasePost, filename: "20181222073750_a.post.down.sql", expected: true},
+		{name: fileline(), phase: PhasePost, filename: "20181222073750_post.up.sql", expected: false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.phase.includes(tc.filename))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// PinsFilename in the migrations directory pins command line flags for everyone migrating the directory,
+// e.g. `{"flags": {"txn-mode": "per-file", "strict": true}}`, so developers and CI get the same behavior
+const PinsFilename = ".dbmigrate.json"
+
+// Pins are values of command line flags by name, without `-`; a repeatable flag may have several
+type Pins map[string][]string
+
+// UnmarshalJSON decodes each value from a string, bool, number, or array of them
+func (p *Pins) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep numbers as written, e.g. 1000000 instead of 1e+06
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	result := Pins{}
+	for name, value := range raw {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case json.Number:
+				result[name] = append(result[name], v.String())
+			case string, bool:
+				result[name] = append(result[name], fmt.Sprint(v))
+			default:
+				return errors.Errorf("flag %q must be a string, bool, number, or array of them", name)
+			}
+		}
+	}
+	*p = result
+	return nil
+}
+
+// ReadPins returns the flags pinned by PinsFilename of `dir`, if any
+func ReadPins(dir fs.FS) (Pins, error) {
+	f, err := dir.Open(PinsFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, PinsFilename)
+	}
+	defer f.Close()
+
+	var content struct {
+		Flags Pins `json:"flags"`
+	}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&content); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", PinsFilename)
+	}
+	return content.Flags, nil
+}
@@ -0,0 +1,57 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPins(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dir      fstest.MapFS
+		expected Pins
+		wantErr  string
+	}{
+		{
+			name: fileline(),
+			dir:  fstest.MapFS{},
+		},
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				PinsFilename: {Data: []byte(`{"flags": {"txn-mode": "per-file", "strict": true, "lock-timeout": 30, "meta": ["team=core", "repo=app"]}}`)},
+			},
+			expected: Pins{"txn-mode": {"per-file"}, "strict": {"true"}, "lock-timeout": {"30"}, "meta": {"team=core", "repo=app"}},
+		},
+		{
+			name:     fileline(),
+			dir:      fstest.MapFS{PinsFilename: {Data: []byte(`{"flags": {"txn-max-files": 1000000, "ratio": 0.25}}`)}},
+			expected: Pins{"txn-max-files": {"1000000"}, "ratio": {"0.25"}},
+		},
+		{
+			name:    fileline(),
+			dir:     fstest.MapFS{PinsFilename: {Data: []byte(`{"flags": {"strict": {"enabled": true}}}`)}},
+			wantErr: `invalid .dbmigrate.json: flag "strict" must be a string, bool, number, or array of them`,
+		},
+		{
+			name:    fileline(),
+			dir:     fstest.MapFS{PinsFilename: {Data: []byte(`{"flag": {"strict": true}}`)}},
+			wantErr: `invalid .dbmigrate.json: json: unknown field "flag"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ReadPins(tc.dir)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
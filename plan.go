@@ -0,0 +1,109 @@
+package dbmigrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A Plan lists what MigrateUp would apply, to be reviewed before it is applied with CheckPlan
+type Plan struct {
+	Pending []PlannedFile `json:"pending"`
+	Impact  []Impact      `json:"impact"`
+}
+
+// A PlannedFile is a pending `.up.sql` file
+type PlannedFile struct {
+	Filename    string   `json:"filename"`
+	Version     string   `json:"version"`
+	Checksum    string   `json:"checksum"`              // sha256 of file content
+	Description string   `json:"description,omitempty"` // from `-- Description:` comment
+	Tables      []string `json:"tables"`                // changed or read, parsed from statements or `-- dbmigrate:tables`
+	Unparsed    int      `json:"unparsed,omitempty"`    // 1-based position of the first statement whose tables are unknown, if any
+}
+
+// Plan returns the pending files, in the order they would be applied, with their estimated impact
+func (c *Config) Plan(ctx context.Context, schema *string) (Plan, error) {
+	pending, err := c.plannedFiles(ctx, schema)
+	if err != nil {
+		return Plan{}, err
+	}
+	impacts, err := c.Impact(ctx, schema)
+	if err != nil {
+		return Plan{}, err
+	}
+	if impacts == nil {
+		impacts = []Impact{}
+	}
+	return Plan{Pending: pending, Impact: impacts}, nil
+}
+
+// CheckPlan returns an error describing each difference between the pending files of `plan`
+// and the pending files now, e.g. a file was modified or another deploy applied a version
+func (c *Config) CheckPlan(ctx context.Context, schema *string, plan Plan) error {
+	pending, err := c.plannedFiles(ctx, schema)
+	if err != nil {
+		return err
+	}
+	if diff := planDiff(plan.Pending, pending); len(diff) > 0 {
+		return errors.Errorf("plan is out of date:\n%s", strings.Join(diff, "\n"))
+	}
+	return nil
+}
+
+func (c *Config) plannedFiles(ctx context.Context, schema *string) ([]PlannedFile, error) {
+	migratedVersions, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	result := []PlannedFile{}
+	for _, currName := range c.pendingFiles(migratedVersions) {
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := c.fileChecksum(currName)
+		if err != nil {
+			return nil, err
+		}
+		tables, unparsed, err := c.fileTables(currName)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, PlannedFile{
+			Filename:    currName,
+			Version:     c.versionOf(currName),
+			Checksum:    checksum,
+			Description: parseDescription(filecontent),
+			Tables:      tables,
+			Unparsed:    unparsed,
+		})
+	}
+	return result, nil
+}
+
+// planDiff lists files planned but no longer pending, pending but not planned, or modified since planned
+func planDiff(planned []PlannedFile, current []PlannedFile) []string {
+	checksums := map[string]string{}
+	for _, f := range current {
+		checksums[f.Filename] = f.Checksum
+	}
+	var result []string
+	for _, f := range planned {
+		checksum, ok := checksums[f.Filename]
+		switch {
+		case !ok:
+			result = append(result, "- "+f.Filename+" is no longer pending")
+		case checksum != f.Checksum:
+			result = append(result, "~ "+f.Filename+" was modified")
+		}
+		delete(checksums, f.Filename)
+	}
+	for _, f := range current {
+		if _, ok := checksums[f.Filename]; ok {
+			result = append(result, "+ "+f.Filename+" is pending but not in plan")
+		}
+	}
+	return result
+}
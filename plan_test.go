@@ -0,0 +1,78 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanDiff(t *testing.T) {
+	a := PlannedFile{Filename: "20181222073750_a.up.sql", Checksum: "aaa"}
+	b := PlannedFile{Filename: "20181222073900_b.up.sql", Checksum: "bbb"}
+	modifiedB := PlannedFile{Filename: b.Filename, Checksum: "BBB"}
+	testCases := []struct {
+		name     string
+		planned  []PlannedFile
+		current  []PlannedFile
+		expected []string
+	}{
+		{
+			name:    fileline(),
+			planned: []PlannedFile{a, b},
+			current: []PlannedFile{a, b},
+		},
+		{
+			name:     fileline(),
+			planned:  []PlannedFile{a, b},
+			current:  []PlannedFile{b},
+			expected: []string{"- 20181222073750_a.up.sql is no longer pending"},
+		},
+		{
+			name:     fileline(),
+			planned:  []PlannedFile{a},
+			current:  []PlannedFile{a, b},
+			expected: []string{"+ 20181222073900_b.up.sql is pending but not in plan"},
+		},
+		{
+			name:     fileline(),
+			planned:  []PlannedFile{a, b},
+			current:  []PlannedFile{a, modifiedB},
+			expected: []string{"~ 20181222073900_b.up.sql was modified"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, planDiff(tc.planned, tc.current))
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"20181222073750_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"20181222073900_b.up.sql":   {Data: []byte("ALTER TABLE a ADD b int;")},
+	}
+	store := &fakeStore{versions: []string{"20181222073750"}}
+	c := &Config{dir: dir, store: store}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+
+	plan, err := c.Plan(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []PlannedFile{{
+		Filename: "20181222073900_b.up.sql",
+		Version:  "20181222073900",
+		Checksum: "69ff7c0f888146b7116b6113a242eb14f95b7f1b7d63442bb3f71cc1f2c20c32",
+		Tables:   []string{"a"},
+	}}, plan.Pending)
+	assert.Equal(t, []Impact{{Filename: "20181222073900_b.up.sql", Statement: 1, Table: "a", Rows: -1, Bytes: -1}}, plan.Impact)
+	assert.NoError(t, c.CheckPlan(context.Background(), nil, plan))
+
+	store.versions = append(store.versions, "20181222073900")
+	assert.EqualError(t, c.CheckPlan(context.Background(), nil, plan), "plan is out of date:\n- 20181222073900_b.up.sql is no longer pending")
+}
@@ -0,0 +1,65 @@
+package dbmigrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// requiredPrivileges returns the privileges of `-- dbmigrate:requires SUPERUSER, rds_superuser` directives
+// of `filenames`, with the first file requiring each
+func (c *Config) requiredPrivileges(filenames []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, currName := range filenames {
+		if c.skipVersions[c.versionOf(currName)] {
+			continue // will not run
+		}
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := parseDirectives(filecontent)["requires"]
+		if !ok {
+			continue
+		}
+		for _, privilege := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' || r == ' ' }) {
+			if _, found := result[privilege]; !found {
+				result[privilege] = currName
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkPrivileges returns an error, before any file is applied, if the role of the connection lacks
+// a privilege or role required by `-- dbmigrate:requires` directives of `filenames`
+func (c *Config) checkPrivileges(ctx context.Context, filenames []string) error {
+	required, err := c.requiredPrivileges(filenames)
+	if err != nil || len(required) == 0 {
+		return err
+	}
+	if c.adapter.HasPrivilegeQuery == "" {
+		return errors.Errorf("database does not support `requires` directive")
+	}
+	privileges := make([]string, 0, len(required))
+	for privilege := range required {
+		privileges = append(privileges, privilege)
+	}
+	sort.Strings(privileges)
+	var missing []string
+	for _, privilege := range privileges {
+		var value interface{}
+		if err := c.db.QueryRowContext(ctx, c.adapter.HasPrivilegeQuery, privilege).Scan(&value); err != nil {
+			return errors.Wrapf(err, "unable to check privilege %s", privilege)
+		}
+		if !truthy(value) {
+			missing = append(missing, privilege+" (required by "+required[privilege]+")")
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("current role lacks %s; no file was applied", strings.Join(missing, ", "))
+	}
+	return nil
+}
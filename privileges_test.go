@@ -0,0 +1,62 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPrivileges(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("-- dbmigrate:requires SUPERUSER\nCREATE EXTENSION pg_trgm;")},
+		"20181222073751_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073752_c.up.sql": &fstest.MapFile{Data: []byte("-- dbmigrate:requires CREATEROLE|rds_superuser\n-- dbmigrate:requires SUPERUSER\nCREATE ROLE app;")},
+	}
+	filenames := []string{"20181222073750_a.up.sql", "20181222073751_b.up.sql", "20181222073752_c.up.sql"}
+	testCases := []struct {
+		name          string
+		filenames     []string
+		query         string
+		values        string // selected by each check of CREATEROLE, SUPERUSER, rds_superuser in turn, see fakeValuesDriver
+		expectedError string
+	}{
+		{
+			name:      fileline(),
+			filenames: filenames[1:2],
+		},
+		{
+			name:          fileline(),
+			filenames:     filenames,
+			expectedError: "database does not support `requires` directive",
+		},
+		{
+			name:      fileline(),
+			filenames: filenames,
+			query:     "has",
+			values:    "1",
+		},
+		{
+			name:          fileline(),
+			filenames:     filenames,
+			query:         "has",
+			values:        "1,0,0",
+			expectedError: "current role lacks SUPERUSER (required by 20181222073750_a.up.sql), rds_superuser (required by 20181222073752_c.up.sql); no file was applied",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, fakeValues(tc.values))
+
+			c := &Config{dir: dir, db: db}
+			c.adapter.HasPrivilegeQuery = tc.query
+			err := c.checkPrivileges(context.Background(), tc.filenames)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/choonkeat/dbmigrate/internal/lease"
+	"github.com/pkg/errors"
+)
+
+// progress is the file being applied by the process holding MigrationLockName
+type progress struct {
+	Process   string
+	Filename  string
+	StartedAt time.Time
+}
+
+// processName identifies this process to others waiting for MigrationLockName, e.g. `web-1[42]`
+func processName() string {
+	return lease.ProcessName()
+}
+
+// progressSchema is the schema of `dbmigrate_progress`: the schema of WithVersionsSchema, if any. Unlike
+// other bookkeeping tables, it is not in the schema given to each call, as it is shared by all holders of MigrationLockName
+func (c *Config) progressSchema() *string {
+	if c.versionsSchema == "" {
+		return nil
+	}
+	return &c.versionsSchema
+}
+
+// lockHolderProgress queries, on `db` outside of any migration transaction, what the holder of
+// MigrationLockName is applying; nil if nothing is recorded or the adapter does not record progress
+func (c *Config) lockHolderProgress(ctx context.Context, db *sql.DB) (*progress, error) {
+	if c.adapter.SelectProgress == nil {
+		return nil, nil
+	}
+	var p progress
+	var startedAt interface{}
+	err := db.QueryRowContext(ctx, c.adapter.SelectProgress(c.progressSchema())).Scan(&p.Process, &p.Filename, &startedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to query progress")
+	}
+	if p.StartedAt, err = parseTimestamp(startedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// describeProgress returns a log message for the result of lockHolderProgress
+func describeProgress(p *progress, err error) string {
+	switch {
+	case err != nil:
+		return "held by another process; " + err.Error()
+	case p == nil:
+		return "held by another process"
+	}
+	return fmt.Sprintf("process %s applying %s since %s", p.Process, p.Filename, p.StartedAt.Local().Format("15:04:05"))
+}
+
+// migrationLock is MigrationLockName held by lockMigrations for one Up or Down call; a nil
+// migrationLock means the lock is not held, and its methods are no-op
+type migrationLock struct {
+	c       *Config
+	conn    *sql.Conn // holds the advisory lock, and progress is written on it; nil means progress is not recorded
+	release func(context.Context) error
+	process string
+	failed  bool
+	tables  []string // table locks of WithTableLocks held instead of MigrationLockName
+}
+
+// setupProgress creates the progress table if needed and removes rows left by processes that
+// died holding the lock
+func (l *migrationLock) setupProgress(ctx context.Context) {
+	if l.conn == nil || l.c.adapter.CreateProgressTable == nil {
+		return
+	}
+	schema := l.c.progressSchema()
+	if schema != nil && l.c.adapter.CreateSchemaQuery != nil {
+		l.conn.ExecContext(ctx, l.c.adapter.CreateSchemaQuery(*schema)) // ok to fail, e.g. already exists
+	}
+	l.conn.ExecContext(ctx, l.c.adapter.CreateProgressTable(schema)) // ok to fail, e.g. already exists
+	l.clearProgress(ctx)
+}
+
+// clearProgress removes all progress rows; only the lock holder writes them
+func (l *migrationLock) clearProgress(ctx context.Context) {
+	if l.conn == nil || l.failed || l.c.adapter.DeleteProgress == nil {
+		return
+	}
+	if _, err := l.conn.ExecContext(ctx, l.c.adapter.DeleteProgress(l.c.progressSchema())); err != nil {
+		l.failed = true
+		l.c.logger("[lock] unable to record progress:", err.Error())
+	}
+}
+
+// progress records `filename` as being applied. Written on the lock connection, so it is seen
+// by waiting processes while the migration transaction is still open
+func (l *migrationLock) progress(ctx context.Context, filename string) {
+	if l == nil || l.conn == nil || l.failed || l.c.adapter.InsertProgress == nil {
+		return
+	}
+	l.clearProgress(ctx)
+	if l.failed {
+		return
+	}
+	if _, err := l.conn.ExecContext(ctx, l.c.adapter.InsertProgress(l.c.progressSchema()), l.process, filename, time.Now().UTC()); err != nil {
+		l.failed = true
+		l.c.logger("[lock] unable to record progress:", err.Error())
+	}
+}
+
+// unlock clears progress and releases the lock
+func (l *migrationLock) unlock() {
+	if l == nil {
+		return
+	}
+	l.clearProgress(context.Background())
+	if err := l.release(context.Background()); err != nil {
+		l.c.logger("[lock]", err.Error())
+	}
+}
+
+// covers returns an error unless `filenames` change only tables whose locks are held, e.g. a
+// version was rolled back by another process after the locks were chosen
+func (l *migrationLock) covers(filenames []string) error {
+	if l == nil || l.tables == nil {
+		return nil
+	}
+	names, err := l.c.tableLockNames(filenames)
+	if err != nil {
+		return err
+	}
+	held := map[string]bool{}
+	for _, name := range l.tables {
+		held[name] = true
+	}
+	for _, name := range names {
+		if !held[name] {
+			return errors.Errorf("lock %q is not held; versions changed while acquiring table locks, try again", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeProgress(t *testing.T) {
+	startedAt := time.Date(2024, 1, 2, 12, 1, 33, 0, time.Local)
+	testCases := []struct {
+		name     string
+		progress *progress
+		err      error
+		expected string
+	}{
+		{
+			name:     fileline(),
+			expected: "held by another process",
+		},
+		{
+			name:     fileline(),
+			err:      errors.New("relation does not exist"),
+			expected: "held by another process; relation does not exist",
+		},
+		{
+			name:     fileline(),
+			progress: &progress{Process: "web-1[42]", Filename: "20240102120000_backfill.up.sql", StartedAt: startedAt.UTC()},
+			expected: "process web-1[42] applying 20240102120000_backfill.up.sql since 12:01:33",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, describeProgress(tc.progress, tc.err))
+		})
+	}
+}
+
+func TestMigrationLockNil(t *testing.T) {
+	var l *migrationLock
+	assert.NotPanics(t, func() {
+		l.progress(context.Background(), "20240102120000_backfill.up.sql")
+		l.unlock()
+	})
+}
+
+func TestProgressSchema(t *testing.T) {
+	c := &Config{adapter: adapters["postgres"]}
+	assert.Equal(t, `DELETE FROM dbmigrate_progress`, c.adapter.DeleteProgress(c.progressSchema()))
+
+	WithVersionsSchema("ops")(c)
+	assert.Equal(t, `DELETE FROM "ops".dbmigrate_progress`, c.adapter.DeleteProgress(c.progressSchema()))
+	assert.Equal(t, `INSERT INTO "ops".dbmigrate_progress (process, filename, started_at) VALUES ($1, $2, $3)`, c.adapter.InsertProgress(c.progressSchema()))
+}
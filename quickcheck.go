@@ -0,0 +1,83 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QuickCheckDriver names the driver QuickCheck replays migrations into; it must be registered,
+// e.g. by including cmd/dbmigrate/sqlite3.go during compilation
+const QuickCheckDriver = "sqlite3"
+
+// A QuickCheckResult reports one `.up.sql` file replayed by QuickCheck
+type QuickCheckResult struct {
+	Filename string `json:"filename"`
+	Error    string `json:"error,omitempty"` // empty if applied; otherwise the file was skipped, e.g. dialect specific sql
+}
+
+// QuickCheck replays every `.up.sql` file in `dir`, in order, into a new in-memory sqlite3 database
+// as a fast smoke test without a database server. Common postgres and mysql syntax is translated;
+// files that still fail, e.g. dialect specific sql, are skipped and reported with their error
+func QuickCheck(ctx context.Context, dir fs.FS, options ...Option) ([]QuickCheckResult, error) {
+	options = append(options, WithSingleConnection(), WithoutMigrationLock(), WithForcedWindows())
+	c, err := New(translatedFS{dir}, QuickCheckDriver, ":memory:", options...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.CloseDB()
+	if err := c.db.PingContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "unable to open in-memory %s database", QuickCheckDriver)
+	}
+
+	var filenames []string
+	for _, currName := range c.migrationFiles {
+		if strings.HasSuffix(currName, "up.sql") {
+			filenames = append(filenames, currName)
+		}
+	}
+	sort.Strings(filenames)
+
+	var result []QuickCheckResult
+	for _, currName := range filenames {
+		r := QuickCheckResult{Filename: currName}
+		err := c.Up(ctx, MigrateOptions{File: currName, AllowGaps: true, Mode: DbTxnModePerFile})
+		if err != nil {
+			r.Error = strings.TrimPrefix(err.Error(), currName+": ")
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// translatedFS serves `.sql` files translated for QuickCheckDriver
+type translatedFS struct {
+	fs.FS
+}
+
+func (t translatedFS) Open(name string) (fs.File, error) {
+	f, err := t.FS.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".sql") {
+		return f, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &translatedFile{File: f, reader: bytes.NewReader(Translator(QuickCheckDriver)(content))}, nil
+}
+
+type translatedFile struct {
+	fs.File
+	reader *bytes.Reader
+}
+
+func (f *translatedFile) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
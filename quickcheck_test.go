@@ -0,0 +1,28 @@
+package dbmigrate
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslatedFS(t *testing.T) {
+	dir := translatedFS{fstest.MapFS{
+		"20181222073750_a.up.sql": {Data: []byte("CREATE TABLE a (id serial);")},
+		"README.md":               {Data: []byte("serial")},
+	}}
+
+	content, err := fs.ReadFile(dir, "20181222073750_a.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE a (id INTEGER);", string(content))
+
+	content, err = fs.ReadFile(dir, "README.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "serial", string(content))
+
+	entries, err := fs.ReadDir(dir, ".")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
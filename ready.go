@@ -0,0 +1,112 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReadyOptions are the settings of ReadyWaitWithOptions. The zero value retries every second
+// until `ctx` is done, like ReadyWait
+type ReadyOptions struct {
+	Interval       time.Duration        // wait before the first retry; 0 means 1s
+	MaxInterval    time.Duration        // doubles the wait after each attempt up to this; 0 means the wait does not grow
+	Jitter         float64              // randomizes each wait by up to this fraction, e.g. 0.2 waits 80% to 120%
+	MaxAttempts    int                  // gives up after this many attempts; 0 means no limit
+	AttemptTimeout time.Duration        // of connecting and PingQuery in each attempt; 0 means no limit other than `ctx`
+	Logger         func(...interface{}) // nil means no logs
+	OnRetry        func(ReadyEvent)     // called before waiting to retry; nil means the event is logged
+}
+
+// A ReadyEvent reports a failed attempt of ReadyWaitWithOptions
+type ReadyEvent struct {
+	Attempt int           // 1 for the first attempt
+	URL     int           // index of the database url tried
+	Err     error         // why the attempt failed
+	Wait    time.Duration // until the next attempt
+}
+
+// wait returns how long to wait after `attempt`, given `random` in [0, 1)
+func (o ReadyOptions) wait(attempt int, random float64) time.Duration {
+	wait := o.Interval
+	if wait <= 0 {
+		wait = time.Second
+	}
+	for i := 1; i < attempt && wait < o.MaxInterval; i++ {
+		wait *= 2
+	}
+	if o.MaxInterval > 0 && wait > o.MaxInterval {
+		wait = o.MaxInterval
+	}
+	if o.Jitter > 0 {
+		wait = time.Duration(float64(wait) * (1 + o.Jitter*(2*random-1)))
+	}
+	return wait
+}
+
+// ReadyWait for server to be ready, and try to create db and connect again
+func ReadyWait(ctx context.Context, driverName string, databaseURLs []string, logger func(...interface{})) error {
+	return ReadyWaitWithOptions(ctx, driverName, databaseURLs, ReadyOptions{Logger: logger})
+}
+
+// ReadyWaitWithOptions waits for server to be ready, trying `databaseURLs` in turn, with the
+// backoff, jitter and limits of `opts`, e.g. to avoid flooding logs of a booting cluster
+func ReadyWaitWithOptions(ctx context.Context, driverName string, databaseURLs []string, opts ReadyOptions) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = func(...interface{}) {}
+	}
+	logger(driverName, "checking connection")
+	adapter, err := AdapterFor(driverName)
+	if err != nil {
+		return err
+	}
+
+	count := len(databaseURLs)
+	curr := -1
+	for attempt := 1; ; attempt++ {
+		curr = (curr + 1) % count
+		if err = readyAttempt(ctx, driverName, databaseURLs[curr], adapter.PingQuery, opts.AttemptTimeout, logger); err == nil {
+			return nil
+		}
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			return errors.Wrapf(err, "server not ready after %d attempt(s)", attempt)
+		}
+		event := ReadyEvent{Attempt: attempt, URL: curr, Err: err, Wait: opts.wait(attempt, rand.Float64())}
+		if opts.OnRetry != nil {
+			opts.OnRetry(event)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(event.Wait):
+			if opts.OnRetry == nil {
+				logger(driverName, "retrying...", err)
+			}
+		}
+	}
+}
+
+// readyAttempt connects to `databaseURL` and runs `pingQuery`, within `timeout` if set
+func readyAttempt(ctx context.Context, driverName string, databaseURL string, pingQuery string, timeout time.Duration, logger func(...interface{})) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	db, err := sql.Open(driverName, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	logger(driverName, "server up")
+	var num int
+	if err = db.QueryRowContext(ctx, pingQuery).Scan(&num); err != nil {
+		return err
+	}
+	logger(driverName, "connected")
+	return nil
+}
@@ -0,0 +1,57 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyOptionsWait(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     ReadyOptions
+		attempt  int
+		random   float64
+		expected time.Duration
+	}{
+		{name: fileline(), opts: ReadyOptions{}, attempt: 1, expected: time.Second},
+		{name: fileline(), opts: ReadyOptions{}, attempt: 5, expected: time.Second},
+		{name: fileline(), opts: ReadyOptions{MaxInterval: 30 * time.Second}, attempt: 1, expected: time.Second},
+		{name: fileline(), opts: ReadyOptions{MaxInterval: 30 * time.Second}, attempt: 4, expected: 8 * time.Second},
+		{name: fileline(), opts: ReadyOptions{MaxInterval: 30 * time.Second}, attempt: 10, expected: 30 * time.Second},
+		{name: fileline(), opts: ReadyOptions{Interval: 100 * time.Millisecond, MaxInterval: time.Second}, attempt: 3, expected: 400 * time.Millisecond},
+		{name: fileline(), opts: ReadyOptions{Jitter: 0.2}, attempt: 1, random: 0, expected: 800 * time.Millisecond},
+		{name: fileline(), opts: ReadyOptions{Jitter: 0.2}, attempt: 1, random: 0.5, expected: time.Second},
+		{name: fileline(), opts: ReadyOptions{Jitter: 0.2}, attempt: 1, random: 0.75, expected: 1100 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.opts.wait(tc.attempt, tc.random))
+		})
+	}
+}
+
+func TestReadyWaitWithOptions(t *testing.T) {
+	var events []ReadyEvent
+	err := ReadyWaitWithOptions(context.Background(), "postgres", []string{
+		"postgres://127.0.0.1:1/app?sslmode=disable",
+		"postgres://127.0.0.1:1/?sslmode=disable",
+	}, ReadyOptions{
+		Interval:       time.Millisecond,
+		MaxAttempts:    3,
+		AttemptTimeout: time.Second,
+		OnRetry:        func(event ReadyEvent) { events = append(events, event) },
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "server not ready after 3 attempt(s): ")
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, 1, events[0].Attempt)
+		assert.Equal(t, 0, events[0].URL)
+		assert.Equal(t, 2, events[1].Attempt)
+		assert.Equal(t, 1, events[1].URL)
+		assert.Error(t, events[1].Err)
+		assert.Equal(t, time.Millisecond, events[1].Wait)
+	}
+}
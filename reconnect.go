@@ -0,0 +1,117 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReconnectOptions of WithReconnect
+type ReconnectOptions struct {
+	Attempts int           // reconnect attempts for each file; 0 means 5
+	Interval time.Duration // wait before the first attempt, doubled after each; 0 means 1s
+}
+
+// connectionLost returns true if `err` means the connection to the database was lost, rather than
+// a statement failed, e.g. a serverless database scaled to zero while a file was being applied
+func (c *Config) connectionLost(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case driver.ErrBadConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	if _, ok := cause.(net.Error); ok {
+		return true
+	}
+	if c.adapter.ErrorCode == nil || len(c.adapter.ConnectionLostCodes) == 0 {
+		return false
+	}
+	code := c.adapter.ErrorCode(cause)
+	for _, lost := range c.adapter.ConnectionLostCodes {
+		if code == lost {
+			return true
+		}
+	}
+	return false
+}
+
+// runFileReconnecting is runFile; with WithReconnect and DbTxnModePerFile, a file that lost its connection
+// was rolled back with it, so it is applied again after reconnecting, unless it turns out to be committed
+func (c *Config) runFileReconnecting(ctx context.Context, r *run, tx ExecCommitRollbacker, currName string) (bool, error) {
+	ran, err := c.runFile(ctx, *r, tx, currName)
+	if c.reconnect == nil || r.mode != DbTxnModePerFile || !c.adapter.TransactionalDDL {
+		return ran, err
+	}
+	attempts, wait := c.reconnect.Attempts, c.reconnect.Interval
+	if attempts <= 0 {
+		attempts = 5
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+	for attempt := 1; err != nil && c.connectionLost(err); attempt++ {
+		if attempt > attempts {
+			return false, errors.Wrapf(err, "gave up reconnecting after %d attempt(s)", attempts)
+		}
+		c.logger("[reconnect]", currName, "lost its connection:", err.Error()+"; attempt", attempt, "of", attempts, "in", wait.String())
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if err = c.recoverRun(ctx, r); err != nil {
+			if !c.connectionLost(err) {
+				return false, err
+			}
+			continue
+		}
+		if r.done(c.versionOf(currName)) {
+			c.logger("[reconnect]", currName, "was committed before the connection was lost")
+			return true, nil
+		}
+		ran, err = c.runFile(ctx, *r, tx, currName)
+	}
+	return ran, err
+}
+
+// recoverRun reconnects, then acquires the migration lock again, since it was lost with its session
+// and another process may have migrated meanwhile, and queries applied versions again for run.done
+func (c *Config) recoverRun(ctx context.Context, r *run) error {
+	if err := c.db.PingContext(ctx); err != nil {
+		return err
+	}
+	if r.lock != nil {
+		r.lock.release(ctx) // ok to fail; lost with its connection
+		lock, err := c.lockMigrations(ctx, r.schema, r.direction)
+		if err != nil {
+			return errors.Wrapf(err, "unable to acquire the migration lock again")
+		}
+		if lock != nil {
+			*r.lock = *lock // released by whoever holds r.lock
+		}
+	}
+	applied, err := c.AppliedVersions(ctx, r.schema)
+	if err != nil {
+		return err
+	}
+	r.applied = map[string]bool{}
+	for _, version := range applied {
+		r.applied[version] = true
+	}
+	c.logger("[reconnect] reconnected;", len(applied), "version(s) applied")
+	return nil
+}
+
+// done returns true if the file of `version` no longer needs to run according to versions queried after
+// reconnecting, e.g. it was committed just before the connection was lost, or applied by another process since
+func (r *run) done(version string) bool {
+	if r.applied == nil {
+		return false
+	}
+	return r.applied[version] == (r.direction == directionUp)
+}
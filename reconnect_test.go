@@ -0,0 +1,157 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// losingTx is a recordingTx that loses its connection on the first `losses` executions of `lose`,
+// calling `lost` each time
+type losingTx struct {
+	recordingTx
+	lose   string
+	losses int
+	lost   func()
+}
+
+func (tx *losingTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if query == tx.lose && tx.losses > 0 {
+		tx.losses--
+		tx.lost()
+		return nil, errors.Wrapf(driver.ErrBadConn, "exec")
+	}
+	return tx.recordingTx.ExecContext(ctx, query, args...)
+}
+
+// fakeSQLStateError is an error with a postgres SQLSTATE, like *pq.Error
+type fakeSQLStateError string
+
+func (e fakeSQLStateError) Error() string    { return "sqlstate " + string(e) }
+func (e fakeSQLStateError) SQLState() string { return string(e) }
+
+func TestConnectionLost(t *testing.T) {
+	c := &Config{adapter: adapters["postgres"]}
+	assert.True(t, c.connectionLost(errors.Wrapf(driver.ErrBadConn, "statement #1")))
+	assert.True(t, c.connectionLost(&net.OpError{Op: "read", Err: errors.Errorf("connection reset by peer")}))
+	assert.True(t, c.connectionLost(fakeSQLStateError("57P01")))
+	assert.False(t, c.connectionLost(fakeSQLStateError("42P07")))
+	assert.False(t, c.connectionLost(errors.Errorf("syntax error")))
+}
+
+func TestWithReconnect(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073900_b", "20181222073901_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE " + name[15:] + " (id int);")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE " + name[15:] + ";")}
+	}
+	testCases := []struct {
+		name            string
+		reconnect       bool
+		mode            DbTxnMode
+		losses          int
+		committed       []string // versions applied when the connection is lost, e.g. by another process
+		recoverError    error    // returned when querying versions after the connection is lost
+		expectedQueries []string
+		expectedApplied []string
+		expectedError   string
+	}{
+		{
+			name:            fileline(),
+			reconnect:       true,
+			mode:            DbTxnModePerFile,
+			losses:          2,
+			expectedQueries: []string{"CREATE TABLE a (id int);", "CREATE TABLE b (id int);", "CREATE TABLE c (id int);"},
+			expectedApplied: []string{"20181222073750", "20181222073900", "20181222073901"},
+		},
+		{
+			name:            fileline(),
+			reconnect:       true,
+			mode:            DbTxnModePerFile,
+			losses:          1,
+			committed:       []string{"20181222073900", "20181222073901"},
+			expectedQueries: []string{"CREATE TABLE a (id int);"},
+			expectedApplied: []string{"20181222073750"},
+		},
+		{
+			name:            fileline(),
+			reconnect:       true,
+			mode:            DbTxnModePerFile,
+			losses:          4,
+			expectedQueries: []string{"CREATE TABLE a (id int);"},
+			expectedApplied: []string{"20181222073750"},
+			expectedError:   "gave up reconnecting after 3 attempt(s): 20181222073900_b.up.sql: exec: driver: bad connection",
+		},
+		{
+			name:            fileline(),
+			reconnect:       true,
+			mode:            DbTxnModePerFile,
+			losses:          1,
+			recoverError:    errors.Errorf("permission denied"),
+			expectedQueries: []string{"CREATE TABLE a (id int);"},
+			expectedApplied: []string{"20181222073750"},
+			expectedError:   "permission denied",
+		},
+		{
+			name:            fileline(),
+			mode:            DbTxnModePerFile,
+			losses:          1,
+			expectedQueries: []string{"CREATE TABLE a (id int);"},
+			expectedApplied: []string{"20181222073750"},
+			expectedError:   "20181222073900_b.up.sql: exec: driver: bad connection",
+		},
+		{
+			name:            fileline(),
+			reconnect:       true,
+			mode:            DbTxnModeAll,
+			losses:          1,
+			expectedQueries: []string{"CREATE TABLE a (id int);"},
+			expectedApplied: []string{"20181222073750"},
+			expectedError:   "20181222073900_b.up.sql: exec: driver: bad connection",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{}
+			tx := &losingTx{recordingTx: recordingTx{noTx: noTx{db: db}}, lose: "CREATE TABLE b (id int);", losses: tc.losses}
+			tx.lost = func() { store.versions, store.err = append(store.versions, tc.committed...), tc.recoverError }
+			adapter := Adapter{
+				TransactionalDDL: true,
+				BeginTx:          func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil },
+			}
+			c := &Config{dir: dir, db: db, adapter: adapter, store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{
+				"20181222073750_a.down.sql", "20181222073750_a.up.sql",
+				"20181222073900_b.down.sql", "20181222073900_b.up.sql",
+				"20181222073901_c.down.sql", "20181222073901_c.up.sql",
+			}
+			if tc.reconnect {
+				WithReconnect(ReconnectOptions{Attempts: 3, Interval: time.Millisecond})(c)
+			}
+
+			var applied []string
+			err := c.Up(context.Background(), MigrateOptions{Mode: tc.mode})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedQueries, tx.queries)
+			for _, entry := range store.entries {
+				applied = append(applied, entry.Version)
+			}
+			assert.Equal(t, tc.expectedApplied, applied)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IndexRepair actions of RepairIndexes
+const (
+	IndexRebuilt = "rebuilt" // the file creating the index is applied, so the index is created again
+	IndexDropped = "dropped" // the file creating the index is pending, and creates it when applied
+)
+
+// An IndexRepair is an invalid index found by RepairIndexes
+type IndexRepair struct {
+	Name     string // qualified by schema
+	Filename string // `.up.sql` file creating the index; "" if none, e.g. created by hand
+	Action   string // IndexRebuilt, IndexDropped, or "" if left alone
+}
+
+var createIndexName = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)\s+ON\s`)
+
+// indexFiles returns the `.up.sql` file creating each index, keyed by unquoteName
+func (c *Config) indexFiles() (map[string]string, error) {
+	result := map[string]string{}
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, ".up.sql") {
+			continue
+		}
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return nil, errors.Wrapf(err, currName)
+		}
+		for _, stmt := range splitStatements(string(filecontent)) {
+			m := createIndexName.FindStringSubmatch(strings.TrimSpace(stripBlockComments(lintLineComments.ReplaceAllString(stmt, ""))))
+			if m != nil {
+				result[unquoteName(m[1])] = currName
+			}
+		}
+	}
+	return result, nil
+}
+
+// RepairIndexes finds indexes in `schema` left invalid by a failed or interrupted concurrent build,
+// which the database keeps updating but never uses. Indexes created by an applied migration file are
+// rebuilt without blocking writes; those of a pending file are dropped, so applying the file creates
+// them again. Other invalid indexes are returned but left alone. Holds the migration lock, so an index
+// being built by a running migration is not mistaken for a failed one
+func (c *Config) RepairIndexes(ctx context.Context, schema *string) ([]IndexRepair, error) {
+	if c.adapter.SelectInvalidIndexes == nil || c.adapter.DropIndexQuery == nil {
+		return nil, errors.Errorf("database does not support -repair-indexes")
+	}
+	lock, err := c.lockMigrations(ctx, schema, directionUp)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+	files, err := c.indexFiles()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectInvalidIndexes(schema))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list invalid indexes")
+	}
+	defer rows.Close()
+	var result []IndexRepair
+	definitions := map[string]string{}
+	for rows.Next() {
+		var r IndexRepair
+		var definition string
+		if err := rows.Scan(&r.Name, &definition); err != nil {
+			return nil, err
+		}
+		r.Filename = files[unquoteName(r.Name)]
+		definitions[r.Name] = definition
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	for i, r := range result {
+		if r.Filename == "" {
+			c.logger("[repair-indexes] leaving", r.Name, "invalid; not created by a migration file")
+			continue
+		}
+		if _, err := c.db.ExecContext(ctx, c.adapter.DropIndexQuery(r.Name)); err != nil {
+			return result, errors.Wrapf(err, "unable to drop invalid index %s", r.Name)
+		}
+		result[i].Action = IndexDropped
+		if _, found := applied.Find(c.versionOf(r.Filename)); !found {
+			c.logger("[repair-indexes] dropped", r.Name, "of pending", r.Filename)
+			continue
+		}
+		if _, err := c.db.ExecContext(ctx, definitions[r.Name]); err != nil {
+			return result, errors.Wrapf(err, "dropped invalid index %s of %s, but unable to create it again", r.Name, r.Filename)
+		}
+		result[i].Action = IndexRebuilt
+		c.logger("[repair-indexes] rebuilt", r.Name, "of", r.Filename)
+	}
+	return result, nil
+}
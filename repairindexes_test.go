@@ -0,0 +1,54 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairIndexes(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("-- dbmigrate:concurrent-index\nCREATE INDEX CONCURRENTLY users_email ON users (email);")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("DROP INDEX users_email;")},
+		"20181222073751_b.up.sql":   &fstest.MapFile{Data: []byte("ALTER TABLE orders ADD COLUMN ref text;\ncreate unique index if not exists \"Orders_ref\" on orders (ref);")},
+	}
+	invalid := &fakeRows{columns: []string{"name", "definition"}, values: [][]driver.Value{
+		{`public."Orders_ref"`, `CREATE UNIQUE INDEX CONCURRENTLY "Orders_ref" ON public.orders USING btree (ref)`},
+		{"public.users_email", "CREATE INDEX CONCURRENTLY users_email ON public.users USING btree (email)"},
+		{"public.manual_idx", "CREATE INDEX CONCURRENTLY manual_idx ON public.users USING btree (name)"},
+	}}
+	db, fake := openFakeDB(t, func(_ int, query string, _ []driver.Value) (*fakeRows, error) {
+		if query == "invalid" {
+			return invalid, nil
+		}
+		return nil, nil
+	})
+
+	c := &Config{dir: dir, db: db, store: &fakeStore{versions: []string{"20181222073750"}}, logger: func(...interface{}) {}}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+	c.adapter.SelectInvalidIndexes = func(*string) string { return "invalid" }
+	c.adapter.DropIndexQuery = func(name string) string { return "DROP INDEX " + name }
+
+	repairs, err := c.RepairIndexes(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []IndexRepair{
+		{Name: `public."Orders_ref"`, Filename: "20181222073751_b.up.sql", Action: IndexDropped},
+		{Name: "public.manual_idx"},
+		{Name: "public.users_email", Filename: "20181222073750_a.up.sql", Action: IndexRebuilt},
+	}, repairs)
+	assert.Equal(t, []string{
+		"invalid",
+		`DROP INDEX public."Orders_ref"`,
+		"DROP INDEX public.users_email",
+		"CREATE INDEX CONCURRENTLY users_email ON public.users USING btree (email)",
+	}, fake.executed())
+
+	c.adapter.SelectInvalidIndexes = nil
+	_, err = c.RepairIndexes(context.Background(), nil)
+	assert.EqualError(t, err, "database does not support -repair-indexes")
+}
@@ -0,0 +1,41 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReplicaLag returns the largest replication lag of replicas of the database, e.g. from
+// `pg_stat_replication` of a postgres primary; 0 if it has no replicas
+func (c *Config) ReplicaLag(ctx context.Context) (time.Duration, error) {
+	if c.adapter.ReplicaLagQuery == "" {
+		return 0, errors.Errorf("database does not support checking replica lag")
+	}
+	var seconds float64
+	if err := c.db.QueryRowContext(ctx, c.adapter.ReplicaLagQuery).Scan(&seconds); err != nil {
+		return 0, errors.Wrapf(err, "unable to check replica lag")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// WaitReplicaLag retries ReplicaLag every second until it is under `threshold`, so migrations do not
+// pile DDL onto an already lagging cluster, or until `ctx` is done
+func (c *Config) WaitReplicaLag(ctx context.Context, threshold time.Duration, logger func(...interface{})) error {
+	for {
+		lag, err := c.ReplicaLag(ctx)
+		if err != nil {
+			return err
+		}
+		if lag < threshold {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "replica lag is %s, over %s", lag.Round(time.Millisecond), threshold)
+		case <-time.After(time.Second):
+			logger("waiting for replica lag", lag.Round(time.Millisecond).String(), "to be under", threshold.String()+"...")
+		}
+	}
+}
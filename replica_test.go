@@ -0,0 +1,62 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitReplicaLag(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		values        string
+		timeout       time.Duration
+		expectedError string
+	}{
+		{
+			name:   fileline(),
+			query:  "lag",
+			values: "0",
+		},
+		{
+			name:    fileline(),
+			query:   "lag",
+			values:  "7.5,1.25",
+			timeout: 5 * time.Second,
+		},
+		{
+			name:          fileline(),
+			query:         "lag",
+			values:        "7.5",
+			timeout:       10 * time.Millisecond,
+			expectedError: "replica lag is 7.5s, over 5s: context deadline exceeded",
+		},
+		{
+			name:          fileline(),
+			values:        "0",
+			expectedError: "database does not support checking replica lag",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, fakeValues(tc.values))
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			c := &Config{db: db, adapter: Adapter{ReplicaLagQuery: tc.query}}
+			err := c.WaitReplicaLag(ctx, 5*time.Second, func(...interface{}) {})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package dbmigrate
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A FileResult reports how a migration file was executed
+type FileResult struct {
+	Filename     string            `json:"filename"`
+	Version      string            `json:"version"`
+	Owner        string            `json:"owner,omitempty"` // from `-- dbmigrate:owner` directive
+	Duration     time.Duration     `json:"duration"`
+	RowsAffected int64             `json:"rows_affected"` // total of Statements
+	Statements   []StatementResult `json:"statements"`
+}
+
+// A StatementResult reports the rows affected by an executed statement
+type StatementResult struct {
+	SQL          string `json:"sql"`
+	RowsAffected int64  `json:"rows_affected"`           // -1 when the driver does not report it
+	IgnoredError string `json:"ignored_error,omitempty"` // error ignored by `-- dbmigrate:ignore-error` directive
+}
+
+func (r *FileResult) add(sqlText string, result sql.Result) {
+	rows, err := rowsAffected(result)
+	if err != nil {
+		rows = -1
+	} else {
+		r.RowsAffected += rows
+	}
+	r.Statements = append(r.Statements, StatementResult{SQL: sqlText, RowsAffected: rows})
+}
+
+// IgnoredErrors returns the statements whose errors were ignored by `-- dbmigrate:ignore-error` directives
+func (r FileResult) IgnoredErrors() []StatementResult {
+	var result []StatementResult
+	for _, stmt := range r.Statements {
+		if stmt.IgnoredError != "" {
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+// rowsAffected returns the rows affected by `result`, or an error if there is no result, e.g. from
+// a Middleware, or the driver returned none, e.g. go-sqlite3 when the sql ends with a comment
+func rowsAffected(result sql.Result) (int64, error) {
+	if result == nil {
+		return -1, errors.Errorf("no result")
+	}
+	if noDriverResult(result) {
+		return -1, errors.Errorf("driver returned no result")
+	}
+	return result.RowsAffected()
+}
+
+// noDriverResult returns true if `result` is database/sql wrapping a nil driver.Result, whose
+// methods would panic
+func noDriverResult(result sql.Result) bool {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Struct || v.Type().PkgPath() != "database/sql" {
+		return false
+	}
+	resi := v.FieldByName("resi")
+	return resi.IsValid() && resi.Kind() == reflect.Interface && resi.IsNil()
+}
@@ -0,0 +1,56 @@
+package dbmigrate
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileResultIgnoredErrors(t *testing.T) {
+	r := FileResult{
+		Statements: []StatementResult{
+			{SQL: "CREATE TABLE t (id int);", RowsAffected: 0},
+			{SQL: "ALTER TABLE t ADD name text;", RowsAffected: -1, IgnoredError: "duplicate column"},
+		},
+	}
+	assert.Equal(t, []StatementResult{r.Statements[1]}, r.IgnoredErrors())
+	assert.Nil(t, FileResult{}.IgnoredErrors())
+}
+
+func TestFileResultAdd(t *testing.T) {
+	db, _ := openFakeDB(t, func(_ int, query string, _ []driver.Value) (*fakeRows, error) {
+		if query == "SELECT 1; -- done" {
+			return fakeNoResult, nil
+		}
+		return nil, nil
+	})
+	affected, err := db.Exec("UPDATE t SET a = 1")
+	assert.NoError(t, err)
+	none, err := db.Exec("SELECT 1; -- done")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		result       sql.Result
+		expectedRows int64
+	}{
+		{name: fileline(), result: affected, expectedRows: 0},
+		{name: fileline(), result: driver.RowsAffected(3), expectedRows: 3},
+		{name: fileline(), result: none, expectedRows: -1},
+		{name: fileline(), result: nil, expectedRows: -1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var r FileResult
+			r.add("SELECT 1", tc.result)
+			assert.Equal(t, []StatementResult{{SQL: "SELECT 1", RowsAffected: tc.expectedRows}}, r.Statements)
+			if tc.expectedRows < 0 {
+				assert.Equal(t, int64(0), r.RowsAffected)
+			} else {
+				assert.Equal(t, tc.expectedRows, r.RowsAffected)
+			}
+		})
+	}
+}
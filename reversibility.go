@@ -0,0 +1,68 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CheckReversibility applies each pending `up.sql`, then its `down.sql`, then the `up.sql` again
+// inside one transaction that is always rolled back; returns error if any of them fail
+//
+// Requires an adapter with TransactionalDDL, otherwise changes would be committed
+func (c *Config) CheckReversibility(ctx context.Context, txOpts *sql.TxOptions, schema *string, logFilename func(string)) error {
+	if !c.adapter.TransactionalDDL {
+		return errors.Errorf("database does not support transactional DDL; unable to check reversibility")
+	}
+	migratedVersions, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return errors.Wrapf(err, "unable to query existing versions")
+	}
+
+	downFiles := map[string]string{}
+	for _, currName := range c.migrationFiles {
+		if strings.HasSuffix(currName, "down.sql") {
+			downFiles[c.versionOf(currName)] = currName
+		}
+	}
+
+	tx, err := c.adapter.BeginTx(ctx, c.db, txOpts)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create transaction")
+	}
+	defer tx.Rollback() // always; this is a rehearsal
+
+	for _, upName := range c.pendingFiles(migratedVersions) {
+		currVer := c.versionOf(upName)
+		downName, ok := downFiles[currVer]
+		if !ok {
+			return errors.Errorf("%s: no `down.sql` found for version %q", upName, currVer)
+		}
+		for _, currName := range []string{upName, downName, upName} {
+			filecontent, err := c.fileContent(currName)
+			if err != nil {
+				return errors.Wrapf(err, currName)
+			}
+			if filecontent, err = c.translate(filecontent); err != nil {
+				return errors.Wrapf(err, currName)
+			}
+			if !parseDirectives(filecontent).allowsEnv(c.env) {
+				continue
+			}
+			if len(bytes.TrimSpace(filecontent)) == 0 {
+				if currName == downName {
+					return errors.Errorf("%s: empty `down.sql`; not reversible", downName)
+				}
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, string(filecontent)); err != nil {
+				return errors.Wrapf(err, "%s: not reversible", currName)
+			}
+		}
+		logFilename(upName)
+	}
+	return nil
+}
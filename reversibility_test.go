@@ -0,0 +1,84 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReversibility(t *testing.T) {
+	testCases := []struct {
+		name             string
+		dir              fstest.MapFS
+		transactionalDDL bool
+		expectedQueries  []string
+		expectedLogged   []string
+		expectedError    string
+	}{
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE a (id int);")},
+				"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE a;")},
+			},
+			transactionalDDL: true,
+			expectedQueries:  []string{"CREATE TABLE a (id int);", "DROP TABLE a;", "CREATE TABLE a (id int);"},
+			expectedLogged:   []string{"20181222073750_a.up.sql"},
+		},
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("CREATE TABLE a (id int);")},
+			},
+			transactionalDDL: true,
+			expectedError:    "20181222073750_a.up.sql: no `down.sql` found for version \"20181222073750\"",
+		},
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE a (id int);")},
+				"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("\n")},
+			},
+			transactionalDDL: true,
+			expectedQueries:  []string{"CREATE TABLE a (id int);"},
+			expectedError:    "20181222073750_a.down.sql: empty `down.sql`; not reversible",
+		},
+		{
+			name: fileline(),
+			dir: fstest.MapFS{
+				"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE a (id int);")},
+				"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE a;")},
+			},
+			expectedError: "database does not support transactional DDL; unable to check reversibility",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, nil)
+			tx := &recordingTx{noTx: noTx{db: db}}
+			adapter := Adapter{
+				TransactionalDDL: tc.transactionalDDL,
+				BeginTx: func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) {
+					return tx, nil
+				},
+			}
+			c := &Config{dir: tc.dir, db: db, adapter: adapter, store: &fakeStore{}}
+			for name := range tc.dir {
+				c.migrationFiles = append(c.migrationFiles, name)
+			}
+
+			var logged []string
+			err := c.CheckReversibility(context.Background(), nil, nil, func(name string) { logged = append(logged, name) })
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedQueries, tx.queries)
+			assert.Equal(t, tc.expectedLogged, logged)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/derekparker/trie"
+	"github.com/pkg/errors"
+)
+
+// A Run is one Up or Down call that applied or reverted files, as recorded in `dbmigrate_runs`
+type Run struct {
+	ID        string            `json:"run_id"`
+	Direction string            `json:"direction"`
+	StartedAt time.Time         `json:"started_at"`
+	AppliedBy string            `json:"applied_by"`
+	Meta      map[string]string `json:"meta,omitempty"` // see WithRunMeta
+	Versions  []string          `json:"versions"`       // applied or reverted by the run, from history
+
+	// WAL LSN on postgres, or GTID set on mysql, before and after the run, e.g. to restore a
+	// backup to just before the run; empty if the database does not report one
+	PositionBefore string `json:"position_before,omitempty"`
+	PositionAfter  string `json:"position_after,omitempty"`
+}
+
+// runStore is implemented by version stores that record runs
+type runStore interface {
+	RecordRun(ctx context.Context, schema *string, run Run) error
+	FinishRun(ctx context.Context, schema *string, run Run) error // records PositionAfter
+	Runs(ctx context.Context, schema *string) ([]Run, error)
+}
+
+// recordRun records `r` before its files are executed, so failed runs are listed too; the
+// returned func records the log position after the run
+func (c *Config) recordRun(ctx context.Context, r run) (func(), error) {
+	store, ok := c.store.(runStore)
+	if !ok {
+		return func() {}, nil
+	}
+	record := Run{
+		ID:             r.id,
+		Direction:      r.direction,
+		StartedAt:      time.Now().UTC(),
+		AppliedBy:      c.appliedBy,
+		Meta:           c.runMeta,
+		PositionBefore: c.logPosition(ctx),
+	}
+	if err := store.RecordRun(ctx, r.schema, record); err != nil {
+		return nil, errors.Wrapf(err, "unable to record run")
+	}
+	return func() {
+		if c.adapter.LogPositionQuery == "" {
+			return
+		}
+		record.PositionAfter = c.logPosition(context.Background())
+		if err := store.FinishRun(context.Background(), r.schema, record); err != nil {
+			c.logger("[run] unable to record position after run:", err.Error())
+		}
+	}, nil
+}
+
+// logPosition returns the WAL LSN or GTID set of the database, or "" if unsupported
+func (c *Config) logPosition(ctx context.Context) string {
+	if c.adapter.LogPositionQuery == "" {
+		return ""
+	}
+	var position sql.NullString
+	if err := c.db.QueryRowContext(ctx, c.adapter.LogPositionQuery).Scan(&position); err != nil {
+		c.logger("[run] unable to query log position:", err.Error())
+	}
+	return position.String
+}
+
+// Runs returns recorded runs with versions each applied or reverted, oldest first
+func (c *Config) Runs(ctx context.Context, schema *string) ([]Run, error) {
+	store, ok := c.store.(runStore)
+	if !ok {
+		return nil, errors.Errorf("version store does not record runs")
+	}
+	runs, err := store.Runs(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.store.History(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i := range runs {
+		index[runs[i].ID] = i
+		runs[i].Versions = []string{}
+	}
+	for _, entry := range entries {
+		if i, ok := index[entry.RunID]; ok && entry.Direction != directionSkip && entry.Direction != directionChunk {
+			runs[i].Versions = append(runs[i].Versions, entry.Version)
+		}
+	}
+	return runs, nil
+}
+
+func (s *sqlStore) RecordRun(ctx context.Context, schema *string, run Run) error {
+	if s.adapter.InsertRun == nil {
+		return nil
+	}
+	meta, err := json.Marshal(run.Meta)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, s.db, s.adapter.InsertRun(s.schemaOf(schema)), run.ID, run.Direction, run.StartedAt, run.AppliedBy, string(meta), run.PositionBefore, run.PositionAfter)
+	return err
+}
+
+func (s *sqlStore) FinishRun(ctx context.Context, schema *string, run Run) error {
+	if s.adapter.UpdateRunPosition == nil {
+		return nil
+	}
+	_, err := s.exec(ctx, s.db, s.adapter.UpdateRunPosition(s.schemaOf(schema)), run.PositionAfter, run.ID)
+	return err
+}
+
+func (s *sqlStore) Runs(ctx context.Context, schema *string) ([]Run, error) {
+	if s.adapter.SelectRuns == nil {
+		return nil, errors.Errorf("database does not record runs")
+	}
+	if _, err := s.AppliedVersions(ctx, schema); err != nil { // also creates the tables
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	rows, err := s.queryContext(ctx, s.adapter.SelectRuns(s.schemaOf(schema)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Run{}
+	for rows.Next() {
+		var run Run
+		var startedAt interface{}
+		var meta string
+		if err := rows.Scan(&run.ID, &run.Direction, &startedAt, &run.AppliedBy, &meta, &run.PositionBefore, &run.PositionAfter); err != nil {
+			return nil, err
+		}
+		if run.StartedAt, err = parseTimestamp(startedAt); err != nil {
+			return nil, errors.Wrapf(err, "run %q", run.ID)
+		}
+		if err := json.Unmarshal([]byte(meta), &run.Meta); err != nil {
+			return nil, errors.Wrapf(err, "run %q", run.ID)
+		}
+		result = append(result, run)
+	}
+	return result, rows.Err()
+}
+
+// LastRun is the RunID of MigrateOptions for the latest run of Up
+const LastRun = "last"
+
+// appliedRun returns run `runID` of Up, or the latest run if LastRun, with only its versions
+// that are still applied, in ascending order; and the versions applied by later runs of Up
+func (c *Config) appliedRun(ctx context.Context, schema *string, runID string, migratedVersions *trie.Trie) (Run, map[string]bool, error) {
+	runs, err := c.Runs(ctx, schema)
+	if err != nil {
+		return Run{}, nil, err
+	}
+	later := map[string]bool{}
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.Direction != directionUp {
+			continue
+		}
+		if runID != LastRun && run.ID != runID {
+			for _, version := range run.Versions {
+				later[version] = true
+			}
+			continue
+		}
+		var versions []string
+		for _, version := range run.Versions {
+			if _, found := migratedVersions.Find(version); found {
+				versions = append(versions, version)
+			}
+		}
+		if len(versions) == 0 {
+			return Run{}, nil, errors.Errorf("run %s has no applied versions left", run.ID)
+		}
+		sort.Strings(versions)
+		run.Versions = versions
+		return run, later, nil
+	}
+	return Run{}, nil, errors.Errorf("run %q of up not found", runID)
+}
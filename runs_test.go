@@ -0,0 +1,180 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunStore is a fakeStore that records runs too, with applied versions from its history
+type fakeRunStore struct {
+	fakeStore
+	runs []Run
+}
+
+func (f *fakeRunStore) AppliedVersions(_ context.Context, _ *string) ([]string, error) {
+	applied := map[string]bool{}
+	for _, entry := range f.entries {
+		applied[entry.Version] = entry.Direction == directionUp
+	}
+	result := []string{}
+	for version, ok := range applied {
+		if ok {
+			result = append(result, version)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeRunStore) RecordRun(_ context.Context, _ *string, run Run) error {
+	f.runs = append(f.runs, run)
+	return nil
+}
+
+func (f *fakeRunStore) FinishRun(_ context.Context, _ *string, run Run) error {
+	for i := range f.runs {
+		if f.runs[i].ID == run.ID {
+			f.runs[i].PositionAfter = run.PositionAfter
+		}
+	}
+	return nil
+}
+
+func (f *fakeRunStore) Runs(_ context.Context, _ *string) ([]Run, error) {
+	return append([]Run(nil), f.runs...), nil
+}
+
+func TestRuns(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073751_b.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	store := &fakeRunStore{}
+	c := &Config{dir: dir, db: db, appliedBy: "ci", logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.down.sql", "20181222073750_a.up.sql", "20181222073751_b.up.sql"}
+	WithVersionStore(store)(c)
+	WithRunMeta(map[string]string{"git_sha": "abc123", "pr": "https://example.com/pull/7"})(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}), "nothing pending; no run")
+
+	runs, err := c.Runs(context.Background(), nil)
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, directionUp, runs[0].Direction)
+		assert.Equal(t, "ci", runs[0].AppliedBy)
+		assert.Equal(t, map[string]string{"git_sha": "abc123", "pr": "https://example.com/pull/7"}, runs[0].Meta)
+		assert.Equal(t, []string{"20181222073750", "20181222073751"}, runs[0].Versions)
+		assert.Equal(t, store.entries[0].RunID, runs[0].ID)
+	}
+
+	c.store = &fakeStore{}
+	_, err = c.Runs(context.Background(), nil)
+	assert.EqualError(t, err, "version store does not record runs")
+}
+
+func TestDownRunID(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{}
+	for _, name := range []string{"20181222073750_a", "20181222073751_b", "20181222073752_c", "20181222073753_d"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+	store := &fakeRunStore{}
+	c := &Config{dir: dir, db: db, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+	WithVersionStore(store)(c)
+
+	var files []string
+	opts := MigrateOptions{Mode: DbTxnModeNone, AfterFile: func(name string) { files = append(files, name) }}
+	up := func(target string) string {
+		opts.Target = target
+		assert.NoError(t, c.Up(context.Background(), opts))
+		return store.runs[len(store.runs)-1].ID
+	}
+	first, second := up("20181222073750"), up("20181222073752")
+	opts.Target = ""
+
+	files = nil
+	opts.RunID = first
+	assert.EqualError(t, c.Down(context.Background(), opts), "20181222073752_c.down.sql was applied after run "+first+"; roll it back first")
+
+	opts.RunID = LastRun
+	assert.NoError(t, c.Down(context.Background(), opts))
+	assert.Equal(t, []string{"20181222073752_c.down.sql", "20181222073751_b.down.sql"}, files)
+
+	opts.RunID = second
+	assert.EqualError(t, c.Down(context.Background(), opts), "run "+second+" has no applied versions left")
+
+	files = nil
+	opts.RunID = first
+	assert.NoError(t, c.Down(context.Background(), opts))
+	assert.Equal(t, []string{"20181222073750_a.down.sql"}, files)
+
+	opts.RunID = "bogus"
+	assert.EqualError(t, c.Down(context.Background(), opts), `run "bogus" of up not found`)
+}
+
+func TestDownRunIDGap(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073753_d.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")}, // no down file
+	}
+	for _, name := range []string{"20181222073750_a", "20181222073751_b", "20181222073752_c"} {
+		dir[name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		dir[name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+	store := &fakeRunStore{}
+	c := &Config{dir: dir, db: db, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+	WithVersionStore(store)(c)
+
+	var files []string
+	opts := MigrateOptions{Mode: DbTxnModeNone, AfterFile: func(name string) { files = append(files, name) }}
+	up := func(opts MigrateOptions) string {
+		assert.NoError(t, c.Up(context.Background(), opts))
+		return store.runs[len(store.runs)-1].ID
+	}
+	up(MigrateOptions{Mode: DbTxnModeNone, File: "20181222073752_c.up.sql", AllowGaps: true})
+	gap := up(MigrateOptions{Mode: DbTxnModeNone, Target: "20181222073751"})
+
+	opts.RunID = gap
+	assert.NoError(t, c.Down(context.Background(), opts))
+	assert.Equal(t, []string{"20181222073751_b.down.sql", "20181222073750_a.down.sql"}, files, "only versions of the run")
+
+	irreversible := up(MigrateOptions{Mode: DbTxnModeNone, Target: "20181222073753", AllowGaps: true})
+	files = nil
+	opts.RunID = irreversible
+	assert.EqualError(t, c.Down(context.Background(), opts), "version 20181222073753 of run "+irreversible+" has no `.down.sql` file; cannot revert the run")
+	assert.Empty(t, files)
+}
+
+func TestRunLogPosition(t *testing.T) {
+	db, _ := openFakeDB(t, fakeValues("100,250"))
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	store := &fakeRunStore{}
+	c := &Config{dir: dir, db: db, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql"}
+	c.adapter.LogPositionQuery = "SELECT pg_current_wal_lsn()::text"
+	WithVersionStore(store)(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone}))
+	if assert.Len(t, store.runs, 1) {
+		assert.Equal(t, "100", store.runs[0].PositionBefore)
+		assert.Equal(t, "250", store.runs[0].PositionAfter)
+	}
+}
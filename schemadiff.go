@@ -0,0 +1,237 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A SchemaChange is a statement that brings the database closer to a declared schema, see DiffSchema
+type SchemaChange struct {
+	Up          string
+	Down        string // reverses Up; "" if it cannot, e.g. dropped data
+	Destructive bool   // drops a table or column of the database, so only suggested for review
+}
+
+// declaredTable is a `CREATE TABLE` statement of a declared schema
+type declaredTable struct {
+	name      string
+	columns   []declaredColumn
+	indexes   []string // `CREATE INDEX` statements on the table, created with it
+	statement string
+}
+
+// declaredColumn is a column definition of a declaredTable
+type declaredColumn struct {
+	name       string
+	typ        string
+	nullable   bool
+	definition string // as written, e.g. `email text NOT NULL DEFAULT ''`
+}
+
+var (
+	schemaCreateTable = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)\s*\((.*)\)\s*;?$`)
+	schemaCreateIndex = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+.*?\sON\s+(?:ONLY\s+)?([\w."]+)`)
+	schemaConstraint  = regexp.MustCompile(`(?i)^(CONSTRAINT|PRIMARY\s+KEY|UNIQUE|FOREIGN\s+KEY|CHECK|EXCLUDE)\b`)
+	schemaTypeEnd     = regexp.MustCompile(`(?i)\s(NOT|NULL|DEFAULT|PRIMARY|REFERENCES|UNIQUE|CHECK|CONSTRAINT|COLLATE|GENERATED)\b`)
+	schemaNotNull     = regexp.MustCompile(`(?i)\b(NOT\s+NULL|PRIMARY\s+KEY)\b`)
+)
+
+// parseSchema returns the `CREATE TABLE` statements of `schemaSQL`, with the `CREATE INDEX` statements
+// on each table, ignoring other statements
+func parseSchema(schemaSQL string) ([]declaredTable, error) {
+	var result []declaredTable
+	for _, stmt := range splitStatements(schemaSQL) {
+		stmt = strings.TrimSpace(stripBlockComments(lintLineComments.ReplaceAllString(stmt, "")))
+		if m := schemaCreateIndex.FindStringSubmatch(stmt); m != nil {
+			for i := range result {
+				if result[i].name == unquoteName(m[1]) {
+					result[i].indexes = append(result[i].indexes, strings.TrimSuffix(stmt, ";")+";")
+				}
+			}
+			continue
+		}
+		m := schemaCreateTable.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+		t := declaredTable{name: unquoteName(m[1]), statement: strings.TrimSuffix(stmt, ";")}
+		for _, definition := range splitTopLevel(m[2]) {
+			if definition = strings.TrimSpace(definition); definition == "" || schemaConstraint.MatchString(definition) {
+				continue
+			}
+			fields := strings.Fields(definition)
+			if len(fields) < 2 {
+				return nil, errors.Errorf("table %s: column %q has no type", t.name, definition)
+			}
+			rest := strings.TrimSpace(strings.TrimPrefix(definition, fields[0]))
+			typ := rest
+			if loc := schemaTypeEnd.FindStringIndex(" " + rest); loc != nil {
+				typ = strings.TrimSpace(rest[:loc[0]])
+			}
+			t.columns = append(t.columns, declaredColumn{
+				name:       unquoteName(fields[0]),
+				typ:        typ,
+				nullable:   !schemaNotNull.MatchString(rest),
+				definition: definition,
+			})
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// splitTopLevel splits `s` by commas outside of parentheses and quotes
+func splitTopLevel(s string) []string {
+	var result []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, s[start:])
+}
+
+// unquoteName returns `name` in lowercase without quotes and schema
+func unquoteName(name string) string {
+	parts := strings.Split(name, ".")
+	return strings.ToLower(strings.Trim(parts[len(parts)-1], `"`))
+}
+
+// diffSchema returns changes to bring `live` tables to `declared`, comparing types with `normalizeType`
+func diffSchema(declared []declaredTable, live []Table, normalizeType func(string) string) []SchemaChange {
+	liveTables := map[string]Table{}
+	for _, t := range live {
+		liveTables[strings.ToLower(t.Name)] = t
+	}
+	var result []SchemaChange
+	declaredNames := map[string]bool{}
+	for _, d := range declared {
+		declaredNames[d.name] = true
+		t, ok := liveTables[d.name]
+		if !ok {
+			up := strings.Join(append([]string{d.statement + ";"}, d.indexes...), "\n")
+			result = append(result, SchemaChange{Up: up, Down: "DROP TABLE " + d.name + ";"})
+			continue
+		}
+		liveColumns := map[string]Column{}
+		for _, col := range t.Columns {
+			liveColumns[strings.ToLower(col.Name)] = col
+		}
+		declaredColumns := map[string]bool{}
+		for _, dc := range d.columns {
+			declaredColumns[dc.name] = true
+			col, ok := liveColumns[dc.name]
+			switch {
+			case !ok:
+				result = append(result, SchemaChange{
+					Up:   "ALTER TABLE " + d.name + " ADD COLUMN " + dc.definition + ";",
+					Down: "ALTER TABLE " + d.name + " DROP COLUMN " + dc.name + ";",
+				})
+				continue
+			case normalizeType(dc.typ) != normalizeType(col.Type):
+				result = append(result, SchemaChange{
+					Up:   "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " TYPE " + dc.typ + ";",
+					Down: "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " TYPE " + col.Type + ";",
+				})
+			}
+			switch {
+			case dc.nullable && !col.Nullable:
+				result = append(result, SchemaChange{
+					Up:   "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " DROP NOT NULL;",
+					Down: "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " SET NOT NULL;",
+				})
+			case !dc.nullable && col.Nullable:
+				result = append(result, SchemaChange{
+					Up:   "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " SET NOT NULL;",
+					Down: "ALTER TABLE " + d.name + " ALTER COLUMN " + dc.name + " DROP NOT NULL;",
+				})
+			}
+		}
+		for _, col := range t.Columns {
+			if !declaredColumns[strings.ToLower(col.Name)] {
+				result = append(result, SchemaChange{Up: "ALTER TABLE " + d.name + " DROP COLUMN " + col.Name + ";", Destructive: true})
+			}
+		}
+	}
+	for _, t := range live {
+		if !declaredNames[strings.ToLower(t.Name)] {
+			result = append(result, SchemaChange{Up: "DROP TABLE " + t.Name + ";", Destructive: true})
+		}
+	}
+	return result
+}
+
+// DiffSchema returns changes to bring the tables of the database to the `CREATE TABLE` statements
+// of `schemaSQL`, e.g. a declarative schema maintained by hand or dumped by an ORM, or JSONSchemaSQL.
+// `CREATE INDEX` statements are only created with their new table; other statements are ignored.
+// Types are compared without length or precision
+func (c *Config) DiffSchema(ctx context.Context, schema *string, schemaSQL []byte) ([]SchemaChange, error) {
+	if c.adapter.NormalizeType == nil {
+		return nil, errors.Errorf("database does not support schema diff")
+	}
+	declared, err := parseSchema(string(schemaSQL))
+	if err != nil {
+		return nil, err
+	}
+	live, err := c.Tables(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	return diffSchema(declared, live, c.adapter.NormalizeType), nil
+}
+
+// pgTypeAliases maps postgres type names, without length or precision, to those of information_schema
+var pgTypeAliases = map[string]string{
+	"int":         "integer",
+	"int4":        "integer",
+	"serial":      "integer",
+	"serial4":     "integer",
+	"int8":        "bigint",
+	"bigserial":   "bigint",
+	"serial8":     "bigint",
+	"int2":        "smallint",
+	"smallserial": "smallint",
+	"serial2":     "smallint",
+	"varchar":     "character varying",
+	"char":        "character",
+	"bool":        "boolean",
+	"float4":      "real",
+	"float8":      "double precision",
+	"float":       "double precision",
+	"decimal":     "numeric",
+	"timestamptz": "timestamp with time zone",
+	"timestamp":   "timestamp without time zone",
+	"timetz":      "time with time zone",
+	"time":        "time without time zone",
+}
+
+var typeModifiers = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// pgNormalizeType returns postgres type `typ` as named by information_schema, without length or precision
+func pgNormalizeType(typ string) string {
+	typ = strings.Join(strings.Fields(strings.ToLower(typeModifiers.ReplaceAllString(typ, ""))), " ")
+	if strings.HasSuffix(typ, "[]") {
+		return "array"
+	}
+	if alias, ok := pgTypeAliases[typ]; ok {
+		return alias
+	}
+	return typ
+}
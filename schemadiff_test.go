@@ -0,0 +1,68 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSchema(t *testing.T) {
+	schemaSQL := `
+-- users of the app
+CREATE TABLE users (
+	id bigserial PRIMARY KEY,
+	email varchar(255) NOT NULL DEFAULT '',
+	name text,
+	org_id int REFERENCES orgs (id),
+	CONSTRAINT users_email UNIQUE (email)
+);
+CREATE INDEX users_name ON users (name);
+CREATE TABLE IF NOT EXISTS public."Orgs" (id serial PRIMARY KEY, title text NOT NULL);
+CREATE TABLE audit_log (id bigint, detail jsonb);
+`
+	live := []Table{
+		{Name: "users", Columns: []Column{
+			{Name: "id", Type: "bigint"},
+			{Name: "email", Type: "text", Nullable: true},
+			{Name: "name", Type: "text", Nullable: false},
+			{Name: "legacy", Type: "text", Nullable: true},
+		}},
+		{Name: "orgs", Columns: []Column{
+			{Name: "id", Type: "integer"},
+			{Name: "title", Type: "text"},
+		}},
+		{Name: "sessions", Columns: []Column{{Name: "id", Type: "integer"}}},
+	}
+
+	declared, err := parseSchema(schemaSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaChange{
+		{Up: "ALTER TABLE users ALTER COLUMN email TYPE varchar(255);", Down: "ALTER TABLE users ALTER COLUMN email TYPE text;"},
+		{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;", Down: "ALTER TABLE users ALTER COLUMN email DROP NOT NULL;"},
+		{Up: "ALTER TABLE users ALTER COLUMN name DROP NOT NULL;", Down: "ALTER TABLE users ALTER COLUMN name SET NOT NULL;"},
+		{Up: "ALTER TABLE users ADD COLUMN org_id int REFERENCES orgs (id);", Down: "ALTER TABLE users DROP COLUMN org_id;"},
+		{Up: "ALTER TABLE users DROP COLUMN legacy;", Destructive: true},
+		{Up: "CREATE TABLE audit_log (id bigint, detail jsonb);", Down: "DROP TABLE audit_log;"},
+		{Up: "DROP TABLE sessions;", Destructive: true},
+	}, diffSchema(declared, live, pgNormalizeType))
+}
+
+func TestPgNormalizeType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		typ      string
+		expected string
+	}{
+		{name: fileline(), typ: "VARCHAR(255)", expected: "character varying"},
+		{name: fileline(), typ: "numeric(10, 2)", expected: "numeric"},
+		{name: fileline(), typ: "timestamptz", expected: "timestamp with time zone"},
+		{name: fileline(), typ: "int[]", expected: "array"},
+		{name: fileline(), typ: "double  precision", expected: "double precision"},
+		{name: fileline(), typ: "uuid", expected: "uuid"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, pgNormalizeType(tc.typ))
+		})
+	}
+}
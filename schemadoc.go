@@ -0,0 +1,139 @@
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A Table describes a database table found by `Config.Tables`
+type Table struct {
+	Name        string
+	Columns     []Column
+	ForeignKeys []ForeignKey
+}
+
+// A Column of a Table
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// A ForeignKey references ForeignTable.ForeignColumn from Column of a Table
+type ForeignKey struct {
+	Column        string
+	ForeignTable  string
+	ForeignColumn string
+}
+
+// Tables returns tables, columns and foreign keys of the database, excluding dbmigrate's own tables
+func (c *Config) Tables(ctx context.Context, schema *string) ([]Table, error) {
+	if c.adapter.SelectColumns == nil || c.adapter.SelectForeignKeys == nil {
+		return nil, errors.Errorf("database does not support introspection")
+	}
+
+	var result []Table
+	index := map[string]int{}
+	rows, err := c.db.QueryContext(ctx, c.adapter.SelectColumns(schema))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query columns")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName, nullable string
+		var col Column
+		if err := rows.Scan(&tableName, &col.Name, &col.Type, &nullable); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(tableName, "dbmigrate_") {
+			continue
+		}
+		col.Nullable = strings.EqualFold(nullable, "YES")
+		i, ok := index[tableName]
+		if !ok {
+			i = len(result)
+			index[tableName] = i
+			result = append(result, Table{Name: tableName})
+		}
+		result[i].Columns = append(result[i].Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fkrows, err := c.db.QueryContext(ctx, c.adapter.SelectForeignKeys(schema))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query foreign keys")
+	}
+	defer fkrows.Close()
+	for fkrows.Next() {
+		var tableName string
+		var fk ForeignKey
+		if err := fkrows.Scan(&tableName, &fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
+			return nil, err
+		}
+		if i, ok := index[tableName]; ok {
+			result[i].ForeignKeys = append(result[i].ForeignKeys, fk)
+		}
+	}
+	return result, fkrows.Err()
+}
+
+var mermaidUnsafe = regexp.MustCompile(`\W+`)
+
+// mermaidType returns column type `s` as a Mermaid word, or `unknown` if it has none, e.g. a sqlite3
+// column declared without a type
+func mermaidType(s string) string {
+	if s = strings.Trim(mermaidUnsafe.ReplaceAllString(s, "_"), "_"); s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// WriteSchemaDoc writes `tables` as Markdown, with a Mermaid entity relationship diagram
+func WriteSchemaDoc(w io.Writer, title string, tables []Table) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+
+	b.WriteString("```mermaid\nerDiagram\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "    %s {\n", mermaidUnsafe.ReplaceAllString(t.Name, "_"))
+		for _, col := range t.Columns {
+			fmt.Fprintf(&b, "        %s %s\n", mermaidType(col.Type), mermaidUnsafe.ReplaceAllString(col.Name, "_"))
+		}
+		b.WriteString("    }\n")
+	}
+	for _, t := range tables {
+		for _, fk := range t.ForeignKeys {
+			fmt.Fprintf(&b, "    %s }o--|| %s : %q\n",
+				mermaidUnsafe.ReplaceAllString(t.Name, "_"),
+				mermaidUnsafe.ReplaceAllString(fk.ForeignTable, "_"),
+				fk.Column)
+		}
+	}
+	b.WriteString("```\n")
+
+	for _, t := range tables {
+		fmt.Fprintf(&b, "\n## %s\n\n| Column | Type | Null | References |\n| --- | --- | --- | --- |\n", t.Name)
+		for _, col := range t.Columns {
+			nullable, references := "NO", ""
+			if col.Nullable {
+				nullable = "YES"
+			}
+			for _, fk := range t.ForeignKeys {
+				if fk.Column == col.Name {
+					references = fk.ForeignTable + "." + fk.ForeignColumn
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", col.Name, col.Type, nullable, references)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,63 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSchemaDoc(t *testing.T) {
+	tables := []Table{
+		{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "name", Type: "character varying", Nullable: true},
+				{Name: "extra", Nullable: true},
+			},
+		},
+		{
+			Name: "posts",
+			Columns: []Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "user_id", Type: "bigint"},
+			},
+			ForeignKeys: []ForeignKey{
+				{Column: "user_id", ForeignTable: "users", ForeignColumn: "id"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSchemaDoc(&buf, "mydb", tables))
+	assert.Equal(t, "# mydb\n"+
+		"\n"+
+		"```mermaid\n"+
+		"erDiagram\n"+
+		"    users {\n"+
+		"        bigint id\n"+
+		"        character_varying name\n"+
+		"        unknown extra\n"+
+		"    }\n"+
+		"    posts {\n"+
+		"        bigint id\n"+
+		"        bigint user_id\n"+
+		"    }\n"+
+		"    posts }o--|| users : \"user_id\"\n"+
+		"```\n"+
+		"\n"+
+		"## users\n"+
+		"\n"+
+		"| Column | Type | Null | References |\n"+
+		"| --- | --- | --- | --- |\n"+
+		"| id | bigint | NO |  |\n"+
+		"| name | character varying | YES |  |\n"+
+		"| extra |  | YES |  |\n"+
+		"\n"+
+		"## posts\n"+
+		"\n"+
+		"| Column | Type | Null | References |\n"+
+		"| --- | --- | --- | --- |\n"+
+		"| id | bigint | NO |  |\n"+
+		"| user_id | bigint | NO | users.id |\n", buf.String())
+}
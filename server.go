@@ -0,0 +1,73 @@
+package dbmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// HealthStatus is the json response of Handler
+type HealthStatus struct {
+	Status  string   `json:"status"` // "ok" or "unavailable"
+	Error   string   `json:"error,omitempty"`
+	Pending []string `json:"pending,omitempty"`
+	Locked  bool     `json:"locked,omitempty"`
+}
+
+// Handler serves `/healthz`, ok when the database is reachable, and `/readyz`, ok when there
+// are no pending versions and MigrationLockName is not held, e.g. by a migration in progress
+func (c *Config) Handler(schema *string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, c.health(r.Context()))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, c.readiness(r.Context(), schema))
+	})
+	return mux
+}
+
+func (c *Config) health(ctx context.Context) HealthStatus {
+	if err := c.db.PingContext(ctx); err != nil {
+		return HealthStatus{Status: "unavailable", Error: err.Error()}
+	}
+	if c.adapter.PingQuery != "" {
+		if _, err := c.firstValue(ctx, c.adapter.PingQuery); err != nil {
+			return HealthStatus{Status: "unavailable", Error: err.Error()}
+		}
+	}
+	return HealthStatus{Status: "ok"}
+}
+
+func (c *Config) readiness(ctx context.Context, schema *string) HealthStatus {
+	if status := c.health(ctx); status.Status != "ok" {
+		return status
+	}
+	pending, err := c.PendingVersions(ctx, schema)
+	if err != nil {
+		return HealthStatus{Status: "unavailable", Error: err.Error()}
+	}
+	if len(pending) > 0 {
+		return HealthStatus{Status: "unavailable", Pending: pending}
+	}
+	if c.adapter.TryLockQuery != "" {
+		lock, err := acquireLock(ctx, c.db, c.adapter, c.migrationLockName(), true)
+		if err == ErrLocked {
+			return HealthStatus{Status: "unavailable", Locked: true}
+		} else if err != nil {
+			return HealthStatus{Status: "unavailable", Error: err.Error()}
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			return HealthStatus{Status: "unavailable", Error: err.Error()}
+		}
+	}
+	return HealthStatus{Status: "ok"}
+}
+
+func writeHealth(w http.ResponseWriter, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
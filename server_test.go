@@ -0,0 +1,50 @@
+package dbmigrate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	db, _ := openFakeLockDB(t)
+	adapter, err := AdapterFor("dbmigrate-fake-lock")
+	assert.NoError(t, err)
+
+	store := &fakeStore{versions: []string{"20181222073750"}}
+	c := &Config{
+		db:             db,
+		adapter:        adapter,
+		driverName:     "dbmigrate-fake-lock",
+		store:          store,
+		migrationFiles: []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"},
+	}
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		c.Handler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.JSONEq(t, `{"status":"unavailable","pending":["20181222073900"]}`, body)
+
+	store.versions = append(store.versions, "20181222073900")
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+
+	lock, err := Lock(context.Background(), db, MigrationLockName)
+	assert.NoError(t, err)
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.JSONEq(t, `{"status":"unavailable","locked":true}`, body)
+	assert.NoError(t, lock.Unlock(context.Background()))
+}
@@ -0,0 +1,35 @@
+package dbmigrate
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFilename in the migrations directory lists versions to skip, one per line; see WithSkipVersions
+const IgnoreFilename = ".dbmigrateignore"
+
+// readIgnoreFile returns versions listed in IgnoreFilename of `dir`, if any.
+// Blank lines and text after `#` are ignored
+func readIgnoreFile(dir fs.FS) ([]string, error) {
+	f, err := dir.Open(IgnoreFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, IgnoreFilename)
+	}
+	defer f.Close()
+
+	var versions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0])
+		if line != "" {
+			versions = append(versions, line)
+		}
+	}
+	return versions, errors.Wrapf(scanner.Err(), IgnoreFilename)
+}
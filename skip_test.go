@@ -0,0 +1,45 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadIgnoreFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    fstest.MapFS
+		expected []string
+	}{
+		{
+			name:     fileline(),
+			given:    fstest.MapFS{},
+			expected: nil,
+		},
+		{
+			name: fileline(),
+			given: fstest.MapFS{
+				IgnoreFilename: {Data: []byte("# broken in production, see #123\n20181222073750\n\n  20181222073900 # fixed by 20181223000000\n")},
+			},
+			expected: []string{"20181222073750", "20181222073900"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := readIgnoreFile(tc.given)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestWithSkipVersions(t *testing.T) {
+	c := &Config{}
+	WithSkipVersions("20181222073750 ", "20181222073900")(c)
+	WithSkipVersions("20181222073901")(c)
+	assert.Equal(t, map[string]bool{"20181222073750": true, "20181222073900": true, "20181222073901": true}, c.skipVersions)
+}
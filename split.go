@@ -0,0 +1,44 @@
+package dbmigrate
+
+import (
+	"strings"
+
+	"github.com/choonkeat/dbmigrate/sqlsplit"
+)
+
+// splitStatements splits `sqlText` into statements as any database would, see sqlsplit.Split.
+// Comments before a statement stay with it, so `-- dbmigrate:` directives apply to the statement that follows
+func splitStatements(sqlText string) []string {
+	return sqlsplit.Split(sqlText, sqlsplit.Options{})
+}
+
+// statements splits `filecontent` as the database of `c` would, e.g. to execute each statement separately
+func (c *Config) statements(filecontent []byte) []string {
+	return sqlsplit.Split(string(filecontent), c.adapter.SplitOptions)
+}
+
+// isBlankStatement returns true if `stmt` only has whitespace, comments and `;`
+func isBlankStatement(stmt string) bool {
+	for _, line := range strings.Split(stripBlockComments(stmt), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == ";" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func stripBlockComments(s string) string {
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			return s
+		}
+		end := strings.Index(s[start:], "*/")
+		if end < 0 {
+			return s[:start]
+		}
+		s = s[:start] + s[start+end+2:]
+	}
+}
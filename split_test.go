@@ -0,0 +1,62 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected []string
+	}{
+		{
+			name:     fileline(),
+			given:    "",
+			expected: nil,
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1; SELECT 2;\n",
+			expected: []string{"SELECT 1;", " SELECT 2;"},
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     fileline(),
+			given:    "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`, 'it''s;');",
+			expected: []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`, 'it''s;');"},
+		},
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:ignore-error 42P07\nCREATE TABLE t (id int); -- ; here\n/* ; */SELECT 1;",
+			expected: []string{"-- dbmigrate:ignore-error 42P07\nCREATE TABLE t (id int);", " -- ; here\n/* ; */SELECT 1;"},
+		},
+		{
+			name:     fileline(),
+			given:    "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql; SELECT $$;$$;",
+			expected: []string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;", " SELECT $$;$$;"},
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT $1; -- trailing comment",
+			expected: []string{"SELECT $1;", " -- trailing comment"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, splitStatements(tc.given))
+		})
+	}
+}
+
+func TestIsBlankStatement(t *testing.T) {
+	assert.True(t, isBlankStatement(" -- comment\n/* block\ncomment */\n;"))
+	assert.False(t, isBlankStatement("-- comment\nSELECT 1;"))
+	assert.False(t, isBlankStatement("/* comment */ SELECT 1"))
+}
@@ -0,0 +1,34 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// execLogged executes `s` in its transaction, appending it to WithSQLLog if any; it is the innermost Executor
+func (c *Config) execLogged(ctx context.Context, s Statement) (sql.Result, error) {
+	filename, stmt := s.Filename, s.SQL
+	started := time.Now()
+	result, err := s.Tx.ExecContext(ctx, stmt)
+	if c.sqlLog == nil {
+		return result, err
+	}
+
+	outcome := ""
+	if err != nil {
+		outcome = "error: " + strings.Join(strings.Fields(err.Error()), " ")
+	} else if rows, rowsErr := rowsAffected(result); rowsErr == nil {
+		outcome = fmt.Sprintf("%d rows affected", rows)
+	}
+	stmt = strings.TrimSpace(stmt)
+	if !strings.HasSuffix(stmt, ";") {
+		stmt += ";"
+	}
+	// one sql comment line per statement keeps the log replayable
+	fmt.Fprintf(c.sqlLog, "-- %s %s %s %s\n%s\n",
+		started.UTC().Format(time.RFC3339Nano), filename, time.Since(started), outcome, stmt)
+	return result, err
+}
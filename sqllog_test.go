@@ -0,0 +1,25 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecLogged(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	var buf bytes.Buffer
+	c := &Config{}
+	_, err := c.execLogged(context.Background(), Statement{Filename: "20240102120000_a.up.sql", SQL: "SELECT 1", Tx: &noTx{db: db}})
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String(), "no log by default")
+
+	WithSQLLog(&buf)(c)
+	_, err = c.execLogged(context.Background(), Statement{Filename: "20240102120000_a.up.sql", SQL: "\nUPDATE users SET active = true\n", Tx: &noTx{db: db}})
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^-- \S+Z 20240102120000_a\.up\.sql \S+ 0 rows affected\nUPDATE users SET active = true;\n$`), buf.String())
+}
@@ -0,0 +1,24 @@
+//go:build go1.18
+// +build go1.18
+
+package sqlsplit
+
+import "testing"
+
+// FuzzSplit checks statements of any text are the text in order, and each splits into itself again;
+// and that comments are stripped at once. Run with `go test -fuzz FuzzSplit ./sqlsplit`
+func FuzzSplit(f *testing.F) {
+	for _, tc := range corpus {
+		f.Add(tc.given)
+	}
+	f.Fuzz(func(t *testing.T, sqlText string) {
+		for _, opts := range []Options{{}, Postgres, MySQL, CQL} {
+			if reason := checkSplit(sqlText, opts, Split(sqlText, opts)); reason != "" {
+				t.Errorf("%+v: %s", opts, reason)
+			}
+			if reason := checkStripComments(sqlText, opts, StripComments(sqlText, opts)); reason != "" {
+				t.Errorf("%+v: %s", opts, reason)
+			}
+		}
+	})
+}
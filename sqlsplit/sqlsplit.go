@@ -0,0 +1,265 @@
+// Package sqlsplit splits sql text into statements on `;`, without splitting inside quoted strings,
+// comments, postgres dollar-quoted function bodies, or the data of `COPY ... FROM STDIN`; mysql
+// `DELIMITER` lines change the terminator, e.g. around stored procedures
+package sqlsplit
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Options of Split for features that differ between databases
+type Options struct {
+	NestedComments   bool // `/* /* */ */` is one comment, as in postgres
+	BackslashEscapes bool // `\'` does not end a quoted string, as in mysql; postgres `E'\''` always does not
+	HashComments     bool // `#` starts a comment until the end of the line, as in mysql
+	DashSpace        bool // `--` starts a comment only if followed by whitespace, as in mysql; `5--3` is 5 minus -3
+	SlashComments    bool // `//` starts a comment until the end of the line, as in cql
+	HintComments     bool // `/*! */` and `/*+ */` are executed or read as optimizer hints, as in mysql; kept by StripComments
+}
+
+// Options of databases
+var (
+	Postgres = Options{NestedComments: true}
+	MySQL    = Options{BackslashEscapes: true, HashComments: true, DashSpace: true, HintComments: true}
+	CQL      = Options{SlashComments: true}
+)
+
+// copyFromStdin matches a statement whose data follows it, until a `\.` line
+var copyFromStdin = regexp.MustCompile(`(?is)^COPY\b.*\bFROM\s+STDIN\b`)
+
+// Split splits `sqlText` into statements. Comments before a statement stay with it, e.g. so directives
+// in comments apply to the statement that follows. A statement ends after `;`, or before the terminator
+// of a `DELIMITER` line, which is not part of any statement, since only the mysql client understands it.
+// The data of `COPY ... FROM STDIN;`, up to and including its `\.` line, is part of the statement
+func Split(sqlText string, opts Options) []string {
+	s := splitter{text: sqlText, opts: opts, delimiter: ";"}
+	for s.i < len(s.text) {
+		s.next()
+	}
+	if rest := s.text[s.start:]; strings.TrimSpace(rest) != "" {
+		s.result = append(s.result, s.prefix+rest)
+	}
+	return s.result
+}
+
+// StripComments removes comments from `sqlText`, e.g. for drivers that reject them. A line comment is
+// removed up to its end of line, and a block comment is replaced by a space, so tokens around it stay
+// apart. Quoted strings, dollar-quoted bodies and `COPY` data are kept as they are
+func StripComments(sqlText string, opts Options) string {
+	var b strings.Builder
+	kept := 0
+	s := splitter{text: sqlText, opts: opts, delimiter: ";"}
+	s.comment = func(start int, end int, block bool) {
+		if block && opts.HintComments && (strings.HasPrefix(sqlText[start:], "/*!") || strings.HasPrefix(sqlText[start:], "/*+")) {
+			return
+		}
+		b.WriteString(sqlText[kept:start])
+		if block {
+			b.WriteString(" ")
+		} else if sqlText[end-1] == '\n' {
+			end--
+		}
+		kept = end
+	}
+	for s.i < len(s.text) {
+		s.next()
+	}
+	b.WriteString(sqlText[kept:])
+	return b.String()
+}
+
+// splitter holds the state of Split at index `i` of `text`
+type splitter struct {
+	text      string
+	opts      Options
+	delimiter string
+	prefix    string // comments before a `DELIMITER` line, for the next statement
+	start     int    // of the current statement
+	i         int
+	result    []string
+	comment   func(start int, end int, block bool) // called with each comment, if not nil
+}
+
+// next advances past the token at `i`
+func (s *splitter) next() {
+	text, i := s.text, s.i
+	switch ch := text[i]; {
+	case s.delimiter != ";" && strings.HasPrefix(text[i:], s.delimiter):
+		s.emit(i, i+len(s.delimiter))
+	case ch == ';' && s.delimiter == ";":
+		s.emit(i+1, i+1)
+	case (ch == 'D' || ch == 'd') && hasPrefixFold(text[i:], "DELIMITER") && s.atLineStart(i) && s.blank(text[s.start:i]):
+		s.i = s.delimiterLine(i)
+	case ch == '\'':
+		s.i = skipQuoted(text, i, ch, s.opts.BackslashEscapes || isEscapeString(text, i))
+	case ch == '"':
+		s.i = skipQuoted(text, i, ch, s.opts.BackslashEscapes)
+	case ch == '`':
+		s.i = skipQuoted(text, i, ch, false)
+	case isDashComment(text[i:], s.opts), ch == '#' && s.opts.HashComments, strings.HasPrefix(text[i:], "//") && s.opts.SlashComments:
+		s.i = skipUntil(text, i, "\n")
+		if s.comment != nil {
+			s.comment(i, s.i, false)
+		}
+	case strings.HasPrefix(text[i:], "/*"):
+		s.i = skipComment(text, i, s.opts.NestedComments)
+		if s.comment != nil {
+			s.comment(i, s.i, true)
+		}
+	case ch == '$' && (i == 0 || !isIdentifier(text[i-1])):
+		if tag := dollarTag(text[i:]); tag != "" {
+			s.i = skipUntil(text, i+len(tag), tag)
+		} else {
+			s.i++
+		}
+	default:
+		s.i++
+	}
+}
+
+// emit the statement from `start` until `end`, continuing after `after`
+func (s *splitter) emit(end int, after int) {
+	stmt := s.prefix + s.text[s.start:end]
+	s.prefix, s.start, s.i = "", after, after
+	if copyFromStdin.MatchString(stripComments(stmt, s.opts)) {
+		s.i = copyDataEnd(s.text, after)
+		stmt, s.start = stmt+s.text[after:s.i], s.i
+	}
+	s.result = append(s.result, stmt)
+}
+
+// delimiterLine changes the delimiter if a `DELIMITER` line starts at `i`, returning the index after it
+func (s *splitter) delimiterLine(i int) int {
+	end := skipUntil(s.text, i, "\n")
+	fields := strings.Fields(s.text[i:end])
+	if len(fields) != 2 || len(fields[0]) != len("DELIMITER") {
+		return i + 1
+	}
+	s.delimiter = fields[1]
+	s.prefix, s.start = s.prefix+s.text[s.start:i], end
+	return end
+}
+
+// atLineStart returns true if only spaces and tabs are before `i` on its line
+func (s *splitter) atLineStart(i int) bool {
+	for i--; i >= 0 && s.text[i] != '\n'; i-- {
+		if s.text[i] != ' ' && s.text[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// blank returns true if `stmt` only has whitespace and comments
+func (s *splitter) blank(stmt string) bool {
+	return strings.TrimSpace(stripComments(stmt, s.opts)) == ""
+}
+
+// stripComments returns `stmt` without leading whitespace and comments
+func stripComments(stmt string, opts Options) string {
+	for {
+		stmt = strings.TrimLeft(stmt, " \t\r\n")
+		switch {
+		case isDashComment(stmt, opts), strings.HasPrefix(stmt, "#") && opts.HashComments, strings.HasPrefix(stmt, "//") && opts.SlashComments:
+			stmt = stmt[skipUntil(stmt, 0, "\n"):]
+		case strings.HasPrefix(stmt, "/*"):
+			stmt = stmt[skipComment(stmt, 0, opts.NestedComments):]
+		default:
+			return stmt
+		}
+	}
+}
+
+// isDashComment returns true if a `--` comment starts `s`
+func isDashComment(s string, opts Options) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return !opts.DashSpace || len(s) == 2 || s[2] <= ' ' // whitespace or control character
+}
+
+// copyDataEnd returns the index after the `\.` line ending the data that starts on the line after `i`
+func copyDataEnd(s string, i int) int {
+	for i = skipUntil(s, i, "\n"); i < len(s); {
+		end := skipUntil(s, i, "\n")
+		if strings.TrimRight(s[i:end], "\r\n") == `\.` {
+			return end
+		}
+		i = end
+	}
+	return len(s)
+}
+
+// skipQuoted returns the index after the closing `quote`; doubled quotes are escapes, as is
+// a backslash before any character if `backslashEscapes`
+func skipQuoted(s string, i int, quote byte, backslashEscapes bool) int {
+	for i++; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && backslashEscapes:
+			i++
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// skipUntil returns the index after the next `end` at or after `i`
+func skipUntil(s string, i int, end string) int {
+	if n := strings.Index(s[i:], end); n >= 0 {
+		return i + n + len(end)
+	}
+	return len(s)
+}
+
+// skipComment returns the index after the block comment at `i`, and after those nested in it if `nested`
+func skipComment(s string, i int, nested bool) int {
+	depth := 0
+	for i < len(s) {
+		switch {
+		case strings.HasPrefix(s[i:], "/*") && (nested || depth == 0):
+			depth++
+			i += 2
+		case strings.HasPrefix(s[i:], "*/"):
+			if depth--; depth == 0 {
+				return i + 2
+			}
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
+
+// hasPrefixFold is strings.HasPrefix, ignoring case
+func hasPrefixFold(s string, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// isEscapeString returns true if the quote at `i` starts a postgres `E'...'` string
+func isEscapeString(s string, i int) bool {
+	return i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i == 1 || !isIdentifier(s[i-2]))
+}
+
+// isIdentifier returns true if `ch` can be part of an unquoted identifier, where `$` is not a dollar quote
+func isIdentifier(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80
+}
+
+// dollarTag returns `$tag$` or `$$` if `s` starts with one
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		if ch == '$' {
+			return s[:i+1]
+		}
+		if !(ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || i > 1 && ch >= '0' && ch <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,335 @@
+package sqlsplit
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fileline() string {
+	_, fn, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", fn, line)
+}
+
+// corpus of Split, also seeding FuzzSplit
+var corpus = []struct {
+	name     string
+	opts     Options
+	given    string
+	expected []string
+}{
+	{
+		name:     fileline(),
+		given:    "",
+		expected: nil,
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 1; SELECT 2;\n",
+		expected: []string{"SELECT 1;", " SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 1",
+		expected: []string{"SELECT 1"},
+	},
+	{
+		name:     fileline(),
+		given:    "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`, 'it''s;');",
+		expected: []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`, 'it''s;');"},
+	},
+	{
+		name:     fileline(),
+		given:    "-- dbmigrate:ignore-error 42P07\nCREATE TABLE t (id int); -- ; here\n/* ; */SELECT 1;",
+		expected: []string{"-- dbmigrate:ignore-error 42P07\nCREATE TABLE t (id int);", " -- ; here\n/* ; */SELECT 1;"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 1; -- trailing comment",
+		expected: []string{"SELECT 1;", " -- trailing comment"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 'unterminated; SELECT 2;",
+		expected: []string{"SELECT 'unterminated; SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 1 /* unterminated; SELECT 2;",
+		expected: []string{"SELECT 1 /* unterminated; SELECT 2;"},
+	},
+
+	// postgres dollar quotes
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql; SELECT $$;$$;",
+		expected: []string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;", " SELECT $$;$$;"},
+	},
+	{
+		name:  fileline(),
+		opts:  Postgres,
+		given: "CREATE FUNCTION f() RETURNS trigger AS $fn$\nBEGIN\n  PERFORM $q$;$q$;\n  RETURN NEW;\nEND;\n$fn$ LANGUAGE plpgsql;\nSELECT 1;",
+		expected: []string{
+			"CREATE FUNCTION f() RETURNS trigger AS $fn$\nBEGIN\n  PERFORM $q$;$q$;\n  RETURN NEW;\nEND;\n$fn$ LANGUAGE plpgsql;",
+			"\nSELECT 1;",
+		},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "SELECT $1; SELECT $1$2;",
+		expected: []string{"SELECT $1;", " SELECT $1$2;"},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "SELECT a$b$c FROM t; SELECT 2;",
+		expected: []string{"SELECT a$b$c FROM t;", " SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "DO $$ BEGIN RAISE NOTICE 'a;b'; END $$; SELECT 2;",
+		expected: []string{"DO $$ BEGIN RAISE NOTICE 'a;b'; END $$;", " SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "DO $$ BEGIN RAISE NOTICE '$$'; END $$; SELECT 2;",
+		expected: []string{"DO $$ BEGIN RAISE NOTICE '$$'; END $$; SELECT 2;"},
+	},
+
+	// postgres escape strings and nested comments
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    `SELECT E'it\'s;', 'c:\'; SELECT 2;`,
+		expected: []string{`SELECT E'it\'s;', 'c:\';`, ` SELECT 2;`},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    `SELECT name'\'; SELECT 2;`,
+		expected: []string{`SELECT name'\';`, ` SELECT 2;`},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "/* outer /* inner; */ still comment; */ SELECT 1; SELECT 2;",
+		expected: []string{"/* outer /* inner; */ still comment; */ SELECT 1;", " SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		given:    "/* outer /* inner; */ SELECT 1; SELECT 2;",
+		expected: []string{"/* outer /* inner; */ SELECT 1;", " SELECT 2;"},
+	},
+
+	// postgres COPY payloads
+	{
+		name:  fileline(),
+		opts:  Postgres,
+		given: "COPY users (id, name) FROM stdin;\n1\ta;b\n2\t'c\n\\.\nSELECT 1;",
+		expected: []string{
+			"COPY users (id, name) FROM stdin;\n1\ta;b\n2\t'c\n\\.\n",
+			"SELECT 1;",
+		},
+	},
+	{
+		name:  fileline(),
+		opts:  Postgres,
+		given: "-- seed\ncopy users FROM STDIN WITH (FORMAT csv);\r\n1,\"x;y\"\r\n\\.\r\nCOPY users TO STDOUT; SELECT 2;",
+		expected: []string{
+			"-- seed\ncopy users FROM STDIN WITH (FORMAT csv);\r\n1,\"x;y\"\r\n\\.\r\n",
+			"COPY users TO STDOUT;",
+			" SELECT 2;",
+		},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "COPY users FROM stdin;\n1\ta;\n",
+		expected: []string{"COPY users FROM stdin;\n1\ta;\n"},
+	},
+	{
+		name:     fileline(),
+		opts:     Postgres,
+		given:    "-- COPY users FROM stdin;\nSELECT 1;\nSELECT 2;",
+		expected: []string{"-- COPY users FROM stdin;\nSELECT 1;", "\nSELECT 2;"},
+	},
+
+	// mysql
+	{
+		name:     fileline(),
+		opts:     MySQL,
+		given:    `INSERT INTO t VALUES ('it\'s;', "say \"hi;\""); SELECT 2;`,
+		expected: []string{`INSERT INTO t VALUES ('it\'s;', "say \"hi;\"");`, ` SELECT 2;`},
+	},
+	{
+		name:     fileline(),
+		opts:     MySQL,
+		given:    "# comment; here\nSELECT 1; SELECT `a``;b`;",
+		expected: []string{"# comment; here\nSELECT 1;", " SELECT `a``;b`;"},
+	},
+	{
+		name:     fileline(),
+		opts:     MySQL,
+		given:    "SELECT 5--3; SELECT 2;--\n-- comment; here\nSELECT 3;",
+		expected: []string{"SELECT 5--3;", " SELECT 2;", "--\n-- comment; here\nSELECT 3;"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 5--3; SELECT 2;",
+		expected: []string{"SELECT 5--3; SELECT 2;"},
+	},
+	{
+		name:     fileline(),
+		given:    "SELECT 1 # not a comment; SELECT 2;",
+		expected: []string{"SELECT 1 # not a comment;", " SELECT 2;"},
+	},
+	{
+		name:  fileline(),
+		opts:  MySQL,
+		given: "DROP PROCEDURE IF EXISTS p;\n-- procedure\nDELIMITER //\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND//\nDELIMITER ;\nCALL p();",
+		expected: []string{
+			"DROP PROCEDURE IF EXISTS p;",
+			"\n-- procedure\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND",
+			"\nCALL p();",
+		},
+	},
+	{
+		name:  fileline(),
+		opts:  MySQL,
+		given: "delimiter $$\nCREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW BEGIN SET NEW.a = '$$'; END $$\n  DELIMITER ;\nSELECT 1;",
+		expected: []string{
+			"CREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW BEGIN SET NEW.a = '$$'; END ",
+			"\n  SELECT 1;",
+		},
+	},
+	{
+		name:     fileline(),
+		opts:     MySQL,
+		given:    "SELECT 1\nDELIMITER //\n;",
+		expected: []string{"SELECT 1\nDELIMITER //\n;"},
+	},
+	{
+		name:     fileline(),
+		opts:     MySQL,
+		given:    "DELIMITERS ok;\nDELIMITER\n;",
+		expected: []string{"DELIMITERS ok;", "\nDELIMITER\n;"},
+	},
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range corpus {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Split(tc.given, tc.opts))
+		})
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     Options
+		given    string
+		expected string
+	}{
+		{
+			name:     fileline(),
+			given:    "-- dbmigrate:ignore-error 42P07\nCREATE TABLE t (id int); -- trailing\nSELECT/* a */1;",
+			expected: "\nCREATE TABLE t (id int); \nSELECT 1;",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT '-- kept', \"/* kept */\" -- removed",
+			expected: "SELECT '-- kept', \"/* kept */\" ",
+		},
+		{
+			name:     fileline(),
+			opts:     Postgres,
+			given:    "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; -- kept\n$$ LANGUAGE sql; /* outer /* inner */ */",
+			expected: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; -- kept\n$$ LANGUAGE sql;  ",
+		},
+		{
+			name:     fileline(),
+			opts:     Postgres,
+			given:    "COPY t FROM stdin;\n-- data\n\\.\n-- removed\n",
+			expected: "COPY t FROM stdin;\n-- data\n\\.\n\n",
+		},
+		{
+			name:     fileline(),
+			opts:     MySQL,
+			given:    "# removed\nSELECT /*+ MAX_EXECUTION_TIME(1000) */ 1 /*!50700 , 2 */; /* removed */",
+			expected: "\nSELECT /*+ MAX_EXECUTION_TIME(1000) */ 1 /*!50700 , 2 */;  ",
+		},
+		{
+			name:     fileline(),
+			opts:     MySQL,
+			given:    "SELECT 5--3, 1 -- removed\n--\tremoved\n",
+			expected: "SELECT 5--3, 1 \n\n",
+		},
+		{
+			name:     fileline(),
+			opts:     CQL,
+			given:    "// removed\nSELECT * FROM t WHERE a = '//kept'; -- removed",
+			expected: "\nSELECT * FROM t WHERE a = '//kept'; ",
+		},
+		{
+			name:     fileline(),
+			given:    "SELECT 1 /* unterminated",
+			expected: "SELECT 1  ",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, StripComments(tc.given, tc.opts))
+		})
+	}
+}
+
+// checkSplit returns why `statements` of `sqlText` are wrong, if they are. Without `DELIMITER` lines,
+// statements are the text in order, without a blank end; and each splits into itself again
+func checkSplit(sqlText string, opts Options, statements []string) string {
+	if strings.Contains(strings.ToUpper(sqlText), "DELIMITER") {
+		return ""
+	}
+	joined := strings.Join(statements, "")
+	if !strings.HasPrefix(sqlText, joined) || strings.TrimSpace(sqlText[len(joined):]) != "" {
+		return fmt.Sprintf("statements %q are not the text in order", statements)
+	}
+	for _, stmt := range statements {
+		if again := Split(stmt, opts); len(again) != 1 || again[0] != stmt {
+			return fmt.Sprintf("statement %q splits into %q", stmt, again)
+		}
+	}
+	return ""
+}
+
+func TestCheckSplit(t *testing.T) {
+	for _, tc := range corpus {
+		for _, opts := range []Options{{}, Postgres, MySQL, CQL} {
+			assert.Equal(t, "", checkSplit(tc.given, opts, Split(tc.given, opts)), tc.name)
+			assert.Equal(t, "", checkStripComments(tc.given, opts, StripComments(tc.given, opts)), tc.name)
+		}
+	}
+	assert.NotEqual(t, "", checkSplit("SELECT 1; SELECT 2;", Options{}, []string{"SELECT 1;"}))
+	assert.NotEqual(t, "", checkSplit("SELECT 1; SELECT 2;", Options{}, []string{"SELECT 1; SELECT 2;"}))
+}
+
+// checkStripComments returns why `stripped` of `sqlText` is wrong, if it is: without `DELIMITER` lines,
+// stripping it again changes nothing
+func checkStripComments(sqlText string, opts Options, stripped string) string {
+	if strings.Contains(strings.ToUpper(sqlText), "DELIMITER") {
+		return ""
+	}
+	if again := StripComments(stripped, opts); again != stripped {
+		return fmt.Sprintf("%q strips into %q again", stripped, again)
+	}
+	return ""
+}
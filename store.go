@@ -0,0 +1,306 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VersionStore keeps track of applied versions. By default, versions are kept in
+// `dbmigrate_versions` and `dbmigrate_history` tables of the migrated database; see
+// WithVersionStore to keep them elsewhere, e.g. when migrating Cassandra or ClickHouse
+type VersionStore interface {
+	// AppliedVersions returns versions that are applied, in any order
+	AppliedVersions(ctx context.Context, schema *string) ([]string, error)
+
+	// Record registers (direction "up") or unregisters (direction "down") `entry.Version`
+	// after its file is executed; direction "skip" is only kept in history. `tx` belongs to
+	// the migrated database; a store kept elsewhere cannot commit or rollback together with it
+	Record(ctx context.Context, tx ExecCommitRollbacker, schema *string, entry HistoryEntry) error
+
+	// History returns recorded entries, oldest first
+	History(ctx context.Context, schema *string) ([]HistoryEntry, error)
+}
+
+// sqlStore keeps versions in an sql database using statements of `adapter`
+type sqlStore struct {
+	db        *sql.DB
+	adapter   Adapter
+	ownTx     bool                 // true if `db` is not the migrated database, so `Record` cannot use its tx
+	schema    *string              // nil means the schema given to each call, see WithVersionsSchema
+	namespace *string              // nil means versions of every namespace, see WithNamespace
+	trace     func(...interface{}) // logs each statement with its arguments, see WithVerbose; nil means not logged
+
+	mu      sync.Mutex
+	created map[string]bool // schemas whose tables are known to exist, so they are not created again
+}
+
+// execer is a database or transaction that executes statements
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// exec executes bookkeeping `query` on `e`, logged with `args` in verbose mode
+func (s *sqlStore) exec(ctx context.Context, e execer, query string, args ...interface{}) (sql.Result, error) {
+	s.traceSQL(query, args)
+	return e.ExecContext(ctx, query, args...)
+}
+
+// queryContext selects bookkeeping `query` from the database of the store, logged with `args` in verbose mode
+func (s *sqlStore) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	s.traceSQL(query, args)
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+// traceSQL logs `query` with `args`, as they differ by adapter, schema and namespace, see WithVerbose
+func (s *sqlStore) traceSQL(query string, args []interface{}) {
+	if s.trace == nil {
+		return
+	}
+	if len(args) == 0 {
+		s.trace("[bookkeeping]", query)
+		return
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			values[i] = strconv.Quote(v)
+		case time.Time:
+			values[i] = v.Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	s.trace("[bookkeeping]", query, "with", strings.Join(values, ", "))
+}
+
+// NewSQLVersionStore returns a VersionStore keeping versions in `db` instead of the migrated
+// database, e.g. a central postgres. `driverName` picks the sql statements to use
+func NewSQLVersionStore(db *sql.DB, driverName string) (VersionStore, error) {
+	adapter, err := AdapterFor(driverName)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{db: db, adapter: adapter, ownTx: true}, nil
+}
+
+// keptElsewhere returns true if `store` records versions outside the migrated database, so
+// they cannot be rolled back together with its files
+func keptElsewhere(store VersionStore) bool {
+	if namespaced, ok := store.(namespacedStore); ok {
+		store = namespaced.VersionStore
+	}
+	s, ok := store.(*sqlStore)
+	return ok && s.ownTx
+}
+
+// useVersionsSchema points the version store at WithVersionsSchema
+func (c *Config) useVersionsSchema() error {
+	if err := ValidateIdentifier(c.versionsSchema); err != nil {
+		return errors.Wrapf(err, "invalid versions schema")
+	}
+	store, ok := c.store.(*sqlStore)
+	if !ok {
+		return errors.Errorf("version store does not support a versions schema")
+	}
+	if store.adapter.CreateSchemaQuery == nil {
+		return errors.Errorf("%q does not support a versions schema", c.driverName)
+	}
+	store.schema = &c.versionsSchema
+	return nil
+}
+
+// schemaOf returns the schema of the versions tables when `schema` is given to a call
+func (s *sqlStore) schemaOf(schema *string) *string {
+	if s.schema != nil {
+		return s.schema
+	}
+	return schema
+}
+
+func (s *sqlStore) AppliedVersions(ctx context.Context, schema *string) ([]string, error) {
+	schema = s.schemaOf(schema)
+	errctx := s.createTables(ctx, schema)
+	rows, err := s.query(ctx, schema, s.adapter.SelectExistingVersions, s.adapter.SelectNamespaceVersions)
+	if err != nil {
+		if errctx != nil {
+			err = errors.Wrap(err, errctx.Error())
+		}
+		return nil, s.versionsTableError(ctx, schema, err)
+	}
+	defer rows.Close()
+	s.tablesCreated(schema)
+
+	result := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// createTables makes a best effort to create the schema and tables of the store, unless they
+// are known to exist; the error creating the versions table explains a failing select after it
+func (s *sqlStore) createTables(ctx context.Context, schema *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created[fqName(schema, "dbmigrate_versions")] {
+		return nil
+	}
+	if s.schema != nil {
+		s.exec(ctx, s.db, s.adapter.CreateSchemaQuery(*s.schema))
+	}
+	_, errctx := s.exec(ctx, s.db, s.adapter.CreateVersionsTable(schema))
+	if s.adapter.CreateHistoryTable != nil {
+		s.exec(ctx, s.db, s.adapter.CreateHistoryTable(schema))
+	}
+	if s.adapter.CreateRunsTable != nil {
+		s.exec(ctx, s.db, s.adapter.CreateRunsTable(schema))
+	}
+	return errctx
+}
+
+// tablesCreated skips createTables of `schema` from now on, after selecting from its versions table
+func (s *sqlStore) tablesCreated(schema *string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created == nil {
+		s.created = map[string]bool{}
+	}
+	s.created[fqName(schema, "dbmigrate_versions")] = true
+}
+
+func (s *sqlStore) Record(ctx context.Context, tx ExecCommitRollbacker, schema *string, entry HistoryEntry) (err error) {
+	schema = s.schemaOf(schema)
+	if s.ownTx {
+		if tx, err = s.adapter.BeginTx(ctx, s.db, &sql.TxOptions{}); err != nil {
+			return errors.Wrapf(err, "unable to create transaction")
+		}
+		defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
+	}
+
+	insertVersion, deleteVersion, insertHistory, args := s.adapter.InsertNewVersion, s.adapter.DeleteOldVersion, s.adapter.InsertHistory, []interface{}{}
+	if s.namespace != nil {
+		insertVersion, deleteVersion, insertHistory, args = s.adapter.InsertNamespaceVersion, s.adapter.DeleteNamespaceVersion, s.adapter.InsertNamespaceHistory, []interface{}{*s.namespace}
+	}
+
+	switch entry.Direction {
+	case directionUp:
+		if _, err := s.exec(ctx, tx, insertVersion(schema), append(args, entry.Version)...); err != nil {
+			return s.versionsTableError(ctx, schema, errors.Wrapf(err, "fail to register version %q", entry.Version))
+		}
+	case directionDown:
+		if _, err := s.exec(ctx, tx, deleteVersion(schema), append(args, entry.Version)...); err != nil {
+			return s.versionsTableError(ctx, schema, errors.Wrapf(err, "fail to unregister version %q", entry.Version))
+		}
+	}
+
+	if s.adapter.InsertHistory != nil {
+		if _, err := s.exec(ctx, tx, insertHistory(schema), append(args,
+			entry.Version,
+			entry.Direction,
+			entry.AppliedAt,
+			entry.Duration.Milliseconds(),
+			entry.Checksum,
+			entry.AppliedBy,
+			entry.Remark,
+			entry.RunID,
+		)...); err != nil {
+			return errors.Wrapf(err, "fail to record history of version %q", entry.Version)
+		}
+	}
+
+	if s.ownTx {
+		return commit(tx)
+	}
+	return nil
+}
+
+// query selects rows of `namespaced` query for the namespace of the store, adding the namespace
+// column on first use, or rows of `query` if the store has no namespace
+func (s *sqlStore) query(ctx context.Context, schema *string, query func(*string) string, namespaced func(*string) string) (*sql.Rows, error) {
+	if s.namespace == nil {
+		return s.queryContext(ctx, query(schema))
+	}
+	rows, err := s.queryContext(ctx, namespaced(schema), *s.namespace)
+	if err == nil {
+		return rows, nil
+	}
+	if adderr := s.addNamespaceColumn(ctx, schema); adderr != nil {
+		return nil, errors.Wrap(err, adderr.Error())
+	}
+	return s.queryContext(ctx, namespaced(schema), *s.namespace)
+}
+
+// addNamespaceColumn alters the versions and history tables of an older release, or of a store without namespace
+func (s *sqlStore) addNamespaceColumn(ctx context.Context, schema *string) error {
+	tx, err := s.adapter.BeginTx(ctx, s.db, &sql.TxOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to create transaction")
+	}
+	defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
+	for _, stmt := range s.adapter.AddNamespaceColumn(schema) {
+		if _, err := s.exec(ctx, tx, stmt); err != nil {
+			return errors.Wrapf(err, "unable to add namespace column")
+		}
+	}
+	return commit(tx)
+}
+
+// History includes applied versions without any history, e.g. applied by an older
+// dbmigrate, with a "no history" remark
+func (s *sqlStore) History(ctx context.Context, schema *string) ([]HistoryEntry, error) {
+	versions, err := s.AppliedVersions(ctx, schema) // also creates the tables
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	if s.adapter.SelectHistory == nil {
+		return nil, errors.Errorf("database does not support history")
+	}
+	schema = s.schemaOf(schema)
+
+	rows, err := s.query(ctx, schema, s.adapter.SelectHistory, s.adapter.SelectNamespaceHistory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []HistoryEntry{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var appliedAt interface{}
+		var durationMS int64
+		if err := rows.Scan(&entry.Version, &entry.Direction, &appliedAt, &durationMS, &entry.Checksum, &entry.AppliedBy, &entry.Remark, &entry.RunID); err != nil {
+			return nil, err
+		}
+		if entry.AppliedAt, err = parseTimestamp(appliedAt); err != nil {
+			return nil, errors.Wrapf(err, "version %q", entry.Version)
+		}
+		entry.Version = strings.TrimSpace(entry.Version)
+		entry.Duration = time.Duration(durationMS) * time.Millisecond
+		seen[entry.Version] = true
+		result = append(result, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []HistoryEntry
+	for _, version := range versions {
+		if version = strings.TrimSpace(version); !seen[version] {
+			missing = append(missing, HistoryEntry{Version: version, Direction: directionUp, Remark: "no history"})
+		}
+	}
+	return append(missing, result...), nil
+}
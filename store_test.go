@@ -0,0 +1,219 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	versions []string
+	entries  []HistoryEntry
+	err      error // returned by AppliedVersions, if set
+}
+
+func (f *fakeStore) AppliedVersions(_ context.Context, _ *string) ([]string, error) {
+	return f.versions, f.err
+}
+
+func (f *fakeStore) Record(_ context.Context, _ ExecCommitRollbacker, _ *string, entry HistoryEntry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeStore) History(_ context.Context, _ *string) ([]HistoryEntry, error) {
+	return f.entries, nil
+}
+
+func TestConfigVersionStore(t *testing.T) {
+	store := &fakeStore{versions: []string{"20181222073900  ", "20181222073750"}}
+	c := &Config{}
+	WithVersionStore(store)(c)
+
+	versions, err := c.AppliedVersions(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20181222073750", "20181222073900"}, versions)
+
+	pending, err := c.PendingVersions(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, pending)
+
+	store.entries = []HistoryEntry{{Version: "20181222073750", Direction: "up"}}
+	history, err := c.History(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, store.entries, history)
+}
+
+// recordingTx keeps the queries executed through it
+type recordingTx struct {
+	noTx
+	queries []string
+}
+
+func (tx *recordingTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tx.queries = append(tx.queries, query)
+	return tx.noTx.ExecContext(ctx, query, args...)
+}
+
+func TestWithVersionsSchema(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	testCases := []struct {
+		name          string
+		driverName    string
+		store         VersionStore
+		schema        string
+		expectedError string
+	}{
+		{
+			name:       fileline(),
+			driverName: "postgres",
+			store:      &sqlStore{db: db, adapter: adapters["postgres"]},
+			schema:     "ops",
+		},
+		{
+			name:          fileline(),
+			driverName:    "postgres",
+			store:         &sqlStore{db: db, adapter: adapters["postgres"]},
+			schema:        "ops; DROP SCHEMA app",
+			expectedError: `invalid versions schema: identifier "ops; DROP SCHEMA app" has unexpected character ';' at position 4`,
+		},
+		{
+			name:          fileline(),
+			driverName:    "mysql",
+			store:         &sqlStore{db: db, adapter: adapters["mysql"]},
+			schema:        "ops",
+			expectedError: `"mysql" does not support a versions schema`,
+		},
+		{
+			name:          fileline(),
+			driverName:    "postgres",
+			store:         &fakeStore{},
+			schema:        "ops",
+			expectedError: `version store does not support a versions schema`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{driverName: tc.driverName, store: tc.store}
+			WithVersionsSchema(tc.schema)(c)
+			err := c.useVersionsSchema()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			app := "app"
+			tx := &recordingTx{noTx: noTx{db: db}}
+			assert.NoError(t, c.store.Record(context.Background(), tx, &app, HistoryEntry{Version: "20181222073750", Direction: directionUp}))
+			assert.Equal(t, []string{
+				`INSERT INTO "ops".dbmigrate_versions (version) VALUES ($1)`,
+				`INSERT INTO "ops".dbmigrate_history (` + historyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			}, tx.queries)
+		})
+	}
+}
+
+func TestSQLStoreTrace(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	var logs []string
+	namespace := "billing"
+	store := &sqlStore{db: db, adapter: adapters["postgres"], namespace: &namespace, trace: func(args ...interface{}) {
+		logs = append(logs, strings.TrimSpace(fmt.Sprintln(args...)))
+	}}
+	schema := "app"
+	assert.NoError(t, store.Record(context.Background(), &recordingTx{noTx: noTx{db: db}}, &schema, HistoryEntry{
+		Version:   "20181222073750",
+		Direction: directionDown,
+		AppliedAt: time.Date(2018, 12, 22, 7, 37, 50, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		RunID:     "20181222073750-0a1b2c3d",
+	}))
+	assert.Equal(t, []string{
+		`[bookkeeping] DELETE FROM "app".dbmigrate_versions WHERE namespace = $1 AND version = $2 with "billing", "20181222073750"`,
+		`[bookkeeping] INSERT INTO "app".dbmigrate_history (namespace, version, direction, applied_at, duration_ms, checksum, applied_by, remark, run_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)` +
+			` with "billing", "20181222073750", "down", 2018-12-22T07:37:50Z, 1500, "", "", "", "20181222073750-0a1b2c3d"`,
+	}, logs)
+}
+
+func TestSQLStoreCreatesTablesOnce(t *testing.T) {
+	db, fake := openFakeDB(t, nil)
+
+	store := &sqlStore{db: db, adapter: adapters["mysql"]}
+	for i := 0; i < 3; i++ {
+		_, err := store.AppliedVersions(context.Background(), nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		adapters["mysql"].CreateVersionsTable(nil),
+		adapters["mysql"].CreateHistoryTable(nil),
+		adapters["mysql"].CreateRunsTable(nil),
+		adapters["mysql"].SelectExistingVersions(nil),
+		adapters["mysql"].SelectExistingVersions(nil),
+		adapters["mysql"].SelectExistingVersions(nil),
+	}, fake.executed())
+}
+
+func TestVersionsKeptElsewhere(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073900_b.up.sql": &fstest.MapFile{Data: []byte("SELECT fail;")},
+	}
+	testCases := []struct {
+		name          string
+		mode          DbTxnMode
+		expectedError string
+		recorded      int
+	}{
+		{
+			name:          fileline(),
+			mode:          DbTxnModeAll,
+			expectedError: "versions kept in another database are recorded as each file runs and cannot be rolled back with the files; use transaction mode per-file",
+		},
+		{
+			name:          fileline(),
+			mode:          DbTxnModePerFile,
+			expectedError: "20181222073900_b.up.sql: fail",
+			recorded:      1,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, func(_ int, query string, _ []driver.Value) (*fakeRows, error) {
+				if strings.Contains(query, "fail") {
+					return nil, errors.New("fail")
+				}
+				return nil, nil
+			})
+			versionsDB, versions := openFakeDB(t, nil)
+			store, err := NewSQLVersionStore(versionsDB, "postgres")
+			assert.NoError(t, err)
+
+			c := &Config{dir: dir, db: db, adapter: adapters["postgres"], store: store, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"}
+			err = c.Up(context.Background(), MigrateOptions{Mode: tc.mode, NoLock: true})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+
+			var recorded int
+			for _, statement := range versions.executed() {
+				if strings.HasPrefix(statement, "INSERT INTO dbmigrate_versions") {
+					recorded++
+				}
+			}
+			assert.Equal(t, tc.recorded, recorded)
+		})
+	}
+}
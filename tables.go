@@ -0,0 +1,156 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const tableName = `[\w."$]+`
+
+// tableStatements match normalized statements, capturing a table name, or a comma separated list of them
+var tableStatements = []*regexp.Regexp{
+	regexp.MustCompile(`^CREATE (?:(?:GLOBAL |LOCAL )?(?:TEMPORARY |TEMP )|UNLOGGED )?TABLE (?:IF NOT EXISTS )?(` + tableName + `)`),
+	regexp.MustCompile(`^ALTER TABLE (?:IF EXISTS )?(?:ONLY )?(` + tableName + `)`),
+	regexp.MustCompile(`^DROP TABLE (?:IF EXISTS )?(` + tableName + `(?:, ?` + tableName + `)*)`),
+	regexp.MustCompile(`^TRUNCATE (?:TABLE )?(?:ONLY )?(` + tableName + `(?:, ?` + tableName + `)*)`),
+	regexp.MustCompile(`^LOCK (?:TABLE )?(?:ONLY )?(` + tableName + `(?:, ?` + tableName + `)*)`),
+	regexp.MustCompile(`^(?:INSERT|REPLACE) (?:IGNORE )?INTO (` + tableName + `)`),
+	regexp.MustCompile(`^UPDATE (?:ONLY )?(` + tableName + `)`),
+	regexp.MustCompile(`^DELETE FROM (?:ONLY )?(` + tableName + `)`),
+	regexp.MustCompile(`^CREATE (?:UNIQUE )?INDEX .*? ON (?:ONLY )?(` + tableName + `)`),
+	regexp.MustCompile(`^CREATE (?:OR REPLACE )?TRIGGER .*? ON (` + tableName + `)`),
+	regexp.MustCompile(`^CREATE (?:OR REPLACE )?(?:MATERIALIZED )?VIEW (?:IF NOT EXISTS )?(` + tableName + `)`),
+	regexp.MustCompile(`^DROP (?:MATERIALIZED )?VIEW (?:IF EXISTS )?(` + tableName + `(?:, ?` + tableName + `)*)`),
+	regexp.MustCompile(`^(?:CREATE|ALTER|DROP) SEQUENCE (?:IF (?:NOT )?EXISTS )?(` + tableName + `)`),
+	regexp.MustCompile(`^(?:VACUUM(?: FULL)?|ANALYZE|CLUSTER|REINDEX TABLE(?: CONCURRENTLY)?) (` + tableName + `)`),
+}
+
+var (
+	// tableReferences match tables read or renamed by a statement, anywhere in it
+	tableReferences = regexp.MustCompile(`\b(?:FROM|JOIN|REFERENCES|RENAME TO) (` + tableName + `)`)
+	renameTable     = regexp.MustCompile(`^RENAME TABLE `)
+	// tablelessStatement matches statements that change no table, e.g. session settings
+	tablelessStatement = regexp.MustCompile(`^(SET|RESET|BEGIN|COMMIT|START TRANSACTION|SELECT)\b`)
+)
+
+// statementTables returns the tables, in lowercase without quotes, that a normalized statement
+// changes or reads, and false if the statement is not understood
+func statementTables(stmt string) ([]string, bool) {
+	var names []string
+	for _, re := range tableStatements {
+		if m := re.FindStringSubmatch(stmt); m != nil {
+			names = append(names, strings.Split(m[1], ",")...)
+			break
+		}
+	}
+	if names == nil && !renameTable.MatchString(stmt) && !tablelessStatement.MatchString(stmt) {
+		return nil, false
+	}
+	for _, m := range tableReferences.FindAllStringSubmatch(stmt, -1) {
+		names = append(names, m[1])
+	}
+	if renameTable.MatchString(stmt) {
+		for _, pair := range strings.Split(strings.TrimPrefix(stmt, "RENAME TABLE "), ",") {
+			if fields := strings.Fields(pair); len(fields) == 3 && fields[1] == "TO" {
+				names = append(names, fields[0], fields[2])
+			}
+		}
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), `"`, "")))
+	}
+	return result, true
+}
+
+// fileTables returns the tables, sorted, that file `filename` changes or reads, as declared by
+// `-- dbmigrate:tables <table>, ...` or else parsed from its statements. Also returns the
+// 1-based position of the first statement not understood, or 0
+func (c *Config) fileTables(filename string) ([]string, int, error) {
+	filecontent, err := c.fileContent(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	var names []string
+	unknown := 0
+	if value, ok := parseDirectives(filecontent)["tables"]; ok {
+		for _, name := range strings.Split(value, ",") {
+			names = append(names, strings.ToLower(strings.TrimSpace(name)))
+		}
+	} else {
+		for i, stmt := range splitStatements(string(filecontent)) {
+			if isBlankStatement(stmt) {
+				continue
+			}
+			tables, ok := statementTables(normalizeStatement(stmt))
+			if !ok && unknown == 0 {
+				unknown = i + 1
+			}
+			names = append(names, tables...)
+		}
+	}
+	return sortedUnique(names), unknown, nil
+}
+
+func sortedUnique(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// tableLockName is the advisory lock of `table` taken by WithTableLocks
+func tableLockName(table string) string {
+	return MigrationLockName + ":" + table
+}
+
+// tableLockNames returns the advisory locks, sorted so processes never wait on each other in a
+// cycle, of the tables that `filenames` change or read
+func (c *Config) tableLockNames(filenames []string) ([]string, error) {
+	var names []string
+	for _, currName := range filenames {
+		tables, unknown, err := c.fileTables(currName)
+		if err != nil {
+			return nil, err
+		}
+		if unknown > 0 {
+			return nil, errors.Errorf("%s: statement #%d: unable to tell which tables it affects, for table locks; declare them with `%stables <table>, ...`", currName, unknown, directivePrefix)
+		}
+		for _, table := range tables {
+			names = append(names, tableLockName(table))
+		}
+	}
+	return sortedUnique(names), nil
+}
+
+// filesToLock returns the files that Up or Down may apply, queried before the lock is held: pending
+// `up.sql` files, or `down.sql` files of applied versions
+func (c *Config) filesToLock(ctx context.Context, schema *string, direction string) ([]string, error) {
+	migratedVersions, err := c.existingVersions(ctx, schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query existing versions")
+	}
+	if direction == directionUp {
+		return c.pendingFiles(migratedVersions), nil
+	}
+	var result []string
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, ".down.sql") {
+			continue
+		}
+		if _, found := migratedVersions.Find(c.versionOf(currName)); found {
+			result = append(result, currName)
+		}
+	}
+	return result, nil
+}
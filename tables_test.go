@@ -0,0 +1,100 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementTables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stmt     string
+		expected []string
+		unknown  bool
+	}{
+		{name: fileline(), stmt: `CREATE TABLE IF NOT EXISTS users (id int, org_id int REFERENCES orgs(id))`, expected: []string{"users", "orgs"}},
+		{name: fileline(), stmt: `ALTER TABLE ONLY public."Users" ADD COLUMN age int`, expected: []string{"public.users"}},
+		{name: fileline(), stmt: `ALTER TABLE users RENAME TO members`, expected: []string{"users", "members"}},
+		{name: fileline(), stmt: `DROP TABLE IF EXISTS a, b CASCADE`, expected: []string{"a", "b"}},
+		{name: fileline(), stmt: `TRUNCATE carts`, expected: []string{"carts"}},
+		{name: fileline(), stmt: `INSERT INTO archive (id) SELECT id FROM orders o JOIN users u ON u.id = o.user_id`, expected: []string{"archive", "orders", "users"}},
+		{name: fileline(), stmt: `UPDATE orders SET total = 0 FROM items WHERE items.order_id = orders.id`, expected: []string{"orders", "items"}},
+		{name: fileline(), stmt: `DELETE FROM sessions WHERE expired`, expected: []string{"sessions", "sessions"}},
+		{name: fileline(), stmt: `CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx ON users (email)`, expected: []string{"users"}},
+		{name: fileline(), stmt: "RENAME TABLE a TO b, c TO d", expected: []string{"a", "b", "c", "d"}},
+		{name: fileline(), stmt: `CREATE VIEW active AS SELECT * FROM users`, expected: []string{"active", "users"}},
+		{name: fileline(), stmt: `SET search_path TO app`, expected: nil},
+		{name: fileline(), stmt: `SELECT 1`, expected: nil},
+		{name: fileline(), stmt: `CREATE EXTENSION pgcrypto`, unknown: true},
+		{name: fileline(), stmt: `CREATE FUNCTION f() RETURNS int AS $$ SELECT 1 $$ LANGUAGE sql`, unknown: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tables, ok := statementTables(normalizeStatement(tc.stmt))
+			assert.Equal(t, !tc.unknown, ok)
+			if !tc.unknown {
+				assert.ElementsMatch(t, tc.expected, tables)
+			}
+		})
+	}
+}
+
+func TestFileTables(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql": {Data: []byte("CREATE TABLE users (id int);\nCREATE TABLE orders (user_id int REFERENCES users);")},
+		"20181222073751_b.up.sql": {Data: []byte("CREATE EXTENSION pgcrypto;\nALTER TABLE users ADD token text;")},
+		"20181222073752_c.up.sql": {Data: []byte("-- dbmigrate:tables users, Tokens\nCREATE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql;")},
+	}
+	c := &Config{dir: dir}
+
+	tables, unparsed, err := c.fileTables("20181222073750_a.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders", "users"}, tables)
+	assert.Equal(t, 0, unparsed)
+
+	tables, unparsed, err = c.fileTables("20181222073751_b.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users"}, tables)
+	assert.Equal(t, 1, unparsed)
+
+	tables, unparsed, err = c.fileTables("20181222073752_c.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tokens", "users"}, tables)
+	assert.Equal(t, 0, unparsed)
+
+	names, err := c.tableLockNames([]string{"20181222073750_a.up.sql", "20181222073752_c.up.sql"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dbmigrate:orders", "dbmigrate:tokens", "dbmigrate:users"}, names)
+
+	_, err = c.tableLockNames([]string{"20181222073751_b.up.sql"})
+	assert.EqualError(t, err, "20181222073751_b.up.sql: statement #1: unable to tell which tables it affects, for table locks; declare them with `-- dbmigrate:tables <table>, ...`")
+}
+
+func TestWithTableLocks(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   {Data: []byte("CREATE TABLE users (id int);")},
+		"20181222073750_a.down.sql": {Data: []byte("DROP TABLE users;")},
+		"20181222073751_b.up.sql":   {Data: []byte("CREATE TABLE orders (id int);")},
+		"20181222073751_b.down.sql": {Data: []byte("DROP TABLE orders;")},
+	}
+	provider := &recordingLockProvider{}
+	c := &Config{dir: dir, db: db, migrationLock: true, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	for name := range dir {
+		c.migrationFiles = append(c.migrationFiles, name)
+	}
+	WithVersionStore(&fakeRunStore{})(c)
+	WithLockProvider(provider)(c)
+	WithTableLocks()(c)
+
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone, Target: "20181222073750"}))
+	assert.Equal(t, []string{"lock dbmigrate:orders", "lock dbmigrate:users", "unlock dbmigrate:users", "unlock dbmigrate:orders"}, provider.calls)
+
+	provider.calls = nil
+	assert.NoError(t, c.Down(context.Background(), MigrateOptions{Mode: DbTxnModeNone, Steps: 1}))
+	assert.Equal(t, []string{"lock dbmigrate:users", "unlock dbmigrate:users"}, provider.calls)
+}
@@ -0,0 +1,42 @@
+package dbmigrate
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pgTenantDatabaseURL connects to `databaseURL` with `tenant` schema as search_path
+func pgTenantDatabaseURL(databaseURL string, tenant string) (string, error) {
+	if err := ValidateIdentifier(tenant); err != nil {
+		return "", err
+	}
+	if strings.Contains(databaseURL, "://") {
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid postgres url")
+		}
+		q := u.Query()
+		q.Set("search_path", pgName(tenant))
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(pgName(tenant))
+	return strings.TrimSpace(databaseURL) + " search_path='" + escaped + "'", nil
+}
+
+// mysqlTenantDatabaseURL connects to `tenant` database instead of the one in `databaseURL`
+func mysqlTenantDatabaseURL(databaseURL string, tenant string) (string, error) {
+	if err := ValidateIdentifier(tenant); err != nil {
+		return "", err
+	}
+	paths := strings.Split(databaseURL, "/")
+	if len(paths) < 2 {
+		return "", errors.Errorf("invalid mysql dsn")
+	}
+	requestURI := strings.SplitN(paths[len(paths)-1], "?", 2)
+	requestURI[0] = tenant
+	paths[len(paths)-1] = strings.Join(requestURI, "?")
+	return strings.Join(paths, "/"), nil
+}
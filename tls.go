@@ -0,0 +1,46 @@
+package dbmigrate
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TLSOptions are files and names for a verified TLS connection with a client certificate
+type TLSOptions struct {
+	RootCert   string // CA certificate file verifying the server
+	Cert       string // client certificate file
+	Key        string // client private key file
+	ServerName string // name expected in the server certificate, if not the host name
+}
+
+// pgTLSDatabaseURL adds `tls` settings to `databaseURL` as libpq parameters
+func pgTLSDatabaseURL(databaseURL string, tls TLSOptions) (string, error) {
+	if tls.ServerName != "" {
+		return "", errors.Errorf("postgres verifies the server certificate against the host; connect by that name instead of -tls-server-name")
+	}
+	params := [][2]string{{"sslrootcert", tls.RootCert}, {"sslcert", tls.Cert}, {"sslkey", tls.Key}}
+	if strings.Contains(databaseURL, "://") {
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid postgres url")
+		}
+		q := u.Query()
+		for _, param := range params {
+			if param[1] != "" {
+				q.Set(param[0], param[1])
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	databaseURL = strings.TrimSpace(databaseURL)
+	for _, param := range params {
+		if param[1] != "" {
+			databaseURL += " " + param[0] + "='" + quote(param[1]) + "'"
+		}
+	}
+	return databaseURL, nil
+}
@@ -0,0 +1,49 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPgTLSDatabaseURL(t *testing.T) {
+	testCases := []struct {
+		name          string
+		databaseURL   string
+		given         TLSOptions
+		expected      string
+		expectedError string
+	}{
+		{
+			name:        fileline(),
+			databaseURL: "postgres://u:p@db:5432/app?sslmode=verify-full",
+			given:       TLSOptions{RootCert: "/certs/ca.pem", Cert: "/certs/client.pem", Key: "/certs/client.key"},
+			expected:    "postgres://u:p@db:5432/app?sslcert=%2Fcerts%2Fclient.pem&sslkey=%2Fcerts%2Fclient.key&sslmode=verify-full&sslrootcert=%2Fcerts%2Fca.pem",
+		},
+		{
+			name:        fileline(),
+			databaseURL: "host=db dbname=app sslmode=verify-ca ",
+			given:       TLSOptions{RootCert: "/certs/it's ca.pem"},
+			expected:    `host=db dbname=app sslmode=verify-ca sslrootcert='/certs/it\'s ca.pem'`,
+		},
+		{
+			name:          fileline(),
+			databaseURL:   "postgres://db/app",
+			given:         TLSOptions{ServerName: "db.internal"},
+			expectedError: "postgres verifies the server certificate against the host; connect by that name instead of -tls-server-name",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := pgTLSDatabaseURL(tc.databaseURL, tc.given)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
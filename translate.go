@@ -0,0 +1,86 @@
+package dbmigrate
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// a translation rewrites one portable sql construct into the syntax of a database
+type translation struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+var (
+	translateTextSizes = translation{regexp.MustCompile(`(?i)\b(TINY|MEDIUM|LONG)TEXT\b`), "TEXT"}
+	translateEngine    = translation{regexp.MustCompile(`(?i)\s*\bENGINE\s*=\s*\w+`), ""}
+	translateCharset   = translation{regexp.MustCompile(`(?i)\s*\b(DEFAULT )?CHARSET\s*=\s*\w+`), ""}
+	translateCasts     = translation{regexp.MustCompile(`::[a-zA-Z_]+(\[\])?`), ""}
+)
+
+// dialectTranslations are the rules of Translator for each database
+var dialectTranslations = map[string][]translation{
+	"postgres": {
+		{regexp.MustCompile(`(?i)\bINTEGER PRIMARY KEY AUTOINCREMENT\b`), "SERIAL PRIMARY KEY"},
+		{regexp.MustCompile(`(?i)\bBIGINT( NOT NULL)? AUTO_?INCREMENT\b`), "BIGSERIAL"},
+		{regexp.MustCompile(`(?i)\bINT(EGER)?( NOT NULL)? AUTO_?INCREMENT\b`), "SERIAL"},
+		{regexp.MustCompile(`(?i)\bDATETIME\b`), "TIMESTAMP"},
+		{regexp.MustCompile(`(?i)\bTINYINT\(1\)`), "BOOLEAN"},
+		{regexp.MustCompile(`(?i)\b(BOOLEAN( NOT NULL)?) DEFAULT 0\b`), "$1 DEFAULT FALSE"},
+		{regexp.MustCompile(`(?i)\b(BOOLEAN( NOT NULL)?) DEFAULT 1\b`), "$1 DEFAULT TRUE"},
+		{regexp.MustCompile("`"), `"`},
+		translateTextSizes,
+		translateEngine,
+		translateCharset,
+	},
+	"mysql": {
+		{regexp.MustCompile(`(?i)\bINTEGER PRIMARY KEY AUTOINCREMENT\b`), "INTEGER PRIMARY KEY AUTO_INCREMENT"},
+		{regexp.MustCompile(`(?i)\bBIGSERIAL\b`), "BIGINT AUTO_INCREMENT"},
+		{regexp.MustCompile(`(?i)\bSERIAL\b`), "INT AUTO_INCREMENT"},
+		{regexp.MustCompile(`(?i)\bTIMESTAMPTZ\b`), "TIMESTAMP"},
+		{regexp.MustCompile(`(?i)\bJSONB\b`), "JSON"},
+		translateCasts,
+	},
+	"sqlite3": {
+		{regexp.MustCompile(`(?i)\b(BIG|SMALL)?SERIAL\b`), "INTEGER"},
+		{regexp.MustCompile(`(?i)\s*\bAUTO_INCREMENT\b`), ""},
+		{regexp.MustCompile(`(?i)\bTIMESTAMPTZ\b`), "TIMESTAMP"},
+		{regexp.MustCompile(`(?i)\bTIMESTAMP WITH(OUT)? TIME ZONE\b`), "TIMESTAMP"},
+		{regexp.MustCompile(`(?i)\bJSONB?\b`), "TEXT"},
+		{regexp.MustCompile(`(?i)\bUUID\b`), "TEXT"},
+		{regexp.MustCompile(`(?i)\bNOW\(\)`), "CURRENT_TIMESTAMP"},
+		{regexp.MustCompile(`(?i)\bINDEX CONCURRENTLY\b`), "INDEX"},
+		translateTextSizes,
+		translateEngine,
+		translateCharset,
+		translateCasts,
+	},
+}
+
+// Translator returns a function rewriting common constructs of other databases, e.g. AUTO_INCREMENT
+// and SERIAL, into the syntax of `dialect`; for files with `-- dbmigrate:portable` directive.
+// Returns nil for unknown dialects
+func Translator(dialect string) func([]byte) []byte {
+	rules, ok := dialectTranslations[dialect]
+	if !ok {
+		return nil
+	}
+	return func(sqlText []byte) []byte {
+		for _, t := range rules {
+			sqlText = t.pattern.ReplaceAll(sqlText, []byte(t.replace))
+		}
+		return sqlText
+	}
+}
+
+// translate returns `filecontent` rewritten by the adapter if it has `-- dbmigrate:portable` directive
+func (c *Config) translate(filecontent []byte) ([]byte, error) {
+	if !parseDirectives(filecontent).has("portable") {
+		return filecontent, nil
+	}
+	if c.adapter.Translate == nil {
+		return nil, errors.Errorf("database does not support `portable` directive")
+	}
+	return c.adapter.Translate(filecontent), nil
+}
@@ -0,0 +1,87 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslator(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  string
+		given    string
+		expected string
+	}{
+		{
+			name:     fileline(),
+			dialect:  "sqlite3",
+			given:    "CREATE TABLE users (id bigserial PRIMARY KEY, created_at timestamptz DEFAULT now(), data jsonb);",
+			expected: "CREATE TABLE users (id INTEGER PRIMARY KEY, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, data TEXT);",
+		},
+		{
+			name:     fileline(),
+			dialect:  "sqlite3",
+			given:    "CREATE TABLE users (id int NOT NULL AUTO_INCREMENT PRIMARY KEY, bio longtext) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			expected: "CREATE TABLE users (id int NOT NULL PRIMARY KEY, bio TEXT);",
+		},
+		{
+			name:     fileline(),
+			dialect:  "sqlite3",
+			given:    "CREATE INDEX CONCURRENTLY idx ON users (email);\nUPDATE users SET name = 'x'::text;",
+			expected: "CREATE INDEX idx ON users (email);\nUPDATE users SET name = 'x';",
+		},
+		{
+			name:     fileline(),
+			dialect:  "sqlite3",
+			given:    "CREATE TABLE serials (serial_number text);",
+			expected: "CREATE TABLE serials (serial_number text);",
+		},
+		{
+			name:     fileline(),
+			dialect:  "postgres",
+			given:    "CREATE TABLE `users` (id INTEGER PRIMARY KEY AUTOINCREMENT, bio mediumtext, admin boolean NOT NULL DEFAULT 0, seen datetime);",
+			expected: `CREATE TABLE "users" (id SERIAL PRIMARY KEY, bio TEXT, admin boolean NOT NULL DEFAULT FALSE, seen TIMESTAMP);`,
+		},
+		{
+			name:     fileline(),
+			dialect:  "postgres",
+			given:    "CREATE TABLE users (id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY, active tinyint(1) DEFAULT 1) ENGINE=InnoDB;",
+			expected: "CREATE TABLE users (id BIGSERIAL PRIMARY KEY, active BOOLEAN DEFAULT TRUE);",
+		},
+		{
+			name:     fileline(),
+			dialect:  "mysql",
+			given:    "CREATE TABLE users (id serial PRIMARY KEY, created_at timestamptz, data jsonb, n int DEFAULT '1'::int);",
+			expected: "CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, created_at TIMESTAMP, data JSON, n int DEFAULT '1');",
+		},
+		{
+			name:     fileline(),
+			dialect:  "mysql",
+			given:    "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT);",
+			expected: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTO_INCREMENT);",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(Translator(tc.dialect)([]byte(tc.given))))
+		})
+	}
+	assert.Nil(t, Translator("unknown"))
+}
+
+func TestConfigTranslate(t *testing.T) {
+	c := &Config{adapter: Adapter{}}
+	actual, err := c.translate([]byte("CREATE TABLE a (id serial);"))
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE a (id serial);", string(actual))
+
+	_, err = c.translate([]byte("-- dbmigrate:portable\nCREATE TABLE a (id serial);"))
+	assert.EqualError(t, err, "database does not support `portable` directive")
+
+	c.adapter.Translate = Translator("sqlite3")
+	actual, err = c.translate([]byte("-- dbmigrate:portable\nCREATE TABLE a (id serial);"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-- dbmigrate:portable\nCREATE TABLE a (id INTEGER);", string(actual))
+}
@@ -0,0 +1,97 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DbTxnMode determines how migration files are grouped into database transactions
+type DbTxnMode int
+
+const (
+	// DbTxnModeAll runs all files in one transaction; any failure rolls back every file
+	DbTxnModeAll DbTxnMode = iota
+	// DbTxnModePerFile runs each file in its own transaction; files before a failure stay applied
+	DbTxnModePerFile
+	// DbTxnModeNone runs files without a transaction; for statements that cannot run inside one
+	DbTxnModeNone
+)
+
+var dbTxnModeNames = map[DbTxnMode]string{
+	DbTxnModeAll:     "all",
+	DbTxnModePerFile: "per-file",
+	DbTxnModeNone:    "none",
+}
+
+func (m DbTxnMode) String() string {
+	return dbTxnModeNames[m]
+}
+
+// ParseDbTxnMode returns the DbTxnMode named by `s`, i.e. `all`, `per-file` or `none`
+func ParseDbTxnMode(s string) (DbTxnMode, error) {
+	for mode, name := range dbTxnModeNames {
+		if strings.EqualFold(name, strings.TrimSpace(s)) {
+			return mode, nil
+		}
+	}
+	return DbTxnModeAll, errors.Errorf("unknown transaction mode %q; must be `all`, `per-file` or `none`", s)
+}
+
+// ParseIsolationLevel returns the sql.IsolationLevel named by `s`, e.g. `read-committed`
+// or `SERIALIZABLE`; empty string is sql.LevelDefault
+func ParseIsolationLevel(s string) (sql.IsolationLevel, error) {
+	normalized := strings.NewReplacer(" ", "-", "_", "-").Replace(strings.ToLower(strings.TrimSpace(s)))
+	if normalized == "" {
+		return sql.LevelDefault, nil
+	}
+	for level := sql.LevelDefault; level <= sql.LevelLinearizable; level++ {
+		if strings.ToLower(strings.ReplaceAll(level.String(), " ", "-")) == normalized {
+			return level, nil
+		}
+	}
+	return sql.LevelDefault, errors.Errorf("unknown transaction isolation level %q", s)
+}
+
+// noTx implements ExecCommitRollbacker for DbTxnModeNone
+type noTx struct {
+	db *sql.DB
+}
+
+func (tx *noTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.db.ExecContext(ctx, query, args...)
+}
+
+func (tx *noTx) Commit() error {
+	return nil
+}
+
+func (tx *noTx) Rollback() error {
+	return nil
+}
+
+func commit(tx ExecCommitRollbacker) error {
+	err := tx.Commit()
+	if err != nil && err.Error() == "pq: unexpected transaction status idle" {
+		return nil // ignore this error; already commited
+	}
+	return errors.Wrapf(err, "unable to commit transaction")
+}
+
+// checkLongTransaction logs, or fails with LongTransactionFail, when the DbTxnModeAll transaction has been open
+// for `elapsed` beyond the WithLongTransaction threshold; logs again each time another threshold passes
+func (c *Config) checkLongTransaction(elapsed time.Duration, remaining int, nextWarning *time.Duration) error {
+	if c.longTxn <= 0 || elapsed < *nextWarning || remaining == 0 {
+		return nil // after the last file, runFiles logs once it commits
+	}
+	if c.longTxnPolicy == LongTransactionFail {
+		return errors.Errorf("transaction open for %s, longer than %s, with %d file(s) remaining; try transaction mode %q",
+			elapsed.Round(time.Second), c.longTxn, remaining, DbTxnModePerFile)
+	}
+	c.logger("[long-txn] transaction open for", elapsed.Round(time.Second).String()+",", remaining, "file(s) remaining")
+	*nextWarning = (elapsed/c.longTxn + 1) * c.longTxn
+	return nil
+}
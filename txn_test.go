@@ -0,0 +1,164 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+	testCases := []struct {
+		given         string
+		expected      sql.IsolationLevel
+		expectedError string
+	}{
+		{given: "", expected: sql.LevelDefault},
+		{given: "read-committed", expected: sql.LevelReadCommitted},
+		{given: "READ COMMITTED", expected: sql.LevelReadCommitted},
+		{given: "repeatable_read", expected: sql.LevelRepeatableRead},
+		{given: "Serializable", expected: sql.LevelSerializable},
+		{given: "bogus", expectedError: `unknown transaction isolation level "bogus"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := ParseIsolationLevel(tc.given)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseDbTxnMode(t *testing.T) {
+	for _, mode := range []DbTxnMode{DbTxnModeAll, DbTxnModePerFile, DbTxnModeNone} {
+		actual, err := ParseDbTxnMode(mode.String())
+		assert.NoError(t, err)
+		assert.Equal(t, mode, actual)
+	}
+	_, err := ParseDbTxnMode("bogus")
+	assert.Error(t, err)
+}
+
+func TestCheckLongTransaction(t *testing.T) {
+	testCases := []struct {
+		name                string
+		policy              LongTransactionPolicy
+		elapsed             time.Duration
+		remaining           int
+		expectedLogs        []string
+		expectedNextWarning time.Duration
+		expectedError       string
+	}{
+		{
+			name:                fileline(),
+			elapsed:             30 * time.Minute,
+			remaining:           2,
+			expectedNextWarning: time.Hour,
+		},
+		{
+			name:                fileline(),
+			elapsed:             150 * time.Minute,
+			remaining:           2,
+			expectedLogs:        []string{"[long-txn] transaction open for 2h30m0s, 2 file(s) remaining"},
+			expectedNextWarning: 3 * time.Hour,
+		},
+		{
+			name:                fileline(),
+			policy:              LongTransactionFail,
+			elapsed:             90 * time.Minute,
+			remaining:           1,
+			expectedNextWarning: time.Hour,
+			expectedError:       `transaction open for 1h30m0s, longer than 1h0m0s, with 1 file(s) remaining; try transaction mode "per-file"`,
+		},
+		{
+			name:                fileline(),
+			policy:              LongTransactionFail,
+			elapsed:             90 * time.Minute,
+			remaining:           0,
+			expectedNextWarning: time.Hour,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs []string
+			c := &Config{
+				longTxn:       time.Hour,
+				longTxnPolicy: tc.policy,
+				logger:        func(args ...interface{}) { logs = append(logs, strings.TrimSuffix(fmt.Sprintln(args...), "\n")) },
+			}
+			nextWarning := c.longTxn
+			err := c.checkLongTransaction(tc.elapsed, tc.remaining, &nextWarning)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedLogs, logs)
+			assert.Equal(t, tc.expectedNextWarning, nextWarning)
+		})
+	}
+}
+
+func TestTxnIsolationDirective(t *testing.T) {
+	db, _ := openFakeDB(t, nil)
+
+	const filename = "20181222073750_a.up.sql"
+	testCases := []struct {
+		name          string
+		content       string
+		env           string
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			content:       "-- dbmigrate:txn-isolation serializable\nUPDATE a;",
+			expectedError: `20181222073750_a.up.sql: txn-isolation "serializable" requires transaction mode "per-file"`,
+		},
+		{
+			name:          fileline(),
+			content:       "-- dbmigrate:txn-isolation sometimes\nUPDATE a;",
+			expectedError: "20181222073750_a.up.sql: unknown transaction isolation level \"sometimes\"",
+		},
+		{
+			name:    fileline(),
+			content: "-- dbmigrate:txn-isolation serializable\n-- dbmigrate:only env=production\nUPDATE a;",
+			env:     "test",
+		},
+		{
+			name:          fileline(),
+			content:       "-- dbmigrate:txn-isolation serializable\n-- dbmigrate:only env=production\nUPDATE a;",
+			env:           "production",
+			expectedError: `20181222073750_a.up.sql: txn-isolation "serializable" requires transaction mode "per-file"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := fstest.MapFS{filename: &fstest.MapFile{Data: []byte(tc.content)}}
+			tx := &recordingTx{noTx: noTx{db: db}}
+			adapter := Adapter{BeginTx: func(context.Context, *sql.DB, *sql.TxOptions) (ExecCommitRollbacker, error) { return tx, nil }}
+			c := &Config{dir: dir, db: db, adapter: adapter, store: &fakeStore{}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+			c.migrationFiles = []string{filename}
+			WithEnv(tc.env, EnvSkipRecord)(c)
+
+			err := c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeAll})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Empty(t, tx.queries)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Verify runs each query in `sqlText`, failing if a query errors or if the first column of
+// its first row is `false` or `0`, e.g. `SELECT count(*) = 0 FROM users WHERE email IS NULL`.
+// A statement can also be an assertion, see parseAssertion, whose failure shows the actual value
+func (c *Config) Verify(ctx context.Context, sqlText string) error {
+	for i, stmt := range splitStatements(sqlText) {
+		if isBlankStatement(stmt) {
+			continue
+		}
+		a, ok, err := parseAssertion(stmt)
+		if err != nil {
+			return errors.Wrapf(err, "verify query #%d", i+1)
+		}
+		query := stmt
+		if ok {
+			query = a.query
+		}
+		value, err := c.firstValue(ctx, query)
+		if err != nil {
+			return errors.Wrapf(err, "verify query #%d", i+1)
+		}
+		if ok && a.operator != "" {
+			if !a.holds(value) {
+				return errors.Errorf("verify query #%d failed: (%s) is %s, expected %s %s", i+1, a.query, displayValue(value), a.operator, a.expected)
+			}
+			continue
+		}
+		if s := strings.ToLower(value); s == "false" || s == "f" || s == "0" {
+			return errors.Errorf("verify query #%d returned %s: %s", i+1, value, strings.TrimSpace(query))
+		}
+	}
+	return nil
+}
+
+// assertion is a statement of Verify like `ASSERT (SELECT count(*) FROM users WHERE email IS NULL) = 0`
+type assertion struct {
+	query    string
+	operator string // one of =, !=, <>, <, <=, >, >=; "" to check the value is not `false` or `0`
+	expected string // unquoted
+}
+
+var (
+	assertPrefix     = regexp.MustCompile(`(?is)^ASSERT\s*\(`)
+	assertComparison = regexp.MustCompile(`(?s)^(=|!=|<>|<=|>=|<|>)\s*('(?:[^']|'')*'|[^\s']+)$`)
+)
+
+// parseAssertion returns the assertion of `stmt`, written as `ASSERT (<query>)` or `ASSERT (<query>) <operator> <value>`,
+// where value is a number or a quoted string; false if `stmt` is not an assertion
+func parseAssertion(stmt string) (assertion, bool, error) {
+	stmt = strings.TrimSuffix(strings.TrimSpace(stripBlockComments(lintLineComments.ReplaceAllString(stmt, ""))), ";")
+	loc := assertPrefix.FindStringIndex(stmt)
+	if loc == nil {
+		return assertion{}, false, nil
+	}
+	depth, end := 0, -1
+	var quote byte
+	for i := loc[1] - 1; i < len(stmt) && end < 0; i++ {
+		switch ch := stmt[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth--; depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return assertion{}, false, errors.Errorf("unbalanced parentheses in %s", stmt)
+	}
+	a := assertion{query: strings.TrimSpace(stmt[loc[1]:end])}
+	rest := strings.TrimSpace(stmt[end+1:])
+	if rest == "" {
+		return a, true, nil
+	}
+	m := assertComparison.FindStringSubmatch(rest)
+	if m == nil {
+		return assertion{}, false, errors.Errorf("expected `= <value>` or another comparison after (%s), not %q", a.query, rest)
+	}
+	a.operator, a.expected = m[1], m[2]
+	if strings.HasPrefix(a.expected, "'") {
+		a.expected = strings.ReplaceAll(a.expected[1:len(a.expected)-1], "''", "'")
+	}
+	return a, true, nil
+}
+
+// holds returns true if `value` compares with the expected value by the operator, as numbers if both are
+func (a assertion) holds(value string) bool {
+	cmp := strings.Compare(value, a.expected)
+	if x, err := strconv.ParseFloat(value, 64); err == nil {
+		if y, err := strconv.ParseFloat(a.expected, 64); err == nil {
+			switch {
+			case x < y:
+				cmp = -1
+			case x > y:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch a.operator {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// displayValue returns `value` of firstValue for messages
+func displayValue(value string) string {
+	if value == "" {
+		return "NULL or no row"
+	}
+	return value
+}
+
+// firstValue returns the first column of the first row of `query` as a string; "" if no rows
+func (c *Config) firstValue(ctx context.Context, query string) (string, error) {
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	if err := rows.Scan(values...); err != nil {
+		return "", err
+	}
+	switch v := (*values[0].(*interface{})).(type) {
+	case []byte:
+		return string(v), nil
+	case nil:
+		return "", nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,121 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAssertion(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stmt        string
+		expected    assertion
+		expectedOK  bool
+		expectedErr string
+	}{
+		{
+			name: fileline(),
+			stmt: "SELECT count(*) = 0 FROM users",
+		},
+		{
+			name:       fileline(),
+			stmt:       "-- no orphans\nASSERT (SELECT count(*) FROM orders WHERE user_id IS NULL) = 0;",
+			expected:   assertion{query: "SELECT count(*) FROM orders WHERE user_id IS NULL", operator: "=", expected: "0"},
+			expectedOK: true,
+		},
+		{
+			name:       fileline(),
+			stmt:       "assert (SELECT status FROM jobs WHERE name = ')') <> 'it''s done'",
+			expected:   assertion{query: "SELECT status FROM jobs WHERE name = ')'", operator: "<>", expected: "it's done"},
+			expectedOK: true,
+		},
+		{
+			name:       fileline(),
+			stmt:       "ASSERT (SELECT count(*) FROM (SELECT 1) t) >= 1",
+			expected:   assertion{query: "SELECT count(*) FROM (SELECT 1) t", operator: ">=", expected: "1"},
+			expectedOK: true,
+		},
+		{
+			name:       fileline(),
+			stmt:       "ASSERT (SELECT bool_and(active) FROM users)",
+			expected:   assertion{query: "SELECT bool_and(active) FROM users"},
+			expectedOK: true,
+		},
+		{
+			name:        fileline(),
+			stmt:        "ASSERT (SELECT count(*) FROM users",
+			expectedErr: "unbalanced parentheses in ASSERT (SELECT count(*) FROM users",
+		},
+		{
+			name:        fileline(),
+			stmt:        "ASSERT (SELECT count(*) FROM users) is 0",
+			expectedErr: `expected ` + "`= <value>`" + ` or another comparison after (SELECT count(*) FROM users), not "is 0"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := parseAssertion(tc.stmt)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name        string
+		value       string // selected by every query, see fakeValuesDriver
+		sqlText     string
+		expectedErr string
+	}{
+		{
+			name:    fileline(),
+			value:   "3",
+			sqlText: "SELECT count(*) FROM users;\nASSERT (SELECT count(*) FROM users) = 3;\nASSERT (SELECT count(*) FROM users) > 2.5;",
+		},
+		{
+			name:        fileline(),
+			value:       "0",
+			sqlText:     "SELECT count(*) FROM users;",
+			expectedErr: "verify query #1 returned 0: SELECT count(*) FROM users;",
+		},
+		{
+			name:        fileline(),
+			value:       "3",
+			sqlText:     "SELECT 1;\nASSERT (SELECT count(*) FROM orders WHERE user_id IS NULL) = 0;",
+			expectedErr: "verify query #2 failed: (SELECT count(*) FROM orders WHERE user_id IS NULL) is 3, expected = 0",
+		},
+		{
+			name:        fileline(),
+			value:       "12",
+			sqlText:     "ASSERT (SELECT count(*) FROM users) < 9",
+			expectedErr: "verify query #1 failed: (SELECT count(*) FROM users) is 12, expected < 9",
+		},
+		{
+			name:        fileline(),
+			value:       "0",
+			sqlText:     "ASSERT (SELECT count(*) FROM users)",
+			expectedErr: "verify query #1 returned 0: SELECT count(*) FROM users",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, fakeValues(tc.value))
+
+			c := &Config{db: db}
+			err := c.Verify(context.Background(), tc.sqlText)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
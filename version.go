@@ -0,0 +1,132 @@
+package dbmigrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VersionLayout is the time layout of the version prefix of migration files, e.g. `20181222073750_create-users.up.sql`
+const VersionLayout = "20060102150405"
+
+// checkVersion returns an error if `version` is not a timestamp in VersionLayout, or does not match `pattern` if given
+func checkVersion(version string, pattern *regexp.Regexp) error {
+	if pattern != nil {
+		if !pattern.MatchString(version) {
+			return errors.Errorf("version %q does not match %s", version, pattern.String())
+		}
+		return nil
+	}
+	if len(version) != len(VersionLayout) {
+		return errors.Errorf("version %q is not a %d-digit timestamp", version, len(VersionLayout))
+	}
+	if _, err := time.Parse(VersionLayout, version); err != nil {
+		return errors.Errorf("version %q is not a %d-digit timestamp", version, len(VersionLayout))
+	}
+	return nil
+}
+
+// versionOf returns the version prefix of migration file `currName`, e.g. `20181222073750` of
+// `20181222073750_create-users.up.sql`. With WithVersionPattern, a version may contain underscores,
+// so it is the shortest prefix before an underscore that matches the pattern
+func (c *Config) versionOf(currName string) string {
+	parts := strings.Split(currName, "_")
+	if c.versionPattern != nil {
+		for i := 1; i < len(parts); i++ {
+			if prefix := strings.Join(parts[:i], "_"); c.versionPattern.MatchString(prefix) {
+				return prefix
+			}
+		}
+	}
+	return parts[0]
+}
+
+// checkVersions returns an error listing `.sql` files in `dir` with an invalid version prefix
+func (c *Config) checkVersions() error {
+	var invalid []string
+	for _, currName := range c.migrationFiles {
+		if !strings.HasSuffix(currName, ".sql") {
+			continue
+		}
+		if err := checkVersion(c.versionOf(currName), c.versionPattern); err != nil {
+			invalid = append(invalid, currName+": "+err.Error())
+		}
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid migration file name(s):\n%s", strings.Join(invalid, "\n"))
+	}
+	return nil
+}
+
+// withoutNewerFiles returns `filenames` without those of a version after WithMaxVersion
+func (c *Config) withoutNewerFiles(filenames []string) []string {
+	if c.maxVersion == "" {
+		return filenames
+	}
+	var result, newer []string
+	for _, currName := range filenames {
+		if c.versionOf(currName) > c.maxVersion {
+			newer = append(newer, currName)
+			continue
+		}
+		result = append(result, currName)
+	}
+	if len(newer) > 0 {
+		c.logger("[max-version] ignoring", len(newer), "file(s) after version", c.maxVersion+", e.g.", newer[0])
+	}
+	return result
+}
+
+// WidenVersionColumns alters the `version` column of `dbmigrate_versions` and `dbmigrate_history`
+// tables created by older releases as char(14), which truncate or pad other versions
+func (c *Config) WidenVersionColumns(ctx context.Context, schema *string) error {
+	base := c.store
+	if namespaced, ok := base.(namespacedStore); ok {
+		base = namespaced.VersionStore
+	}
+	store, ok := base.(*sqlStore)
+	if !ok {
+		return errors.Errorf("version store does not support widening version columns")
+	}
+	if store.adapter.WidenVersionColumn == nil {
+		return nil // column type does not truncate
+	}
+	tables := []string{"dbmigrate_versions"}
+	if store.adapter.CreateHistoryTable != nil {
+		tables = append(tables, "dbmigrate_history")
+	}
+	if _, err := store.AppliedVersions(ctx, schema); err != nil {
+		return err // ensure tables exist
+	}
+	for _, table := range tables {
+		if _, err := store.exec(ctx, store.db, store.adapter.WidenVersionColumn(store.schemaOf(schema), table)); err != nil {
+			return errors.Wrapf(err, "unable to widen %s.version", table)
+		}
+	}
+	return nil
+}
+
+// truncatedVersions returns applied versions that are not in `dir`, but are the prefix of a longer
+// version that is, e.g. a char(14) column truncated a version of another format
+func (c *Config) truncatedVersions(applied []string) []string {
+	known := map[string]bool{}
+	for _, currName := range c.migrationFiles {
+		known[c.versionOf(currName)] = true
+	}
+	var result []string
+	for _, version := range applied {
+		if known[version] {
+			continue
+		}
+		for v := range known {
+			if len(v) > len(version) && strings.HasPrefix(v, version) {
+				result = append(result, version)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckVersion(t *testing.T) {
+	testCases := []struct {
+		name          string
+		version       string
+		pattern       *regexp.Regexp
+		expectedError string
+	}{
+		{
+			name:    fileline(),
+			version: "20181222073750",
+		},
+		{
+			name:          fileline(),
+			version:       "2018122207375",
+			expectedError: `version "2018122207375" is not a 14-digit timestamp`,
+		},
+		{
+			name:          fileline(),
+			version:       "20181322073750",
+			expectedError: `version "20181322073750" is not a 14-digit timestamp`,
+		},
+		{
+			name:          fileline(),
+			version:       "2018-12-22-07",
+			expectedError: `version "2018-12-22-07" is not a 14-digit timestamp`,
+		},
+		{
+			name:    fileline(),
+			version: "0001",
+			pattern: regexp.MustCompile(`^\d{4}$`),
+		},
+		{
+			name:          fileline(),
+			version:       "20181222073750",
+			pattern:       regexp.MustCompile(`^\d{4}$`),
+			expectedError: `version "20181222073750" does not match ^\d{4}$`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkVersion(tc.version, tc.pattern)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	testCases := []struct {
+		name            string
+		filename        string
+		pattern         *regexp.Regexp
+		expectedVersion string
+	}{
+		{
+			name:            fileline(),
+			filename:        "20181222073750_create_users.up.sql",
+			expectedVersion: "20181222073750",
+		},
+		{
+			name:            fileline(),
+			filename:        "0001_create_users.up.sql",
+			pattern:         regexp.MustCompile(`^\d{4}$`),
+			expectedVersion: "0001",
+		},
+		{
+			name:            fileline(),
+			filename:        "1_2_create_users.up.sql",
+			pattern:         regexp.MustCompile(`^\d+_\d+$`),
+			expectedVersion: "1_2",
+		},
+		{
+			name:            fileline(),
+			filename:        "1_create_users.up.sql",
+			pattern:         regexp.MustCompile(`^\d+_\d+$`),
+			expectedVersion: "1",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{versionPattern: tc.pattern}
+			assert.Equal(t, tc.expectedVersion, c.versionOf(tc.filename))
+		})
+	}
+}
+
+func TestCheckVersions(t *testing.T) {
+	c := &Config{migrationFiles: []string{
+		"20181222073750_a.up.sql",
+		"20181222073750_a.down.sql",
+		"README.md",
+		"2018122207375_b.up.sql",
+	}}
+	assert.EqualError(t, c.checkVersions(), "invalid migration file name(s):\n2018122207375_b.up.sql: version \"2018122207375\" is not a 14-digit timestamp")
+
+	c.migrationFiles = c.migrationFiles[:3]
+	assert.NoError(t, c.checkVersions())
+}
+
+func TestWithMaxVersion(t *testing.T) {
+	dir := fstest.MapFS{
+		"20181222073750_a.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073750_a.down.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073900_b.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073901_c.up.sql":   &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}
+	var logs []string
+	c, err := New(dir, "dbmigrate-fake", "1", WithMaxVersion("20181222073900"), WithLogger(func(args ...interface{}) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(args...))) }))
+	assert.NoError(t, err)
+	defer c.CloseDB()
+	assert.Equal(t, []string{"20181222073750_a.down.sql", "20181222073750_a.up.sql", "20181222073900_b.up.sql"}, c.MigrationFiles())
+	assert.Equal(t, []string{"[max-version] ignoring 1 file(s) after version 20181222073900, e.g. 20181222073901_c.up.sql"}, logs)
+}
+
+func TestTruncatedVersions(t *testing.T) {
+	c := &Config{migrationFiles: []string{
+		"20181222073750_a.up.sql",
+		"2018122207390001_b.up.sql",
+	}}
+	assert.Equal(t, []string{"20181222073900"}, c.truncatedVersions([]string{"20181222073750", "20181222073900", "20170101000000"}))
+	assert.Nil(t, c.truncatedVersions([]string{"20181222073750", "2018122207390001"}))
+}
+
+func TestWidenVersionColumn(t *testing.T) {
+	schema := "app"
+	postgres, err := AdapterFor("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, `ALTER TABLE "app".dbmigrate_versions ALTER COLUMN version TYPE varchar(255)`, postgres.WidenVersionColumn(&schema, "dbmigrate_versions"))
+
+	mysql, err := AdapterFor("mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, `ALTER TABLE dbmigrate_history MODIFY version varchar(255) NOT NULL`, mysql.WidenVersionColumn(nil, "dbmigrate_history"))
+
+	c := &Config{store: &sqlStore{adapter: Adapter{}}}
+	assert.NoError(t, c.WidenVersionColumns(context.Background(), nil), "nothing to widen")
+
+	c = &Config{store: &fakeStore{}}
+	assert.EqualError(t, c.WidenVersionColumns(context.Background(), nil), "version store does not support widening version columns")
+}
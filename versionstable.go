@@ -0,0 +1,171 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VersionsTableError is returned when a statement on `dbmigrate_versions` fails because the table
+// exists with a definition dbmigrate cannot use, e.g. created by another tool or edited by hand
+type VersionsTableError struct {
+	Problems []string // e.g. `primary key is (version, app), expected (version)`
+	Err      error    // the failed statement
+}
+
+func (e *VersionsTableError) Error() string {
+	return fmt.Sprintf("dbmigrate_versions has an incompatible definition: %s; run `dbmigrate -upgrade-meta` to recreate it keeping its versions: %s",
+		strings.Join(e.Problems, "; "), e.Err.Error())
+}
+
+// Cause returns the failed statement, see errors.Cause
+func (e *VersionsTableError) Cause() error { return e.Err }
+
+// Unwrap returns the failed statement
+func (e *VersionsTableError) Unwrap() error { return e.Err }
+
+// versionsColumn is a column of `dbmigrate_versions` as selected by SelectVersionsColumns of adapters
+type versionsColumn struct {
+	name       string
+	columnType string
+	primaryKey bool
+	required   bool // NOT NULL without a default, so inserts of dbmigrate fail
+}
+
+var versionsColumnLength = regexp.MustCompile(`char[a-z ]*\((\d+)\)`)
+
+// versionsTableProblems returns what prevents dbmigrate from using `columns`, and whether they include
+// a `namespace` column; no problems if there are no columns, i.e. the table does not exist
+func versionsTableProblems(columns []versionsColumn) (problems []string, namespaced bool) {
+	if len(columns) == 0 {
+		return nil, false
+	}
+	var version *versionsColumn
+	var primaryKey []string
+	for i, col := range columns {
+		switch col.name {
+		case "version":
+			version = &columns[i]
+		case "namespace":
+			namespaced = true
+		default:
+			if col.required {
+				problems = append(problems, fmt.Sprintf("column %s is NOT NULL without a default", col.name))
+			}
+		}
+		if col.primaryKey {
+			primaryKey = append(primaryKey, col.name)
+		}
+	}
+	if version == nil {
+		return append(problems, "column version is missing"), namespaced
+	}
+	columnType := strings.ToLower(version.columnType)
+	if m := versionsColumnLength.FindStringSubmatch(columnType); m != nil {
+		if n, _ := strconv.Atoi(m[1]); n < len(VersionLayout) {
+			problems = append(problems, fmt.Sprintf("column version is %s, too short for %d-digit versions", version.columnType, len(VersionLayout)))
+		}
+	} else if !strings.Contains(columnType, "char") && !strings.Contains(columnType, "text") {
+		problems = append(problems, fmt.Sprintf("column version is %s, expected %s", version.columnType, versionColumnType))
+	}
+	expected := "(version)"
+	if namespaced {
+		expected = "(namespace, version)"
+	}
+	if len(primaryKey) == 0 {
+		problems = append(problems, "no primary key, expected "+expected)
+	} else if actual := "(" + strings.Join(primaryKey, ", ") + ")"; actual != expected && (!namespaced || actual != "(version, namespace)") {
+		problems = append(problems, "primary key is "+actual+", expected "+expected)
+	}
+	return problems, namespaced
+}
+
+// versionsColumns selects the columns of `dbmigrate_versions`; none if the adapter cannot tell
+func (s *sqlStore) versionsColumns(ctx context.Context, schema *string) ([]versionsColumn, error) {
+	if s.adapter.SelectVersionsColumns == nil {
+		return nil, nil
+	}
+	rows, err := s.queryContext(ctx, s.adapter.SelectVersionsColumns(schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []versionsColumn
+	for rows.Next() {
+		var col versionsColumn
+		var primaryKey, required interface{}
+		if err := rows.Scan(&col.name, &col.columnType, &primaryKey, &required); err != nil {
+			return nil, err
+		}
+		col.primaryKey, col.required = truthy(primaryKey), truthy(required)
+		result = append(result, col)
+	}
+	return result, rows.Err()
+}
+
+// versionsTableError returns a VersionsTableError if `err` of a statement on `dbmigrate_versions` is
+// explained by its definition, otherwise `err`
+func (s *sqlStore) versionsTableError(ctx context.Context, schema *string, err error) error {
+	columns, colerr := s.versionsColumns(ctx, schema)
+	if colerr != nil {
+		return err
+	}
+	if problems, _ := versionsTableProblems(columns); len(problems) > 0 {
+		return &VersionsTableError{Problems: problems, Err: err}
+	}
+	return err
+}
+
+// UpgradeVersionsTable recreates `dbmigrate_versions` if it has an incompatible definition, see
+// VersionsTableError, keeping its distinct versions; no-op if the table is usable
+func (c *Config) UpgradeVersionsTable(ctx context.Context, schema *string) error {
+	base := c.store
+	if namespaced, ok := base.(namespacedStore); ok {
+		base = namespaced.VersionStore
+	}
+	store, ok := base.(*sqlStore)
+	if !ok {
+		return errors.Errorf("version store does not support upgrading the versions table")
+	}
+	if store.adapter.SelectVersionsColumns == nil || store.adapter.RebuildVersionsTable == nil {
+		return errors.Errorf("%q does not support -upgrade-meta", c.driverName)
+	}
+	lock, err := c.lockMigrations(ctx, schema, directionUp)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	schema = store.schemaOf(schema)
+	columns, err := store.versionsColumns(ctx, schema)
+	if err != nil {
+		return errors.Wrapf(err, "unable to select columns of dbmigrate_versions")
+	}
+	problems, namespaced := versionsTableProblems(columns)
+	if len(problems) == 0 {
+		c.logger("[upgrade-meta] dbmigrate_versions is up to date")
+		return nil
+	}
+	for _, problem := range problems {
+		if problem == "column version is missing" {
+			return errors.Errorf("unable to upgrade dbmigrate_versions: %s", problem)
+		}
+	}
+	c.logger("[upgrade-meta] recreating dbmigrate_versions:", strings.Join(problems, "; "))
+	tx, err := store.adapter.BeginTx(ctx, store.db, &sql.TxOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to create transaction")
+	}
+	defer tx.Rollback() // ok to fail rollback if we did `tx.Commit`
+	for _, stmt := range store.adapter.RebuildVersionsTable(schema, namespaced) {
+		if _, err := store.exec(ctx, tx, stmt); err != nil {
+			return errors.Wrapf(err, "unable to upgrade dbmigrate_versions")
+		}
+	}
+	return commit(tx)
+}
@@ -0,0 +1,78 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionsTableProblems(t *testing.T) {
+	testCases := []struct {
+		name           string
+		columns        []versionsColumn
+		wantProblems   []string
+		wantNamespaced bool
+	}{
+		{
+			name:    fileline(),
+			columns: nil, // table does not exist
+		},
+		{
+			name:    fileline(),
+			columns: []versionsColumn{{name: "version", columnType: "character varying(255)", primaryKey: true, required: true}},
+		},
+		{
+			name:    fileline(),
+			columns: []versionsColumn{{name: "version", columnType: "character(14)", primaryKey: true, required: true}}, // older releases
+		},
+		{
+			name: fileline(),
+			columns: []versionsColumn{
+				{name: "version", columnType: "character varying(255)", primaryKey: true, required: true},
+				{name: "namespace", columnType: "character varying(255)", primaryKey: true},
+			},
+			wantNamespaced: true,
+		},
+		{
+			name: fileline(),
+			columns: []versionsColumn{
+				{name: "version", columnType: "bigint", primaryKey: true, required: true},
+				{name: "app", columnType: "text", primaryKey: true, required: true},
+				{name: "applied_at", columnType: "timestamp"},
+			},
+			wantProblems: []string{
+				"column app is NOT NULL without a default",
+				"column version is bigint, expected varchar(255)",
+				"primary key is (version, app), expected (version)",
+			},
+		},
+		{
+			name:         fileline(),
+			columns:      []versionsColumn{{name: "version", columnType: "varchar(10)"}},
+			wantProblems: []string{"column version is varchar(10), too short for 14-digit versions", "no primary key, expected (version)"},
+		},
+		{
+			name:         fileline(),
+			columns:      []versionsColumn{{name: "id", columnType: "integer", primaryKey: true}},
+			wantProblems: []string{"column version is missing"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			problems, namespaced := versionsTableProblems(tc.columns)
+			assert.Equal(t, tc.wantProblems, problems)
+			assert.Equal(t, tc.wantNamespaced, namespaced)
+		})
+	}
+}
+
+func TestVersionsTableError(t *testing.T) {
+	cause := errors.Errorf("NOT NULL constraint failed: dbmigrate_versions.app")
+	err := error(&VersionsTableError{Problems: []string{"column app is NOT NULL without a default"}, Err: cause})
+	assert.Equal(t, "dbmigrate_versions has an incompatible definition: column app is NOT NULL without a default;"+
+		" run `dbmigrate -upgrade-meta` to recreate it keeping its versions: NOT NULL constraint failed: dbmigrate_versions.app", err.Error())
+	assert.Equal(t, cause, errors.Cause(err))
+}
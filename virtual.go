@@ -0,0 +1,49 @@
+package dbmigrate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// virtualFiles are migrations registered with AddVirtual, keyed by file name
+var virtualFiles = map[string][]byte{}
+
+// AddVirtual registers an in-memory migration, applied along with the files of `dir` by every Config
+// created afterwards, e.g. in the init() of a library that ships its own job queue or outbox tables.
+//
+// `version` may be followed by `_name` like a migration file, e.g. `20240101000000_outbox`; the name
+// defaults to `virtual`. An empty `downSQL` means there is no `.down.sql`
+func AddVirtual(version string, upSQL string, downSQL string) {
+	if !strings.Contains(version, "_") {
+		version += "_virtual"
+	}
+	virtualFiles[version+".up.sql"] = []byte(upSQL)
+	if downSQL != "" {
+		virtualFiles[version+".down.sql"] = []byte(downSQL)
+	}
+}
+
+// addVirtualFiles merges migrations of AddVirtual into the files of `dir`
+func (c *Config) addVirtualFiles() error {
+	if len(virtualFiles) == 0 {
+		return nil
+	}
+	existing := map[string]bool{}
+	for _, currName := range c.migrationFiles {
+		existing[currName] = true
+	}
+	c.virtualFiles = map[string][]byte{}
+	var names []string
+	for currName, filecontent := range virtualFiles {
+		if existing[currName] {
+			return errors.Errorf("%s: is both a file in dir and a virtual migration", currName)
+		}
+		c.virtualFiles[currName] = filecontent
+		names = append(names, currName)
+	}
+	sort.Strings(names)
+	c.migrationFiles = append(c.migrationFiles, names...)
+	return nil
+}
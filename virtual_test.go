@@ -0,0 +1,44 @@
+package dbmigrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddVirtual(t *testing.T) {
+	defer func(saved map[string][]byte) { virtualFiles = saved }(virtualFiles)
+	virtualFiles = map[string][]byte{}
+
+	db, _ := openFakeDB(t, nil)
+
+	AddVirtual("20181222073800_outbox", "CREATE TABLE outbox (id int);", "DROP TABLE outbox;")
+	AddVirtual("20181222073850", "CREATE TABLE jobs (id int);", "")
+
+	c := &Config{dir: fstest.MapFS{
+		"20181222073750_a.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"20181222073900_b.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}, db: db, store: &fakeStore{versions: []string{"20181222073750"}}, logger: func(...interface{}) {}, resultHandler: func(FileResult) {}}
+	c.migrationFiles = []string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"}
+	assert.NoError(t, c.addVirtualFiles())
+	assert.Equal(t, []string{
+		"20181222073750_a.up.sql",
+		"20181222073900_b.up.sql",
+		"20181222073800_outbox.down.sql",
+		"20181222073800_outbox.up.sql",
+		"20181222073850_virtual.up.sql",
+	}, c.migrationFiles)
+
+	filecontent, err := c.fileContent("20181222073800_outbox.down.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, "DROP TABLE outbox;", string(filecontent))
+
+	var files []string
+	assert.NoError(t, c.Up(context.Background(), MigrateOptions{Mode: DbTxnModeNone, AfterFile: func(filename string) { files = append(files, filename) }}))
+	assert.Equal(t, []string{"20181222073800_outbox.up.sql", "20181222073850_virtual.up.sql", "20181222073900_b.up.sql"}, files)
+
+	c.migrationFiles = []string{"20181222073800_outbox.up.sql"}
+	assert.EqualError(t, c.addVirtualFiles(), "20181222073800_outbox.up.sql: is both a file in dir and a virtual migration")
+}
@@ -0,0 +1,150 @@
+package dbmigrate
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Window is a cron-like time range, e.g. `* 2-4 * * sat,sun` for 2am to 4:59am on weekends.
+// Fields are minute, hour, day of month, month and day of week
+type Window struct {
+	expr     string
+	fields   [5]map[int]bool
+	anyDay   bool // day of month is `*`
+	anyWeekd bool // day of week is `*`
+}
+
+var windowFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// ParseWindow parses a cron-like expression of 5 fields; each field is `*`, a value, a range
+// `a-b`, a step `*/n` or `a-b/n`, or a comma separated list of those
+func ParseWindow(expr string) (Window, error) {
+	w := Window{expr: strings.TrimSpace(expr)}
+	parts := strings.Fields(w.expr)
+	if len(parts) != len(windowFields) {
+		return w, errors.Errorf("window %q must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+	for i, part := range parts {
+		values, err := parseWindowField(strings.ToLower(part), windowFields[i].min, windowFields[i].max, windowFields[i].names)
+		if err != nil {
+			return w, errors.Wrapf(err, "window %q %s", expr, windowFields[i].name)
+		}
+		w.fields[i] = values
+	}
+	if w.fields[4][7] {
+		w.fields[4][0] = true // both 0 and 7 are sunday
+	}
+	w.anyDay, w.anyWeekd = parts[2] == "*", parts[4] == "*"
+	return w, nil
+}
+
+func parseWindowField(field string, min, max int, names []string) (map[int]bool, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if name != "" && s == name {
+				return i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, errors.Errorf("%q is not within %d-%d", s, min, max)
+		}
+		return n, nil
+	}
+
+	result := map[int]bool{}
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid step %q", item)
+			}
+			rangePart, step = item[:i], n
+		}
+		from, to := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = value(bounds[0]); err != nil {
+				return nil, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = value(bounds[1]); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				to = max
+			}
+			if to < from {
+				return nil, errors.Errorf("invalid range %q", rangePart)
+			}
+		}
+		for n := from; n <= to; n += step {
+			result[n] = true
+		}
+	}
+	return result, nil
+}
+
+// Contains returns true if `t` is within the window
+func (w Window) Contains(t time.Time) bool {
+	if !w.fields[0][t.Minute()] || !w.fields[1][t.Hour()] || !w.fields[3][int(t.Month())] {
+		return false
+	}
+	day, weekday := w.fields[2][t.Day()], w.fields[4][int(t.Weekday())]
+	if w.anyDay || w.anyWeekd {
+		return day && weekday
+	}
+	return day || weekday // like cron, either matches when both are restricted
+}
+
+// String returns the expression of the window
+func (w Window) String() string {
+	return w.expr
+}
+
+// checkWindows returns an error if any of `filenames` has a `-- dbmigrate:window <name>`
+// directive but `now` is outside that window
+func (c *Config) checkWindows(filenames []string, now time.Time) error {
+	for _, currName := range filenames {
+		if c.skipVersions[c.versionOf(currName)] {
+			continue // will not run
+		}
+		filecontent, err := c.fileContent(currName)
+		if err != nil {
+			return err
+		}
+		name, ok := parseDirectives(filecontent)["window"]
+		if !ok {
+			continue
+		}
+		window, ok := c.windows[name]
+		if ok && window.Contains(now) {
+			continue
+		}
+		if c.forceWindows {
+			c.logger("[window]", currName, "is applied outside window", name, "by force")
+			continue
+		}
+		if !ok {
+			return errors.Errorf("%s: window %q is not configured", currName, name)
+		}
+		return errors.Errorf("%s: only runs in window %q (%s); now is %s", currName, name, window.String(), now.Format(time.RFC3339))
+	}
+	return nil
+}
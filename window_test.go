@@ -0,0 +1,71 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowContains(t *testing.T) {
+	saturday := time.Date(2018, 12, 22, 3, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		expr     string
+		given    time.Time
+		expected bool
+		wantErr  bool
+	}{
+		{name: fileline(), expr: "* * * * *", given: saturday, expected: true},
+		{name: fileline(), expr: "* 2-4 * * sat,sun", given: saturday, expected: true},
+		{name: fileline(), expr: "* 2-4 * * sat,sun", given: saturday.Add(2 * time.Hour), expected: false},
+		{name: fileline(), expr: "* 2-4 * * 1-5", given: saturday, expected: false},
+		{name: fileline(), expr: "0-29 * * * *", given: saturday, expected: false},
+		{name: fileline(), expr: "*/15 * * * *", given: saturday, expected: true},
+		{name: fileline(), expr: "* * * dec 7", given: saturday.AddDate(0, 0, 1), expected: true},
+		{name: fileline(), expr: "* * 1 * mon", given: saturday, expected: false},
+		{name: fileline(), expr: "* * 22 * mon", given: saturday, expected: true}, // either day matches
+
+		{name: fileline(), expr: "* * * *", wantErr: true},
+		{name: fileline(), expr: "* 24 * * *", wantErr: true},
+		{name: fileline(), expr: "* 4-2 * * *", wantErr: true},
+		{name: fileline(), expr: "*/0 * * * *", wantErr: true},
+		{name: fileline(), expr: "* * * * someday", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := ParseWindow(tc.expr)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, w.Contains(tc.given))
+		})
+	}
+}
+
+func TestCheckWindows(t *testing.T) {
+	saturday := time.Date(2018, 12, 22, 3, 30, 0, 0, time.UTC)
+	weekend, err := ParseWindow("* 2-4 * * sat,sun")
+	assert.NoError(t, err)
+	c := &Config{dir: fstest.MapFS{
+		"20181222073750_a.up.sql": {Data: []byte("-- dbmigrate:window maintenance\nREINDEX TABLE users;")},
+		"20181222073900_b.up.sql": {Data: []byte("-- dbmigrate:window nightly\nREINDEX TABLE orders;")},
+		"20181222073901_c.up.sql": {Data: []byte("SELECT 1;")},
+	}}
+	WithWindow("maintenance", weekend)(c)
+
+	assert.NoError(t, c.checkWindows([]string{"20181222073750_a.up.sql", "20181222073901_c.up.sql"}, saturday))
+	assert.EqualError(t, c.checkWindows([]string{"20181222073750_a.up.sql"}, saturday.Add(2*time.Hour)),
+		`20181222073750_a.up.sql: only runs in window "maintenance" (* 2-4 * * sat,sun); now is 2018-12-22T05:30:00Z`)
+	assert.EqualError(t, c.checkWindows([]string{"20181222073900_b.up.sql"}, saturday),
+		`20181222073900_b.up.sql: window "nightly" is not configured`)
+
+	c.logger = func(...interface{}) {}
+	WithForcedWindows()(c)
+	assert.NoError(t, c.checkWindows([]string{"20181222073750_a.up.sql", "20181222073900_b.up.sql"}, saturday.Add(2*time.Hour)))
+}
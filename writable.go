@@ -0,0 +1,45 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrReadOnly is returned when the database only accepts reads, e.g. a replica
+var ErrReadOnly = errors.Errorf("database is read-only; is -url pointing to a replica?")
+
+// CheckWritable returns ErrReadOnly if the database is read-only
+//
+// Databases whose adapter has no `ReadOnlyQuery` are assumed to be writable
+func (c *Config) CheckWritable(ctx context.Context) error {
+	if c.adapter.ReadOnlyQuery == "" {
+		return nil
+	}
+	var readOnly bool
+	if err := c.db.QueryRowContext(ctx, c.adapter.ReadOnlyQuery).Scan(&readOnly); err != nil {
+		return errors.Wrapf(err, "unable to check if database is read-only")
+	}
+	if readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// WaitWritable retries CheckWritable every second until the database is writable,
+// e.g. after a replica is promoted, or until `ctx` is done
+func (c *Config) WaitWritable(ctx context.Context, logger func(...interface{})) error {
+	for {
+		err := c.CheckWritable(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, ctx.Err().Error())
+		case <-time.After(time.Second):
+			logger("waiting for writable database...", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// readOnlyConfig returns a Config whose database answers its ReadOnlyQuery with `readOnly`, or `err`
+func readOnlyConfig(t *testing.T, readOnly bool, err error) *Config {
+	db, _ := openFakeDB(t, func(int, string, []driver.Value) (*fakeRows, error) {
+		return &fakeRows{columns: []string{"read_only"}, values: [][]driver.Value{{readOnly}}}, err
+	})
+	return &Config{db: db, adapter: Adapter{ReadOnlyQuery: "read-only?"}}
+}
+
+func TestCheckWritable(t *testing.T) {
+	testCases := []struct {
+		name          string
+		readOnly      bool
+		queryError    error
+		unsupported   bool
+		expectedError string
+	}{
+		{
+			name:          fileline(),
+			readOnly:      true,
+			expectedError: "database is read-only; is -url pointing to a replica?",
+		},
+		{
+			name:     fileline(),
+			readOnly: false,
+		},
+		{
+			name:        fileline(),
+			readOnly:    true,
+			unsupported: true,
+		},
+		{
+			name:          fileline(),
+			queryError:    errors.Errorf("connection refused"),
+			expectedError: "unable to check if database is read-only: connection refused",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := readOnlyConfig(t, tc.readOnly, tc.queryError)
+			if tc.unsupported {
+				c.adapter.ReadOnlyQuery = ""
+			}
+			err := c.CheckWritable(context.Background())
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWaitWritable(t *testing.T) {
+	var logs []interface{}
+	logger := func(args ...interface{}) { logs = append(logs, args...) }
+
+	c := readOnlyConfig(t, false, nil)
+	assert.NoError(t, c.WaitWritable(context.Background(), logger))
+
+	c = readOnlyConfig(t, true, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.EqualError(t, c.WaitWritable(ctx, logger), "context deadline exceeded: database is read-only; is -url pointing to a replica?")
+	assert.Empty(t, logs, "gave up before retrying")
+}